@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/amorin24/llmproxy/pkg/api"
 	"github.com/amorin24/llmproxy/pkg/config"
+	v1 "github.com/amorin24/llmproxy/pkg/gateway/v1"
+	httpclient "github.com/amorin24/llmproxy/pkg/http"
+	"github.com/amorin24/llmproxy/pkg/llm"
 	"github.com/amorin24/llmproxy/pkg/logging"
 	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/amorin24/llmproxy/pkg/pricing"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,21 +27,65 @@ func main() {
 
 	cfg := config.GetConfig()
 
+	if err := httpclient.Init(); err != nil {
+		logrus.Fatalf("%v", err)
+	}
+
+	llm.LogDefaultModelVersions()
+
 	monitoring.InitMonitoring()
 
 	r := mux.NewRouter()
 
 	r.Use(monitoring.RequestLoggerMiddleware)
 	r.Use(monitoring.MetricsMiddleware)
+	if cfg.CompressionEnabled {
+		r.Use(api.CompressionMiddleware(cfg.CompressionMinSize))
+	}
 
-	handler := api.NewHandler()
+	catalogLoader, err := pricing.LoadCatalog(cfg.PriceCatalogPath)
+	if err != nil {
+		logrus.WithError(err).Warn("Price catalog not loaded, cost reporting and the /v1 gateway are disabled")
+	} else if cfg.CatalogStrict && catalogLoader.IsStale() {
+		logrus.Fatalf("Price catalog version %s is past its validation due date and CATALOG_STRICT is set", catalogLoader.GetVersion())
+	}
+
+	handler := api.NewHandlerWithCatalog(catalogLoader)
 
 	r.HandleFunc("/api/query", handler.QueryHandler).Methods("POST")
 	r.HandleFunc("/api/parallel", handler.ParallelQueryHandler).Methods("POST")
+	r.HandleFunc("/api/eval", handler.EvalHandler).Methods("POST")
+	r.HandleFunc("/api/batch", handler.BatchHandler).Methods("POST")
+	r.HandleFunc("/api/jobs/{id}", handler.JobStatusHandler).Methods("GET")
 	r.HandleFunc("/api/status", handler.StatusHandler).Methods("GET")
+	r.HandleFunc("/api/status/detailed", handler.DetailedStatusHandler).Methods("GET")
 	r.HandleFunc("/api/download", handler.DownloadHandler).Methods("POST")
 	r.HandleFunc("/api/health", handler.HealthHandler).Methods("GET")
 	r.HandleFunc("/api/metrics", monitoring.MetricsHandler).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/rpc", handler.RPCHandler).Methods("POST")
+	r.Handle("/api/usage", api.AdminAuthMiddleware(http.HandlerFunc(handler.UsageHandler))).Methods("GET")
+
+	if catalogLoader != nil {
+		gateway := v1.NewGatewayHandler(catalogLoader)
+
+		gatewayRoutes := r.PathPrefix("/v1").Subrouter()
+		gatewayRoutes.Use(handler.RateLimitMiddleware)
+		gatewayRoutes.HandleFunc("/query", gateway.QueryHandler).Methods("POST")
+		gatewayRoutes.HandleFunc("/cost-estimate", gateway.CostEstimateHandler).Methods("POST")
+		gatewayRoutes.HandleFunc("/gateway/query", gateway.QueryHandler).Methods("POST")
+		gatewayRoutes.HandleFunc("/gateway/cost-estimate", gateway.CostEstimateHandler).Methods("POST")
+	}
+
+	admin := r.PathPrefix("/api/admin").Subrouter()
+	admin.Use(api.AdminAuthMiddleware)
+	admin.HandleFunc("/refresh-availability", handler.RefreshAvailabilityHandler).Methods("POST")
+	admin.HandleFunc("/validate-key", handler.ValidateKeyHandler).Methods("POST")
+	admin.HandleFunc("/captures", handler.CapturesHandler).Methods("GET")
+	admin.HandleFunc("/cache/stats", handler.CacheStatsHandler).Methods("GET")
+	admin.HandleFunc("/cache/key", handler.CacheKeyHandler).Methods("POST")
+	admin.HandleFunc("/cache", handler.CacheFlushHandler).Methods("DELETE")
+	admin.HandleFunc("/cache/{key}", handler.CacheEvictHandler).Methods("DELETE")
 
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./ui"))))
 
@@ -50,9 +102,29 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
-	logrus.Infof("Starting server on port %s", port)
-	if err := server.ListenAndServe(); err != nil {
-		logrus.Fatalf("Error starting server: %v", err)
-		os.Exit(1)
+	go func() {
+		logrus.Infof("Starting server on port %s", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("Error starting server: %v", err)
+			os.Exit(1)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	logrus.Info("Shutting down server")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.Errorf("Error shutting down server: %v", err)
 	}
+
+	monitoring.DrainMetrics(monitoring.DrainOptions{
+		Addr:           server.Addr,
+		Window:         time.Duration(cfg.MetricsDrainWindow) * time.Second,
+		PushgatewayURL: cfg.PushgatewayURL,
+		SnapshotPath:   cfg.MetricsSnapshotPath,
+	})
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/amorin24/llmproxy/pkg/cache"
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func (h *Handler) CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	sendJSONResponse(w, h.cache.Stats(), http.StatusOK)
+}
+
+func (h *Handler) CacheFlushHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	sendJSONResponse(w, models.CacheEvictResponse{Evicted: h.cache.Flush()}, http.StatusOK)
+}
+
+func (h *Handler) CacheEvictHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	key := mux.Vars(r)["key"]
+	if !h.cache.Delete(key) {
+		handleError(w, "Cache entry not found", http.StatusNotFound)
+		return
+	}
+	
+	sendJSONResponse(w, models.CacheEvictResponse{Key: key, Evicted: 1}, http.StatusOK)
+}
+
+func (h *Handler) CacheKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	
+	var req models.QueryRequest
+	if err := decodeRequestBody(body, &req); err != nil {
+		handleDecodeError(w, err)
+		return
+	}
+	
+	// Admin-only, so the tenant header is trusted
+	req, qErr := normalizeQueryRequest(req, strings.TrimSpace(r.Header.Get(tenantHeader)))
+	if qErr != nil {
+		writeQueryError(w, qErr)
+		return
+	}
+	
+	sendJSONResponse(w, models.CacheKeyResponse{Key: cache.Key(req)}, http.StatusOK)
+}
+
+func (h *Handler) ValidateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	
+	var req models.ValidateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, "Invalid JSON in request body", http.StatusBadRequest)
+		return
+	}
+	
+	provider := models.ModelType(strings.ToLower(strings.TrimSpace(req.Provider)))
+	switch provider {
+	case models.OpenAI, models.Gemini, models.Mistral, models.Claude:
+	default:
+		handleError(w, "Unsupported provider. Supported providers are: openai, gemini, mistral, claude.", http.StatusBadRequest)
+		return
+	}
+	
+	key := strings.TrimSpace(req.Key)
+	if key == "" {
+		handleError(w, "Key cannot be empty", http.StatusBadRequest)
+		return
+	}
+	
+	resp := models.ValidateKeyResponse{Provider: string(provider), FormatValid: true}
+	if err := config.GetConfig().ValidateAPIKeyFormat(string(provider), key); err != nil {
+		resp.FormatValid = false
+		resp.FormatError = err.Error()
+	}
+	
+	reachable, latency, err := llm.ProbeAPIKey(provider, key)
+	if err != nil {
+		handleError(w, "Error checking key: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.Reachable = reachable
+	resp.LatencyMs = latency.Milliseconds()
+	
+	logrus.WithFields(logrus.Fields{
+		"provider":     provider,
+		"format_valid": resp.FormatValid,
+		"reachable":    resp.Reachable,
+		"latency_ms":   resp.LatencyMs,
+	}).Info("API key validated")
+	
+	sendJSONResponse(w, resp, http.StatusOK)
+}
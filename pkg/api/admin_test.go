@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/cache"
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+func TestCacheStatsHandler(t *testing.T) {
+	handler := &Handler{cache: &MockCache{entries: map[string]bool{"a": true, "b": true}}}
+	
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/cache/stats", nil)
+	w := httptest.NewRecorder()
+	
+	handler.CacheStatsHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	
+	var stats models.CacheStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !stats.Enabled || stats.Size != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheFlushHandler(t *testing.T) {
+	mockCache := &MockCache{entries: map[string]bool{"a": true, "b": true}}
+	handler := &Handler{cache: mockCache}
+	
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/cache", nil)
+	w := httptest.NewRecorder()
+	
+	handler.CacheFlushHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	
+	var resp models.CacheEvictResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Evicted != 2 || len(mockCache.entries) != 0 {
+		t.Errorf("Expected 2 entries evicted and an empty cache, got %+v with %d left", resp, len(mockCache.entries))
+	}
+}
+
+func TestCacheEvictHandler(t *testing.T) {
+	mockCache := &MockCache{entries: map[string]bool{"a": true, "b": true}}
+	handler := &Handler{cache: mockCache}
+	
+	evict := func(key string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/api/admin/cache/"+key, nil), map[string]string{"key": key})
+		w := httptest.NewRecorder()
+		handler.CacheEvictHandler(w, req)
+		return w
+	}
+	
+	if w := evict("a"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if mockCache.entries["a"] || !mockCache.entries["b"] {
+		t.Errorf("Expected only key a to be evicted, got %v", mockCache.entries)
+	}
+	
+	if w := evict("a"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing key, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestCacheKeyHandler(t *testing.T) {
+	cfg := config.GetConfig()
+	originalWrapper := cfg.DefaultPromptWrapper
+	defer func() { cfg.DefaultPromptWrapper = originalWrapper }()
+	cfg.DefaultPromptWrapper = config.PromptWrapper{Prefix: "Be brief."}
+	
+	handler := &Handler{cache: &MockCache{}}
+	
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/cache/key", bytes.NewBufferString(`{"query":"  hello  ","model":"openai"}`))
+	req.Header.Set("X-Tenant-ID", "acme")
+	w := httptest.NewRecorder()
+	
+	handler.CacheKeyHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp models.CacheKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	
+	expected := cache.Key(models.QueryRequest{Query: "Be brief.\n\n" + sanitizeQuery("  hello  "), Model: models.OpenAI, Tenant: "acme"})
+	if resp.Key != expected {
+		t.Errorf("Expected key %s for the normalized request, got %s", expected, resp.Key)
+	}
+	
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/cache/key", bytes.NewBufferString(`{`))
+	w = httptest.NewRecorder()
+	handler.CacheKeyHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid JSON, got %d", http.StatusBadRequest, w.Code)
+	}
+	
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/cache/key", bytes.NewBufferString(`{"query":"   "}`))
+	w = httptest.NewRecorder()
+	handler.CacheKeyHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a request the query endpoint rejects, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestValidateKeyHandler(t *testing.T) {
+	originalProbe := llm.ProbeAPIKey
+	defer func() { llm.ProbeAPIKey = originalProbe }()
+	
+	var probedKey string
+	llm.ProbeAPIKey = func(modelType models.ModelType, apiKey string) (bool, time.Duration, error) {
+		probedKey = apiKey
+		return apiKey == "sk-live-key-123", 42 * time.Millisecond, nil
+	}
+	
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       models.ValidateKeyResponse
+	}{
+		{
+			name:           "Valid reachable key",
+			body:           `{"provider":"OpenAI","key":"sk-live-key-123"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.ValidateKeyResponse{Provider: "openai", FormatValid: true, Reachable: true, LatencyMs: 42},
+		},
+		{
+			name:           "Malformed key is still probed",
+			body:           `{"provider":"claude","key":"bad key!"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.ValidateKeyResponse{Provider: "claude", FormatValid: false, Reachable: false, LatencyMs: 42},
+		},
+		{name: "Unknown provider", body: `{"provider":"bedrock","key":"sk-live-key-123"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Empty key", body: `{"provider":"openai","key":" "}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", body: `{`, expectedStatus: http.StatusBadRequest},
+	}
+	
+	handler := &Handler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/validate-key", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			handler.ValidateKeyHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			
+			var resp models.ValidateKeyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if !tt.expected.FormatValid && resp.FormatError == "" {
+				t.Error("Expected a format error message")
+			}
+			resp.FormatError = ""
+			if resp != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, resp)
+			}
+		})
+	}
+	
+	if probedKey != "bad key!" {
+		t.Errorf("Expected the last request's key to be probed, got %q", probedKey)
+	}
+}
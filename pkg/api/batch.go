@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BatchStatusDone       = "done"
+	BatchStatusFailed     = "failed"
+	BatchStatusUnfinished = "unfinished" // Not completed before the batch deadline
+)
+
+type BatchRequest struct {
+	Queries []models.QueryRequest `json:"queries"`
+	Timeout int                   `json:"timeout,omitempty"` // Overall batch deadline in seconds, capped at BATCH_TIMEOUT
+}
+
+type BatchItemResult struct {
+	Index    int                   `json:"index"` // Position in the request's queries
+	Status   string                `json:"status"`
+	Response *models.QueryResponse `json:"response,omitempty"`
+	Error    *models.ErrorDetail   `json:"error,omitempty"`
+}
+
+func (h *Handler) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	clientIP := getClientIP(r)
+	if !h.rateLimiter.AllowClient(clientIP) {
+		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
+		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+	
+	tenant, err := getTenant(r)
+	if err != nil {
+		handleTenantError(w, err)
+		return
+	}
+	
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			handleError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		} else {
+			handleError(w, "Error reading request body", http.StatusBadRequest)
+		}
+		return
+	}
+	
+	var req BatchRequest
+	if err := decodeRequestBody(bodyBytes, &req); err != nil {
+		handleDecodeError(w, err)
+		return
+	}
+	
+	cfg := config.GetConfig()
+	if len(req.Queries) == 0 {
+		handleError(w, "At least one query is required", http.StatusBadRequest)
+		return
+	}
+	
+	if len(req.Queries) > cfg.MaxBatchSize {
+		handleError(w, fmt.Sprintf("Too many queries: %d requested, maximum is %d", len(req.Queries), cfg.MaxBatchSize), http.StatusBadRequest)
+		return
+	}
+	
+	calls := 0
+	for _, query := range req.Queries {
+		calls += max(query.N, 1)
+	}
+	if err := checkFanout(calls); err != nil {
+		handleError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	timeout := time.Duration(cfg.BatchTimeout) * time.Second
+	if req.Timeout > 0 && time.Duration(req.Timeout)*time.Second < timeout {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	
+	workers := cfg.BatchWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(req.Queries) {
+		workers = len(req.Queries)
+	}
+	
+	batchID := requestIDFor(w, r)
+	priority := requestPriority(r, tenant)
+	logrus.WithFields(logrus.Fields{
+		"batch_id": batchID,
+		"queries":  len(req.Queries),
+		"workers":  workers,
+		"timeout":  timeout,
+	}).Info("Starting batch")
+	
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range req.Queries {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	
+	results := make(chan BatchItemResult, workers)
+	charge := newFanoutCharge(h.rateLimiter, clientIP)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if !charge.take() {
+					results <- rateLimitedBatchItem(i)
+					continue
+				}
+				results <- h.runBatchItem(ctx, i, req.Queries[i], tenant, priority, batchID)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Batch-ID", batchID)
+	w.WriteHeader(http.StatusOK)
+	
+	// Results are written as they complete, so only the not-yet-written flags are kept
+	stream := newBatchStream(w)
+	written := make([]bool, len(req.Queries))
+	for result := range results {
+		written[result.Index] = true
+		stream.write(result)
+	}
+	
+	unfinished := 0
+	for i, done := range written {
+		if !done {
+			unfinished++
+			stream.write(unfinishedBatchItem(i))
+		}
+	}
+	stream.close()
+	
+	logrus.WithFields(logrus.Fields{
+		"batch_id":   batchID,
+		"queries":    len(req.Queries),
+		"unfinished": unfinished,
+	}).Info("Batch finished")
+}
+
+func (h *Handler) runBatchItem(ctx context.Context, index int, req models.QueryRequest, tenant string, priority string, batchID string) BatchItemResult {
+	if ctx.Err() != nil {
+		return unfinishedBatchItem(index)
+	}
+	
+	req, qErr := normalizeQueryRequest(req, tenant)
+	if qErr != nil {
+		detail := qErr.detail()
+		return BatchItemResult{Index: index, Status: BatchStatusFailed, Error: &detail}
+	}
+	req.Priority = priority
+	
+	if req.CallbackURL != "" {
+		return BatchItemResult{Index: index, Status: BatchStatusFailed, Error: &models.ErrorDetail{Message: "callback_url is not supported in a batch", Code: myerrors.CodeInvalidRequest}}
+	}
+	
+	queryCtx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+	
+	resp, qErr := h.processAndCapture(queryCtx, req, fmt.Sprintf("%s/%d", batchID, index))
+	if qErr != nil {
+		if ctx.Err() != nil {
+			return unfinishedBatchItem(index)
+		}
+		detail := qErr.detail()
+		return BatchItemResult{Index: index, Status: BatchStatusFailed, Error: &detail}
+	}
+	
+	return BatchItemResult{Index: index, Status: BatchStatusDone, Response: &resp}
+}
+
+func rateLimitedBatchItem(index int) BatchItemResult {
+	return BatchItemResult{
+		Index:  index,
+		Status: BatchStatusFailed,
+		Error:  &models.ErrorDetail{Message: "Rate limit exceeded. Please try again later.", Code: myerrors.CodeRateLimit},
+	}
+}
+
+func unfinishedBatchItem(index int) BatchItemResult {
+	return BatchItemResult{
+		Index:  index,
+		Status: BatchStatusUnfinished,
+		Error:  &models.ErrorDetail{Message: "Batch deadline exceeded before the query finished", Code: myerrors.CodeTimeout},
+	}
+}
+
+type batchStream struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+	started bool
+}
+
+func newBatchStream(w http.ResponseWriter) *batchStream {
+	w.Write([]byte("["))
+	return &batchStream{w: w, encoder: json.NewEncoder(w)}
+}
+
+func (s *batchStream) write(result BatchItemResult) {
+	if s.started {
+		s.w.Write([]byte(","))
+	}
+	s.started = true
+	
+	if err := s.encoder.Encode(result); err != nil {
+		logrus.WithError(err).Warn("Error writing batch result")
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *batchStream) close() {
+	s.w.Write([]byte("]\n"))
+}
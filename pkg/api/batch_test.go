@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+)
+
+func TestBatchHandler(t *testing.T) {
+	cfg := config.GetConfig()
+	originalWorkers, originalTimeout, originalMax := cfg.BatchWorkers, cfg.BatchTimeout, cfg.MaxBatchSize
+	defer func() {
+		cfg.BatchWorkers, cfg.BatchTimeout, cfg.MaxBatchSize = originalWorkers, originalTimeout, originalMax
+	}()
+	cfg.BatchWorkers = 2
+	cfg.BatchTimeout = 10
+	cfg.MaxBatchSize = 5
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+				}()
+				
+				if query == "slow" {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				time.Sleep(10 * time.Millisecond)
+				return &llm.QueryResult{Response: "answer to " + query}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	handler.rateLimiter = NewRateLimiter(6000, 100) // Each batch item takes a token
+	
+	runBatch := func(t *testing.T, body string) (int, []BatchItemResult) {
+		req := httptest.NewRequest(http.MethodPost, "/api/batch", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		
+		handler.BatchHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		
+		var results []BatchItemResult
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Fatalf("Error decoding batch response: %v", err)
+		}
+		return w.Code, results
+	}
+	
+	t.Run("Bounded concurrency", func(t *testing.T) {
+		_, results := runBatch(t, `{"queries":[{"query":"a"},{"query":"b"},{"query":"c"},{"query":"d"},{"query":""}]}`)
+		
+		if len(results) != 5 {
+			t.Fatalf("Expected 5 results, got %d", len(results))
+		}
+		if maxInFlight > 2 {
+			t.Errorf("Expected at most 2 concurrent queries, got %d", maxInFlight)
+		}
+		
+		seen := make(map[int]bool)
+		for _, result := range results {
+			seen[result.Index] = true
+			if result.Index == 4 {
+				if result.Status != BatchStatusFailed || result.Error == nil {
+					t.Errorf("Expected the empty query to fail validation, got %+v", result)
+				}
+				continue
+			}
+			if result.Status != BatchStatusDone || result.Response == nil {
+				t.Errorf("Expected query %d to be done, got %+v", result.Index, result)
+			}
+		}
+		if len(seen) != 5 {
+			t.Errorf("Expected one result per query, got indices %v", seen)
+		}
+	})
+	
+	t.Run("Deadline marks unfinished items", func(t *testing.T) {
+		_, results := runBatch(t, `{"queries":[{"query":"a"},{"query":"slow"},{"query":"slow"},{"query":"b"}],"timeout":1}`)
+		
+		if len(results) != 4 {
+			t.Fatalf("Expected 4 results, got %d", len(results))
+		}
+		
+		statuses := make(map[int]string)
+		for _, result := range results {
+			statuses[result.Index] = result.Status
+		}
+		if statuses[0] != BatchStatusDone {
+			t.Errorf("Expected the first query to finish, got %s", statuses[0])
+		}
+		for _, i := range []int{1, 2, 3} {
+			if statuses[i] != BatchStatusUnfinished {
+				t.Errorf("Expected query %d to be unfinished, got %s", i, statuses[i])
+			}
+		}
+	})
+	
+	t.Run("Rate limit charged per item", func(t *testing.T) {
+		originalLimiter := handler.rateLimiter
+		defer func() { handler.rateLimiter = originalLimiter }()
+		handler.rateLimiter = NewRateLimiter(60, 2)
+		
+		_, results := runBatch(t, `{"queries":[{"query":"a"},{"query":"b"},{"query":"c"},{"query":"d"}]}`)
+		if len(results) != 4 {
+			t.Fatalf("Expected 4 results, got %d", len(results))
+		}
+		
+		done, limited := 0, 0
+		for _, result := range results {
+			switch {
+			case result.Status == BatchStatusDone:
+				done++
+			case result.Error != nil && result.Error.Code == myerrors.CodeRateLimit:
+				limited++
+			}
+		}
+		if done != 2 || limited != 2 {
+			t.Errorf("Expected 2 queries within the burst and 2 rate limited, got %d done and %d limited", done, limited)
+		}
+	})
+	
+	t.Run("Too many queries", func(t *testing.T) {
+		code, _ := runBatch(t, `{"queries":[{"query":"a"},{"query":"b"},{"query":"c"},{"query":"d"},{"query":"e"},{"query":"f"}]}`)
+		if code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+	
+	t.Run("Fan-out counts completions", func(t *testing.T) {
+		originalFanout := cfg.MaxFanout
+		defer func() { cfg.MaxFanout = originalFanout }()
+		cfg.MaxFanout = 4
+		
+		code, _ := runBatch(t, `{"queries":[{"query":"a","n":3},{"query":"b","n":2}]}`)
+		if code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+	
+	t.Run("Empty batch", func(t *testing.T) {
+		code, _ := runBatch(t, `{"queries":[]}`)
+		if code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+	})	
+	t.Run("Flushes through the middleware chain", func(t *testing.T) {
+		chain := monitoring.RequestLoggerMiddleware(monitoring.MetricsMiddleware(http.HandlerFunc(handler.BatchHandler)))
+		req := httptest.NewRequest(http.MethodPost, "/api/batch", bytes.NewBufferString(`{"queries":[{"query":"a"},{"query":"b"}]}`))
+		w := httptest.NewRecorder()
+		
+		chain.ServeHTTP(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if !w.Flushed {
+			t.Error("Expected batch results to be flushed through the monitoring middleware")
+		}
+	})
+}
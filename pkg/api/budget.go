@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/cache"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	budgetWarnThreshold = 0.8
+	maxBudgetKeys       = 1000
+)
+
+type budgetPeriod struct {
+	name   string
+	layout string        // Time layout naming the current window
+	ttl    time.Duration // How long a window's spend is kept
+}
+
+var budgetPeriods = []budgetPeriod{
+	{name: "daily", layout: "2006-01-02", ttl: 48 * time.Hour},
+	{name: "monthly", layout: "2006-01", ttl: 32 * 24 * time.Hour},
+}
+
+type budgetTracker struct {
+	store  cache.CacheProvider
+	limits map[string]map[models.ModelType]float64 // Period name to per-model limit in USD
+	now    func() time.Time
+	mutex  sync.Mutex
+}
+
+func newBudgetTracker(daily, monthly map[models.ModelType]float64) *budgetTracker {
+	return &budgetTracker{
+		store: cache.NewInMemoryCache(budgetPeriods[len(budgetPeriods)-1].ttl, time.Hour, maxBudgetKeys),
+		limits: map[string]map[models.ModelType]float64{
+			"daily":   daily,
+			"monthly": monthly,
+		},
+		now: time.Now,
+	}
+}
+
+func (b *budgetTracker) key(period budgetPeriod, model models.ModelType) string {
+	return "budget:" + period.name + ":" + string(model) + ":" + b.now().UTC().Format(period.layout)
+}
+
+func (b *budgetTracker) spent(key string) float64 {
+	if value, found := b.store.Get(key); found {
+		return value.(float64)
+	}
+	return 0
+}
+
+func (b *budgetTracker) record(model models.ModelType, costUSD float64) {
+	if b == nil || costUSD <= 0 {
+		return
+	}
+	
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	
+	for _, period := range budgetPeriods {
+		limit, ok := b.limits[period.name][model]
+		if !ok {
+			continue
+		}
+		
+		key := b.key(period, model)
+		before := b.spent(key)
+		after := before + costUSD
+		b.store.Set(key, after, period.ttl)
+		monitoring.SetBudgetUtilization(string(model), period.name, after/limit)
+		
+		fields := logrus.Fields{
+			"model":     string(model),
+			"period":    period.name,
+			"spent_usd": after,
+			"limit_usd": limit,
+		}
+		switch {
+		case before < limit && after >= limit:
+			logrus.WithFields(fields).Warn("Budget exhausted, routing away from model")
+			monitoring.RecordBudgetAlert(string(model), period.name, "exhausted")
+		case before < limit*budgetWarnThreshold && after >= limit*budgetWarnThreshold:
+			logrus.WithFields(fields).Warn("Budget 80% used")
+			monitoring.RecordBudgetAlert(string(model), period.name, "warning")
+		}
+	}
+}
+
+func (b *budgetTracker) allow(model models.ModelType) bool {
+	if b == nil {
+		return true
+	}
+	
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	
+	for _, period := range budgetPeriods {
+		if limit, ok := b.limits[period.name][model]; ok && b.spent(b.key(period, model)) >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *budgetTracker) status(model models.ModelType) *models.ModelBudget {
+	if b == nil {
+		return nil
+	}
+	
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	
+	var budget *models.ModelBudget
+	for _, period := range budgetPeriods {
+		limit, ok := b.limits[period.name][model]
+		if !ok {
+			continue
+		}
+		
+		spent := b.spent(b.key(period, model))
+		remaining := limit - spent
+		if remaining < 0 {
+			remaining = 0
+		}
+		usage := &models.BudgetUsage{LimitUSD: limit, SpentUSD: spent, RemainingUSD: remaining}
+		
+		if budget == nil {
+			budget = &models.ModelBudget{}
+		}
+		if period.name == "daily" {
+			budget.Daily = usage
+		} else {
+			budget.Monthly = usage
+		}
+	}
+	return budget
+}
+
+type budgetClient struct {
+	llm.Client
+	budgets *budgetTracker
+}
+
+func (c *budgetClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
+	if !c.budgets.allow(c.GetModelType()) {
+		logrus.WithField("model", string(c.GetModelType())).Warn("Model budget exhausted")
+		monitoring.GetMetrics().RecordError("model_budget_exceeded")
+		return nil, myerrors.NewBudgetExceededError(string(c.GetModelType()))
+	}
+	
+	return c.Client.Query(ctx, query, modelVersion, opts)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestBudgetTracker(t *testing.T) {
+	budgets := newBudgetTracker(
+		map[models.ModelType]float64{models.OpenAI: 10},
+		map[models.ModelType]float64{models.OpenAI: 100},
+	)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	budgets.now = func() time.Time { return now }
+	
+	budgets.record(models.OpenAI, 8)
+	if !budgets.allow(models.OpenAI) {
+		t.Errorf("Expected openai to be allowed below its daily budget")
+	}
+	
+	budgets.record(models.OpenAI, 2)
+	if budgets.allow(models.OpenAI) {
+		t.Errorf("Expected openai to be blocked once its daily budget is spent")
+	}
+	
+	status := budgets.status(models.OpenAI)
+	if status == nil || status.Daily == nil || status.Monthly == nil {
+		t.Fatalf("Expected daily and monthly budget status, got %+v", status)
+	}
+	if status.Daily.SpentUSD != 10 || status.Daily.RemainingUSD != 0 {
+		t.Errorf("Expected daily spend 10 with nothing remaining, got %+v", status.Daily)
+	}
+	if status.Monthly.SpentUSD != 10 || status.Monthly.RemainingUSD != 90 {
+		t.Errorf("Expected monthly spend 10 with 90 remaining, got %+v", status.Monthly)
+	}
+	
+	now = now.Add(24 * time.Hour)
+	if !budgets.allow(models.OpenAI) {
+		t.Errorf("Expected the daily budget to reset on the next day")
+	}
+	if status := budgets.status(models.OpenAI); status.Daily.SpentUSD != 0 || status.Monthly.SpentUSD != 10 {
+		t.Errorf("Expected a new daily window within the same month, got %+v %+v", status.Daily, status.Monthly)
+	}
+	
+	if !budgets.allow(models.Claude) || budgets.status(models.Claude) != nil {
+		t.Errorf("Expected models without a budget to be unlimited")
+	}
+	
+	var unset *budgetTracker
+	unset.record(models.OpenAI, 1)
+	if !unset.allow(models.OpenAI) || unset.status(models.OpenAI) != nil {
+		t.Errorf("Expected a nil tracker to allow everything")
+	}
+}
+
+func TestProcessQueryBudgetFallback(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var queried []models.ModelType
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				queried = append(queried, modelType)
+				return &llm.QueryResult{Response: "response from " + string(modelType)}, nil
+			},
+		}, nil
+	}
+	
+	var fallbackErr error
+	handler := &Handler{
+		router: &MockRouter{
+			fallbackOnErrorFunc: func(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+				fallbackErr = err
+				return models.Gemini, nil
+			},
+		},
+		cache:   &MockCache{},
+		budgets: newBudgetTracker(map[models.ModelType]float64{models.OpenAI: 1}, nil),
+	}
+	handler.budgets.record(models.OpenAI, 1)
+	
+	resp, qErr := handler.processQuery(context.Background(), models.QueryRequest{Query: "test"}, "req-1")
+	if qErr != nil {
+		t.Fatalf("Expected fallback instead of an error, got %v", qErr)
+	}
+	if resp.Model != models.Gemini {
+		t.Errorf("Expected fallback to gemini, got %s", resp.Model)
+	}
+	if !errors.Is(fallbackErr, myerrors.ErrBudgetExceeded) {
+		t.Errorf("Expected fallback to be triggered by a budget error, got %v", fallbackErr)
+	}
+	if len(queried) != 1 || queried[0] != models.Gemini {
+		t.Errorf("Expected openai not to be called over its budget, got calls %v", queried)
+	}
+	
+	_, qErr = handler.processQuery(context.Background(), models.QueryRequest{Query: "test", NoFallback: true}, "req-2")
+	if qErr == nil || qErr.StatusCode != 429 || qErr.Code != myerrors.CodeBudgetExceeded {
+		t.Errorf("Expected 429 %s without fallback, got %+v", myerrors.CodeBudgetExceeded, qErr)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+const (
+	defaultCaptureSize = 100 // Captures kept in the rolling buffer
+	maxCaptureLimit    = 1000
+)
+
+var (
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{8,}`),
+		regexp.MustCompile(`\bAIza[A-Za-z0-9_-]{20,}`),
+		regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`),
+	}
+	secretAssignment = regexp.MustCompile(`(?i)\b(api[_-]?key|token|secret|password)(["']?\s*[:=]\s*["']?)[^\s"',}]+`)
+)
+
+func redactSecrets(text string) string {
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, "[REDACTED]")
+	}
+	return secretAssignment.ReplaceAllString(text, "${1}${2}[REDACTED]")
+}
+
+type captureStore struct {
+	enabled    bool
+	sampleRate float64
+	captures   []models.Capture // Ring buffer, next is the slot for the next capture
+	next       int
+	full       bool
+	mutex      sync.Mutex
+}
+
+func newCaptureStore() *captureStore {
+	cfg := config.GetConfig()
+	
+	size := cfg.DebugCaptureSize
+	if size <= 0 {
+		size = defaultCaptureSize
+	}
+	
+	sampleRate := cfg.DebugCaptureSampleRate
+	if sampleRate < 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+	
+	return &captureStore{
+		enabled:    cfg.DebugCapture,
+		sampleRate: sampleRate,
+		captures:   make([]models.Capture, size),
+	}
+}
+
+func (s *captureStore) record(req models.QueryRequest, requestID string, start time.Time, resp models.QueryResponse, qErr *queryError) {
+	if s == nil || !s.enabled || rand.Float64() >= s.sampleRate {
+		return
+	}
+	
+	req.Query = redactSecrets(req.Query)
+	req.CachePrefix = redactSecrets(req.CachePrefix)
+	
+	capture := models.Capture{
+		RequestID:    requestID,
+		Timestamp:    start,
+		Tenant:       req.Tenant,
+		Model:        resp.Model,
+		ModelVersion: resp.ModelVersion,
+		Request:      req,
+		Response:     redactSecrets(resp.Response),
+		DurationMs:   time.Since(start).Milliseconds(),
+		InputTokens:  resp.InputTokens,
+		OutputTokens: resp.OutputTokens,
+		Cached:       resp.Cached,
+		StatusCode:   http.StatusOK,
+	}
+	
+	if qErr != nil {
+		detail := qErr.detail()
+		detail.Message = redactSecrets(detail.Message)
+		detail.ProviderMessage = redactSecrets(detail.ProviderMessage)
+		capture.Error = &detail
+		capture.StatusCode = qErr.StatusCode
+		if capture.Model == "" {
+			capture.Model = models.ModelType(qErr.Model)
+		}
+	}
+	
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	s.captures[s.next] = capture
+	s.next = (s.next + 1) % len(s.captures)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+func (s *captureStore) list(requestID string, limit int) []models.Capture {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	count := s.next
+	if s.full {
+		count = len(s.captures)
+	}
+	
+	captures := []models.Capture{}
+	for i := 1; i <= count && len(captures) < limit; i++ {
+		capture := s.captures[(s.next-i+len(s.captures))%len(s.captures)]
+		if requestID == "" || capture.RequestID == requestID {
+			captures = append(captures, capture)
+		}
+	}
+	return captures
+}
+
+func (h *Handler) processAndCapture(ctx context.Context, req models.QueryRequest, requestID string) (models.QueryResponse, *queryError) {
+	start := time.Now()
+	resp, qErr := h.processQuery(ctx, req, requestID)
+	h.captures.record(req, requestID, start, resp, qErr)
+	return resp, qErr
+}
+
+func (h *Handler) CapturesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	limit := maxCaptureLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			handleError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if parsed < limit {
+			limit = parsed
+		}
+	}
+	
+	resp := models.CapturesResponse{Captures: []models.Capture{}}
+	if h.captures != nil {
+		resp.Enabled = h.captures.enabled
+		resp.Captures = h.captures.list(r.URL.Query().Get("request_id"), limit)
+	}
+	
+	sendJSONResponse(w, resp, http.StatusOK)
+}
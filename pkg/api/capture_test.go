@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"my key is sk-abcdef1234567890", "my key is [REDACTED]"},
+		{"Authorization: Bearer abc.def.ghijkl", "Authorization: [REDACTED]"},
+		{`{"api_key": "hunter2hunter2"}`, `{"api_key": "[REDACTED]"}`},
+		{"password=letmein please", "password=[REDACTED] please"},
+		{"nothing secret here", "nothing secret here"},
+	}
+	
+	for _, tt := range tests {
+		if got := redactSecrets(tt.input); got != tt.expected {
+			t.Errorf("redactSecrets(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCaptureStore(t *testing.T) {
+	store := &captureStore{enabled: true, sampleRate: 1, captures: make([]models.Capture, 3)}
+	
+	for i := 1; i <= 5; i++ {
+		store.record(models.QueryRequest{Query: "query"}, fmt.Sprintf("req-%d", i), time.Now(), models.QueryResponse{}, nil)
+	}
+	
+	captures := store.list("", maxCaptureLimit)
+	if len(captures) != 3 {
+		t.Fatalf("Expected 3 captures in the rolling buffer, got %d", len(captures))
+	}
+	if captures[0].RequestID != "req-5" || captures[2].RequestID != "req-3" {
+		t.Errorf("Expected newest captures first, got %s..%s", captures[0].RequestID, captures[2].RequestID)
+	}
+	
+	if captures := store.list("req-4", maxCaptureLimit); len(captures) != 1 || captures[0].RequestID != "req-4" {
+		t.Errorf("Expected only req-4, got %v", captures)
+	}
+	
+	if captures := store.list("", 2); len(captures) != 2 {
+		t.Errorf("Expected limit to apply, got %d captures", len(captures))
+	}
+	
+	disabled := &captureStore{sampleRate: 1, captures: make([]models.Capture, 3)}
+	disabled.record(models.QueryRequest{}, "req-1", time.Now(), models.QueryResponse{}, nil)
+	if captures := disabled.list("", maxCaptureLimit); len(captures) != 0 {
+		t.Errorf("Expected no captures when disabled, got %d", len(captures))
+	}
+}
+
+func TestNewCaptureStore(t *testing.T) {
+	cfg := config.GetConfig()
+	originalEnabled, originalRate, originalSize := cfg.DebugCapture, cfg.DebugCaptureSampleRate, cfg.DebugCaptureSize
+	defer func() { cfg.DebugCapture, cfg.DebugCaptureSampleRate, cfg.DebugCaptureSize = originalEnabled, originalRate, originalSize }()
+	
+	cfg.DebugCapture, cfg.DebugCaptureSampleRate, cfg.DebugCaptureSize = true, 0.25, 5
+	store := newCaptureStore()
+	if !store.enabled || store.sampleRate != 0.25 || len(store.captures) != 5 {
+		t.Errorf("Expected configured capture settings, got enabled=%v rate=%v size=%d", store.enabled, store.sampleRate, len(store.captures))
+	}
+	
+	cfg.DebugCaptureSampleRate, cfg.DebugCaptureSize = 2, 0
+	store = newCaptureStore()
+	if store.sampleRate != 1 || len(store.captures) != defaultCaptureSize {
+		t.Errorf("Expected defaults for invalid settings, got rate=%v size=%d", store.sampleRate, len(store.captures))
+	}
+}
+
+func TestCapturesHandler(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				return &llm.QueryResult{Response: "use sk-0123456789abcdef", InputTokens: 3, OutputTokens: 4}, nil
+			},
+		}, nil
+	}
+	
+	handler := &Handler{
+		router:   &MockRouter{},
+		cache:    &MockCache{},
+		captures: &captureStore{enabled: true, sampleRate: 1, captures: make([]models.Capture, 10)},
+	}
+	
+	temperature := 0.3
+	query := models.QueryRequest{Query: "token=abc123456", ModelVersion: "gpt-4o", Temperature: &temperature, Stop: []string{"END"}, Tenant: "acme"}
+	if _, qErr := handler.processAndCapture(context.Background(), query, "req-1"); qErr != nil {
+		t.Fatalf("Expected no error, got %v", qErr)
+	}
+	
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/captures?request_id=req-1", nil)
+	w := httptest.NewRecorder()
+	handler.CapturesHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	
+	var resp models.CapturesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	
+	if !resp.Enabled || len(resp.Captures) != 1 {
+		t.Fatalf("Expected 1 capture, got %+v", resp)
+	}
+	
+	capture := resp.Captures[0]
+	if capture.Model != models.OpenAI || capture.InputTokens != 3 || capture.OutputTokens != 4 {
+		t.Errorf("Expected model and tokens to be captured, got %+v", capture)
+	}
+	if capture.Tenant != "acme" || capture.Request.ModelVersion != "gpt-4o" || capture.Request.Temperature == nil || *capture.Request.Temperature != 0.3 || len(capture.Request.Stop) != 1 {
+		t.Errorf("Expected the request options to be captured, got %+v", capture.Request)
+	}
+	if strings.Contains(capture.Request.Query, "abc123456") || strings.Contains(capture.Response, "sk-0123456789abcdef") {
+		t.Errorf("Expected secrets to be redacted, got query %q and response %q", capture.Request.Query, capture.Response)
+	}
+	
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/captures?limit=0", nil)
+	w = httptest.NewRecorder()
+	handler.CapturesHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid limit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"sync"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+type flight struct {
+	done chan struct{}
+	resp models.QueryResponse
+	err  *queryError
+}
+
+type flightGroup struct {
+	mutex   sync.Mutex
+	flights map[string]*flight
+}
+
+func (g *flightGroup) join(key string) (*flight, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+func (g *flightGroup) finish(key string, f *flight, resp models.QueryResponse, err *queryError) {
+	g.mutex.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mutex.Unlock()
+	
+	f.resp = resp
+	f.err = err
+	close(f.done)
+}
+
+func (e *queryError) canceled() bool {
+	return e.Code == myerrors.CodeCanceled || e.Code == myerrors.CodeTimeout
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+)
+
+func coalescedRequests() int {
+	return monitoring.GetMetrics().GetMetricsData()["coalesced_requests"].(int)
+}
+
+func stampedesPrevented() int {
+	return monitoring.GetMetrics().GetMetricsData()["stampedes_prevented"].(int)
+}
+
+func TestProcessQueryCoalescesIdenticalRequests(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var calls int32
+	release := make(chan struct{})
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return &llm.QueryResult{Response: "shared response"}, nil
+			},
+		}, nil
+	}
+	
+	handler := &Handler{
+		router: &MockRouter{},
+		cache:  &MockCache{},
+	}
+	req := models.QueryRequest{Query: "same question"}
+	before := coalescedRequests()
+	
+	const waiters = 3
+	responses := make([]models.QueryResponse, waiters+1)
+	var wg sync.WaitGroup
+	
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		responses[0], _ = handler.processQuery(context.Background(), req, "leader")
+	}()
+	
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&calls) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	
+	for i := 1; i <= waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], _ = handler.processQuery(context.Background(), req, "waiter")
+		}(i)
+	}
+	
+	for coalescedRequests()-before < waiters && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	
+	if calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+	
+	if got := coalescedRequests() - before; got != waiters {
+		t.Errorf("Expected %d coalesced requests, got %d", waiters, got)
+	}
+	
+	for i, resp := range responses {
+		if resp.Response != "shared response" {
+			t.Errorf("Response %d: expected shared response, got %q", i, resp.Response)
+		}
+	}
+	
+	if responses[0].RequestID != "leader" || responses[1].RequestID != "waiter" {
+		t.Errorf("Expected each caller to keep its request ID, got %q and %q", responses[0].RequestID, responses[1].RequestID)
+	}
+}
+
+func TestProcessQueryStampedePrevented(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var calls int32
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				atomic.AddInt32(&calls, 1)
+				return &llm.QueryResult{Response: "fresh response"}, nil
+			},
+		}, nil
+	}
+	
+	var lookups int32
+	handler := &Handler{
+		router: &MockRouter{},
+		cache: &MockCache{
+			getFunc: func(req models.QueryRequest) (models.QueryResponse, bool) {
+				if atomic.AddInt32(&lookups, 1) == 1 {
+					return models.QueryResponse{}, false
+				}
+				return models.QueryResponse{Response: "refilled response", Model: models.OpenAI}, true
+			},
+		},
+	}
+	before := stampedesPrevented()
+	
+	resp, qerr := handler.processQuery(context.Background(), models.QueryRequest{Query: "test"}, "req-1")
+	if qerr != nil {
+		t.Fatalf("Expected no error, got %+v", qerr)
+	}
+	
+	if resp.Response != "refilled response" {
+		t.Errorf("Expected refilled response, got %q", resp.Response)
+	}
+	
+	if calls != 0 {
+		t.Errorf("Expected no upstream call, got %d", calls)
+	}
+	
+	if got := stampedesPrevented() - before; got != 1 {
+		t.Errorf("Expected 1 stampede prevented, got %d", got)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func CompressionMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, statusCode: http.StatusOK}
+			defer gw.Close()
+			
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		
+		params = strings.ReplaceAll(params, " ", "")
+		if q, ok := strings.CutPrefix(params, "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize    int
+	statusCode int
+	buf        []byte       // Held back until minSize bytes decide whether to compress
+	gz         *gzip.Writer // Nil when the response is written uncompressed
+	started    bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.started {
+		return
+	}
+	w.statusCode = code
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		if !w.compressible() {
+			w.start(false)
+		} else {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) < w.minSize {
+				return len(p), nil
+			}
+			
+			w.start(true)
+			return len(p), nil
+		}
+	}
+	
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipResponseWriter) Close() error {
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+func (w *gzipResponseWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		return false
+	}
+	return w.statusCode != http.StatusNoContent && w.statusCode != http.StatusNotModified && w.statusCode != http.StatusPartialContent
+}
+
+func (w *gzipResponseWriter) start(compress bool) {
+	w.started = true
+	
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	
+	if len(w.buf) > 0 {
+		if w.gz != nil {
+			w.gz.Write(w.buf)
+		} else {
+			w.ResponseWriter.Write(w.buf)
+		}
+		w.buf = nil
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"response":"a long model response"}`, 100)
+	small := `{"status":"ok"}`
+	
+	testCases := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		expectGzip     bool
+	}{
+		{"Large response", "gzip, deflate, br", "application/json", large, true},
+		{"Small response", "gzip", "application/json", small, false},
+		{"No Accept-Encoding", "", "application/json", large, false},
+		{"Gzip refused", "gzip;q=0, br", "application/json", large, false},
+		{"Event stream", "gzip", "text/event-stream", large, false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := CompressionMiddleware(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, tc.body[:len(tc.body)/2])
+				io.WriteString(w, tc.body[len(tc.body)/2:])
+			}))
+			
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			
+			handler.ServeHTTP(w, req)
+			
+			if w.Code != http.StatusCreated {
+				t.Errorf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", vary)
+			}
+			
+			body := w.Body.String()
+			if tc.expectGzip {
+				if encoding := w.Header().Get("Content-Encoding"); encoding != "gzip" {
+					t.Fatalf("Expected Content-Encoding: gzip, got %q", encoding)
+				}
+				
+				reader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("Error reading gzip body: %v", err)
+				}
+				decompressed, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("Error decompressing body: %v", err)
+				}
+				body = string(decompressed)
+			} else if encoding := w.Header().Get("Content-Encoding"); encoding != "" {
+				t.Errorf("Expected no Content-Encoding, got %q", encoding)
+			}
+			
+			if body != tc.body {
+				t.Errorf("Expected body of %d bytes to round-trip, got %d bytes", len(tc.body), len(body))
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareFlush(t *testing.T) {
+	handler := CompressionMiddleware(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		
+		if !strings.Contains(w.(*gzipResponseWriter).ResponseWriter.(*httptest.ResponseRecorder).Body.String(), "data: first") {
+			t.Errorf("Expected flushed data to reach the client before the handler returns")
+		}
+		io.WriteString(w, strings.Repeat("data: more\n\n", 200))
+	}))
+	
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	
+	handler.ServeHTTP(w, req)
+	
+	if encoding := w.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Expected flushed response to stay uncompressed, got Content-Encoding %q", encoding)
+	}
+	if !w.Flushed {
+		t.Errorf("Expected Flush to reach the underlying writer")
+	}
+}
+
+func TestCompressionMiddlewareFlushBehindMonitoring(t *testing.T) {
+	w := httptest.NewRecorder()
+	handler := CompressionMiddleware(64)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, strings.Repeat(`{"index":0}`, 10))
+		rw.(http.Flusher).Flush()
+		
+		if w.Body.Len() == 0 {
+			t.Errorf("Expected flushed data to reach the client before the handler returns")
+		}
+		io.WriteString(rw, strings.Repeat(`{"index":1}`, 10))
+	}))
+	// Same order as the server: the monitoring writers wrap the gzip writer's target
+	chain := monitoring.RequestLoggerMiddleware(monitoring.MetricsMiddleware(handler))
+	
+	req := httptest.NewRequest(http.MethodPost, "/api/batch", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	
+	chain.ServeHTTP(w, req)
+	
+	if !w.Flushed {
+		t.Fatalf("Expected Flush to reach the client through the monitoring middleware")
+	}
+	if encoding := w.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("Expected a gzip response, got Content-Encoding %q", encoding)
+	}
+	
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Error reading gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(reader)
+	if expected := strings.Repeat(`{"index":0}`, 10) + strings.Repeat(`{"index":1}`, 10); string(body) != expected {
+		t.Errorf("Unexpected body after decompression: %q", body)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	testCases := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"GZIP":                true,
+		"deflate, gzip;q=0.5": true,
+		"gzip;q=0":            false,
+		"gzip; q=0.0, br":     false,
+		"br":                  false,
+		"x-gzip":              false,
+	}
+	
+	for header, expected := range testCases {
+		if accepted := acceptsGzip(header); accepted != expected {
+			t.Errorf("acceptsGzip(%q): expected %v, got %v", header, expected, accepted)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+const defaultErrorMessage = "Error processing your request: {detail}"
+
+var defaultErrorStatuses = map[string]config.ErrorStatus{
+	myerrors.CodeAllModelsFailed:         {Status: http.StatusInternalServerError, Message: "All available models failed to process your request."},
+	myerrors.CodeTimeout:                 {Status: http.StatusRequestTimeout, Message: "Request timed out. Please try again later."},
+	myerrors.CodeRateLimit:               {Status: http.StatusTooManyRequests, Message: "Rate limit exceeded. Please try again later."},
+	myerrors.CodeBudgetExceeded:          {Status: http.StatusTooManyRequests, Message: "Spending budget exhausted for {model}."},
+	myerrors.CodeAPIKeyMissing:           {Status: http.StatusUnauthorized, Message: "API key not configured for this model."},
+	myerrors.CodeUnsupportedModelVersion: {Status: http.StatusBadRequest, Message: "Unsupported model version: {version}"},
+	myerrors.CodeToolsUnsupported:        {Status: http.StatusBadRequest, Message: "Tool calling is not supported by {model}."},
+	myerrors.CodeImagesUnsupported:       {Status: http.StatusBadRequest, Message: "Image input is not supported: {detail}"},
+	myerrors.CodeUnavailable:             {Status: http.StatusServiceUnavailable, Message: "Service is currently unavailable. Please try again later."},
+}
+
+func errorStatusFor(code string) config.ErrorStatus {
+	status, ok := defaultErrorStatuses[code]
+	if !ok {
+		status = config.ErrorStatus{Status: http.StatusInternalServerError, Message: defaultErrorMessage}
+	}
+	
+	if override, ok := config.GetConfig().ErrorStatuses[code]; ok {
+		status.Status = override.Status
+		if override.Message != "" {
+			status.Message = override.Message
+		}
+	}
+	return status
+}
+
+// proxyError builds the queryError for a failure raised by the proxy itself rather than a
+// provider, so ERROR_STATUS_MAP applies to it the same way.
+func proxyError(code string, model models.ModelType) *queryError {
+	mapping := errorStatusFor(code)
+	return &queryError{Message: errorMessage(mapping.Message, string(model), "", ""), StatusCode: mapping.Status, Code: code, Model: string(model)}
+}
+
+func errorMessage(template, model, version, detail string) string {
+	return strings.NewReplacer("{model}", model, "{version}", version, "{detail}", detail).Replace(template)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestDefaultErrorStatuses(t *testing.T) {
+	testCases := []struct {
+		code   string
+		status int
+	}{
+		{myerrors.CodeTimeout, http.StatusRequestTimeout},
+		{myerrors.CodeRateLimit, http.StatusTooManyRequests},
+		{myerrors.CodeBudgetExceeded, http.StatusTooManyRequests},
+		{myerrors.CodeAPIKeyMissing, http.StatusUnauthorized},
+		{myerrors.CodeUnsupportedModelVersion, http.StatusBadRequest},
+		{myerrors.CodeToolsUnsupported, http.StatusBadRequest},
+		{myerrors.CodeImagesUnsupported, http.StatusBadRequest},
+		{myerrors.CodeUnavailable, http.StatusServiceUnavailable},
+		{myerrors.CodeAllModelsFailed, http.StatusInternalServerError},
+		{myerrors.CodeProviderError, http.StatusInternalServerError},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			if status := errorStatusFor(tc.code); status.Status != tc.status || status.Message == "" {
+				t.Errorf("Expected status %d with a message, got %+v", tc.status, status)
+			}
+		})
+	}
+	
+	if msg := errorMessage(errorStatusFor(myerrors.CodeBudgetExceeded).Message, "openai", "", ""); msg != "Spending budget exhausted for openai." {
+		t.Errorf("Unexpected budget message: %q", msg)
+	}
+}
+
+func TestQueryHandlerErrorStatusOverride(t *testing.T) {
+	cfg := config.GetConfig()
+	originalStatuses := cfg.ErrorStatuses
+	defer func() { cfg.ErrorStatuses = originalStatuses }()
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				return nil, myerrors.NewUnavailableError(string(modelType))
+			},
+		}, nil
+	}
+	
+	testCases := []struct {
+		name           string
+		statuses       map[string]config.ErrorStatus
+		expectedStatus int
+		expectedMsg    string
+	}{
+		{"Default", nil, http.StatusServiceUnavailable, "Service is currently unavailable. Please try again later."},
+		{"Status override", map[string]config.ErrorStatus{myerrors.CodeUnavailable: {Status: http.StatusBadGateway}}, http.StatusBadGateway, "Service is currently unavailable. Please try again later."},
+		{"Status and message override", map[string]config.ErrorStatus{myerrors.CodeUnavailable: {Status: http.StatusBadGateway, Message: "{model} is down"}}, http.StatusBadGateway, "openai is down"},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.ErrorStatuses = tc.statuses
+			
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test","no_fallback":true}`))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			
+			var resp models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if resp.Error.Message != tc.expectedMsg || resp.Error.Code != myerrors.CodeUnavailable {
+				t.Errorf("Expected %q with code %s, got %+v", tc.expectedMsg, myerrors.CodeUnavailable, resp.Error)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerProxyErrorStatusOverride(t *testing.T) {
+	cfg := config.GetConfig()
+	originalStatuses := cfg.ErrorStatuses
+	defer func() { cfg.ErrorStatuses = originalStatuses }()
+	cfg.ErrorStatuses = map[string]config.ErrorStatus{
+		myerrors.CodeUnavailable: {Status: http.StatusBadGateway, Message: "No model can take this"},
+		myerrors.CodeTimeout:     {Status: http.StatusGatewayTimeout},
+	}
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}, nil
+	}
+	
+	testCases := []struct {
+		name           string
+		router         *MockRouter
+		requestTimeout time.Duration
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"No model available", &MockRouter{
+			routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+				return "", errors.New("no models available")
+			},
+		}, 0, http.StatusBadGateway, myerrors.CodeUnavailable},
+		{"Request deadline", &MockRouter{}, 50 * time.Millisecond, http.StatusGatewayTimeout, myerrors.CodeTimeout},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = tc.router
+			if tc.requestTimeout > 0 {
+				handler.requestTimeout = tc.requestTimeout
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test","no_fallback":true}`))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			
+			var resp models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if resp.Error.Code != tc.expectedCode {
+				t.Errorf("Expected code %s, got %+v", tc.expectedCode, resp.Error)
+			}
+		})
+	}
+}
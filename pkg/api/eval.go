@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/logging"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxEvalPrompts     = 50
+	maxEvalConcurrency = 4 // Provider calls in flight at once across the whole suite
+)
+
+type EvalRequest struct {
+	Prompts       []string           `json:"prompts"`
+	Models        []models.ModelType `json:"models"`
+	ModelVersions map[string]string  `json:"model_versions,omitempty"` // Map of model name to version
+	Timeout       int                `json:"timeout,omitempty"`        // Per-query timeout in seconds
+	Stop          []string           `json:"stop,omitempty"`
+}
+
+type EvalModelSummary struct {
+	SuccessCount    int     `json:"success_count"`
+	FailureCount    int     `json:"failure_count"`
+	AvgResponseTime int64   `json:"avg_response_time_ms"` // Over successful queries
+	InputTokens     int     `json:"input_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+	TotalCostUSD    float64 `json:"total_cost_usd"`
+}
+
+type EvalResponse struct {
+	Models      []models.ModelType          `json:"models"`
+	Results     [][]models.QueryResponse    `json:"results"` // One row per prompt, one column per model in Models order
+	Summary     map[string]EvalModelSummary `json:"summary"`
+	RequestID   string                      `json:"request_id"`
+	Timestamp   time.Time                   `json:"timestamp"`
+	ElapsedTime int64                       `json:"elapsed_time_ms"`
+}
+
+func (h *Handler) EvalHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	clientIP := getClientIP(r)
+	if !h.rateLimiter.AllowClient(clientIP) {
+		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
+		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+	
+	tenant, err := getTenant(r)
+	if err != nil {
+		handleTenantError(w, err)
+		return
+	}
+	
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			handleError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		} else {
+			handleError(w, "Error reading request body", http.StatusBadRequest)
+		}
+		return
+	}
+	
+	var req EvalRequest
+	if err := decodeRequestBody(bodyBytes, &req); err != nil {
+		handleDecodeError(w, err)
+		return
+	}
+	
+	if len(req.Prompts) == 0 {
+		handleError(w, "At least one prompt is required", http.StatusBadRequest)
+		return
+	}
+	
+	if len(req.Prompts) > maxEvalPrompts {
+		handleError(w, fmt.Sprintf("Too many prompts: %d requested, maximum is %d", len(req.Prompts), maxEvalPrompts), http.StatusBadRequest)
+		return
+	}
+	
+	for i, prompt := range req.Prompts {
+		prompt = sanitizeQuery(prompt)
+		if prompt == "" {
+			handleError(w, fmt.Sprintf("Prompt %d cannot be empty", i), http.StatusBadRequest)
+			return
+		}
+		if len(prompt) > maxQueryLength {
+			handleError(w, fmt.Sprintf("Prompt %d exceeds maximum length", i), http.StatusBadRequest)
+			return
+		}
+		req.Prompts[i] = wrapPrompt(prompt, tenant)
+	}
+	
+	priority := requestPriority(r, tenant)
+	modelList, qErr := h.resolveParallelModels(req.Models, tenant)
+	if qErr != nil {
+		writeQueryError(w, qErr)
+		return
+	}
+	req.Models = modelList
+	
+	if err := checkFanout(len(req.Prompts) * len(req.Models)); err != nil {
+		handleError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	requestID := requestIDFor(w, r)
+	logging.LogRequest(logging.LogFields{
+		Model:      "eval",
+		Query:      fmt.Sprintf("%d prompts on %d models", len(req.Prompts), len(req.Models)),
+		Timestamp:  time.Now(),
+		RequestID:  requestID,
+	})
+	
+	timeout := h.timeout()
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	
+	ctx, cancel := context.WithTimeout(llm.WithRequestID(r.Context(), requestID), time.Duration(config.GetConfig().EvalTimeout)*time.Second)
+	defer cancel()
+	startTime := time.Now()
+	
+	results := make([][]models.QueryResponse, len(req.Prompts))
+	for i := range results {
+		results[i] = make([]models.QueryResponse, len(req.Models))
+	}
+	
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxEvalConcurrency)
+	charge := newFanoutCharge(h.rateLimiter, clientIP)
+	
+	for i, prompt := range req.Prompts {
+		for j, model := range req.Models {
+			wg.Add(1)
+			go func(i, j int, prompt string, model models.ModelType) {
+				defer wg.Done()
+				
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				
+				if !charge.take() {
+					results[i][j] = models.QueryResponse{
+						Model:     model,
+						Timestamp: time.Now(),
+						RequestID: fmt.Sprintf("%s/%d", requestID, i),
+						Error:     "Rate limit exceeded. Please try again later.",
+						ErrorType: myerrors.CodeRateLimit,
+					}
+					return
+				}
+				
+				queryCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				
+				results[i][j] = h.queryParallelModel(queryCtx, model, prompt, req.ModelVersions[string(model)], llm.QueryOptions{Stop: req.Stop}, tenant, priority, fmt.Sprintf("%s/%d", requestID, i))
+			}(i, j, prompt, model)
+		}
+	}
+	
+	wg.Wait()
+	
+	elapsedTime := time.Since(startTime).Milliseconds()
+	
+	resp := EvalResponse{
+		Models:      req.Models,
+		Results:     results,
+		Summary:     summarizeEval(req.Models, results),
+		RequestID:   requestID,
+		Timestamp:   time.Now(),
+		ElapsedTime: elapsedTime,
+	}
+	
+	logging.LogResponse(logging.LogFields{
+		Model:        "eval",
+		ResponseTime: elapsedTime,
+		RequestID:    requestID,
+		Timestamp:    time.Now(),
+	})
+	
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func summarizeEval(modelList []models.ModelType, results [][]models.QueryResponse) map[string]EvalModelSummary {
+	summary := make(map[string]EvalModelSummary, len(modelList))
+	for j, model := range modelList {
+		var modelSummary EvalModelSummary
+		var totalResponseTime int64
+		
+		for _, row := range results {
+			result := row[j]
+			if result.Error != "" {
+				modelSummary.FailureCount++
+				continue
+			}
+			
+			modelSummary.SuccessCount++
+			totalResponseTime += result.ResponseTime
+			modelSummary.InputTokens += result.InputTokens
+			modelSummary.OutputTokens += result.OutputTokens
+			modelSummary.TotalCostUSD += result.CostUSD
+		}
+		
+		if modelSummary.SuccessCount > 0 {
+			modelSummary.AvgResponseTime = totalResponseTime / int64(modelSummary.SuccessCount)
+		}
+		summary[string(model)] = modelSummary
+	}
+	return summary
+}
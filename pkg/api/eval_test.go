@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestEvalHandler(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var inFlight, maxInFlight int32
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				current := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+				for {
+					observed := atomic.LoadInt32(&maxInFlight)
+					if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				
+				if modelType == models.Claude && query == "fail" {
+					return nil, myerrors.NewEmptyResponseError("claude")
+				}
+				return &llm.QueryResult{Response: string(modelType) + ": " + query, InputTokens: 2, OutputTokens: 3, TotalTokens: 5}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	body := `{"prompts":["one","two","three","fail"],"models":["openai","claude"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/eval", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	
+	handler.EvalHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp EvalResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if len(resp.Results) != 4 {
+		t.Fatalf("Expected a row per prompt, got %d", len(resp.Results))
+	}
+	for i, prompt := range []string{"one", "two", "three", "fail"} {
+		row := resp.Results[i]
+		if len(row) != 2 || row[0].Model != models.OpenAI || row[1].Model != models.Claude {
+			t.Fatalf("Expected row %d in request model order, got %+v", i, row)
+		}
+		if row[0].Response != "openai: "+prompt {
+			t.Errorf("Expected openai's answer to %q, got %q", prompt, row[0].Response)
+		}
+	}
+	
+	if failed := resp.Results[3][1]; failed.Error == "" || failed.ErrorType != myerrors.CodeEmptyResponse {
+		t.Errorf("Expected the failed query to keep its error, got %+v", failed)
+	}
+	
+	openai := resp.Summary["openai"]
+	if openai.SuccessCount != 4 || openai.FailureCount != 0 || openai.InputTokens != 8 || openai.OutputTokens != 12 {
+		t.Errorf("Unexpected openai summary: %+v", openai)
+	}
+	if claude := resp.Summary["claude"]; claude.SuccessCount != 3 || claude.FailureCount != 1 || claude.OutputTokens != 9 {
+		t.Errorf("Unexpected claude summary: %+v", claude)
+	}
+	if openai.AvgResponseTime <= 0 {
+		t.Errorf("Expected an average response time, got %d", openai.AvgResponseTime)
+	}
+	
+	if maxInFlight > maxEvalConcurrency {
+		t.Errorf("Expected at most %d queries in flight, saw %d", maxEvalConcurrency, maxInFlight)
+	}
+}
+
+func TestEvalHandlerDeadline(t *testing.T) {
+	cfg := config.GetConfig()
+	originalTimeout := cfg.EvalTimeout
+	defer func() { cfg.EvalTimeout = originalTimeout }()
+	cfg.EvalTimeout = 1
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				if query == "slow" {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return &llm.QueryResult{Response: query}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	req := httptest.NewRequest(http.MethodPost, "/api/eval", bytes.NewBufferString(`{"prompts":["fast","slow"],"models":["openai"],"timeout":30}`))
+	w := httptest.NewRecorder()
+	
+	start := time.Now()
+	handler.EvalHandler(w, req)
+	
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected EVAL_TIMEOUT to bound the eval, took %v", elapsed)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp EvalResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if resp.Results[0][0].Error != "" {
+		t.Errorf("Expected the fast prompt to succeed, got %+v", resp.Results[0][0])
+	}
+	if resp.Results[1][0].ErrorType != myerrors.CodeTimeout {
+		t.Errorf("Expected the slow prompt to time out, got %+v", resp.Results[1][0])
+	}
+}
+
+func TestEvalHandlerValidation(t *testing.T) {
+	cfg := config.GetConfig()
+	originalFanout := cfg.MaxFanout
+	defer func() { cfg.MaxFanout = originalFanout }()
+	cfg.MaxFanout = 3
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	tooMany := `{"prompts":["x"` + strings.Repeat(`,"x"`, maxEvalPrompts) + `],"models":["openai"]}`
+	
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"No prompts", `{"prompts":[],"models":["openai"]}`, http.StatusBadRequest},
+		{"Empty prompt", `{"prompts":["ok","  "],"models":["openai"]}`, http.StatusBadRequest},
+		{"Too many prompts", tooMany, http.StatusBadRequest},
+		{"Invalid model", `{"prompts":["ok"],"models":["bedrock"]}`, http.StatusBadRequest},
+		{"Duplicate models", `{"prompts":["ok"],"models":["openai","openai"]}`, http.StatusBadRequest},
+		{"Invalid JSON", `{"prompts":`, http.StatusBadRequest},
+		{"Within fan-out", `{"prompts":["a","b","c"],"models":["openai"]}`, http.StatusOK},
+		{"Fan-out exceeded", `{"prompts":["a","b"],"models":["openai","claude"]}`, http.StatusBadRequest},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			req := httptest.NewRequest(http.MethodPost, "/api/eval", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			handler.EvalHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+var fencedBlock = regexp.MustCompile("(?s)```([\\w+#.-]*)[^\\n]*\\n(.*?)\\n?```")
+
+func extractResponse(response string, mode string) (string, error) {
+	switch mode {
+	case "":
+		return response, nil
+	case models.ExtractCode:
+		return extractCode(response)
+	case models.ExtractJSON:
+		return extractJSON(response)
+	}
+	
+	return "", fmt.Errorf("%w: unknown extract mode %s", myerrors.ErrExtractionFailed, mode)
+}
+
+func extractCode(response string) (string, error) {
+	match := fencedBlock.FindStringSubmatch(response)
+	if match == nil {
+		return "", fmt.Errorf("%w: no fenced code block in response", myerrors.ErrExtractionFailed)
+	}
+	
+	return match[2], nil
+}
+
+func extractJSON(response string) (string, error) {
+	var candidates []string
+	for _, match := range fencedBlock.FindAllStringSubmatch(response, -1) {
+		if strings.EqualFold(match[1], "json") {
+			candidates = append([]string{match[2]}, candidates...)
+		} else {
+			candidates = append(candidates, match[2])
+		}
+	}
+	candidates = append(candidates, response)
+	
+	if start := strings.IndexAny(response, "{["); start != -1 {
+		if end := strings.LastIndexAny(response, "}]"); end > start {
+			candidates = append(candidates, response[start:end+1])
+		}
+	}
+	
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if candidate != "" && json.Valid([]byte(candidate)) {
+			return candidate, nil
+		}
+	}
+	
+	return "", fmt.Errorf("%w: no valid JSON in response", myerrors.ErrExtractionFailed)
+}
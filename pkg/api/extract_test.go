@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestExtractResponse(t *testing.T) {
+	testCases := []struct {
+		name        string
+		response    string
+		mode        string
+		expected    string
+		expectError bool
+	}{
+		{"No extraction", "Here you go", "", "Here you go", false},
+		{"Code block", "Sure:\n```go\nfmt.Println(\"hi\")\n```\nDone.", models.ExtractCode, "fmt.Println(\"hi\")", false},
+		{"First code block", "```\nfirst\n```\n```\nsecond\n```", models.ExtractCode, "first", false},
+		{"Code block missing", "No code here", models.ExtractCode, "", true},
+		{"JSON block", "Result:\n```json\n{\"a\": 1}\n```", models.ExtractJSON, "{\"a\": 1}", false},
+		{"JSON block preferred over other blocks", "```\nnot json\n```\n```json\n[1, 2]\n```", models.ExtractJSON, "[1, 2]", false},
+		{"Bare JSON", "  {\"ok\": true}  ", models.ExtractJSON, "{\"ok\": true}", false},
+		{"Embedded JSON", "The answer is {\"ok\": true} as requested.", models.ExtractJSON, "{\"ok\": true}", false},
+		{"Invalid JSON", "```json\n{\"a\": \n```", models.ExtractJSON, "", true},
+		{"No JSON", "Plain text", models.ExtractJSON, "", true},
+		{"Unknown mode", "text", "yaml", "", true},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			extracted, err := extractResponse(tc.response, tc.mode)
+			if tc.expectError {
+				if !errors.Is(err, myerrors.ErrExtractionFailed) {
+					t.Fatalf("Expected extraction error, got %v", err)
+				}
+				return
+			}
+			
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if extracted != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, extracted)
+			}
+		})
+	}
+}
@@ -1,24 +1,39 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/amorin24/llmproxy/pkg/cache"
+	"github.com/amorin24/llmproxy/pkg/config"
 	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/export"
+	httpclient "github.com/amorin24/llmproxy/pkg/http"
 	"github.com/amorin24/llmproxy/pkg/llm"
 	"github.com/amorin24/llmproxy/pkg/logging"
 	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/amorin24/llmproxy/pkg/pricing"
+	"github.com/amorin24/llmproxy/pkg/retry"
 	"github.com/amorin24/llmproxy/pkg/router"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
@@ -27,6 +42,14 @@ const (
 	defaultRateLimit      = 60          // Requests per minute
 	defaultRateLimitBurst = 10          // Burst capacity
 	defaultTimeout        = 30 * time.Second
+	maxAutoContinuations  = 3
+	rateLimitRetryAfter   = 60 // Seconds clients should wait after a provider rate limit
+	timeoutRetryAfter     = 5  // Seconds clients should wait after a query timed out
+	proxyTimeoutHeader    = "X-Proxy-Timeout-Ms"
+	maxCompletions        = 10 // Maximum n per request
+	maxProviderMessageLength = 500 // Characters of a provider error message passed through to clients
+	tenantHeader          = "X-Tenant-ID"
+	apiKeyHeader          = "X-API-Key"
 )
 
 type RateLimiter struct {
@@ -37,6 +60,7 @@ type RateLimiter struct {
 	mutex          sync.Mutex
 	clientLimiters map[string]*RateLimiter // IP-based limiters
 	allowClientFunc func(clientID string) bool // For testing purposes
+	distributed    distributedLimiter // Shared buckets across instances, nil for in-memory only
 }
 
 func NewRateLimiter(requestsPerMinute, burst int) *RateLimiter {
@@ -69,8 +93,25 @@ func (rl *RateLimiter) AllowClient(clientID string) bool {
 	if rl.allowClientFunc != nil {
 		return rl.allowClientFunc(clientID)
 	}
+	
+	if rl.distributed != nil {
+		allowed, tokens, err := rl.distributed.Take(clientID, rl.refillRate, rl.maxTokens)
+		if err == nil {
+			limiter := rl.clientLimiter(clientID)
+			limiter.mutex.Lock()
+			limiter.tokens = tokens
+			limiter.lastRefill = time.Now()
+			limiter.mutex.Unlock()
+			return allowed
+		}
+	}
+
+	return rl.clientLimiter(clientID).Allow()
+}
 
+func (rl *RateLimiter) clientLimiter(clientID string) *RateLimiter {
 	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
 	
 	if _, exists := rl.clientLimiters[clientID]; !exists {
 		rl.clientLimiters[clientID] = NewRateLimiter(
@@ -78,31 +119,210 @@ func (rl *RateLimiter) AllowClient(clientID string) bool {
 			int(rl.maxTokens),
 		)
 	}
-	clientLimiter := rl.clientLimiters[clientID]
-	rl.mutex.Unlock()
+	return rl.clientLimiters[clientID]
+}
+
+func (rl *RateLimiter) SetClientHeaders(w http.ResponseWriter, clientID string) {
+	if rl.allowClientFunc != nil {
+		return
+	}
+	
+	limiter := rl.clientLimiter(clientID)
+	limiter.mutex.Lock()
+	elapsed := time.Since(limiter.lastRefill).Seconds()
+	tokens := min(limiter.maxTokens, limiter.tokens+elapsed*limiter.refillRate)
+	limiter.mutex.Unlock()
+	
+	resetSeconds, retryAfter := 0, 0
+	if limiter.refillRate > 0 {
+		resetSeconds = int(math.Ceil((limiter.maxTokens - tokens) / limiter.refillRate))
+		if tokens < 1 {
+			retryAfter = int(math.Ceil((1 - tokens) / limiter.refillRate))
+		}
+	}
 	
-	return clientLimiter.Allow()
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(int(limiter.maxTokens)))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+}
+
+func newClientRateLimiter(requestsPerMinute, burst int) *RateLimiter {
+	rl := NewRateLimiter(requestsPerMinute, burst)
+	if config.GetConfig().RateLimitBackend != config.RateLimitRedis {
+		return rl
+	}
+	
+	distributed, err := newRedisLimiter(config.GetConfig().RedisURL)
+	if err != nil {
+		logrus.WithError(err).Error("Invalid REDIS_URL, using in-memory rate limiting")
+		return rl
+	}
+	rl.distributed = distributed
+	return rl
 }
 
 func (rl *RateLimiter) SetAllowClientFunc(fn func(clientID string) bool) {
 	rl.allowClientFunc = fn
 }
 
+// fanoutCharge takes one rate limit token per provider call of a batch or eval request.
+// The request's own AllowClient check pays for its first call.
+type fanoutCharge struct {
+	limiter  *RateLimiter
+	clientID string
+	prepaid  atomic.Bool
+}
+
+func newFanoutCharge(limiter *RateLimiter, clientID string) *fanoutCharge {
+	charge := &fanoutCharge{limiter: limiter, clientID: clientID}
+	charge.prepaid.Store(true)
+	return charge
+}
+
+func (c *fanoutCharge) take() bool {
+	if c.prepaid.CompareAndSwap(true, false) {
+		return true
+	}
+	return c.limiter.AllowClient(c.clientID)
+}
+
 type Handler struct {
 	router      RouterInterface
 	cache       CacheInterface
 	rateLimiter *RateLimiter
+	jobs        *JobManager
+	flights     flightGroup
+	requestTimeout time.Duration // Overall deadline for a query, independent of the HTTP client timeout
+	costEstimator  *pricing.CostEstimator // Nil when the price catalog could not be loaded
+	idempotency    *idempotencyStore
+	modelQuotas    modelQuotas // Server-wide requests per minute per provider
+	budgets        *budgetTracker // Daily and monthly spend per provider
+	captures       *captureStore
+	usage          *usageTracker // Per-tenant requests, tokens and cost for /api/usage
+	admission      *admissionQueue // Bounds upstream queries, admitting higher priority tiers first
 }
 
 func NewHandler() *Handler {
+	catalogLoader, err := pricing.LoadCatalog(config.GetConfig().PriceCatalogPath)
+	if err != nil {
+		logrus.WithError(err).Warn("Price catalog not loaded, cost reporting disabled")
+	}
+	
+	return NewHandlerWithCatalog(catalogLoader)
+}
+
+// NewHandlerWithCatalog shares a price catalog loaded by the caller. A nil
+// loader disables cost reporting.
+func NewHandlerWithCatalog(catalogLoader *pricing.CatalogLoader) *Handler {
 	rateLimit := getEnvAsInt("RATE_LIMIT", defaultRateLimit)
 	rateLimitBurst := getEnvAsInt("RATE_LIMIT_BURST", defaultRateLimitBurst)
 	
-	return &Handler{
+	h := &Handler{
 		router:      router.NewRouter(),
 		cache:       cache.GetCache(),
-		rateLimiter: NewRateLimiter(rateLimit, rateLimitBurst),
+		rateLimiter: newClientRateLimiter(rateLimit, rateLimitBurst),
+		requestTimeout: time.Duration(config.GetConfig().RequestTimeout) * time.Second,
+		idempotency:    newIdempotencyStore(time.Duration(config.GetConfig().IdempotencyTTL) * time.Second),
+		modelQuotas:    newModelQuotas(config.GetConfig().ModelRPM),
+		budgets:        newBudgetTracker(config.GetConfig().ModelDailyBudgetUSD, config.GetConfig().ModelMonthlyBudgetUSD),
+		captures:       newCaptureStore(),
+		usage:          newUsageTracker(),
+		admission:      newAdmissionQueue(),
+	}
+	h.jobs = NewJobManager(h.processAndCapture)
+	
+	if catalogLoader != nil {
+		h.costEstimator = pricing.NewCostEstimator(catalogLoader)
+	}
+	
+	return h
+}
+
+func (h *Handler) recordCost(model models.ModelType, modelVersion string, inputTokens, outputTokens int) float64 {
+	if h.costEstimator == nil {
+		return 0
+	}
+	
+	provider := pricing.MapModelTypeToProvider(model)
+	estimate, err := h.costEstimator.EstimatePostCall(provider, modelVersion, inputTokens, outputTokens)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"provider":      provider,
+			"model_version": modelVersion,
+			"error":         err.Error(),
+		}).Debug("Skipping cost calculation")
+		return 0
+	}
+	
+	monitoring.RecordCost(provider, modelVersion, estimate.EstimatedCostUSD)
+	h.budgets.record(model, estimate.EstimatedCostUSD)
+	monitoring.RecordTokenCost(provider, modelVersion, "input", float64(inputTokens)/1000.0*estimate.PricePerInputToken)
+	monitoring.RecordTokenCost(provider, modelVersion, "output", float64(outputTokens)/1000.0*estimate.PricePerOutputToken)
+	
+	return estimate.EstimatedCostUSD
+}
+
+func (h *Handler) limitClient(client llm.Client, tenant string) llm.Client {
+	limited := &budgetClient{Client: &quotaClient{Client: client, quotas: h.modelQuotas}, budgets: h.budgets}
+	return &partialUsageClient{Client: limited, handler: h, tenant: tenant}
+}
+
+// partialUsageClient bills the completions that finished before a sibling
+// failed, then drops the partial result so callers only see the error.
+type partialUsageClient struct {
+	llm.Client
+	handler *Handler
+	tenant  string
+}
+
+func (c *partialUsageClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
+	result, err := c.Client.Query(ctx, query, modelVersion, opts)
+	if err == nil || result == nil {
+		return result, err
+	}
+	
+	model := c.GetModelType()
+	costUSD := c.handler.recordCost(model, result.ModelVersion, result.InputTokens, result.OutputTokens)
+	c.handler.usage.record(c.tenant, model, result.InputTokens, result.OutputTokens, costUSD)
+	return nil, err
+}
+
+// reportSlowRequest logs and counts a query over SLOW_REQUEST_THRESHOLD_MS. qErr is set when the
+// query failed, so slow timeouts and fallbacks that end in an error are reported too.
+func reportSlowRequest(resp models.QueryResponse, qErr *queryError) {
+	threshold := config.GetConfig().SlowRequestThresholdMs
+	if threshold <= 0 || resp.Timings == nil || resp.Timings.TotalMs <= int64(threshold) {
+		return
+	}
+	
+	fields := logrus.Fields{
+		"model":         string(resp.Model),
+		"model_version": resp.ModelVersion,
+		"request_id":    resp.RequestID,
+		"input_tokens":  resp.InputTokens,
+		"output_tokens": resp.OutputTokens,
+		"num_retries":   resp.NumRetries,
+		"routing_ms":    resp.Timings.RoutingMs,
+		"provider_ms":   resp.Timings.ProviderMs,
+		"overhead_ms":   resp.Timings.OverheadMs,
+		"total_ms":      resp.Timings.TotalMs,
+		"threshold_ms":  threshold,
+	}
+	if qErr != nil {
+		fields["error_code"] = qErr.Code
 	}
+	logrus.WithFields(fields).Warn("Slow request")
+	monitoring.RecordSlowRequest(string(resp.Model))
+}
+
+func (h *Handler) timeout() time.Duration {
+	if h.requestTimeout <= 0 {
+		return defaultTimeout
+	}
+	return h.requestTimeout
 }
 
 func getClientIP(r *http.Request) string {
@@ -120,6 +340,84 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
+var errUnknownField = errors.New("unknown field")
+
+func decodeRequestBody(body []byte, v interface{}) error {
+	if !config.GetConfig().StrictRequestSchema {
+		return json.Unmarshal(body, v)
+	}
+	
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return fmt.Errorf("%w %s in request body", errUnknownField, field)
+		}
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON body")
+	}
+	return nil
+}
+
+func handleDecodeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownField) {
+		handleErrorWithCode(w, err.Error(), http.StatusBadRequest, myerrors.CodeInvalidRequest, "")
+		return
+	}
+	handleErrorWithCode(w, "Invalid JSON in request body", http.StatusBadRequest, myerrors.CodeInvalidJSON, "")
+}
+
+var (
+	errInvalidAPIKey       = errors.New("Invalid API key")
+	errTenantNotAuthorized = errors.New("X-Tenant-ID requires an API key issued to that tenant")
+)
+
+// getTenant resolves the tenant from the API key in X-API-Key or Authorization: Bearer.
+// X-Tenant-ID is only accepted when it names the key's own tenant.
+func getTenant(r *http.Request) (string, error) {
+	apiKey := strings.TrimSpace(r.Header.Get(apiKeyHeader))
+	if apiKey == "" {
+		apiKey = bearerToken(r)
+	}
+	claimed := strings.TrimSpace(r.Header.Get(tenantHeader))
+	
+	if apiKey == "" {
+		if claimed != "" {
+			return "", errTenantNotAuthorized
+		}
+		return "", nil
+	}
+	
+	tenant, ok := config.GetConfig().TenantForAPIKey(apiKey)
+	if !ok {
+		return "", errInvalidAPIKey
+	}
+	if claimed != "" && claimed != tenant {
+		return "", errTenantNotAuthorized
+	}
+	return tenant, nil
+}
+
+// bearerToken returns the credentials of an Authorization header using the Bearer scheme, and ""
+// for any other scheme so a Basic header is not mistaken for an API key.
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func handleTenantError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidAPIKey) {
+		handleErrorWithCode(w, err.Error(), http.StatusUnauthorized, myerrors.CodeUnauthorized, "")
+		return
+	}
+	handleErrorWithCode(w, err.Error(), http.StatusForbidden, myerrors.CodeForbidden, "")
+}
+
 func validateQueryRequest(req models.QueryRequest) error {
 	if req.Query == "" {
 		return errors.New("query cannot be empty")
@@ -129,6 +427,10 @@ func validateQueryRequest(req models.QueryRequest) error {
 		return fmt.Errorf("query exceeds maximum length of %d characters", maxQueryLength)
 	}
 	
+	if len(req.CachePrefix) > maxQueryLength {
+		return fmt.Errorf("cache_prefix exceeds maximum length of %d characters", maxQueryLength)
+	}
+	
 	if req.Model != "" {
 		validModels := []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}
 		valid := false
@@ -143,33 +445,276 @@ func validateQueryRequest(req models.QueryRequest) error {
 		if !valid {
 			return fmt.Errorf("invalid model: %s", req.Model)
 		}
+		
+		if !config.GetConfig().IsModelAllowed(req.Tenant, req.Model) {
+			return fmt.Errorf("%w: %s", myerrors.ErrModelNotAllowed, req.Model)
+		}
 	}
 	
 	if req.TaskType != "" {
-		validTaskTypes := []models.TaskType{
-			models.TextGeneration,
-			models.Summarization,
-			models.SentimentAnalysis,
-			models.QuestionAnswering,
+		if _, valid := config.GetConfig().TaskRouting[req.TaskType]; !valid {
+			return fmt.Errorf("invalid task type: %s", req.TaskType)
 		}
-		valid := false
-		
-		for _, taskType := range validTaskTypes {
-			if req.TaskType == taskType {
-				valid = true
-				break
+	}
+	
+	if req.CallbackURL != "" {
+		callbackURL, err := url.Parse(req.CallbackURL)
+		if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+			return fmt.Errorf("invalid callback_url: %s", req.CallbackURL)
+		}
+		if !config.GetConfig().CallbackAllowPrivateNetworks {
+			ctx, cancel := context.WithTimeout(context.Background(), callbackResolveTimeout)
+			err := httpclient.CheckPublicHost(ctx, callbackURL.Hostname())
+			cancel()
+			if err != nil {
+				return fmt.Errorf("invalid callback_url: %w", err)
 			}
 		}
-		
-		if !valid {
-			return fmt.Errorf("invalid task type: %s", req.TaskType)
+	}
+	
+	if req.N < 0 || req.N > maxCompletions {
+		return fmt.Errorf("n must be between 1 and %d", maxCompletions)
+	}
+	
+	if req.TopP != nil && (*req.TopP < 0 || *req.TopP > 1) {
+		return errors.New("top_p must be between 0 and 1")
+	}
+	
+	if req.FrequencyPenalty != nil && (*req.FrequencyPenalty < -2 || *req.FrequencyPenalty > 2) {
+		return errors.New("frequency_penalty must be between -2 and 2")
+	}
+	
+	if req.PresencePenalty != nil && (*req.PresencePenalty < -2 || *req.PresencePenalty > 2) {
+		return errors.New("presence_penalty must be between -2 and 2")
+	}
+	
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		return errors.New("max_tokens must be at least 1")
+	}
+	
+	if err := checkTokenCeiling(req.MaxTokens, req.N); err != nil {
+		return err
+	}
+	
+	switch req.Extract {
+	case "", models.ExtractCode, models.ExtractJSON:
+	default:
+		return fmt.Errorf("invalid extract: %s", req.Extract)
+	}
+	
+	switch req.OnOverflow {
+	case "", models.OverflowReject, models.OverflowTruncateHead, models.OverflowTruncateTail:
+	default:
+		return fmt.Errorf("invalid on_overflow: %s", req.OnOverflow)
+	}
+	
+	if req.Hedge && req.NoFallback {
+		return errors.New("hedge cannot be combined with no_fallback")
+	}
+	
+	if err := validateImages(req.Images); err != nil {
+		return err
+	}
+	
+	if err := validateTools(req.Tools, req.ToolChoice); err != nil {
+		return err
+	}
+	
+	return validateCapabilities(req)
+}
+
+func validateCapabilities(req models.QueryRequest) error {
+	if req.Model == "" {
+		return nil
+	}
+	
+	version := llm.ValidateModelVersion(req.Model, req.ModelVersion)
+	capabilities := llm.ModelCapabilities(req.Model, version)
+	
+	if len(req.Tools) > 0 && !capabilities.SupportsTools {
+		return fmt.Errorf("%w: %s/%s", myerrors.ErrToolsUnsupported, req.Model, version)
+	}
+	
+	if len(req.Images) > 0 && !capabilities.SupportsVision {
+		return fmt.Errorf("%w: %s/%s", myerrors.ErrImagesUnsupported, req.Model, version)
+	}
+	
+	return nil
+}
+
+func validateImages(images []string) error {
+	totalSize := 0
+	for i, image := range images {
+		if err := llm.ValidateImage(image); err != nil {
+			return fmt.Errorf("invalid image %d: %v", i, err)
 		}
+		totalSize += len(image)
+	}
+	
+	if totalSize > maxRequestBodySize {
+		return fmt.Errorf("images exceed maximum payload size of %d bytes", maxRequestBodySize)
 	}
 	
 	return nil
 }
 
+func validateTools(tools []models.ToolDefinition, toolChoice string) error {
+	names := make(map[string]bool)
+	for _, tool := range tools {
+		if tool.Name == "" {
+			return errors.New("tool name cannot be empty")
+		}
+		if names[tool.Name] {
+			return fmt.Errorf("duplicate tool name: %s", tool.Name)
+		}
+		if len(tool.Parameters) > 0 && !json.Valid(tool.Parameters) {
+			return fmt.Errorf("invalid parameters for tool: %s", tool.Name)
+		}
+		names[tool.Name] = true
+	}
+	
+	switch toolChoice {
+	case "":
+		return nil
+	case models.ToolChoiceAuto, models.ToolChoiceNone, models.ToolChoiceRequired:
+		if len(tools) == 0 {
+			return errors.New("tool_choice requires tools")
+		}
+		return nil
+	}
+	
+	if !names[toolChoice] {
+		return fmt.Errorf("invalid tool_choice: %s", toolChoice)
+	}
+	
+	return nil
+}
+
+func resolveModelAlias(req models.QueryRequest) models.QueryRequest {
+	if req.Model == "" {
+		return req
+	}
+	
+	alias, found := config.GetConfig().ModelAliases[strings.ToLower(string(req.Model))]
+	if !found {
+		return req
+	}
+	
+	logrus.WithFields(logrus.Fields{
+		"alias":         string(req.Model),
+		"model":         string(alias.Model),
+		"model_version": alias.ModelVersion,
+	}).Debug("Resolved model alias")
+	
+	req.Model = alias.Model
+	if req.ModelVersion == "" {
+		req.ModelVersion = alias.ModelVersion
+	}
+	
+	return req
+}
+
+type sanitizeRules struct {
+	stripControlChars  bool
+	normalizeUnicode   bool
+	collapseWhitespace bool
+}
+
+var (
+	repeatedSpaces     = regexp.MustCompile(`[^\S\n]+`)
+	repeatedBlankLines = regexp.MustCompile(`\n(\s*\n){2,}`)
+)
+
+func configuredSanitizeRules() sanitizeRules {
+	cfg := config.GetConfig()
+	return sanitizeRules{
+		stripControlChars:  cfg.SanitizeControlChars,
+		normalizeUnicode:   cfg.SanitizeNormalizeUnicode,
+		collapseWhitespace: cfg.SanitizeCollapseWhitespace,
+	}
+}
+
+// normalizeQueryRequest runs the steps every entry point applies before a query reaches the cache
+// or a provider: model aliases, sanitizing, the tenant, validation and the tenant's prompt wrapper.
+// The cache key endpoint uses it too, so its keys match the entries queries store.
+func normalizeQueryRequest(req models.QueryRequest, tenant string) (models.QueryRequest, *queryError) {
+	req = resolveModelAlias(req)
+	req.Query = sanitizeQuery(req.Query)
+	req.Tenant = tenant
+	
+	if err := validateQueryRequest(req); err != nil {
+		qErr := &queryError{Message: err.Error(), StatusCode: http.StatusBadRequest, Code: myerrors.CodeInvalidRequest}
+		switch {
+		case errors.Is(err, myerrors.ErrModelNotAllowed):
+			qErr.StatusCode, qErr.Code, qErr.Model = http.StatusForbidden, myerrors.CodeModelNotAllowed, string(req.Model)
+		case errors.Is(err, myerrors.ErrToolsUnsupported) || errors.Is(err, myerrors.ErrImagesUnsupported):
+			qErr.Code, qErr.Model = myerrors.ErrorCode(err), string(req.Model)
+		}
+		return req, qErr
+	}
+	
+	req.Query = wrapPrompt(req.Query, req.Tenant)
+	return req, nil
+}
+
+func wrapPrompt(query string, tenant string) string {
+	wrapper := config.GetConfig().PromptWrapper(tenant)
+	
+	parts := make([]string, 0, 3)
+	for _, part := range []string{wrapper.Prefix, query, wrapper.Suffix} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// splitPrompt recovers the tenant wrapper around a query built by wrapPrompt, so truncation
+// can cut the caller's text without touching the tenant's prefix or suffix.
+func splitPrompt(query string, tenant string) (string, string, string) {
+	wrapper := config.GetConfig().PromptWrapper(tenant)
+	
+	var prefix, suffix string
+	if wrapper.Prefix != "" {
+		if rest, ok := strings.CutPrefix(query, wrapper.Prefix+"\n\n"); ok {
+			prefix, query = wrapper.Prefix+"\n\n", rest
+		}
+	}
+	if wrapper.Suffix != "" {
+		if rest, ok := strings.CutSuffix(query, "\n\n"+wrapper.Suffix); ok {
+			suffix, query = "\n\n"+wrapper.Suffix, rest
+		}
+	}
+	return prefix, query, suffix
+}
+
 func sanitizeQuery(query string) string {
+	return sanitizeQueryWithRules(query, configuredSanitizeRules())
+}
+
+func sanitizeQueryWithRules(query string, rules sanitizeRules) string {
+	if rules.normalizeUnicode {
+		query = norm.NFC.String(query)
+	}
+	
+	if rules.stripControlChars {
+		query = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && r != '\n' && r != '\t' {
+				return -1
+			}
+			return r
+		}, query)
+	}
+	
+	if rules.collapseWhitespace {
+		query = repeatedBlankLines.ReplaceAllString(query, "\n\n")
+		query = repeatedSpaces.ReplaceAllString(query, " ")
+	}
+	
 	sanitized := strings.TrimSpace(query)
 	return sanitized
 }
@@ -183,13 +728,20 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
 	if !h.rateLimiter.AllowClient(clientIP) {
 		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
 		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
 	
+	tenant, err := getTenant(r)
+	if err != nil {
+		handleTenantError(w, err)
+		return
+	}
+	
 	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
 	
-	requestID := uuid.New().String()
+	requestID := requestIDFor(w, r)
 	
 	var req models.QueryRequest
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -202,17 +754,123 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if err := json.Unmarshal(bodyBytes, &req); err != nil {
-		handleError(w, "Invalid JSON in request body", http.StatusBadRequest)
+	if err := decodeRequestBody(bodyBytes, &req); err != nil {
+		handleDecodeError(w, err)
 		return
 	}
 	
-	if err := validateQueryRequest(req); err != nil {
-		handleError(w, err.Error(), http.StatusBadRequest)
+	req, qErr := normalizeQueryRequest(req, tenant)
+	if qErr != nil {
+		writeQueryError(w, qErr)
 		return
 	}
+	req.Priority = requestPriority(r, req.Tenant)
 	
-	req.Query = sanitizeQuery(req.Query)
+	if req.CallbackURL != "" || isAsyncRequest(r) {
+		h.submitJob(w, req, requestID)
+		return
+	}
+	
+	var idempotencyStoreKey, fingerprint string
+	if idempotencyKey := r.Header.Get(idempotencyKeyHeader); idempotencyKey != "" {
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			handleError(w, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength), http.StatusBadRequest)
+			return
+		}
+		
+		idempotencyStoreKey = req.Tenant + ":" + idempotencyKey
+		fingerprint = cache.Key(req)
+		if record, reserved := h.idempotency.begin(idempotencyStoreKey, fingerprint); !reserved {
+			writeIdempotentReplay(w, record, fingerprint)
+			return
+		}
+	}
+	
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout())
+	defer cancel()
+	
+	resp, qErr := h.processAndCapture(ctx, req, requestID)
+	if qErr != nil {
+		if idempotencyStoreKey != "" {
+			h.idempotency.release(idempotencyStoreKey)
+		}
+		if qErr.Code == myerrors.CodeTimeout {
+			h.setTimeoutHeaders(w)
+		}
+		writeQueryError(w, qErr)
+		return
+	}
+	
+	if idempotencyStoreKey != "" {
+		h.idempotency.complete(idempotencyStoreKey, fingerprint, resp)
+	}
+	
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func writeIdempotentReplay(w http.ResponseWriter, record idempotencyRecord, fingerprint string) {
+	switch {
+	case record.fingerprint != fingerprint:
+		handleErrorWithCode(w, fmt.Sprintf("%s was already used for a different request", idempotencyKeyHeader), http.StatusUnprocessableEntity, myerrors.CodeIdempotencyKeyReused, "")
+	case !record.done:
+		w.Header().Set("Retry-After", "1")
+		handleErrorWithCode(w, fmt.Sprintf("A request with this %s is still in progress", idempotencyKeyHeader), http.StatusConflict, myerrors.CodeIdempotencyKeyInProgress, "")
+	default:
+		w.Header().Set(idempotencyReplayedHeader, "true")
+		sendJSONResponse(w, record.resp, http.StatusOK)
+	}
+}
+
+type queryError struct {
+	Message    string
+	StatusCode int
+	Code       string
+	Model      string
+	RetryAfter int
+	ProviderStatus  int
+	ProviderMessage string
+}
+
+func (e *queryError) Error() string {
+	return e.Message
+}
+
+func (e *queryError) detail() models.ErrorDetail {
+	return models.ErrorDetail{
+		Message:         e.Message,
+		Code:            e.Code,
+		Model:           e.Model,
+		ProviderStatus:  e.ProviderStatus,
+		ProviderMessage: e.ProviderMessage,
+	}
+}
+
+func writeQueryError(w http.ResponseWriter, qErr *queryError) {
+	if qErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(qErr.RetryAfter))
+	}
+	writeErrorDetail(w, qErr.detail(), qErr.StatusCode)
+}
+
+func (h *Handler) setTimeoutHeaders(w http.ResponseWriter) {
+	w.Header().Set(proxyTimeoutHeader, strconv.FormatInt(h.timeout().Milliseconds(), 10))
+	w.Header().Set("Retry-After", strconv.Itoa(timeoutRetryAfter))
+}
+
+func providerMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	
+	message := []rune(err.Error())
+	if len(message) > maxProviderMessageLength {
+		return string(message[:maxProviderMessageLength]) + "..."
+	}
+	return string(message)
+}
+
+func (h *Handler) processQuery(ctx context.Context, req models.QueryRequest, requestID string) (models.QueryResponse, *queryError) {
+	requestStart := time.Now()
 	
 	logging.LogRequest(logging.LogFields{
 		Model:      string(req.Model),
@@ -230,14 +888,93 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 			Timestamp:  time.Now(),
 		})
 		
-		sendJSONResponse(w, cachedResp, http.StatusOK)
-		return
+		cachedResp.RequestID = requestID
+		cachedResp.Timings = &models.Timings{
+			TotalMs:    time.Since(requestStart).Milliseconds(),
+			OverheadMs: time.Since(requestStart).Milliseconds(),
+		}
+		
+		return cachedResp, nil
 	}
 	
-	ctx, cancel := context.WithTimeout(r.Context(), defaultTimeout)
-	defer cancel()
+	key := cache.Key(req)
+	flight, leader := h.flights.join(key)
+	if !leader {
+		monitoring.GetMetrics().RecordCoalescedRequest()
+		monitoring.RecordCoalescedRequest()
+		
+		logrus.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"cache_key":  key,
+		}).Debug("Attached to in-flight request")
+		
+		select {
+		case <-flight.done:
+			if flight.err == nil {
+				resp := flight.resp
+				resp.RequestID = requestID
+				resp.Timings = &models.Timings{
+					TotalMs:    time.Since(requestStart).Milliseconds(),
+					OverheadMs: time.Since(requestStart).Milliseconds(),
+				}
+				return resp, nil
+			}
+			
+			if !flight.err.canceled() {
+				return models.QueryResponse{}, flight.err
+			}
+		case <-ctx.Done():
+		}
+		
+		return h.queryUpstream(ctx, req, requestID, requestStart)
+	}
 	
+	if cachedResp, found := h.cache.Get(req); found {
+		monitoring.GetMetrics().RecordStampedePrevented()
+		monitoring.RecordStampedePrevented()
+		h.flights.finish(key, flight, cachedResp, nil)
+		
+		cachedResp.RequestID = requestID
+		cachedResp.Timings = &models.Timings{
+			TotalMs:    time.Since(requestStart).Milliseconds(),
+			OverheadMs: time.Since(requestStart).Milliseconds(),
+		}
+		
+		return cachedResp, nil
+	}
+	
+	resp, qerr := h.queryUpstream(ctx, req, requestID, requestStart)
+	h.flights.finish(key, flight, resp, qerr)
+	
+	return resp, qerr
+}
+
+func (h *Handler) queryUpstream(ctx context.Context, req models.QueryRequest, requestID string, requestStart time.Time) (resp models.QueryResponse, qErr *queryError) {
 	startTime := time.Now()
+	timings := &models.Timings{}
+	defer func() {
+		if qErr == nil {
+			reportSlowRequest(resp, nil)
+			return
+		}
+		timings.TotalMs = time.Since(requestStart).Milliseconds()
+		reportSlowRequest(models.QueryResponse{Model: models.ModelType(qErr.Model), RequestID: requestID, Timings: timings}, qErr)
+	}()
+	recorder := retry.NewRecorder()
+	ctx = retry.WithRecorder(ctx, recorder)
+	ctx = llm.WithRequestID(ctx, requestID)
+	
+	release, err := h.admission.acquire(ctx, req.Priority)
+	if errors.Is(err, errRequestShed) {
+		logrus.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"priority":   req.Priority,
+		}).Warn("Query shed, priority queue full")
+		return models.QueryResponse{}, &queryError{Message: "Server is overloaded. Please try again later.", StatusCode: http.StatusTooManyRequests, Code: myerrors.CodeRateLimit, RetryAfter: overloadedRetryAfter}
+	}
+	if err == nil {
+		defer release()
+	}
 	
 	select {
 	case <-ctx.Done():
@@ -249,8 +986,7 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 				RequestID:  requestID,
 				Timestamp:  time.Now(),
 			})
-			handleError(w, "Request was canceled by client", 499) // Client Closed Request
-			return
+			return models.QueryResponse{}, &queryError{Message: "Request was canceled by client", StatusCode: 499, Code: myerrors.CodeCanceled} // Client Closed Request
 		} else if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			logging.LogResponse(logging.LogFields{
 				Model:      "",
@@ -259,13 +995,14 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 				RequestID:  requestID,
 				Timestamp:  time.Now(),
 			})
-			handleError(w, "Request timed out", http.StatusRequestTimeout)
-			return
+			return models.QueryResponse{}, proxyError(myerrors.CodeTimeout, "")
 		}
 	default:
 	}
 	
-	modelType, err := h.router.RouteRequest(ctx, req)
+	routingStart := time.Now()
+	modelType, detectedLanguage, err := h.router.RouteRequest(ctx, req)
+	timings.RoutingMs = time.Since(routingStart).Milliseconds()
 	if err != nil {
 		logging.LogResponse(logging.LogFields{
 			Error:      err.Error(),
@@ -274,8 +1011,41 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 			Timestamp:  time.Now(),
 		})
 		
-		handleError(w, "No LLM providers available", http.StatusServiceUnavailable)
-		return
+		if errors.Is(err, myerrors.ErrModelNotAllowed) {
+			return models.QueryResponse{}, &queryError{Message: err.Error(), StatusCode: http.StatusForbidden, Code: myerrors.CodeModelNotAllowed, Model: string(req.Model)}
+		}
+		if errors.Is(err, myerrors.ErrToolsUnsupported) || errors.Is(err, myerrors.ErrImagesUnsupported) {
+			return models.QueryResponse{}, &queryError{Message: err.Error(), StatusCode: http.StatusBadRequest, Code: myerrors.ErrorCode(err)}
+		}
+		
+		return models.QueryResponse{}, proxyError(myerrors.CodeUnavailable, "")
+	}
+	
+	baseReq := req // The caller's request, before any per-model clamping or truncation
+	req, clamped, truncated, err := requestFor(modelType, baseReq)
+	if err != nil {
+		logging.LogResponse(logging.LogFields{
+			Model:      string(modelType),
+			Error:      err.Error(),
+			ErrorType:  "context_window_exceeded",
+			RequestID:  requestID,
+			Timestamp:  time.Now(),
+		})
+		
+		return models.QueryResponse{}, contextWindowError(modelType, err)
+	}
+	if clamped != "" {
+		logrus.WithFields(logrus.Fields{
+			"model":      string(modelType),
+			"request_id": requestID,
+		}).Info(clamped)
+	}
+	if truncated {
+		logrus.WithFields(logrus.Fields{
+			"model":       string(modelType),
+			"on_overflow": req.OnOverflow,
+			"request_id":  requestID,
+		}).Info("Query truncated to fit the context window")
 	}
 	
 	client, err := llm.Factory(modelType)
@@ -287,14 +1057,35 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 			Timestamp:  time.Now(),
 		})
 		
-		handleError(w, "Error creating LLM client", http.StatusInternalServerError)
-		return
+		return models.QueryResponse{}, &queryError{Message: "Error creating LLM client", StatusCode: http.StatusInternalServerError, Code: myerrors.CodeInternal, Model: string(modelType)}
 	}
 	
-	result, err := client.Query(ctx, req.Query, req.ModelVersion)
+	client = &timedClient{Client: h.limitClient(client, req.Tenant), timings: timings, recorder: recorder}
+	
+	opts := queryOptions(req)
+	var result *llm.QueryResult
+	var hedgeModel models.ModelType
+	if req.Hedge && config.GetConfig().HedgeDelayMs > 0 {
+		var winner hedgeAttempt
+		winner, hedgeModel = h.hedgedQuery(ctx, hedgeAttempt{model: modelType, client: client, req: req, clamped: clamped, truncated: truncated, timings: timings}, baseReq, requestID)
+		modelType, client, result, err = winner.model, winner.client, winner.result, winner.err
+		req, clamped, truncated = winner.req, winner.clamped, winner.truncated
+		opts = queryOptions(req)
+	} else {
+		result, err = client.Query(ctx, req.Query, req.ModelVersion, opts)
+	}
+	fallbackChain := []models.ModelType{modelType}
+	if err != nil && hedgeModel != "" {
+		fallbackChain = append(fallbackChain, hedgeModel)
+	}
 	
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, myerrors.ErrTimeout) {
+			h.router.RecordTimeout(modelType)
+		}
+		
 		if errors.Is(err, context.Canceled) {
+			monitoring.RecordRequestAborted(string(modelType))
 			logging.LogResponse(logging.LogFields{
 				Model:      string(modelType),
 				Error:      "request canceled by client",
@@ -302,8 +1093,7 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 				RequestID:  requestID,
 				Timestamp:  time.Now(),
 			})
-			handleError(w, "Request was canceled by client", 499) // Client Closed Request
-			return
+			return models.QueryResponse{}, &queryError{Message: "Request was canceled by client", StatusCode: 499, Code: myerrors.CodeCanceled, Model: string(modelType)} // Client Closed Request
 		} else if errors.Is(err, context.DeadlineExceeded) {
 			logging.LogResponse(logging.LogFields{
 				Model:      string(modelType),
@@ -312,35 +1102,64 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 				RequestID:  requestID,
 				Timestamp:  time.Now(),
 			})
-			handleError(w, "Request timed out", http.StatusRequestTimeout)
-			return
+			return models.QueryResponse{}, proxyError(myerrors.CodeTimeout, modelType)
 		}
 		
-		var modelErr *myerrors.ModelError
-		if errors.As(err, &modelErr) && modelErr.Retryable {
+		originalModel := modelType
+		for !req.NoFallback && ctx.Err() == nil {
+			var modelErr *myerrors.ModelError
+			if !errors.As(err, &modelErr) || !modelErr.Retryable {
+				break
+			}
+			
 			logrus.WithFields(logrus.Fields{
 				"model":      string(modelType),
 				"error":      err.Error(),
 				"request_id": requestID,
-			}).Warn("Initial model query failed, attempting fallback")
+			}).Warn("Model query failed, attempting fallback")
+			
+			fallbackModel, fallbackErr := h.router.FallbackOnError(ctx, modelType, req, err, fallbackChain...)
+			if fallbackErr != nil || containsModel(fallbackChain, fallbackModel) {
+				break
+			}
+			fallbackChain = append(fallbackChain, fallbackModel)
 			
-			fallbackModel, fallbackErr := h.router.FallbackOnError(ctx, modelType, req, err)
+			fallbackReq, fallbackClamped, fallbackTruncated, fitErr := requestFor(fallbackModel, baseReq)
+			if fitErr != nil {
+				logrus.WithFields(logrus.Fields{
+					"model":      string(fallbackModel),
+					"error":      fitErr.Error(),
+					"request_id": requestID,
+				}).Debug("Query does not fit the fallback model, skipping it")
+				continue
+			}
 			
-			if fallbackErr == nil {
-				fallbackClient, clientErr := llm.Factory(fallbackModel)
-				if clientErr == nil {
-					result, err = fallbackClient.Query(ctx, req.Query, req.ModelVersion)
-					
-					if err == nil {
-						logrus.WithFields(logrus.Fields{
-							"original_model": string(modelType),
-							"fallback_model": string(fallbackModel),
-							"request_id":     requestID,
-						}).Info("Fallback to alternative model successful")
-						
-						modelType = fallbackModel
-					}
-				}
+			fallbackClient, clientErr := llm.Factory(fallbackModel)
+			if clientErr != nil {
+				continue
+			}
+			fallbackClient = &timedClient{Client: h.limitClient(fallbackClient, req.Tenant), timings: timings, recorder: recorder}
+			
+			modelType = fallbackModel
+			client = fallbackClient
+			req, clamped, truncated = fallbackReq, fallbackClamped, fallbackTruncated
+			if clamped != "" {
+				logrus.WithFields(logrus.Fields{
+					"model":      string(fallbackModel),
+					"request_id": requestID,
+				}).Info(clamped)
+			}
+			opts = queryOptions(req)
+			result, err = fallbackClient.Query(ctx, req.Query, req.ModelVersion, opts)
+			
+			if err == nil {
+				logrus.WithFields(logrus.Fields{
+					"original_model": string(originalModel),
+					"fallback_model": string(fallbackModel),
+					"request_id":     requestID,
+				}).Info("Fallback to alternative model successful")
+			} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, myerrors.ErrTimeout) {
+				h.router.RecordTimeout(fallbackModel)
 			}
 		}
 		
@@ -353,56 +1172,127 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 				Timestamp:  time.Now(),
 			})
 			
+			if len(fallbackChain) > 1 {
+				logrus.WithFields(logrus.Fields{
+					"fallback_chain": fallbackChain,
+					"request_id":     requestID,
+				}).Warn("All fallback models failed")
+			}
+			
 			errorMsg := "Error querying LLM"
 			statusCode := http.StatusInternalServerError
+			errorCode := myerrors.ErrorCode(err)
+			retryAfter := 0
+			providerStatus := 0
+			providerMsg := ""
 			
 			var modelErr *myerrors.ModelError
 			if errors.As(err, &modelErr) {
 				if strings.Contains(err.Error(), "fallback") {
-					errorMsg = "All available models failed to process your request."
-					statusCode = http.StatusInternalServerError
-				} else {
-					switch {
-					case errors.Is(modelErr.Err, myerrors.ErrTimeout):
-						errorMsg = "Request timed out. Please try again later."
-						statusCode = http.StatusRequestTimeout
-					case errors.Is(modelErr.Err, myerrors.ErrRateLimit):
-						errorMsg = "Rate limit exceeded. Please try again later."
-						statusCode = http.StatusInternalServerError // Changed from 429 to 500
-					case errors.Is(modelErr.Err, myerrors.ErrAPIKeyMissing):
-						errorMsg = "API key not configured for this model."
-						statusCode = http.StatusUnauthorized
-					case errors.Is(modelErr.Err, myerrors.ErrUnavailable):
-						errorMsg = "Service is currently unavailable. Please try again later."
-						statusCode = http.StatusServiceUnavailable
-					default:
-						errorMsg = "Error processing your request: " + modelErr.Error()
-					}
+					errorCode = myerrors.CodeAllModelsFailed
+				}
+				
+				mapping := errorStatusFor(errorCode)
+				statusCode = mapping.Status
+				
+				detail := modelErr.Err.Error()
+				if _, known := defaultErrorStatuses[errorCode]; !known {
+					detail = modelErr.Error()
+					providerStatus = modelErr.Code
+					providerMsg = providerMessage(modelErr.Err)
+				}
+				errorMsg = errorMessage(mapping.Message, string(modelType), req.ModelVersion, detail)
+				
+				if errorCode == myerrors.CodeRateLimit {
+					retryAfter = rateLimitRetryAfter
 				}
 			}
 			
-			handleError(w, errorMsg, statusCode)
-			return
+			return models.QueryResponse{}, &queryError{
+				Message:    errorMsg,
+				StatusCode: statusCode,
+				Code:       errorCode,
+				Model:      string(modelType),
+				RetryAfter: retryAfter,
+				ProviderStatus:  providerStatus,
+				ProviderMessage: providerMsg,
+			}
+		}
+	}
+	
+	continuations := 0
+	if req.AutoContinue {
+		result, continuations = continueTruncated(ctx, client, req, result, requestID)
+	}
+	
+	monitoring.RecordTokenLengths(string(modelType), result.InputTokens, result.OutputTokens)
+	costUSD := h.recordCost(modelType, result.ModelVersion, result.InputTokens, result.OutputTokens)
+	h.usage.record(req.Tenant, modelType, result.InputTokens, result.OutputTokens, costUSD)
+	
+	response, err := extractResponse(result.Response, req.Extract)
+	if err != nil {
+		logging.LogResponse(logging.LogFields{
+			Model:      string(modelType),
+			Error:      err.Error(),
+			ErrorType:  "extraction_error",
+			RequestID:  requestID,
+			Timestamp:  time.Now(),
+		})
+		
+		return models.QueryResponse{}, &queryError{Message: err.Error(), StatusCode: http.StatusUnprocessableEntity, Code: myerrors.CodeExtractionFailed, Model: string(modelType)}
+	}
+	
+	candidates := result.Candidates
+	if req.Extract != "" && len(candidates) > 0 {
+		candidates = make([]string, len(result.Candidates))
+		for i, candidate := range result.Candidates {
+			if candidates[i], err = extractResponse(candidate, req.Extract); err != nil {
+				return models.QueryResponse{}, &queryError{Message: fmt.Sprintf("candidate %d: %v", i, err), StatusCode: http.StatusUnprocessableEntity, Code: myerrors.CodeExtractionFailed, Model: string(modelType)}
+			}
 		}
 	}
 	
 	elapsedTime := time.Since(startTime).Milliseconds()
 	
-	resp := models.QueryResponse{
-		Response:     result.Response,
-		Model:        modelType,
-		ResponseTime: elapsedTime,
-		Timestamp:    time.Now(),
-		Cached:       false,
-		RequestID:    requestID,
-		InputTokens:  result.InputTokens,
-		OutputTokens: result.OutputTokens,
-		TotalTokens:  result.TotalTokens,
-		NumTokens:    result.NumTokens, // For backward compatibility
-		NumRetries:   result.NumRetries,
+	timings.TotalMs = time.Since(requestStart).Milliseconds()
+	timings.OverheadMs = timings.TotalMs - timings.RoutingMs - timings.ProviderMs
+	if timings.OverheadMs < 0 {
+		timings.OverheadMs = 0
+	}
+	
+	resp = models.QueryResponse{
+		Response:      response,
+		Model:         modelType,
+		ModelVersion:  result.ModelVersion,
+		ResponseTime:  elapsedTime,
+		Timestamp:     time.Now(),
+		Cached:        false,
+		RequestID:     requestID,
+		InputTokens:   result.InputTokens,
+		OutputTokens:  result.OutputTokens,
+		TotalTokens:   result.TotalTokens,
+		NumTokens:     result.NumTokens, // For backward compatibility
+		CacheReadTokens:  result.CacheReadTokens,
+		CacheWriteTokens: result.CacheWriteTokens,
+		NumRetries:    result.NumRetries,
+		FinishReason:  result.FinishReason,
+		ProviderRequestID: result.ProviderRequestID,
+		Continuations: continuations,
+		Truncated:     truncated,
+		Clamped:       clamped,
+		HedgeModel:    hedgeModel,
+		DetectedLanguage: detectedLanguage,
+		ToolCalls:     result.ToolCalls,
+		Candidates:    candidates,
+		Timings:       timings,
 	}
 	
-	h.cache.Set(req, resp)
+	if len(fallbackChain) > 1 {
+		resp.OriginalModel = fallbackChain[0]
+		resp.FallbackChain = fallbackChain
+	}
+	
+	h.cache.Set(baseReq, resp)
 	
 	logging.LogResponse(logging.LogFields{
 		Model:        string(modelType),
@@ -412,10 +1302,208 @@ func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 		NumTokens:    result.NumTokens,
 		NumRetries:   result.NumRetries,
 		RequestID:    requestID,
+		ProviderRequestID: result.ProviderRequestID,
 		Timestamp:    time.Now(),
 	})
 	
-	sendJSONResponse(w, resp, http.StatusOK)
+	return resp, nil
+}
+
+// requestIDFor returns the ID RequestLoggerMiddleware stored for the request, minting one when it did not run.
+func requestIDFor(w http.ResponseWriter, r *http.Request) string {
+	requestID := llm.RequestIDFromContext(r.Context())
+	if requestID == "" {
+		requestID = uuid.New().String()
+		w.Header().Set("X-Request-ID", requestID)
+	}
+	return requestID
+}
+
+// checkTokenCeiling bounds max_tokens across every completion one request can produce.
+func checkTokenCeiling(maxTokens *int, completions int) error {
+	limit := config.GetConfig().MaxTokensPerRequest
+	if limit <= 0 || maxTokens == nil {
+		return nil
+	}
+	if completions < 1 {
+		completions = 1
+	}
+	if total := *maxTokens * completions; total > limit {
+		return fmt.Errorf("max_tokens of %d across %d completions exceeds the per-request limit of %d tokens", *maxTokens, completions, limit)
+	}
+	return nil
+}
+
+func checkFanout(calls int) error {
+	limit := config.GetConfig().MaxFanout
+	if limit > 0 && calls > limit {
+		return fmt.Errorf("Request needs %d provider calls, maximum is %d", calls, limit)
+	}
+	return nil
+}
+
+func containsModel(modelTypes []models.ModelType, model models.ModelType) bool {
+	for _, modelType := range modelTypes {
+		if modelType == model {
+			return true
+		}
+	}
+	return false
+}
+
+// requestFor adapts the caller's request to modelType, clamping its temperature and fitting its
+// query to the context window, so each fallback or hedge target gets its own limits applied. A
+// model_version only applies to the model the caller named; other targets use their default.
+func requestFor(modelType models.ModelType, base models.QueryRequest) (models.QueryRequest, string, bool, error) {
+	if modelType != base.Model {
+		base.ModelVersion = ""
+	}
+	
+	req, clamped := clampTemperature(modelType, base)
+	req, truncated, err := fitContextWindow(modelType, req)
+	if err != nil {
+		return base, "", false, err
+	}
+	return req, clamped, truncated, nil
+}
+
+// fitContextWindow applies the request's on_overflow policy for modelType and checks that the
+// result fits its context window. base is the request before any model-specific truncation, so
+// every fallback or hedge target is fitted against the caller's full query.
+func fitContextWindow(modelType models.ModelType, base models.QueryRequest) (models.QueryRequest, bool, error) {
+	req := base
+	truncated := false
+	if req.OnOverflow == models.OverflowTruncateHead || req.OnOverflow == models.OverflowTruncateTail {
+		prefix, query, suffix := splitPrompt(req.Query, req.Tenant)
+		
+		var err error
+		query, truncated, err = llm.TruncateToContextWindow(modelType, req.ModelVersion, req.CachePrefix+prefix, query, suffix, queryOptions(req), req.OnOverflow == models.OverflowTruncateHead)
+		if err != nil {
+			return base, false, err
+		}
+		req.Query = prefix + query + suffix
+	}
+	
+	if err := llm.CheckContextWindow(modelType, req.ModelVersion, req.CachePrefix+req.Query); err != nil {
+		return base, false, err
+	}
+	return req, truncated, nil
+}
+
+func contextWindowError(modelType models.ModelType, err error) *queryError {
+	errorMsg := "Query is too long for " + string(modelType)
+	var modelErr *myerrors.ModelError
+	if errors.As(err, &modelErr) {
+		errorMsg += ": " + modelErr.Err.Error()
+	}
+	
+	return &queryError{Message: errorMsg, StatusCode: http.StatusBadRequest, Code: myerrors.CodeContextWindowExceeded, Model: string(modelType)}
+}
+
+func clampTemperature(modelType models.ModelType, req models.QueryRequest) (models.QueryRequest, string) {
+	maxTemperature := config.GetConfig().ModelDefaults[modelType].MaxTemperature
+	if req.Temperature == nil || maxTemperature == nil || *req.Temperature <= *maxTemperature {
+		return req, ""
+	}
+	
+	note := fmt.Sprintf("temperature %g clamped to %g for %s", *req.Temperature, *maxTemperature, modelType)
+	temperature := *maxTemperature
+	req.Temperature = &temperature
+	return req, note
+}
+
+func queryOptions(req models.QueryRequest) llm.QueryOptions {
+	return llm.QueryOptions{
+		Stop:       req.Stop,
+		Tools:      req.Tools,
+		ToolChoice: req.ToolChoice,
+		Images:     req.Images,
+		N:          req.N,
+		Seed:       req.Seed,
+		TopP:             req.TopP,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		Temperature:      req.Temperature,
+		MaxTokens:        req.MaxTokens,
+		CachePrefix:      req.CachePrefix,
+	}
+}
+
+type timedClient struct {
+	llm.Client
+	timings  *models.Timings
+	recorder *retry.Recorder
+}
+
+func (c *timedClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
+	start := time.Now()
+	first := c.recorder.Len()
+	
+	result, err := c.Client.Query(ctx, query, modelVersion, opts)
+	
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+		var modelErr *myerrors.ModelError
+		if errors.As(err, &modelErr) && modelErr.Code >= http.StatusBadRequest {
+			status = modelErr.Code
+		}
+	}
+	monitoring.GetMetrics().RecordRequest(string(c.GetModelType()), status, time.Since(start))
+	
+	c.timings.ProviderMs += time.Since(start).Milliseconds()
+	for _, attempt := range c.recorder.Attempts()[first:] {
+		timing := models.AttemptTiming{
+			Model:      c.GetModelType(),
+			Attempt:    attempt.Number,
+			DurationMs: attempt.Duration.Milliseconds(),
+			BackoffMs:  attempt.Backoff.Milliseconds(),
+		}
+		if attempt.Err != nil {
+			timing.Error = attempt.Err.Error()
+		}
+		c.timings.Attempts = append(c.timings.Attempts, timing)
+	}
+	
+	return result, err
+}
+
+func continueTruncated(ctx context.Context, client llm.Client, req models.QueryRequest, result *llm.QueryResult, requestID string) (*llm.QueryResult, int) {
+	continuations := 0
+	opts := queryOptions(req)
+	opts.N = 0 // Only the first candidate is continued
+	
+	for continuations < maxAutoContinuations && llm.IsTruncated(result.FinishReason) {
+		prompt := fmt.Sprintf("%s\n\nPartial answer so far:\n%s\n\nContinue the answer exactly where it stops, without repeating any of it.", req.Query, result.Response)
+		
+		next, err := client.Query(ctx, prompt, req.ModelVersion, opts)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"model":         string(client.GetModelType()),
+				"error":         err.Error(),
+				"request_id":    requestID,
+				"continuations": continuations,
+			}).Warn("Auto-continue query failed, returning truncated response")
+			break
+		}
+		
+		continuations++
+		result.Response += next.Response
+		result.FinishReason = next.FinishReason
+		result.InputTokens += next.InputTokens
+		result.OutputTokens += next.OutputTokens
+		result.TotalTokens += next.TotalTokens
+		result.NumTokens += next.NumTokens
+		result.CacheReadTokens += next.CacheReadTokens
+		result.CacheWriteTokens += next.CacheWriteTokens
+		result.NumRetries += next.NumRetries
+	}
+	
+	if continuations > 0 && len(result.Candidates) > 0 {
+		result.Candidates[0] = result.Response
+	}
+	
+	return result, continuations
 }
 
 func (h *Handler) StatusHandler(w http.ResponseWriter, r *http.Request) {
@@ -427,11 +1515,68 @@ func (h *Handler) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
 	if !h.rateLimiter.AllowClient(clientIP) {
 		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded for status check")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
 		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
 	
-	status := h.router.GetAvailability()
+	status := h.router.GetModelAvailability()
+	
+	sendJSONResponse(w, status, http.StatusOK)
+}
+
+func (h *Handler) DetailedStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	clientIP := getClientIP(r)
+	if !h.rateLimiter.AllowClient(clientIP) {
+		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded for status check")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
+		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+	
+	availability := h.router.GetModelAvailability()
+	
+	metrics := monitoring.GetMetrics()
+	resp := models.DetailedStatusResponse{
+		Models:    make(map[models.ModelType]models.ModelHealth, len(availability)),
+		Timestamp: time.Now(),
+	}
+	
+	for model, available := range availability {
+		stats := metrics.GetModelStats(model)
+		resp.Models[models.ModelType(model)] = models.ModelHealth{
+			Available:      available,
+			RecentRequests: stats.RecentRequests,
+			ErrorRate:      stats.ErrorRate,
+			P50LatencyMs:   stats.P50LatencyMs,
+			P95LatencyMs:   stats.P95LatencyMs,
+			LastErrorTime:  stats.LastErrorTime,
+			Budget:         h.budgets.status(models.ModelType(model)),
+		}
+	}
+	
+	sendJSONResponse(w, resp, http.StatusOK)
+}
+
+func (h *Handler) RefreshAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	start := time.Now()
+	status := h.router.RefreshAvailability()
+	
+	fields := logrus.Fields{"duration_ms": time.Since(start).Milliseconds()}
+	for model, available := range status {
+		fields[model] = available
+	}
+	logrus.WithFields(fields).Info("Model availability refreshed")
 	
 	sendJSONResponse(w, status, http.StatusOK)
 }
@@ -445,6 +1590,7 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
 	if !h.rateLimiter.AllowClient(clientIP) {
 		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded for health check")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
 		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
@@ -466,6 +1612,7 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
 	if !h.rateLimiter.AllowClient(clientIP) {
 		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded for download")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
 		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
@@ -475,6 +1622,7 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Response string `json:"response"`
 		Format   string `json:"format"`
+		Render   string `json:"render"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -487,6 +1635,29 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	switch req.Render {
+	case "", export.RenderPlain, export.RenderMarkdown:
+	default:
+		handleError(w, "Unsupported render. Supported values are: plain, markdown.", http.StatusBadRequest)
+		return
+	}
+	
+	cfg := config.GetConfig()
+	if !config.IsKnownDownloadFormat(req.Format) {
+		handleError(w, "Unsupported format. Supported formats are: "+strings.Join(config.DownloadFormats, ", ")+".", http.StatusBadRequest)
+		return
+	}
+	
+	if !cfg.IsDownloadFormatEnabled(req.Format) {
+		handleError(w, fmt.Sprintf("Download format %s is disabled. Enabled formats are: %s.", req.Format, strings.Join(cfg.DownloadFormats, ", ")), http.StatusBadRequest)
+		return
+	}
+	
+	if cfg.MaxDownloadSize > 0 && len(req.Response) > cfg.MaxDownloadSize {
+		handleError(w, fmt.Sprintf("Response content exceeds the maximum download size of %d bytes", cfg.MaxDownloadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	
 	switch req.Format {
 	case "txt":
 		w.Header().Set("Content-Disposition", "attachment; filename=llm_response.txt")
@@ -494,14 +1665,34 @@ func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(req.Response))
 		
 	case "pdf":
+		content := []byte(req.Response)
+		if req.Render == export.RenderMarkdown {
+			rendered, err := export.MarkdownPDF(req.Response)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to render markdown PDF")
+				handleError(w, "Failed to render PDF", http.StatusInternalServerError)
+				return
+			}
+			content = rendered
+		}
 		w.Header().Set("Content-Disposition", "attachment; filename=llm_response.pdf")
 		w.Header().Set("Content-Type", "application/pdf")
-		w.Write([]byte(req.Response))
+		w.Write(content)
 		
 	case "docx":
+		content := []byte(req.Response)
+		if req.Render == export.RenderMarkdown {
+			rendered, err := export.MarkdownDOCX(req.Response)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to render markdown DOCX")
+				handleError(w, "Failed to render DOCX", http.StatusInternalServerError)
+				return
+			}
+			content = rendered
+		}
 		w.Header().Set("Content-Disposition", "attachment; filename=llm_response.docx")
 		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
-		w.Write([]byte(req.Response))
+		w.Write(content)
 		
 	default:
 		handleError(w, "Unsupported format. Supported formats are: txt, pdf, docx.", http.StatusBadRequest)
@@ -526,12 +1717,53 @@ func sendJSONResponse(w http.ResponseWriter, data interface{}, statusCode int) {
 	}
 }
 
+func errorCodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return myerrors.CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return myerrors.CodeUnauthorized
+	case http.StatusForbidden:
+		return myerrors.CodeForbidden
+	case http.StatusNotFound:
+		return myerrors.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return myerrors.CodeMethodNotAllowed
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return myerrors.CodeTimeout
+	case http.StatusRequestEntityTooLarge:
+		return myerrors.CodeRequestTooLarge
+	case http.StatusTooManyRequests:
+		return myerrors.CodeRateLimit
+	case 499:
+		return myerrors.CodeCanceled
+	case http.StatusServiceUnavailable:
+		return myerrors.CodeUnavailable
+	default:
+		return myerrors.CodeInternal
+	}
+}
+
 func handleError(w http.ResponseWriter, message string, statusCode int) {
-	logrus.Error(message)
+	handleErrorWithCode(w, message, statusCode, errorCodeForStatus(statusCode), "")
+}
+
+func handleErrorWithCode(w http.ResponseWriter, message string, statusCode int, code string, model string) {
+	writeErrorDetail(w, models.ErrorDetail{
+		Message: message,
+		Code:    code,
+		Model:   model,
+	}, statusCode)
+}
+
+func writeErrorDetail(w http.ResponseWriter, detail models.ErrorDetail, statusCode int) {
+	logrus.WithFields(logrus.Fields{
+		"code":            detail.Code,
+		"model":           detail.Model,
+		"provider_status": detail.ProviderStatus,
+	}).Error(detail.Message)
 	
-	errorResponse := map[string]string{
-		"error": message,
-	}
+	errorResponse := models.ErrorResponse{Error: detail}
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -546,7 +1778,7 @@ func handleError(w http.ResponseWriter, message string, statusCode int) {
 	
 	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
 		logrus.WithError(err).Error("Error encoding error response")
-		http.Error(w, message, statusCode)
+		http.Error(w, detail.Message, statusCode)
 	}
 }
 
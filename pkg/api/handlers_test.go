@@ -7,13 +7,20 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	myerrors "github.com/amorin24/llmproxy/pkg/errors"
 	"github.com/amorin24/llmproxy/pkg/llm"
 	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/amorin24/llmproxy/pkg/retry"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func mockLLMFactory(modelType models.ModelType) (llm.Client, error) {
@@ -114,6 +121,78 @@ func TestHelperFunctions(t *testing.T) {
 		}
 	})
 	
+	t.Run("validateQueryRequest invalid n", func(t *testing.T) {
+		req := models.QueryRequest{
+			Query: "test",
+			N:     maxCompletions + 1,
+		}
+		
+		err := validateQueryRequest(req)
+		if err == nil {
+			t.Errorf("Expected error for invalid n")
+		}
+	})
+	
+	t.Run("validateQueryRequest token ceiling", func(t *testing.T) {
+		cfg := config.GetConfig()
+		originalCeiling := cfg.MaxTokensPerRequest
+		defer func() { cfg.MaxTokensPerRequest = originalCeiling }()
+		cfg.MaxTokensPerRequest = 1000
+		
+		withinCeiling, overCeiling := 500, 1500
+		
+		if err := validateQueryRequest(models.QueryRequest{Query: "test", MaxTokens: &withinCeiling}); err != nil {
+			t.Errorf("Expected no error within the ceiling, got: %v", err)
+		}
+		if err := validateQueryRequest(models.QueryRequest{Query: "test", MaxTokens: &withinCeiling, N: 2}); err != nil {
+			t.Errorf("Expected no error at the ceiling, got: %v", err)
+		}
+		if err := validateQueryRequest(models.QueryRequest{Query: "test", MaxTokens: &withinCeiling, N: 3}); err == nil {
+			t.Errorf("Expected error when max_tokens x n exceeds the ceiling")
+		}
+		if err := validateQueryRequest(models.QueryRequest{Query: "test", MaxTokens: &overCeiling}); err == nil {
+			t.Errorf("Expected error when max_tokens exceeds the ceiling")
+		}
+		
+		cfg.MaxTokensPerRequest = 0
+		if err := validateQueryRequest(models.QueryRequest{Query: "test", MaxTokens: &overCeiling, N: 3}); err != nil {
+			t.Errorf("Expected no error with the ceiling disabled, got: %v", err)
+		}
+	})
+	
+	t.Run("validateQueryRequest sampling parameter ranges", func(t *testing.T) {
+		inRange, topPTooHigh, penaltyTooLow, temperatureTooHigh := 0.5, 1.5, -2.5, 2.5
+		maxTokens, zeroMaxTokens := 500, 0
+		
+		if err := validateQueryRequest(models.QueryRequest{Query: "test", TopP: &inRange, FrequencyPenalty: &inRange, PresencePenalty: &inRange, Temperature: &inRange, MaxTokens: &maxTokens}); err != nil {
+			t.Errorf("Expected no error for valid sampling parameters, got %v", err)
+		}
+		
+		for _, req := range []models.QueryRequest{
+			{Query: "test", TopP: &topPTooHigh},
+			{Query: "test", FrequencyPenalty: &penaltyTooLow},
+			{Query: "test", PresencePenalty: &penaltyTooLow},
+			{Query: "test", Temperature: &temperatureTooHigh},
+			{Query: "test", MaxTokens: &zeroMaxTokens},
+		} {
+			if err := validateQueryRequest(req); err == nil {
+				t.Errorf("Expected error for out-of-range sampling parameter in %+v", req)
+			}
+		}
+	})
+	
+	t.Run("validateQueryRequest invalid extract", func(t *testing.T) {
+		req := models.QueryRequest{
+			Query:   "test",
+			Extract: "yaml",
+		}
+		
+		err := validateQueryRequest(req)
+		if err == nil {
+			t.Errorf("Expected error for invalid extract")
+		}
+	})
+	
 	t.Run("validateQueryRequest invalid model", func(t *testing.T) {
 		req := models.QueryRequest{
 			Query:    "Test query",
@@ -159,6 +238,85 @@ func TestHelperFunctions(t *testing.T) {
 		}
 	})
 	
+	t.Run("validateImages", func(t *testing.T) {
+		png := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+		
+		if err := validateImages([]string{png, "https://example.com/cat.png"}); err != nil {
+			t.Errorf("Expected valid images, got %v", err)
+		}
+		
+		if err := validateImages([]string{"not an image!"}); err == nil {
+			t.Errorf("Expected error for invalid image")
+		}
+		
+		oversized := make([]string, maxRequestBodySize/len(png)+1)
+		for i := range oversized {
+			oversized[i] = png
+		}
+		if err := validateImages(oversized); err == nil {
+			t.Errorf("Expected error for images exceeding the payload size")
+		}
+	})
+	
+	t.Run("validateTools", func(t *testing.T) {
+		weather := models.ToolDefinition{Name: "get_weather", Parameters: json.RawMessage(`{"type":"object"}`)}
+		
+		tests := []struct {
+			name        string
+			tools       []models.ToolDefinition
+			toolChoice  string
+			expectError bool
+		}{
+			{"No tools", nil, "", false},
+			{"Valid tool", []models.ToolDefinition{weather}, "", false},
+			{"Auto choice", []models.ToolDefinition{weather}, models.ToolChoiceAuto, false},
+			{"Named choice", []models.ToolDefinition{weather}, "get_weather", false},
+			{"Unknown named choice", []models.ToolDefinition{weather}, "get_time", true},
+			{"Choice without tools", nil, models.ToolChoiceRequired, true},
+			{"Empty tool name", []models.ToolDefinition{{Name: ""}}, "", true},
+			{"Duplicate tool name", []models.ToolDefinition{weather, weather}, "", true},
+			{"Invalid parameters", []models.ToolDefinition{{Name: "bad", Parameters: json.RawMessage(`{`)}}, "", true},
+		}
+		
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				err := validateTools(test.tools, test.toolChoice)
+				if test.expectError && err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				if !test.expectError && err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+			})
+		}
+	})
+	
+	t.Run("sanitizeQueryWithRules", func(t *testing.T) {
+		all := sanitizeRules{stripControlChars: true, normalizeUnicode: true, collapseWhitespace: true}
+		
+		tests := []struct {
+			name     string
+			input    string
+			rules    sanitizeRules
+			expected string
+		}{
+			{"Trim only by default", " a\x00b  c\u0065\u0301 ", sanitizeRules{}, "a\x00b  c\u0065\u0301"},
+			{"Strip control characters", "a\x00b\x1bc\td\ne", sanitizeRules{stripControlChars: true}, "abc\td\ne"},
+			{"Normalize to NFC", "caf\u0065\u0301", sanitizeRules{normalizeUnicode: true}, "caf\u00e9"},
+			{"Collapse spaces", "a  \t b", sanitizeRules{collapseWhitespace: true}, "a b"},
+			{"Collapse blank lines", "a\n\n\n\n  \nb\n\nc", sanitizeRules{collapseWhitespace: true}, "a\n\nb\n\nc"},
+			{"Control characters only", " \x00\x07 ", all, ""},
+		}
+		
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if result := sanitizeQueryWithRules(test.input, test.rules); result != test.expected {
+					t.Errorf("Expected %q, got %q", test.expected, result)
+				}
+			})
+		}
+	})
+	
 	t.Run("getClientIP with X-Forwarded-For", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		req.Header.Set("X-Forwarded-For", "192.168.1.1, 10.0.0.1")
@@ -308,6 +466,37 @@ func TestQueryHandler(t *testing.T) {
 		if !resp.Cached {
 			t.Errorf("Expected cached=true")
 		}
+		
+		if resp.RequestID == cachedResponse.RequestID || resp.RequestID != w.Header().Get("X-Request-ID") {
+			t.Errorf("Expected this request's ID %q, got %q", w.Header().Get("X-Request-ID"), resp.RequestID)
+		}
+	})
+	
+	t.Run("Cache hit after taking the flight", func(t *testing.T) {
+		handler := NewHandler()
+		handler.router = &MockRouter{}
+		
+		lookups := 0
+		handler.cache = &MockCache{
+			getFunc: func(req models.QueryRequest) (models.QueryResponse, bool) {
+				lookups++
+				return models.QueryResponse{Response: "Cached response", Cached: true, RequestID: "test-id"}, lookups > 1
+			},
+		}
+		
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`))
+		w := httptest.NewRecorder()
+		
+		handler.QueryHandler(w, req)
+		
+		var resp models.QueryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		
+		if !resp.Cached || resp.RequestID != w.Header().Get("X-Request-ID") {
+			t.Errorf("Expected a cached response with this request's ID %q, got %q", w.Header().Get("X-Request-ID"), resp.RequestID)
+		}
 	})
 	
 	t.Run("Routing error", func(t *testing.T) {
@@ -412,8 +601,12 @@ func TestQueryHandler(t *testing.T) {
 		
 		handler.QueryHandler(w, req)
 		
-		if w.Code != http.StatusInternalServerError {
-			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+		}
+		
+		if got := w.Header().Get("Retry-After"); got != strconv.Itoa(rateLimitRetryAfter) {
+			t.Errorf("Expected Retry-After %d, got %q", rateLimitRetryAfter, got)
 		}
 	})
 	
@@ -491,6 +684,64 @@ func TestQueryHandler(t *testing.T) {
 		}
 	})
 	
+	t.Run("Client disconnect cancels upstream", func(t *testing.T) {
+		handler := NewHandler()
+		handler.cache = &MockCache{}
+		handler.router = &MockRouter{
+			routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+				return models.OpenAI, nil
+			},
+		}
+		
+		started := make(chan struct{})
+		upstreamCanceled := make(chan struct{})
+		llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+			return &MockLLMClient{
+				modelType: modelType,
+				queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+					close(started)
+					<-ctx.Done()
+					close(upstreamCanceled)
+					return nil, ctx.Err()
+				},
+			}, nil
+		}
+		
+		abortedCount := func() float64 {
+			var metric dto.Metric
+			monitoring.RequestsAborted.WithLabelValues(string(models.OpenAI)).Write(&metric)
+			return metric.GetCounter().GetValue()
+		}
+		abortedBefore := abortedCount()
+		
+		ctx, disconnect := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		
+		done := make(chan struct{})
+		go func() {
+			handler.QueryHandler(w, req)
+			close(done)
+		}()
+		
+		<-started
+		disconnect()
+		
+		select {
+		case <-upstreamCanceled:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the upstream context to be canceled after the client disconnected")
+		}
+		<-done
+		
+		if w.Code != 499 {
+			t.Errorf("Expected status 499 (Client Closed Request), got %d", w.Code)
+		}
+		if aborted := abortedCount(); aborted != abortedBefore+1 {
+			t.Errorf("Expected aborted requests to increase by 1, got %v -> %v", abortedBefore, aborted)
+		}
+	})
+	
 	t.Run("Context deadline exceeded", func(t *testing.T) {
 		handler := NewHandler()
 		handler.cache = &MockCache{}
@@ -625,6 +876,29 @@ func TestStatusHandler(t *testing.T) {
 			}
 		}
 	})
+	
+	t.Run("New providers appear without struct changes", func(t *testing.T) {
+		handler := NewHandler()
+		handler.router = &MockRouter{
+			getModelAvailabilityFunc: func() models.ModelAvailability {
+				return models.ModelAvailability{"openai": true, "bedrock": true}
+			},
+		}
+		
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		w := httptest.NewRecorder()
+		
+		handler.StatusHandler(w, req)
+		
+		var resp models.ModelAvailability
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		
+		if !resp["openai"] || !resp["bedrock"] {
+			t.Errorf("Expected every provider in the response, got %v", resp)
+		}
+	})
 }
 
 func TestHealthHandler(t *testing.T) {
@@ -768,3 +1042,1861 @@ func TestGetEnvAsInt(t *testing.T) {
 		}
 	})
 }
+
+func TestQueryHandlerAutoContinue(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+
+	newTruncatingFactory := func(calls *int) func(models.ModelType) (llm.Client, error) {
+		return func(modelType models.ModelType) (llm.Client, error) {
+			return &MockLLMClient{
+				modelType: modelType,
+				queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+					*calls++
+					if *calls == 1 {
+						return &llm.QueryResult{
+							Response:     "The first half",
+							FinishReason: "length",
+							InputTokens:  5,
+							OutputTokens: 10,
+							TotalTokens:  15,
+						}, nil
+					}
+					if !strings.Contains(query, "The first half") {
+						t.Errorf("Expected continuation prompt to include partial output, got %q", query)
+					}
+					return &llm.QueryResult{
+						Response:     " and the second half.",
+						FinishReason: "stop",
+						InputTokens:  20,
+						OutputTokens: 5,
+						TotalTokens:  25,
+					}, nil
+				},
+			}, nil
+		}
+	}
+
+	t.Run("Finish reason surfaced without auto-continue", func(t *testing.T) {
+		calls := 0
+		llm.Factory = newTruncatingFactory(&calls)
+
+		handler := NewHandler()
+		handler.cache = &MockCache{}
+		handler.router = &MockRouter{}
+
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`))
+		w := httptest.NewRecorder()
+
+		handler.QueryHandler(w, req)
+
+		var resp models.QueryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+
+		if resp.FinishReason != "length" {
+			t.Errorf("Expected finish reason 'length', got %q", resp.FinishReason)
+		}
+		if resp.Continuations != 0 || calls != 1 {
+			t.Errorf("Expected no continuation calls, got continuations=%d calls=%d", resp.Continuations, calls)
+		}
+	})
+
+	t.Run("Truncated response is continued", func(t *testing.T) {
+		calls := 0
+		llm.Factory = newTruncatingFactory(&calls)
+
+		handler := NewHandler()
+		handler.cache = &MockCache{}
+		handler.router = &MockRouter{}
+
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test","auto_continue":true}`))
+		w := httptest.NewRecorder()
+
+		handler.QueryHandler(w, req)
+
+		var resp models.QueryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+
+		if resp.Response != "The first half and the second half." {
+			t.Errorf("Expected stitched response, got %q", resp.Response)
+		}
+		if resp.FinishReason != "stop" {
+			t.Errorf("Expected final finish reason 'stop', got %q", resp.FinishReason)
+		}
+		if resp.Continuations != 1 {
+			t.Errorf("Expected 1 continuation, got %d", resp.Continuations)
+		}
+		if resp.TotalTokens != 40 {
+			t.Errorf("Expected aggregated total tokens 40, got %d", resp.TotalTokens)
+		}
+	})
+}
+
+func TestQueryHandlerErrorCodes(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	failingFactory := func(queryErr error) func(models.ModelType) (llm.Client, error) {
+		return func(modelType models.ModelType) (llm.Client, error) {
+			return &MockLLMClient{
+				modelType: modelType,
+				queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+					return nil, queryErr
+				},
+			}, nil
+		}
+	}
+	
+	noFallback := func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+		return "", errors.New("no fallback available")
+	}
+	
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		routeErr       error
+		factory        func(models.ModelType) (llm.Client, error)
+		expectedStatus int
+		expectedCode   string
+		expectedModel  string
+	}{
+		{
+			name:           "Method not allowed",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   myerrors.CodeMethodNotAllowed,
+		},
+		{
+			name:           "Invalid JSON",
+			body:           `{"query":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   myerrors.CodeInvalidJSON,
+		},
+		{
+			name:           "Empty query",
+			body:           `{"query":""}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   myerrors.CodeInvalidRequest,
+		},
+		{
+			name:           "No providers available",
+			body:           `{"query":"test"}`,
+			routeErr:       errors.New("no models available"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   myerrors.CodeUnavailable,
+		},
+		{
+			name:           "Model not allowed for tenant",
+			body:           `{"query":"test"}`,
+			routeErr:       myerrors.NewModelNotAllowedError(string(models.OpenAI)),
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   myerrors.CodeModelNotAllowed,
+		},
+		{
+			name: "Client creation failure",
+			body: `{"query":"test"}`,
+			factory: func(modelType models.ModelType) (llm.Client, error) {
+				return nil, errors.New("factory failure")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   myerrors.CodeInternal,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Provider timeout",
+			body:           `{"query":"test"}`,
+			factory:        failingFactory(myerrors.NewTimeoutError(string(models.OpenAI))),
+			expectedStatus: http.StatusRequestTimeout,
+			expectedCode:   myerrors.CodeTimeout,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Provider rate limit",
+			body:           `{"query":"test"}`,
+			factory:        failingFactory(myerrors.NewRateLimitError(string(models.OpenAI))),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedCode:   myerrors.CodeRateLimit,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Provider API key missing",
+			body:           `{"query":"test"}`,
+			factory:        failingFactory(myerrors.NewModelError(string(models.OpenAI), 401, myerrors.ErrAPIKeyMissing, false)),
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   myerrors.CodeAPIKeyMissing,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Unsupported model version",
+			body:           `{"query":"test","model_version":"gpt-4oo"}`,
+			factory:        failingFactory(myerrors.NewUnsupportedModelVersionError(string(models.OpenAI), "gpt-4oo")),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   myerrors.CodeUnsupportedModelVersion,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Provider unavailable",
+			body:           `{"query":"test"}`,
+			factory:        failingFactory(myerrors.NewModelError(string(models.OpenAI), 503, myerrors.ErrUnavailable, true)),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   myerrors.CodeUnavailable,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "All models failed",
+			body:           `{"query":"test"}`,
+			factory:        failingFactory(myerrors.NewModelError("fallback", 500, errors.New("all fallback models failed"), false)),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   myerrors.CodeAllModelsFailed,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Extraction failed",
+			body:           `{"query":"test","extract":"json"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   myerrors.CodeExtractionFailed,
+			expectedModel:  string(models.OpenAI),
+		},
+		{
+			name:           "Unclassified provider error",
+			body:           `{"query":"test"}`,
+			factory:        failingFactory(errors.New("boom")),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   myerrors.CodeInternal,
+			expectedModel:  string(models.OpenAI),
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{
+				routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+					if tt.routeErr != nil {
+						return "", tt.routeErr
+					}
+					return models.OpenAI, nil
+				},
+				fallbackOnErrorFunc: noFallback,
+			}
+			
+			llm.Factory = mockLLMFactory
+			if tt.factory != nil {
+				llm.Factory = tt.factory
+			}
+			
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			
+			req := httptest.NewRequest(method, "/query", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			
+			var resp models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if resp.Error.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, resp.Error.Code)
+			}
+			
+			if resp.Error.Model != tt.expectedModel {
+				t.Errorf("Expected model %q, got %q", tt.expectedModel, resp.Error.Model)
+			}
+			
+			if resp.Error.Message == "" {
+				t.Errorf("Expected non-empty error message")
+			}
+		})
+	}
+}
+
+func TestQueryHandlerContextWindowExceeded(t *testing.T) {
+	originalWindow, hadWindow := llm.ContextWindows[llm.DefaultOpenAIVersion]
+	defer func() {
+		if hadWindow {
+			llm.ContextWindows[llm.DefaultOpenAIVersion] = originalWindow
+		} else {
+			delete(llm.ContextWindows, llm.DefaultOpenAIVersion)
+		}
+	}()
+	llm.ContextWindows[llm.DefaultOpenAIVersion] = 2
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	providerCalled := false
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		providerCalled = true
+		return mockLLMFactory(modelType)
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{
+		routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+			return models.OpenAI, nil
+		},
+	}
+	
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"this prompt is longer than two tokens"}`))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	
+	var resp models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if resp.Error.Code != myerrors.CodeContextWindowExceeded {
+		t.Errorf("Expected code %q, got %q", myerrors.CodeContextWindowExceeded, resp.Error.Code)
+	}
+	
+	if providerCalled {
+		t.Errorf("Expected the provider not to be called")
+	}
+}
+
+func TestQueryHandlerTruncatesOverflow(t *testing.T) {
+	originalWindow, hadWindow := llm.ContextWindows[llm.DefaultOpenAIVersion]
+	defer func() {
+		if hadWindow {
+			llm.ContextWindows[llm.DefaultOpenAIVersion] = originalWindow
+		} else {
+			delete(llm.ContextWindows, llm.DefaultOpenAIVersion)
+		}
+	}()
+	llm.ContextWindows[llm.DefaultOpenAIVersion] = 20
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var sentQuery string
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				sentQuery = query
+				return &llm.QueryResult{Response: "Mock response"}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{
+		routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+			return models.OpenAI, nil
+		},
+	}
+	
+	query := "HEAD " + strings.Repeat("x", 200) + " TAIL"
+	
+	testCases := []struct {
+		onOverflow string
+		keep       string
+		drop       string
+	}{
+		{models.OverflowTruncateHead, "TAIL", "HEAD"},
+		{models.OverflowTruncateTail, "HEAD", "TAIL"},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.onOverflow, func(t *testing.T) {
+			body := `{"query":"` + query + `","max_tokens":5,"on_overflow":"` + tc.onOverflow + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			
+			var resp models.QueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if !resp.Truncated {
+				t.Errorf("Expected truncated to be true")
+			}
+			if !strings.Contains(sentQuery, tc.keep) || strings.Contains(sentQuery, tc.drop) {
+				t.Errorf("Expected query to keep %q and drop %q, got %q", tc.keep, tc.drop, sentQuery)
+			}
+			if tokens := llm.EstimateTokenCount(sentQuery); tokens > 15 {
+				t.Errorf("Expected at most 15 tokens after reserving max_tokens, got %d", tokens)
+			}
+		})
+	}
+	
+	t.Run("Keeps the tenant prefix", func(t *testing.T) {
+		cfg := config.GetConfig()
+		originalWrapper := cfg.DefaultPromptWrapper
+		defer func() { cfg.DefaultPromptWrapper = originalWrapper }()
+		cfg.DefaultPromptWrapper = config.PromptWrapper{Prefix: "RULES"}
+		
+		body := `{"query":"` + query + `","max_tokens":5,"on_overflow":"truncate_head"}`
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		
+		handler.QueryHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if !strings.HasPrefix(sentQuery, "RULES\n\n") || !strings.HasSuffix(sentQuery, "TAIL") {
+			t.Errorf("Expected the tenant prefix and the query tail to survive, got %q", sentQuery)
+		}
+		if tokens := llm.EstimateTokenCount(sentQuery); tokens > 15 {
+			t.Errorf("Expected at most 15 tokens including the prefix, got %d", tokens)
+		}
+	})
+	
+	t.Run("max_tokens fills the window", func(t *testing.T) {
+		body := `{"query":"` + query + `","max_tokens":20,"on_overflow":"truncate_head"}`
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		
+		handler.QueryHandler(w, req)
+		
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), myerrors.CodeContextWindowExceeded) {
+			t.Errorf("Expected %s, got %s", myerrors.CodeContextWindowExceeded, w.Body.String())
+		}
+	})
+	
+	t.Run("Refits for the fallback model", func(t *testing.T) {
+		originalGeminiWindow, hadGeminiWindow := llm.ContextWindows[llm.DefaultGeminiVersion]
+		defer func() {
+			if hadGeminiWindow {
+				llm.ContextWindows[llm.DefaultGeminiVersion] = originalGeminiWindow
+			} else {
+				delete(llm.ContextWindows, llm.DefaultGeminiVersion)
+			}
+		}()
+		llm.ContextWindows[llm.DefaultGeminiVersion] = 12
+		
+		sentQueries := map[models.ModelType]string{}
+		llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+			return &MockLLMClient{
+				modelType: modelType,
+				queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+					sentQueries[modelType] = query
+					if modelType == models.OpenAI {
+						return nil, myerrors.NewModelError(string(modelType), http.StatusServiceUnavailable, myerrors.ErrUnavailable, true)
+					}
+					return &llm.QueryResult{Response: "Mock response"}, nil
+				},
+			}, nil
+		}
+		
+		fallbackHandler := NewHandler()
+		fallbackHandler.cache = &MockCache{}
+		fallbackHandler.router = &MockRouter{
+			routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+				return models.OpenAI, nil
+			},
+			fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+				return models.Gemini, nil
+			},
+		}
+		
+		body := `{"query":"` + query + `","max_tokens":5,"on_overflow":"truncate_head"}`
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		
+		fallbackHandler.QueryHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if tokens := llm.EstimateTokenCount(sentQueries[models.Gemini]); tokens > 7 {
+			t.Errorf("Expected the fallback query refitted to at most 7 tokens, got %d", tokens)
+		}
+		if len(sentQueries[models.Gemini]) >= len(sentQueries[models.OpenAI]) {
+			t.Errorf("Expected a shorter query for the smaller fallback window")
+		}
+	})
+	
+	t.Run("Invalid strategy", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"hello","on_overflow":"truncate_middle"}`))
+		w := httptest.NewRecorder()
+		
+		handler.QueryHandler(w, req)
+		
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+type optionsCapturingClient struct {
+	MockLLMClient
+	opts *llm.QueryOptions
+}
+
+func (c *optionsCapturingClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
+	*c.opts = opts
+	return &llm.QueryResult{Response: "Mock response"}, nil
+}
+
+func TestQueryHandlerTemperatureClamp(t *testing.T) {
+	cfg := config.GetConfig()
+	originalDefaults := cfg.ModelDefaults
+	defer func() { cfg.ModelDefaults = originalDefaults }()
+	maxTemperature := 1.0
+	cfg.ModelDefaults = map[models.ModelType]config.ModelDefaults{
+		models.OpenAI: {MaxTemperature: &maxTemperature},
+	}
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var sentOpts llm.QueryOptions
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &optionsCapturingClient{MockLLMClient: MockLLMClient{modelType: modelType}, opts: &sentOpts}, nil
+	}
+	
+	handler := NewHandler()
+	handler.router = &MockRouter{}
+	
+	testCases := []struct {
+		name        string
+		temperature string
+		expected    float64
+		clamped     bool
+	}{
+		{"Above max is clamped", "1.8", 1, true},
+		{"At max passes through", "1", 1, false},
+		{"Below max passes through", "0.3", 0.3, false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler.cache = &MockCache{}
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"hello","temperature":`+tc.temperature+`}`))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			
+			var resp models.QueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if sentOpts.Temperature == nil || *sentOpts.Temperature != tc.expected {
+				t.Errorf("Expected temperature %g sent to the provider, got %v", tc.expected, sentOpts.Temperature)
+			}
+			if (resp.Clamped != "") != tc.clamped {
+				t.Errorf("Expected clamped note %v, got %q", tc.clamped, resp.Clamped)
+			}
+		})
+	}
+	
+	t.Run("Clamped for the fallback model", func(t *testing.T) {
+		geminiMax := 0.5
+		cfg.ModelDefaults[models.Gemini] = config.ModelDefaults{MaxTemperature: &geminiMax}
+		
+		sentOpts = llm.QueryOptions{}
+		llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+			if modelType == models.OpenAI {
+				return &MockLLMClient{
+					modelType: modelType,
+					queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+						return nil, myerrors.NewUnavailableError(string(modelType))
+					},
+				}, nil
+			}
+			return &optionsCapturingClient{MockLLMClient: MockLLMClient{modelType: modelType}, opts: &sentOpts}, nil
+		}
+		
+		fallbackHandler := NewHandler()
+		fallbackHandler.cache = &MockCache{}
+		fallbackHandler.router = &MockRouter{
+			fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+				return models.Gemini, nil
+			},
+		}
+		
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"hello","temperature":0.8}`))
+		w := httptest.NewRecorder()
+		
+		fallbackHandler.QueryHandler(w, req)
+		
+		var resp models.QueryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		
+		if resp.Model != models.Gemini {
+			t.Fatalf("Expected the fallback model to answer, got %q", resp.Model)
+		}
+		if sentOpts.Temperature == nil || *sentOpts.Temperature != geminiMax {
+			t.Errorf("Expected temperature %g sent to the fallback model, got %v", geminiMax, sentOpts.Temperature)
+		}
+		if !strings.Contains(resp.Clamped, string(models.Gemini)) {
+			t.Errorf("Expected the clamped note to name the fallback model, got %q", resp.Clamped)
+		}
+	})
+}
+
+func TestQueryHandlerProviderRequestID(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var forwardedID string
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				forwardedID = llm.RequestIDFromContext(ctx)
+				return &llm.QueryResult{Response: "response", ProviderRequestID: "provider-req-123"}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.router = &MockRouter{}
+	handler.cache = &MockCache{}
+	
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"hello"}`))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp models.QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.ProviderRequestID != "provider-req-123" {
+		t.Errorf("Expected provider_request_id provider-req-123, got %q", resp.ProviderRequestID)
+	}
+	if forwardedID == "" || forwardedID != resp.RequestID {
+		t.Errorf("Expected the provider call to carry request ID %q, got %q", resp.RequestID, forwardedID)
+	}
+}
+
+func TestQueryHandlerPromptWrappers(t *testing.T) {
+	cfg := config.GetConfig()
+	originalTenantWrappers, originalDefaultWrapper := cfg.TenantPromptWrappers, cfg.DefaultPromptWrapper
+	defer func() { cfg.TenantPromptWrappers, cfg.DefaultPromptWrapper = originalTenantWrappers, originalDefaultWrapper }()
+	cfg.TenantPromptWrappers = map[string]config.PromptWrapper{"acme": {Prefix: "Answer in JSON."}}
+	originalAPIKeys := cfg.TenantAPIKeys
+	defer func() { cfg.TenantAPIKeys = originalAPIKeys }()
+	cfg.TenantAPIKeys = map[string]string{"key-acme": "acme", "key-other": "other"}
+	cfg.DefaultPromptWrapper = config.PromptWrapper{Prefix: "Be brief.", Suffix: "Thanks."}
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var sentQuery string
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				sentQuery = query
+				return &llm.QueryResult{Response: "response"}, nil
+			},
+		}, nil
+	}
+	
+	tests := []struct {
+		name          string
+		tenant        string
+		expectedQuery string
+	}{
+		{"Tenant wrapper", "acme", "Answer in JSON.\n\nhello"},
+		{"Default wrapper", "other", "Be brief.\n\nhello\n\nThanks."},
+		{"No tenant", "", "Be brief.\n\nhello\n\nThanks."},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cachedQuery string
+			handler := NewHandler()
+			handler.router = &MockRouter{}
+			handler.cache = &MockCache{
+				getFunc: func(req models.QueryRequest) (models.QueryResponse, bool) {
+					cachedQuery = req.Query
+					return models.QueryResponse{}, false
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"hello"}`))
+			if tt.tenant != "" {
+				req.Header.Set(apiKeyHeader, "key-"+tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if sentQuery != tt.expectedQuery {
+				t.Errorf("Expected provider to receive %q, got %q", tt.expectedQuery, sentQuery)
+			}
+			if cachedQuery != tt.expectedQuery {
+				t.Errorf("Expected cache lookup on the wrapped query %q, got %q", tt.expectedQuery, cachedQuery)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerTenantAllowList(t *testing.T) {
+	cfg := config.GetConfig()
+	originalTenantModels := cfg.TenantModels
+	defer func() { cfg.TenantModels = originalTenantModels }()
+	cfg.TenantModels = map[string][]models.ModelType{"free": {models.Mistral}}
+	originalAPIKeys := cfg.TenantAPIKeys
+	defer func() { cfg.TenantAPIKeys = originalAPIKeys }()
+	cfg.TenantAPIKeys = map[string]string{"key-free": "free", "key-other": "other"}
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	tests := []struct {
+		name           string
+		tenant         string
+		body           string
+		expectedStatus int
+	}{
+		{"Allowed model", "free", `{"query":"test","model":"mistral"}`, http.StatusOK},
+		{"Disallowed model", "free", `{"query":"test","model":"openai"}`, http.StatusForbidden},
+		{"Unknown tenant uses default allow-list", "other", `{"query":"test","model":"openai"}`, http.StatusOK},
+		{"No tenant uses default allow-list", "", `{"query":"test","model":"openai"}`, http.StatusOK},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{
+				routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+					if req.Tenant != tt.tenant {
+						t.Errorf("Expected tenant %q, got %q", tt.tenant, req.Tenant)
+					}
+					return req.Model, nil
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(tt.body))
+			if tt.tenant != "" {
+				req.Header.Set(apiKeyHeader, "key-"+tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			
+			if tt.expectedStatus == http.StatusForbidden {
+				var resp models.ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Error decoding response: %v", err)
+				}
+				if resp.Error.Code != myerrors.CodeModelNotAllowed {
+					t.Errorf("Expected code %q, got %q", myerrors.CodeModelNotAllowed, resp.Error.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTenant(t *testing.T) {
+	cfg := config.GetConfig()
+	originalAPIKeys := cfg.TenantAPIKeys
+	defer func() { cfg.TenantAPIKeys = originalAPIKeys }()
+	cfg.TenantAPIKeys = map[string]string{"key-acme": "acme"}
+	
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedTenant string
+		expectedStatus int
+	}{
+		{"Anonymous", nil, "", http.StatusOK},
+		{"API key", map[string]string{apiKeyHeader: "key-acme"}, "acme", http.StatusOK},
+		{"Bearer token", map[string]string{"Authorization": "Bearer key-acme"}, "acme", http.StatusOK},
+		{"Lowercase bearer scheme", map[string]string{"Authorization": "bearer key-acme"}, "acme", http.StatusOK},
+		{"Basic credentials", map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, "", http.StatusOK},
+		{"Matching tenant header", map[string]string{apiKeyHeader: "key-acme", tenantHeader: "acme"}, "acme", http.StatusOK},
+		{"Unknown API key", map[string]string{apiKeyHeader: "key-other"}, "", http.StatusUnauthorized},
+		{"Tenant header without a key", map[string]string{tenantHeader: "acme"}, "", http.StatusForbidden},
+		{"Tenant header naming another tenant", map[string]string{apiKeyHeader: "key-acme", tenantHeader: "free"}, "", http.StatusForbidden},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/query", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			
+			tenant, err := getTenant(req)
+			if tenant != tt.expectedTenant {
+				t.Errorf("Expected tenant %q, got %q", tt.expectedTenant, tenant)
+			}
+			
+			w := httptest.NewRecorder()
+			if err != nil {
+				handleTenantError(w, err)
+			}
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestResolveModelAlias(t *testing.T) {
+	cfg := config.GetConfig()
+	originalAliases := cfg.ModelAliases
+	defer func() { cfg.ModelAliases = originalAliases }()
+	
+	cfg.ModelAliases = map[string]config.ModelAlias{
+		"smart": {Model: models.OpenAI, ModelVersion: "gpt-4o"},
+		"cheap": {Model: models.Mistral},
+	}
+	
+	tests := []struct {
+		name            string
+		req             models.QueryRequest
+		expectedModel   models.ModelType
+		expectedVersion string
+	}{
+		{
+			name:            "Alias expands model and version",
+			req:             models.QueryRequest{Model: "smart"},
+			expectedModel:   models.OpenAI,
+			expectedVersion: "gpt-4o",
+		},
+		{
+			name:            "Alias is case insensitive",
+			req:             models.QueryRequest{Model: "SMART"},
+			expectedModel:   models.OpenAI,
+			expectedVersion: "gpt-4o",
+		},
+		{
+			name:            "Explicit version wins",
+			req:             models.QueryRequest{Model: "smart", ModelVersion: "gpt-4o-mini"},
+			expectedModel:   models.OpenAI,
+			expectedVersion: "gpt-4o-mini",
+		},
+		{
+			name:          "Alias without version",
+			req:           models.QueryRequest{Model: "cheap"},
+			expectedModel: models.Mistral,
+		},
+		{
+			name:          "Concrete model is unchanged",
+			req:           models.QueryRequest{Model: models.Claude},
+			expectedModel: models.Claude,
+		},
+		{
+			name:          "Unknown alias is left for validation",
+			req:           models.QueryRequest{Model: "fast"},
+			expectedModel: "fast",
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := resolveModelAlias(tt.req)
+			
+			if resolved.Model != tt.expectedModel {
+				t.Errorf("Expected model %s, got %s", tt.expectedModel, resolved.Model)
+			}
+			
+			if resolved.ModelVersion != tt.expectedVersion {
+				t.Errorf("Expected version %q, got %q", tt.expectedVersion, resolved.ModelVersion)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerTimings(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	fastRetry := retry.Config{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		BackoffFactor:  2.0,
+	}
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				calls := 0
+				result, err := retry.Do(ctx, func() (interface{}, error) {
+					calls++
+					if modelType == models.OpenAI {
+						return nil, myerrors.NewUnavailableError(string(modelType))
+					}
+					if calls == 1 {
+						return nil, myerrors.NewTimeoutError(string(modelType))
+					}
+					return &llm.QueryResult{Response: "Response from " + string(modelType), StatusCode: 200}, nil
+				}, fastRetry)
+				if err != nil {
+					return nil, err
+				}
+				return result.(*llm.QueryResult), nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{
+		routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+			return models.OpenAI, nil
+		},
+		fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+			return models.Gemini, nil
+		},
+	}
+	
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	
+	var resp models.QueryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if resp.Timings == nil {
+		t.Fatal("Expected timings in response")
+	}
+	
+	if len(resp.Timings.Attempts) != 5 {
+		t.Fatalf("Expected 5 attempts (3 openai, 2 gemini), got %d", len(resp.Timings.Attempts))
+	}
+	
+	for i, attempt := range resp.Timings.Attempts {
+		expectedModel := models.OpenAI
+		if i >= 3 {
+			expectedModel = models.Gemini
+		}
+		if attempt.Model != expectedModel {
+			t.Errorf("Attempt %d: expected model %s, got %s", i, expectedModel, attempt.Model)
+		}
+	}
+	
+	last := resp.Timings.Attempts[4]
+	if last.Attempt != 2 || last.Error != "" {
+		t.Errorf("Expected final gemini attempt 2 to succeed, got %+v", last)
+	}
+	
+	if resp.Timings.Attempts[0].Error == "" || resp.Timings.Attempts[0].BackoffMs == 0 {
+		t.Errorf("Expected first attempt to record an error and backoff, got %+v", resp.Timings.Attempts[0])
+	}
+	
+	if resp.Timings.TotalMs < resp.Timings.ProviderMs {
+		t.Errorf("Expected total %dms to cover provider time %dms", resp.Timings.TotalMs, resp.Timings.ProviderMs)
+	}
+}
+
+func TestQueryHandlerFallbackChain(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	next := map[models.ModelType]models.ModelType{
+		models.OpenAI:  models.Gemini,
+		models.Gemini:  models.Mistral,
+		models.Mistral: models.Claude,
+		models.Claude:  models.OpenAI,
+	}
+	
+	tests := []struct {
+		name           string
+		succeeds       models.ModelType
+		expectedStatus int
+		expectedChain  []models.ModelType
+	}{
+		{"Third model succeeds", models.Mistral, http.StatusOK, []models.ModelType{models.OpenAI, models.Gemini, models.Mistral}},
+		{"Every model fails", "", http.StatusServiceUnavailable, []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queried []models.ModelType
+			llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+				return &MockLLMClient{
+					modelType: modelType,
+					queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+						queried = append(queried, modelType)
+						if modelType != tt.succeeds {
+							return nil, myerrors.NewUnavailableError(string(modelType))
+						}
+						return &llm.QueryResult{Response: "response from " + string(modelType)}, nil
+					},
+				}, nil
+			}
+			
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{
+				fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+					return next[failedModel], nil
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if !reflect.DeepEqual(queried, tt.expectedChain) {
+				t.Errorf("Expected models %v to be tried, got %v", tt.expectedChain, queried)
+			}
+			
+			if tt.expectedStatus != http.StatusOK {
+				var resp models.ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Error decoding response: %v", err)
+				}
+				if resp.Error.Model != string(models.Claude) {
+					t.Errorf("Expected the last model's error, got model %q", resp.Error.Model)
+				}
+				return
+			}
+			
+			var resp models.QueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if resp.Model != tt.succeeds || resp.OriginalModel != models.OpenAI || !reflect.DeepEqual(resp.FallbackChain, tt.expectedChain) {
+				t.Errorf("Unexpected fallback result: model %s, original %s, chain %v", resp.Model, resp.OriginalModel, resp.FallbackChain)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerStrictVersionFallback(t *testing.T) {
+	cfg := config.GetConfig()
+	originalStrict := cfg.StrictModelVersion
+	defer func() { cfg.StrictModelVersion = originalStrict }()
+	cfg.StrictModelVersion = true
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	versions := make(map[models.ModelType]string)
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				versions[modelType] = modelVersion
+				version, err := llm.ResolveModelVersion(modelType, modelVersion, true)
+				if err != nil {
+					return nil, err
+				}
+				if modelType == models.OpenAI {
+					return nil, myerrors.NewUnavailableError(string(modelType))
+				}
+				return &llm.QueryResult{Response: "response from " + string(modelType), ModelVersion: version}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{
+		fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+			return models.Claude, nil
+		},
+	}
+	
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test","model":"openai","model_version":"gpt-4o"}`))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the fallback to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if versions[models.OpenAI] != "gpt-4o" || versions[models.Claude] != "" {
+		t.Errorf("Expected gpt-4o for openai only and the default for claude, got %v", versions)
+	}
+	
+	var resp models.QueryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if resp.Model != models.Claude || resp.ModelVersion != llm.DefaultModelVersion(models.Claude) {
+		t.Errorf("Expected claude with its default version, got %s/%s", resp.Model, resp.ModelVersion)
+	}
+}
+
+func TestQueryHandlerNoFallback(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				if modelType == models.OpenAI {
+					return nil, myerrors.NewUnavailableError(string(modelType))
+				}
+				return &llm.QueryResult{Response: "Fallback response from " + string(modelType), StatusCode: 200}, nil
+			},
+		}, nil
+	}
+	
+	tests := []struct {
+		name              string
+		body              string
+		expectedStatus    int
+		expectedFallbacks int
+	}{
+		{
+			name:              "Fallback by default",
+			body:              `{"query":"test","model":"openai"}`,
+			expectedStatus:    http.StatusOK,
+			expectedFallbacks: 1,
+		},
+		{
+			name:              "Fallback disabled",
+			body:              `{"query":"test","model":"openai","no_fallback":true}`,
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedFallbacks: 0,
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallbacks := 0
+			
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{
+				routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+					return models.OpenAI, nil
+				},
+				fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+					fallbacks++
+					return models.Gemini, nil
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			
+			if fallbacks != tt.expectedFallbacks {
+				t.Errorf("Expected %d fallback calls, got %d", tt.expectedFallbacks, fallbacks)
+			}
+			
+			if tt.expectedStatus != http.StatusOK {
+				var resp models.ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Error decoding response: %v", err)
+				}
+				
+				if resp.Error.Model != string(models.OpenAI) || resp.Error.Code != myerrors.CodeUnavailable {
+					t.Errorf("Expected original openai UNAVAILABLE error, got %+v", resp.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRefreshAvailabilityHandler(t *testing.T) {
+	t.Run("Method not allowed", func(t *testing.T) {
+		handler := NewHandler()
+		handler.router = &MockRouter{}
+		
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/refresh-availability", nil)
+		w := httptest.NewRecorder()
+		
+		handler.RefreshAvailabilityHandler(w, req)
+		
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+		}
+	})
+	
+	t.Run("Refreshes availability", func(t *testing.T) {
+		refreshed := false
+		
+		handler := NewHandler()
+		handler.router = &MockRouter{
+			refreshAvailabilityFunc: func() models.StatusResponse {
+				refreshed = true
+				return models.StatusResponse{OpenAI: true, Claude: true}
+			},
+		}
+		
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/refresh-availability", nil)
+		w := httptest.NewRecorder()
+		
+		handler.RefreshAvailabilityHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		
+		if !refreshed {
+			t.Error("Expected router availability to be refreshed")
+		}
+		
+		var status models.StatusResponse
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		
+		if !status.OpenAI || status.Gemini || status.Mistral || !status.Claude {
+			t.Errorf("Unexpected status: %+v", status)
+		}
+	})
+}
+
+func TestDetailedStatusHandler(t *testing.T) {
+	metrics := monitoring.GetMetrics()
+	for i := 1; i <= 10; i++ {
+		metrics.RecordRequest(string(models.Claude), http.StatusOK, time.Duration(i)*10*time.Millisecond)
+	}
+	metrics.RecordRequest(string(models.Claude), http.StatusServiceUnavailable, 500*time.Millisecond)
+	
+	handler := NewHandler()
+	handler.router = &MockRouter{
+		getAvailabilityFunc: func() models.StatusResponse {
+			return models.StatusResponse{OpenAI: true, Claude: true}
+		},
+	}
+	
+	req := httptest.NewRequest(http.MethodGet, "/api/status/detailed", nil)
+	w := httptest.NewRecorder()
+	
+	handler.DetailedStatusHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	
+	var resp models.DetailedStatusResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if len(resp.Models) != 4 {
+		t.Fatalf("Expected 4 models, got %d", len(resp.Models))
+	}
+	
+	if !resp.Models[models.OpenAI].Available || resp.Models[models.Gemini].Available {
+		t.Errorf("Unexpected availability: %+v", resp.Models)
+	}
+	
+	claude := resp.Models[models.Claude]
+	if claude.RecentRequests < 11 {
+		t.Errorf("Expected at least 11 recent claude requests, got %d", claude.RecentRequests)
+	}
+	if claude.ErrorRate <= 0 || claude.ErrorRate >= 1 {
+		t.Errorf("Expected a partial claude error rate, got %f", claude.ErrorRate)
+	}
+	if claude.LastErrorTime == nil {
+		t.Error("Expected claude last error time to be set")
+	}
+	if claude.P50LatencyMs <= 0 || claude.P95LatencyMs < claude.P50LatencyMs {
+		t.Errorf("Unexpected claude latencies: p50=%f p95=%f", claude.P50LatencyMs, claude.P95LatencyMs)
+	}
+}
+
+func TestQueryHandlerToolCalls(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				return &llm.QueryResult{
+					FinishReason: "tool_calls",
+					ToolCalls: []models.ToolCall{
+						{ID: "call_1", Name: "get_weather", Arguments: json.RawMessage(`{"city":"Paris"}`)},
+					},
+				}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	
+	body := `{"query":"Weather in Paris?","tools":[{"name":"get_weather","parameters":{"type":"object"}}],"tool_choice":"auto"}`
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp models.QueryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "get_weather" || string(resp.ToolCalls[0].Arguments) != `{"city":"Paris"}` {
+		t.Errorf("Unexpected tool calls: %+v", resp.ToolCalls)
+	}
+}
+
+func TestQueryHandlerCapabilityValidation(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	providerCalled := false
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				providerCalled = true
+				return &llm.QueryResult{Response: "ok"}, nil
+			},
+		}, nil
+	}
+	
+	image := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+	tools := `[{"name":"lookup","parameters":{"type":"object"}}]`
+	
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode string
+		expectedText string
+	}{
+		{"Tools on a model without tool support", `{"query":"q","model":"mistral","tools":` + tools + `}`, myerrors.CodeToolsUnsupported, "mistral/mistral-medium-latest"},
+		{"Image on a text-only version", `{"query":"q","model":"openai","model_version":"gpt-4","images":["` + image + `"]}`, myerrors.CodeImagesUnsupported, "openai/gpt-4"},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providerCalled = false
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			handler.QueryHandler(w, req)
+			
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+			
+			var errResp models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if errResp.Error.Code != tt.expectedCode || !strings.Contains(errResp.Error.Message, tt.expectedText) {
+				t.Errorf("Expected %s mentioning %s, got %+v", tt.expectedCode, tt.expectedText, errResp.Error)
+			}
+			
+			if providerCalled {
+				t.Error("Expected the request to be rejected before calling the provider")
+			}
+		})
+	}
+}
+
+func TestQueryHandlerCandidates(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				return &llm.QueryResult{
+					Response:    "```json\n{\"answer\":1}\n```",
+					Candidates:  []string{"```json\n{\"answer\":1}\n```", "```json\n{\"answer\":2}\n```"},
+					TotalTokens: 30,
+				}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"Pick a number","n":2,"extract":"json"}`))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp models.QueryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if len(resp.Candidates) != 2 || resp.Candidates[0] != `{"answer":1}` || resp.Candidates[1] != `{"answer":2}` {
+		t.Errorf("Unexpected candidates: %q", resp.Candidates)
+	}
+	
+	if resp.Response != resp.Candidates[0] {
+		t.Errorf("Expected response %q to match the first candidate", resp.Response)
+	}
+}
+
+func TestQueryHandlerRequestTimeout(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}, nil
+	}
+	
+	var timedOut []models.ModelType
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{
+		recordTimeoutFunc: func(model models.ModelType) {
+			timedOut = append(timedOut, model)
+		},
+	}
+	handler.requestTimeout = 50 * time.Millisecond
+	
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`))
+	w := httptest.NewRecorder()
+	
+	start := time.Now()
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusRequestTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestTimeout, w.Code)
+	}
+	
+	if got := w.Header().Get(proxyTimeoutHeader); got != "50" {
+		t.Errorf("Expected %s 50, got %q", proxyTimeoutHeader, got)
+	}
+	
+	if got := w.Header().Get("Retry-After"); got != strconv.Itoa(timeoutRetryAfter) {
+		t.Errorf("Expected Retry-After %d, got %q", timeoutRetryAfter, got)
+	}
+	
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request timeout to end the query, took %v", elapsed)
+	}
+	
+	if len(timedOut) != 1 || timedOut[0] != models.OpenAI {
+		t.Errorf("Expected the timeout reported to the router for openai, got %v", timedOut)
+	}
+	
+	if (&Handler{}).timeout() != defaultTimeout {
+		t.Errorf("Expected default timeout when REQUEST_TIMEOUT is unset")
+	}
+}
+
+func TestQueryHandlerSlowRequests(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	cfg := config.GetConfig()
+	originalThreshold := cfg.SlowRequestThresholdMs
+	defer func() { cfg.SlowRequestThresholdMs = originalThreshold }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				if strings.HasPrefix(query, "slow") {
+					time.Sleep(50 * time.Millisecond)
+				}
+				if strings.HasSuffix(query, "failing") {
+					return nil, myerrors.NewModelError(string(modelType), http.StatusBadRequest, errors.New("bad request"), false)
+				}
+				return &llm.QueryResult{Response: "ok", InputTokens: 3, OutputTokens: 5}, nil
+			},
+		}, nil
+	}
+	
+	slowCount := func() float64 {
+		var metric dto.Metric
+		monitoring.SlowRequests.WithLabelValues(string(models.OpenAI)).Write(&metric)
+		return metric.GetCounter().GetValue()
+	}
+	
+	tests := []struct {
+		name       string
+		threshold  int
+		query      string
+		wantStatus int
+		wantSlow   bool
+	}{
+		{"Slower than threshold", 20, "slow", http.StatusOK, true},
+		{"Faster than threshold", 1000, "fast", http.StatusOK, false},
+		{"Disabled", 0, "slow", http.StatusOK, false},
+		{"Slow failure", 20, "slow failing", http.StatusInternalServerError, true},
+		{"Fast failure", 1000, "fast failing", http.StatusInternalServerError, false},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.SlowRequestThresholdMs = tt.threshold
+			
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{}
+			
+			before := slowCount()
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"`+tt.query+`"}`))
+			w := httptest.NewRecorder()
+			handler.QueryHandler(w, req)
+			
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			
+			if got := slowCount() - before; (got == 1) != tt.wantSlow {
+				t.Errorf("Expected slow request recorded %v, counter moved by %v", tt.wantSlow, got)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerProviderErrorPassthrough(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	tests := []struct {
+		name            string
+		queryErr        error
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name:            "Unclassified provider error",
+			queryErr:        myerrors.NewModelError(string(models.OpenAI), 400, errors.New("This model's maximum context length is 8192 tokens"), false),
+			expectedStatus:  400,
+			expectedMessage: "This model's maximum context length is 8192 tokens",
+		},
+		{
+			name:            "Long provider message is truncated",
+			queryErr:        myerrors.NewModelError(string(models.OpenAI), 422, errors.New(strings.Repeat("x", maxProviderMessageLength+100)), false),
+			expectedStatus:  422,
+			expectedMessage: strings.Repeat("x", maxProviderMessageLength) + "...",
+		},
+		{
+			name:     "Known category is not passed through",
+			queryErr: myerrors.NewRateLimitError(string(models.OpenAI)),
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+				return &MockLLMClient{
+					modelType: modelType,
+					queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+						return nil, tt.queryErr
+					},
+				}, nil
+			}
+			
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{
+				fallbackOnErrorFunc: func(ctx context.Context, failedModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+					return "", errors.New("no fallback available")
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test"}`))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			var resp models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if resp.Error.ProviderStatus != tt.expectedStatus {
+				t.Errorf("Expected provider status %d, got %d", tt.expectedStatus, resp.Error.ProviderStatus)
+			}
+			
+			if resp.Error.ProviderMessage != tt.expectedMessage {
+				t.Errorf("Expected provider message %q, got %q", tt.expectedMessage, resp.Error.ProviderMessage)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	handler := NewHandler()
+	handler.rateLimiter = NewRateLimiter(60, 2)
+	
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w = httptest.NewRecorder()
+		handler.StatusHandler(w, req)
+	}
+	
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	
+	expected := map[string]string{
+		"X-RateLimit-Limit":     "2",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "2",
+		"Retry-After":           "1",
+	}
+	for header, value := range expected {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Expected %s %s, got %q", header, value, got)
+		}
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		path       string
+		body       string
+		incomingID string
+		keepsID    bool
+	}{
+		{"Incoming ID is kept", monitoring.RequestLoggerMiddleware(http.HandlerFunc(handler.QueryHandler)), "/api/query", `{"query":"test"}`, "client-123", true},
+		{"Invalid incoming ID is replaced", monitoring.RequestLoggerMiddleware(http.HandlerFunc(handler.QueryHandler)), "/api/query", `{"query":"test"}`, "bad id\n", false},
+		{"Minted without the middleware", http.HandlerFunc(handler.QueryHandler), "/api/query", `{"query":"test"}`, "", false},
+		{"Parallel query", monitoring.RequestLoggerMiddleware(http.HandlerFunc(handler.ParallelQueryHandler)), "/api/parallel", `{"query":"test","models":["openai"]}`, "client-456", true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+			if tt.incomingID != "" {
+				req.Header.Set("X-Request-ID", tt.incomingID)
+			}
+			w := httptest.NewRecorder()
+			
+			tt.handler.ServeHTTP(w, req)
+			
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			
+			headerID := w.Header().Get("X-Request-ID")
+			if headerID == "" {
+				t.Fatalf("Expected an X-Request-ID header")
+			}
+			if tt.keepsID && headerID != tt.incomingID {
+				t.Errorf("Expected incoming ID %q to be kept, got %q", tt.incomingID, headerID)
+			}
+			if !tt.keepsID && headerID == tt.incomingID {
+				t.Errorf("Expected invalid incoming ID to be replaced")
+			}
+			
+			var resp struct {
+				RequestID string `json:"request_id"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if resp.RequestID != headerID {
+				t.Errorf("Expected body request_id %q to match the header %q", resp.RequestID, headerID)
+			}
+		})
+	}
+}
+
+func TestDownloadHandler(t *testing.T) {
+	cfg := config.GetConfig()
+	originalFormats, originalMax := cfg.DownloadFormats, cfg.MaxDownloadSize
+	defer func() { cfg.DownloadFormats, cfg.MaxDownloadSize = originalFormats, originalMax }()
+	cfg.DownloadFormats = []string{"txt", "pdf"}
+	cfg.MaxDownloadSize = 16
+	
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedPrefix string
+	}{
+		{"Enabled format", `{"response":"hello","format":"txt"}`, http.StatusOK, "hello"},
+		{"Disabled format", `{"response":"hello","format":"docx"}`, http.StatusBadRequest, ""},
+		{"Unknown format", `{"response":"hello","format":"html"}`, http.StatusBadRequest, ""},
+		{"Oversized content", `{"response":"` + strings.Repeat("a", 17) + `","format":"pdf"}`, http.StatusRequestEntityTooLarge, ""},
+		{"Empty content", `{"response":"","format":"txt"}`, http.StatusBadRequest, ""},
+		{"Plain render", `{"response":"# hello","format":"pdf","render":"plain"}`, http.StatusOK, "# hello"},
+		{"Markdown render", `{"response":"# hello","format":"pdf","render":"markdown"}`, http.StatusOK, "%PDF-"},
+		{"Markdown text stays raw", `{"response":"# hello","format":"txt","render":"markdown"}`, http.StatusOK, "# hello"},
+		{"Unknown render", `{"response":"hello","format":"pdf","render":"html"}`, http.StatusBadRequest, ""},
+	}
+	
+	handler := NewHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/download", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			handler.DownloadHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedPrefix != "" && !strings.HasPrefix(w.Body.String(), tt.expectedPrefix) {
+				t.Errorf("Expected body to start with %q, got %q", tt.expectedPrefix, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStrictRequestSchema(t *testing.T) {
+	cfg := config.GetConfig()
+	originalStrict := cfg.StrictRequestSchema
+	defer func() { cfg.StrictRequestSchema = originalStrict }()
+	
+	body := []byte(`{"query":"hello","tempurature":0.2}`)
+	
+	cfg.StrictRequestSchema = false
+	var req models.QueryRequest
+	if err := decodeRequestBody(body, &req); err != nil || req.Query != "hello" {
+		t.Fatalf("Expected unknown fields to be ignored by default, got %v", err)
+	}
+	
+	cfg.StrictRequestSchema = true
+	if err := decodeRequestBody(body, &models.QueryRequest{}); !errors.Is(err, errUnknownField) || !strings.Contains(err.Error(), `"tempurature"`) {
+		t.Errorf("Expected unknown field error naming tempurature, got %v", err)
+	}
+	if err := decodeRequestBody([]byte(`{"query":"hello"} {}`), &models.QueryRequest{}); err == nil {
+		t.Error("Expected error for trailing data, got nil")
+	}
+	if err := decodeRequestBody([]byte(`{"query":"hello","temperature":0.2}`), &models.QueryRequest{}); err != nil {
+		t.Errorf("Expected known fields to decode, got %v", err)
+	}
+	
+	handler := NewHandler()
+	for _, tc := range []struct {
+		name  string
+		path  string
+		body  string
+		serve func(http.ResponseWriter, *http.Request)
+	}{
+		{"Query", "/api/query", string(body), handler.QueryHandler},
+		{"Parallel", "/api/parallel", `{"query":"hello","modles":["openai"]}`, handler.ParallelQueryHandler},
+		{"Batch", "/api/batch", `{"queries":[{"query":"hello","tempurature":0.2}]}`, handler.BatchHandler},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewBufferString(tc.body))
+			w := httptest.NewRecorder()
+			
+			tc.serve(w, req)
+			
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown field") {
+				t.Errorf("Expected 400 naming the unknown field, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestQueryHandlerDetectedLanguage(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	body := `{"query":"¿Puedes explicarme cómo funciona la fotosíntesis en las plantas y por qué es tan importante?"}`
+	for _, tc := range []struct {
+		name     string
+		language string
+	}{
+		{"Detected", "es"},
+		{"Not detected", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{detectedLanguage: tc.language}
+			
+			req := httptest.NewRequest(http.MethodPost, "/api/query", bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			handler.QueryHandler(w, req)
+			
+			var resp models.QueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if resp.DetectedLanguage != tc.language {
+				t.Errorf("Expected detected_language %q, got %q", tc.language, resp.DetectedLanguage)
+			}
+		})
+	}
+}
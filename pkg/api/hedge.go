@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/retry"
+	"github.com/sirupsen/logrus"
+)
+
+type hedgeAttempt struct {
+	model     models.ModelType
+	client    llm.Client
+	req       models.QueryRequest // The request as adapted to model by requestFor
+	clamped   string
+	truncated bool
+	timings   *models.Timings
+	result    *llm.QueryResult
+	err       error
+}
+
+// hedgedQuery races a second model against the primary once HEDGE_DELAY_MS passes without a
+// response. The first success wins; if both fail the primary's error goes to the usual fallback.
+// base is the caller's request; the hedge model gets its own clamping and truncation of it.
+func (h *Handler) hedgedQuery(ctx context.Context, primary hedgeAttempt, base models.QueryRequest, requestID string) (hedgeAttempt, models.ModelType) {
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	
+	done := make(chan hedgeAttempt, 2)
+	run := func(ctx context.Context, attempt hedgeAttempt, release func()) {
+		defer release()
+		attempt.result, attempt.err = attempt.client.Query(ctx, attempt.req.Query, attempt.req.ModelVersion, queryOptions(attempt.req))
+		done <- attempt
+	}
+	
+	go run(raceCtx, primary, func() {}) // The primary already holds the query's admission slot
+	pending := 1
+	
+	timer := time.NewTimer(time.Duration(config.GetConfig().HedgeDelayMs) * time.Millisecond)
+	defer timer.Stop()
+	
+	var hedgeModel models.ModelType
+	var hedgeTimings *models.Timings
+	defer func() {
+		if hedgeTimings != nil {
+			primary.timings.Attempts = append(primary.timings.Attempts, hedgeTimings.Attempts...)
+			if hedgeTimings.ProviderMs > primary.timings.ProviderMs {
+				primary.timings.ProviderMs = hedgeTimings.ProviderMs
+			}
+		}
+	}()
+	
+	failed := hedgeAttempt{}
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			model, err := h.router.FallbackOnError(ctx, primary.model, base, myerrors.NewTimeoutError(string(primary.model)))
+			if err != nil || model == primary.model {
+				continue
+			}
+			hedgeReq, clamped, truncated, err := requestFor(model, base)
+			if err != nil {
+				logrus.WithField("request_id", requestID).Debug("Query does not fit the hedge model, waiting on the primary")
+				continue
+			}
+			release, ok := h.admission.tryAcquire()
+			if !ok {
+				logrus.WithField("request_id", requestID).Debug("No free slot for a hedge, waiting on the primary")
+				continue
+			}
+			client, err := llm.Factory(model)
+			if err != nil {
+				release()
+				continue
+			}
+			
+			logrus.WithFields(logrus.Fields{
+				"model":       string(primary.model),
+				"hedge_model": string(model),
+				"request_id":  requestID,
+			}).Info("Primary model slow, hedging with a second model")
+			
+			recorder := retry.NewRecorder()
+			hedgeTimings = &models.Timings{}
+			hedgeModel = model
+			pending++
+			go run(retry.WithRecorder(raceCtx, recorder), hedgeAttempt{
+				model:     model,
+				client:    &timedClient{Client: h.limitClient(client, base.Tenant), timings: hedgeTimings, recorder: recorder},
+				req:       hedgeReq,
+				clamped:   clamped,
+				truncated: truncated,
+				timings:   hedgeTimings,
+			}, release)
+		case attempt := <-done:
+			pending--
+			if attempt.err != nil {
+				if attempt.model == primary.model || failed.err == nil {
+					failed = attempt
+				}
+				continue
+			}
+			
+			cancel()
+			for ; pending > 0; pending-- {
+				if loser := <-done; loser.err == nil {
+					costUSD := h.recordCost(loser.model, loser.result.ModelVersion, loser.result.InputTokens, loser.result.OutputTokens)
+					h.usage.record(base.Tenant, loser.model, loser.result.InputTokens, loser.result.OutputTokens, costUSD)
+				}
+			}
+			return attempt, hedgeModel
+		}
+	}
+	
+	return failed, hedgeModel
+}
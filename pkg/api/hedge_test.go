@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestQueryHandlerHedging(t *testing.T) {
+	cfg := config.GetConfig()
+	originalDelay := cfg.HedgeDelayMs
+	defer func() { cfg.HedgeDelayMs = originalDelay }()
+	cfg.HedgeDelayMs = 50
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	tests := []struct {
+		name          string
+		body          string
+		primaryDelay  time.Duration
+		expectedModel models.ModelType
+		expectedHedge models.ModelType
+	}{
+		{"Slow primary is hedged", `{"query":"test","hedge":true}`, 5 * time.Second, models.Gemini, models.Gemini},
+		{"Fast primary is not hedged", `{"query":"test","hedge":true}`, 0, models.OpenAI, ""},
+		{"Hedging is opt-in", `{"query":"test"}`, 200 * time.Millisecond, models.OpenAI, ""},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryCanceled, hedgeCalls int32
+			llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+				return &MockLLMClient{
+					modelType: modelType,
+					queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+						if modelType != models.OpenAI {
+							atomic.AddInt32(&hedgeCalls, 1)
+							return &llm.QueryResult{Response: "response from " + string(modelType)}, nil
+						}
+						select {
+						case <-time.After(tt.primaryDelay):
+							return &llm.QueryResult{Response: "response from openai"}, nil
+						case <-ctx.Done():
+							atomic.StoreInt32(&primaryCanceled, 1)
+							return nil, ctx.Err()
+						}
+					},
+				}, nil
+			}
+			
+			handler := NewHandler()
+			handler.cache = &MockCache{}
+			handler.router = &MockRouter{}
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			start := time.Now()
+			handler.QueryHandler(w, req)
+			
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			
+			var resp models.QueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if resp.Model != tt.expectedModel || resp.HedgeModel != tt.expectedHedge {
+				t.Errorf("Expected model %q with hedge %q, got %q with hedge %q", tt.expectedModel, tt.expectedHedge, resp.Model, resp.HedgeModel)
+			}
+			
+			if tt.expectedHedge == "" {
+				if atomic.LoadInt32(&hedgeCalls) != 0 {
+					t.Errorf("Expected no hedge query, got %d", hedgeCalls)
+				}
+				return
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the hedge to answer before the slow primary, took %v", elapsed)
+			}
+			if atomic.LoadInt32(&primaryCanceled) != 1 {
+				t.Errorf("Expected the losing primary query to be canceled")
+			}
+		})
+	}
+}
+
+func TestValidateQueryRequestHedge(t *testing.T) {
+	if err := validateQueryRequest(models.QueryRequest{Query: "test", Hedge: true}); err != nil {
+		t.Errorf("Expected no error for a hedged request, got: %v", err)
+	}
+	if err := validateQueryRequest(models.QueryRequest{Query: "test", Hedge: true, NoFallback: true}); err == nil {
+		t.Errorf("Expected error when hedge is combined with no_fallback")
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/cache"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotencyKeys        = 10000
+)
+
+type idempotencyRecord struct {
+	fingerprint string // Cache key of the original request, to detect a key reused for a different request
+	done        bool
+	resp        models.QueryResponse
+}
+
+type idempotencyStore struct {
+	provider cache.CacheProvider
+	ttl      time.Duration
+	mutex    sync.Mutex
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		provider: cache.NewInMemoryCache(ttl, ttl, maxIdempotencyKeys),
+		ttl:      ttl,
+	}
+}
+
+func (s *idempotencyStore) begin(key, fingerprint string) (idempotencyRecord, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	if value, found := s.provider.Get(key); found {
+		return value.(idempotencyRecord), false
+	}
+	
+	record := idempotencyRecord{fingerprint: fingerprint}
+	s.provider.Set(key, record, s.ttl)
+	return record, true
+}
+
+func (s *idempotencyStore) complete(key, fingerprint string, resp models.QueryResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	s.provider.Set(key, idempotencyRecord{fingerprint: fingerprint, done: true, resp: resp}, s.ttl)
+}
+
+func (s *idempotencyStore) release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	s.provider.Delete(key)
+}
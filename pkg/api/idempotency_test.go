@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func newIdempotencyTestHandler() *Handler {
+	return &Handler{
+		router:      &MockRouter{},
+		cache:       &MockCache{},
+		rateLimiter: NewRateLimiter(1000, 1000),
+		idempotency: newIdempotencyStore(time.Minute),
+	}
+}
+
+func sendIdempotentQuery(handler *Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/query", bytes.NewBufferString(body))
+	req.Header.Set(idempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	handler.QueryHandler(w, req)
+	return w
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	return resp.Error.Code
+}
+
+func TestQueryHandlerIdempotencyKey(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var calls int32
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				atomic.AddInt32(&calls, 1)
+				return &llm.QueryResult{Response: "charged once"}, nil
+			},
+		}, nil
+	}
+	
+	handler := newIdempotencyTestHandler()
+	body := `{"query":"pay me"}`
+	
+	first := sendIdempotentQuery(handler, "key-1", body)
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, first.Code)
+	}
+	
+	t.Run("Completed key replays the stored response", func(t *testing.T) {
+		replay := sendIdempotentQuery(handler, "key-1", body)
+		if replay.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, replay.Code)
+		}
+		if replay.Header().Get(idempotencyReplayedHeader) != "true" {
+			t.Errorf("Expected %s header on replay", idempotencyReplayedHeader)
+		}
+		if replay.Body.String() != first.Body.String() {
+			t.Errorf("Expected replayed body %s, got %s", first.Body.String(), replay.Body.String())
+		}
+		if calls != 1 {
+			t.Errorf("Expected 1 provider call, got %d", calls)
+		}
+	})
+	
+	t.Run("Key reused for a different request", func(t *testing.T) {
+		w := sendIdempotentQuery(handler, "key-1", `{"query":"something else"}`)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+		if code := errorCode(t, w); code != myerrors.CodeIdempotencyKeyReused {
+			t.Errorf("Expected code %s, got %s", myerrors.CodeIdempotencyKeyReused, code)
+		}
+	})
+	
+	t.Run("Different key calls the provider", func(t *testing.T) {
+		sendIdempotentQuery(handler, "key-2", body)
+		if calls != 2 {
+			t.Errorf("Expected 2 provider calls, got %d", calls)
+		}
+	})
+}
+
+func TestQueryHandlerIdempotencyKeyInProgress(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	started := make(chan struct{})
+	release := make(chan struct{})
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				close(started)
+				<-release
+				return &llm.QueryResult{Response: "slow response"}, nil
+			},
+		}, nil
+	}
+	
+	handler := newIdempotencyTestHandler()
+	body := `{"query":"slow"}`
+	
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- sendIdempotentQuery(handler, "key-1", body)
+	}()
+	<-started
+	
+	w := sendIdempotentQuery(handler, "key-1", body)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if code := errorCode(t, w); code != myerrors.CodeIdempotencyKeyInProgress {
+		t.Errorf("Expected code %s, got %s", myerrors.CodeIdempotencyKeyInProgress, code)
+	}
+	
+	close(release)
+	if first := <-done; first.Code != http.StatusOK {
+		t.Errorf("Expected original request to succeed, got %d", first.Code)
+	}
+}
+
+func TestQueryHandlerIdempotencyKeyReleasedOnError(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var calls int32
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return nil, myerrors.NewModelError(string(modelType), 400, errors.New("bad request"), false)
+				}
+				return &llm.QueryResult{Response: "second try"}, nil
+			},
+		}, nil
+	}
+	
+	handler := newIdempotencyTestHandler()
+	body := `{"query":"retry me"}`
+	
+	if w := sendIdempotentQuery(handler, "key-1", body); w.Code == http.StatusOK {
+		t.Fatalf("Expected first request to fail")
+	}
+	
+	w := sendIdempotentQuery(handler, "key-1", body)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected retry after a failure to reach the provider, got %d", w.Code)
+	}
+	if w.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Errorf("Expected a fresh response, not a replay")
+	}
+}
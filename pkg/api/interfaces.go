@@ -7,12 +7,18 @@ import (
 )
 
 type RouterInterface interface {
-	RouteRequest(ctx context.Context, req models.QueryRequest) (models.ModelType, error)
-	FallbackOnError(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error)
-	GetAvailability() models.StatusResponse
+	RouteRequest(ctx context.Context, req models.QueryRequest) (models.ModelType, string, error)
+	FallbackOnError(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error, exclude ...models.ModelType) (models.ModelType, error)
+	GetAvailability() models.StatusResponse // Deprecated: use GetModelAvailability
+	GetModelAvailability() models.ModelAvailability
+	RefreshAvailability() models.ModelAvailability
+	RecordTimeout(model models.ModelType)
 }
 
 type CacheInterface interface {
 	Get(req models.QueryRequest) (models.QueryResponse, bool)
 	Set(req models.QueryRequest, resp models.QueryResponse)
+	Stats() models.CacheStats
+	Flush() int
+	Delete(key string) bool
 }
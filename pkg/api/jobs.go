@@ -0,0 +1,293 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	httpclient "github.com/amorin24/llmproxy/pkg/http"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/retry"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/patrickmn/go-cache"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultJobWorkers      = 4
+	defaultJobQueueSize    = 100
+	defaultJobTimeout      = 300  // Seconds a single async query may run
+	defaultJobRetention    = 3600 // Seconds finished jobs stay queryable
+	callbackTimeout        = 10 * time.Second
+	callbackResolveTimeout = 2 * time.Second // Resolving callback_url's host at submit time
+)
+
+var errJobQueueFull = errors.New("job queue is full")
+
+type queryRunner func(ctx context.Context, req models.QueryRequest, requestID string) (models.QueryResponse, *queryError)
+
+type jobTask struct {
+	jobID string
+	req   models.QueryRequest
+}
+
+type JobManager struct {
+	jobs          *cache.Cache
+	queue         chan jobTask
+	runner        queryRunner
+	httpClient    *http.Client
+	callbackRetry retry.Config
+	jobTimeout    time.Duration
+	workers       int
+	startOnce     sync.Once
+	mutex         sync.Mutex
+}
+
+func NewJobManager(runner queryRunner) *JobManager {
+	workers := getEnvAsInt("JOB_WORKERS", defaultJobWorkers)
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	
+	queueSize := getEnvAsInt("JOB_QUEUE_SIZE", defaultJobQueueSize)
+	if queueSize <= 0 {
+		queueSize = defaultJobQueueSize
+	}
+	
+	jobTimeout := getEnvAsInt("JOB_TIMEOUT", defaultJobTimeout)
+	if jobTimeout <= 0 {
+		jobTimeout = defaultJobTimeout
+	}
+	
+	retention := getEnvAsInt("JOB_RETENTION", defaultJobRetention)
+	if retention <= 0 {
+		retention = defaultJobRetention
+	}
+	
+	return &JobManager{
+		jobs:          cache.New(time.Duration(retention)*time.Second, time.Duration(retention)*time.Second),
+		queue:         make(chan jobTask, queueSize),
+		runner:        runner,
+		httpClient:    httpclient.NewWebhookClient(callbackTimeout, config.GetConfig().CallbackAllowPrivateNetworks),
+		callbackRetry: retry.DefaultConfig,
+		jobTimeout:    time.Duration(jobTimeout) * time.Second,
+		workers:       workers,
+	}
+}
+
+func (m *JobManager) Submit(req models.QueryRequest, requestID string) (models.Job, error) {
+	m.startOnce.Do(func() {
+		for i := 0; i < m.workers; i++ {
+			go m.worker()
+		}
+	})
+	
+	now := time.Now()
+	job := &models.Job{
+		ID:          uuid.New().String(),
+		RequestID:   requestID,
+		Status:      models.JobPending,
+		CallbackURL: req.CallbackURL,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	
+	m.mutex.Lock()
+	m.jobs.SetDefault(job.ID, job)
+	snapshot := *job
+	m.mutex.Unlock()
+	
+	select {
+	case m.queue <- jobTask{jobID: job.ID, req: req}:
+		return snapshot, nil
+	default:
+		m.jobs.Delete(job.ID)
+		return models.Job{}, errJobQueueFull
+	}
+}
+
+func (m *JobManager) Get(id string) (models.Job, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	value, found := m.jobs.Get(id)
+	if !found {
+		return models.Job{}, false
+	}
+	
+	return *value.(*models.Job), true
+}
+
+func (m *JobManager) update(id string, fn func(job *models.Job)) (models.Job, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	value, found := m.jobs.Get(id)
+	if !found {
+		return models.Job{}, false
+	}
+	
+	job := value.(*models.Job)
+	fn(job)
+	job.UpdatedAt = time.Now()
+	
+	return *job, true
+}
+
+func (m *JobManager) worker() {
+	for task := range m.queue {
+		m.run(task)
+	}
+}
+
+func (m *JobManager) run(task jobTask) {
+	job, found := m.Get(task.jobID)
+	if !found {
+		return
+	}
+	
+	queueTime := time.Since(job.CreatedAt)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), m.jobTimeout)
+	resp, qErr := m.runner(ctx, task.req, job.RequestID)
+	cancel()
+	
+	if resp.Timings != nil {
+		timings := *resp.Timings
+		timings.QueueMs = queueTime.Milliseconds()
+		resp.Timings = &timings
+	}
+	
+	job, found = m.update(task.jobID, func(job *models.Job) {
+		if qErr != nil {
+			job.Status = models.JobFailed
+			detail := qErr.detail()
+			job.Error = &detail
+			return
+		}
+		job.Status = models.JobDone
+		job.Result = &resp
+	})
+	if !found {
+		return
+	}
+	
+	logrus.WithFields(logrus.Fields{
+		"job_id":     job.ID,
+		"request_id": job.RequestID,
+		"status":     string(job.Status),
+	}).Info("Async job finished")
+	
+	if job.CallbackURL != "" {
+		m.deliverCallback(job)
+	}
+}
+
+func (m *JobManager) deliverCallback(job models.Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		logrus.WithError(err).WithField("job_id", job.ID).Error("Error encoding job callback")
+		return
+	}
+	
+	ctx := context.Background()
+	attempts := 0
+	
+	_, err = retry.Do(ctx, func() (interface{}, error) {
+		attempts++
+		return nil, m.postCallback(ctx, job, body)
+	}, m.callbackRetry)
+	
+	m.update(job.ID, func(job *models.Job) {
+		job.CallbackAttempts = attempts
+		job.CallbackDelivered = err == nil
+	})
+	
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"job_id":     job.ID,
+			"request_id": job.RequestID,
+			"attempts":   attempts,
+			"error":      err.Error(),
+		}).Error("Job callback delivery failed")
+	}
+}
+
+func (m *JobManager) postCallback(ctx context.Context, job models.Job, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, callbackTimeout)
+	defer cancel()
+	
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Request-ID", job.RequestID)
+	httpReq.Header.Set("X-Job-ID", job.ID)
+	
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return myerrors.NewModelError("callback", 0, err, true)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return myerrors.NewModelError("callback", resp.StatusCode, fmt.Errorf("callback returned status %d", resp.StatusCode), retryable)
+}
+
+func isAsyncRequest(r *http.Request) bool {
+	async, err := strconv.ParseBool(r.URL.Query().Get("async"))
+	return err == nil && async
+}
+
+func (h *Handler) submitJob(w http.ResponseWriter, req models.QueryRequest, requestID string) {
+	if h.jobs == nil {
+		handleError(w, "Async jobs are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	
+	job, err := h.jobs.Submit(req, requestID)
+	if err != nil {
+		logrus.WithError(err).WithField("request_id", requestID).Warn("Rejected async job")
+		handleError(w, "Too many pending jobs. Please try again later.", http.StatusServiceUnavailable)
+		return
+	}
+	
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	sendJSONResponse(w, job, http.StatusAccepted)
+}
+
+func (h *Handler) JobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	if h.jobs == nil {
+		handleError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	
+	job, found := h.jobs.Get(mux.Vars(r)["id"])
+	if !found {
+		handleError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	
+	sendJSONResponse(w, job, http.StatusOK)
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	httpclient "github.com/amorin24/llmproxy/pkg/http"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/retry"
+	"github.com/gorilla/mux"
+)
+
+func newJobTestHandler() *Handler {
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	handler.jobs.httpClient = httpclient.NewWebhookClient(callbackTimeout, true) // Test servers listen on loopback
+	handler.jobs.callbackRetry = retry.Config{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		BackoffFactor:  2.0,
+	}
+	return handler
+}
+
+func waitForJob(t *testing.T, handler *Handler, id string, done func(job models.Job) bool) models.Job {
+	t.Helper()
+	
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, found := handler.jobs.Get(id); found && done(job) {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	
+	t.Fatalf("Timed out waiting for job %s", id)
+	return models.Job{}
+}
+
+func TestQueryHandlerAsyncJob(t *testing.T) {
+	cfg := config.GetConfig()
+	originalAllowPrivate := cfg.CallbackAllowPrivateNetworks
+	defer func() { cfg.CallbackAllowPrivateNetworks = originalAllowPrivate }()
+	cfg.CallbackAllowPrivateNetworks = true
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	t.Run("Completed job fires callback", func(t *testing.T) {
+		callbacks := make(chan *http.Request, 1)
+		payloads := make(chan models.Job, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var job models.Job
+			json.NewDecoder(r.Body).Decode(&job)
+			callbacks <- r
+			payloads <- job
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		
+		handler := newJobTestHandler()
+		
+		body := `{"query":"test","callback_url":"` + server.URL + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		
+		handler.QueryHandler(w, req)
+		
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, w.Code)
+		}
+		
+		var accepted models.Job
+		if err := json.NewDecoder(w.Body).Decode(&accepted); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		
+		if accepted.ID == "" || accepted.RequestID == "" {
+			t.Fatalf("Expected job and request IDs, got %+v", accepted)
+		}
+		
+		if w.Header().Get("Location") != "/api/jobs/"+accepted.ID {
+			t.Errorf("Expected Location header for job, got %q", w.Header().Get("Location"))
+		}
+		
+		select {
+		case r := <-callbacks:
+			if r.Header.Get("X-Request-ID") != accepted.RequestID {
+				t.Errorf("Expected X-Request-ID %s, got %s", accepted.RequestID, r.Header.Get("X-Request-ID"))
+			}
+			if r.Header.Get("X-Job-ID") != accepted.ID {
+				t.Errorf("Expected X-Job-ID %s, got %s", accepted.ID, r.Header.Get("X-Job-ID"))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for callback")
+		}
+		
+		payload := <-payloads
+		if payload.Status != models.JobDone {
+			t.Errorf("Expected status %s, got %s", models.JobDone, payload.Status)
+		}
+		if payload.Result == nil || payload.Result.Response == "" {
+			t.Errorf("Expected callback payload to include the result")
+		}
+		
+		job := waitForJob(t, handler, accepted.ID, func(job models.Job) bool {
+			return job.CallbackDelivered
+		})
+		if job.CallbackAttempts != 1 {
+			t.Errorf("Expected 1 callback attempt, got %d", job.CallbackAttempts)
+		}
+	})
+	
+	t.Run("Callback is retried on server errors", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		
+		handler := newJobTestHandler()
+		
+		job, err := handler.jobs.Submit(models.QueryRequest{Query: "test", CallbackURL: server.URL}, "req-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		job = waitForJob(t, handler, job.ID, func(job models.Job) bool {
+			return job.CallbackAttempts > 0
+		})
+		
+		if !job.CallbackDelivered {
+			t.Errorf("Expected callback to be delivered")
+		}
+		if job.CallbackAttempts != 3 {
+			t.Errorf("Expected 3 callback attempts, got %d", job.CallbackAttempts)
+		}
+	})
+	
+	t.Run("Failed query is reported to callback", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		
+		handler := newJobTestHandler()
+		handler.router = &MockRouter{
+			routeRequestFunc: func(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+				return "", context.DeadlineExceeded
+			},
+		}
+		
+		job, err := handler.jobs.Submit(models.QueryRequest{Query: "test", CallbackURL: server.URL}, "req-2")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		job = waitForJob(t, handler, job.ID, func(job models.Job) bool {
+			return job.CallbackDelivered
+		})
+		
+		if job.Status != models.JobFailed {
+			t.Errorf("Expected status %s, got %s", models.JobFailed, job.Status)
+		}
+		if job.Error == nil || job.Error.Code == "" {
+			t.Errorf("Expected error details on failed job, got %+v", job.Error)
+		}
+	})
+	
+	t.Run("Invalid callback URL", func(t *testing.T) {
+		handler := newJobTestHandler()
+		
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test","callback_url":"ftp://example.com"}`))
+		w := httptest.NewRecorder()
+		
+		handler.QueryHandler(w, req)
+		
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestCallbackPrivateNetworks(t *testing.T) {
+	cfg := config.GetConfig()
+	originalAllowPrivate := cfg.CallbackAllowPrivateNetworks
+	defer func() { cfg.CallbackAllowPrivateNetworks = originalAllowPrivate }()
+	cfg.CallbackAllowPrivateNetworks = false
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	for _, callbackURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/hook",
+		"http://[fd00:ec2::254]/hook",
+	} {
+		t.Run(callbackURL, func(t *testing.T) {
+			handler := newJobTestHandler()
+			
+			req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(`{"query":"test","callback_url":"`+callbackURL+`"}`))
+			w := httptest.NewRecorder()
+			
+			handler.QueryHandler(w, req)
+			
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+	
+	t.Run("Dial-time check", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+		}))
+		defer server.Close()
+		
+		// Submit skips validation, as a host that resolved publicly and then rebinds to loopback would
+		handler := newJobTestHandler()
+		handler.jobs.httpClient = httpclient.NewWebhookClient(callbackTimeout, false)
+		job, err := handler.jobs.Submit(models.QueryRequest{Query: "test", CallbackURL: server.URL}, "req-private")
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		
+		job = waitForJob(t, handler, job.ID, func(job models.Job) bool { return job.CallbackAttempts > 0 })
+		if job.CallbackDelivered || hits.Load() != 0 {
+			t.Errorf("Expected callback to a loopback address to be refused, delivered=%v hits=%d", job.CallbackDelivered, hits.Load())
+		}
+	})
+}
+
+func TestJobStatusHandler(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	handler := newJobTestHandler()
+	
+	t.Run("Unknown job", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/jobs/missing", nil), map[string]string{"id": "missing"})
+		w := httptest.NewRecorder()
+		
+		handler.JobStatusHandler(w, req)
+		
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+	
+	t.Run("Done job", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		
+		job, err := handler.jobs.Submit(models.QueryRequest{Query: "test", CallbackURL: server.URL}, "req-3")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		waitForJob(t, handler, job.ID, func(job models.Job) bool {
+			return job.Status == models.JobDone
+		})
+		
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/jobs/"+job.ID, nil), map[string]string{"id": job.ID})
+		w := httptest.NewRecorder()
+		
+		handler.JobStatusHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		
+		var resp models.Job
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		
+		if resp.Status != models.JobDone || resp.Result == nil {
+			t.Errorf("Expected done job with result, got %+v", resp)
+		}
+		if resp.RequestID != "req-3" {
+			t.Errorf("Expected request ID req-3, got %s", resp.RequestID)
+		}
+	})
+}
+
+func TestQueryHandlerAsyncPolling(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	handler := newJobTestHandler()
+	
+	req := httptest.NewRequest(http.MethodPost, "/query?async=true", bytes.NewBufferString(`{"query":"test"}`))
+	w := httptest.NewRecorder()
+	
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, w.Code)
+	}
+	
+	var accepted models.Job
+	if err := json.NewDecoder(w.Body).Decode(&accepted); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	
+	if accepted.Status != models.JobPending {
+		t.Errorf("Expected status %s, got %s", models.JobPending, accepted.Status)
+	}
+	
+	job := waitForJob(t, handler, accepted.ID, func(job models.Job) bool {
+		return job.Status != models.JobPending
+	})
+	
+	if job.Status != models.JobDone {
+		t.Errorf("Expected status %s, got %s", models.JobDone, job.Status)
+	}
+	if job.Result == nil || job.Result.Response == "" {
+		t.Errorf("Expected job result to be populated")
+	}
+	if job.CallbackAttempts != 0 || job.CallbackDelivered {
+		t.Errorf("Expected no callback for polled job, got %d attempts", job.CallbackAttempts)
+	}
+}
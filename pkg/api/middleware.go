@@ -1,7 +1,9 @@
 package api
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -49,7 +51,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-Tenant-ID, X-API-Key, Idempotency-Key")
 		
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -66,6 +68,7 @@ func RateLimitMiddleware(next http.Handler, rateLimiter *RateLimiter) http.Handl
 		
 		if !rateLimiter.AllowClient(clientIP) {
 			logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded")
+			rateLimiter.SetClientHeaders(w, clientIP)
 			handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 			return
 		}
@@ -74,6 +77,33 @@ func RateLimitMiddleware(next http.Handler, rateLimiter *RateLimiter) http.Handl
 	})
 }
 
+func (h *Handler) RateLimitMiddleware(next http.Handler) http.Handler {
+	return RateLimitMiddleware(next, h.rateLimiter)
+}
+
+func AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			handleError(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		
+		token := r.Header.Get("X-Admin-Token")
+		if token == "" {
+			token = bearerToken(r)
+		}
+		
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			logrus.WithField("client_ip", getClientIP(r)).Warn("Rejected admin request")
+			handleError(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		
+		next.ServeHTTP(w, r)
+	})
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -83,3 +113,13 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
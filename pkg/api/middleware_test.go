@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 )
 
@@ -82,7 +83,7 @@ func TestCORSMiddleware(t *testing.T) {
 	expectedHeaders := map[string]string{
 		"Access-Control-Allow-Origin":  "*",
 		"Access-Control-Allow-Methods": "GET, POST, OPTIONS",
-		"Access-Control-Allow-Headers": "Content-Type, Authorization, X-Requested-With",
+		"Access-Control-Allow-Headers": "Content-Type, Authorization, X-Requested-With, X-Tenant-ID, X-API-Key, Idempotency-Key",
 	}
 	
 	for header, expectedValue := range expectedHeaders {
@@ -106,6 +107,26 @@ func TestCORSMiddleware(t *testing.T) {
 	}
 }
 
+func TestHandlerRateLimitMiddleware(t *testing.T) {
+	h := &Handler{rateLimiter: NewRateLimiter(60, 1)}
+	middleware := h.RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	
+	expectedCodes := []int{http.StatusOK, http.StatusTooManyRequests}
+	for i, expectedCode := range expectedCodes {
+		req := httptest.NewRequest(http.MethodPost, "/v1/query", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		w := httptest.NewRecorder()
+		
+		middleware.ServeHTTP(w, req)
+		
+		if w.Code != expectedCode {
+			t.Errorf("Request %d: expected status code %d, got %d", i+1, expectedCode, w.Code)
+		}
+	}
+}
+
 func TestRateLimitMiddleware(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -154,3 +175,68 @@ func TestRateLimitMiddleware(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
 	}
 }
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	originalToken := os.Getenv("ADMIN_TOKEN")
+	defer os.Setenv("ADMIN_TOKEN", originalToken)
+	
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	middleware := AdminAuthMiddleware(handler)
+	
+	tests := []struct {
+		name           string
+		adminToken     string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "Admin token not configured",
+			adminToken:     "",
+			headers:        map[string]string{"X-Admin-Token": "anything"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Missing token",
+			adminToken:     "secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong token",
+			adminToken:     "secret",
+			headers:        map[string]string{"X-Admin-Token": "wrong"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Admin token header",
+			adminToken:     "secret",
+			headers:        map[string]string{"X-Admin-Token": "secret"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Bearer token",
+			adminToken:     "secret",
+			headers:        map[string]string{"Authorization": "Bearer secret"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("ADMIN_TOKEN", tt.adminToken)
+			
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/refresh-availability", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			
+			middleware.ServeHTTP(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -12,16 +12,21 @@ type MockRouter struct {
 	routeRequestFunc    func(ctx context.Context, req models.QueryRequest) (models.ModelType, error)
 	fallbackOnErrorFunc func(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error)
 	getAvailabilityFunc func() models.StatusResponse
+	getModelAvailabilityFunc func() models.ModelAvailability
+	refreshAvailabilityFunc func() models.StatusResponse
+	recordTimeoutFunc   func(model models.ModelType)
+	detectedLanguage    string
 }
 
-func (m *MockRouter) RouteRequest(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+func (m *MockRouter) RouteRequest(ctx context.Context, req models.QueryRequest) (models.ModelType, string, error) {
 	if m.routeRequestFunc != nil {
-		return m.routeRequestFunc(ctx, req)
+		model, err := m.routeRequestFunc(ctx, req)
+		return model, m.detectedLanguage, err
 	}
-	return models.OpenAI, nil
+	return models.OpenAI, m.detectedLanguage, nil
 }
 
-func (m *MockRouter) FallbackOnError(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+func (m *MockRouter) FallbackOnError(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error, exclude ...models.ModelType) (models.ModelType, error) {
 	if m.fallbackOnErrorFunc != nil {
 		return m.fallbackOnErrorFunc(ctx, originalModel, req, err)
 	}
@@ -40,6 +45,26 @@ func (m *MockRouter) GetAvailability() models.StatusResponse {
 	}
 }
 
+func (m *MockRouter) GetModelAvailability() models.ModelAvailability {
+	if m.getModelAvailabilityFunc != nil {
+		return m.getModelAvailabilityFunc()
+	}
+	return m.GetAvailability().ModelAvailability()
+}
+
+func (m *MockRouter) RefreshAvailability() models.ModelAvailability {
+	if m.refreshAvailabilityFunc != nil {
+		return m.refreshAvailabilityFunc().ModelAvailability()
+	}
+	return m.GetModelAvailability()
+}
+
+func (m *MockRouter) RecordTimeout(model models.ModelType) {
+	if m.recordTimeoutFunc != nil {
+		m.recordTimeoutFunc(model)
+	}
+}
+
 func (m *MockRouter) SetTestMode(enabled bool) {
 }
 
@@ -72,6 +97,7 @@ type MockCache struct {
 	mutex   sync.RWMutex
 	getFunc func(req models.QueryRequest) (models.QueryResponse, bool)
 	setFunc func(req models.QueryRequest, resp models.QueryResponse)
+	entries map[string]bool // Keys reported by Stats and removed by Flush and Delete
 }
 
 func (m *MockCache) Get(req models.QueryRequest) (models.QueryResponse, bool) {
@@ -93,12 +119,39 @@ func (m *MockCache) Set(req models.QueryRequest, resp models.QueryResponse) {
 	}
 }
 
+func (m *MockCache) Stats() models.CacheStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	return models.CacheStats{Enabled: true, Size: len(m.entries)}
+}
+
+func (m *MockCache) Flush() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	evicted := len(m.entries)
+	m.entries = nil
+	return evicted
+}
+
+func (m *MockCache) Delete(key string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	if !m.entries[key] {
+		return false
+	}
+	delete(m.entries, key)
+	return true
+}
+
 type MockLLMClient struct {
 	modelType models.ModelType
 	queryFunc func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error)
 }
 
-func (m *MockLLMClient) Query(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+func (m *MockLLMClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
 	if m.queryFunc != nil {
 		return m.queryFunc(ctx, query, modelVersion)
 	}
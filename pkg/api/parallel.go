@@ -2,18 +2,20 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
 	"github.com/amorin24/llmproxy/pkg/llm"
 	"github.com/amorin24/llmproxy/pkg/logging"
 	"github.com/amorin24/llmproxy/pkg/models"
 	"github.com/amorin24/llmproxy/pkg/monitoring"
-	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,13 +24,249 @@ type ParallelQueryRequest struct {
 	Models        []models.ModelType              `json:"models"`
 	ModelVersions map[string]string               `json:"model_versions,omitempty"` // Map of model name to version
 	Timeout       int                             `json:"timeout,omitempty"`        // Timeout in seconds
+	Stop          []string                        `json:"stop,omitempty"`           // Stop sequences for every model
+	MaxTokens     *int                            `json:"max_tokens,omitempty"`     // Output token limit for every model
 }
 
 type ParallelQueryResponse struct {
 	Responses   map[string]models.QueryResponse `json:"responses"`
+	TotalCostUSD float64                        `json:"total_cost_usd"`
 	RequestID   string                          `json:"request_id"`
 	Timestamp   time.Time                       `json:"timestamp"`
 	ElapsedTime int64                           `json:"elapsed_time_ms"`
+	SuccessCount int                            `json:"success_count"`
+	FailureCount int                            `json:"failure_count"`
+}
+
+func parallelStatusCode(responses map[string]models.QueryResponse) (int, int, int) {
+	successes, failures := 0, 0
+	allUnavailable := true
+	for _, response := range responses {
+		if response.Error == "" {
+			successes++
+			continue
+		}
+		failures++
+		if response.ErrorType != myerrors.CodeUnavailable && response.ErrorType != myerrors.CodeRateLimit {
+			allUnavailable = false
+		}
+	}
+	
+	switch {
+	case failures == 0:
+		return http.StatusOK, successes, failures
+	case successes > 0:
+		return http.StatusMultiStatus, successes, failures
+	case allUnavailable:
+		return http.StatusServiceUnavailable, successes, failures
+	default:
+		return http.StatusBadGateway, successes, failures
+	}
+}
+
+func dedupeParallelModels(requested []models.ModelType, maxModels int) ([]models.ModelType, error) {
+	seen := make(map[models.ModelType]bool)
+	modelList := make([]models.ModelType, 0, len(requested))
+	
+	for _, model := range requested {
+		model = models.ModelType(strings.ToLower(strings.TrimSpace(string(model))))
+		if seen[model] {
+			return nil, fmt.Errorf("duplicate model in request: %s", model)
+		}
+		seen[model] = true
+		modelList = append(modelList, model)
+	}
+	
+	if maxModels > 0 && len(modelList) > maxModels {
+		return nil, fmt.Errorf("too many models: %d requested, maximum is %d", len(modelList), maxModels)
+	}
+	
+	return modelList, nil
+}
+
+func (h *Handler) defaultParallelModels(tenant string) []models.ModelType {
+	availability := h.router.GetModelAvailability()
+	
+	var available []models.ModelType
+	for _, model := range config.GetConfig().ParallelModels(tenant) {
+		if availability[string(model)] {
+			available = append(available, model)
+		} else {
+			logrus.WithField("model", string(model)).Debug("Skipping unavailable model in parallel query")
+		}
+	}
+	return available
+}
+
+func (h *Handler) resolveParallelModels(requested []models.ModelType, tenant string) ([]models.ModelType, *queryError) {
+	maxModels := config.GetConfig().MaxParallelModels
+	if len(requested) == 0 {
+		requested = h.defaultParallelModels(tenant)
+		if len(requested) == 0 {
+			return nil, &queryError{Message: "No models available for a parallel query", StatusCode: http.StatusServiceUnavailable, Code: myerrors.CodeUnavailable}
+		}
+		if maxModels > 0 && len(requested) > maxModels {
+			requested = requested[:maxModels]
+		}
+	}
+	
+	modelList, err := dedupeParallelModels(requested, maxModels)
+	if err != nil {
+		return nil, &queryError{Message: err.Error(), StatusCode: http.StatusBadRequest, Code: errorCodeForStatus(http.StatusBadRequest)}
+	}
+	
+	availability := h.router.GetModelAvailability()
+	for _, model := range modelList {
+		valid := false
+		for _, validModel := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+			if model == validModel {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, &queryError{Message: "Invalid model: " + string(model), StatusCode: http.StatusBadRequest, Code: errorCodeForStatus(http.StatusBadRequest)}
+		}
+		if !config.GetConfig().IsModelAllowed(tenant, model) {
+			return nil, &queryError{Message: "Model not allowed for tenant: " + string(model), StatusCode: http.StatusForbidden, Code: myerrors.CodeModelNotAllowed, Model: string(model)}
+		}
+		if config.GetConfig().IsModelDisabled(model) || !availability[string(model)] {
+			return nil, &queryError{Message: "Model not available: " + string(model), StatusCode: http.StatusServiceUnavailable, Code: myerrors.CodeUnavailable, Model: string(model)}
+		}
+	}
+	
+	return modelList, nil
+}
+
+func subRequestID(requestID string, model models.ModelType) string {
+	return requestID + "/" + string(model)
+}
+
+func (h *Handler) queryParallelModel(ctx context.Context, model models.ModelType, query string, modelVersion string, opts llm.QueryOptions, tenant string, priority string, requestID string) models.QueryResponse {
+	requestID = subRequestID(requestID, model)
+	ctx = llm.WithRequestID(ctx, requestID)
+	
+	metrics := monitoring.GetMetrics()
+	metrics.IncreaseActiveRequests(string(model))
+	defer metrics.DecreaseActiveRequests(string(model))
+	
+	modelStartTime := time.Now()
+	
+	release, err := h.admission.acquire(ctx, priority)
+	if err != nil {
+		response := models.QueryResponse{
+			Model:        model,
+			ResponseTime: time.Since(modelStartTime).Milliseconds(),
+			Timestamp:    time.Now(),
+			RequestID:    requestID,
+			Error:        "timeout",
+			ErrorType:    myerrors.CodeTimeout,
+		}
+		if errors.Is(err, errRequestShed) {
+			response.Error = "Server is overloaded. Please try again later."
+			response.ErrorType = myerrors.CodeRateLimit
+		}
+		return response
+	}
+	defer release()
+	
+	client, err := llm.Factory(model)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"model":      string(model),
+			"error":      err.Error(),
+			"request_id": requestID,
+		}).Error("Error creating LLM client")
+		
+		metrics.RecordError("client_creation_error")
+		return models.QueryResponse{
+			Model:        model,
+			Response:     "Error: " + err.Error(),
+			ResponseTime: time.Since(modelStartTime).Milliseconds(),
+			Timestamp:    time.Now(),
+			RequestID:    requestID,
+			Error:        err.Error(),
+		}
+	}
+	
+	client = h.limitClient(client, tenant)
+	result, err := client.Query(ctx, query, modelVersion, opts)
+	
+	modelElapsedTime := time.Since(modelStartTime).Milliseconds()
+	
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			logrus.WithFields(logrus.Fields{
+				"model":      string(model),
+				"error":      "request timeout or canceled",
+				"request_id": requestID,
+			}).Warn("Request timeout or canceled")
+			
+			metrics.RecordError("timeout")
+			return models.QueryResponse{
+				Model:        model,
+				Response:     "Error: Request timed out or was canceled",
+				ResponseTime: modelElapsedTime,
+				Timestamp:    time.Now(),
+				RequestID:    requestID,
+				Error:        "timeout",
+				ErrorType:    myerrors.CodeTimeout,
+			}
+		}
+		
+		logrus.WithFields(logrus.Fields{
+			"model":      string(model),
+			"error":      err.Error(),
+			"request_id": requestID,
+		}).Error("Error querying LLM")
+		
+		metrics.RecordError("query_error")
+		return models.QueryResponse{
+			Model:        model,
+			Response:     "Error: " + err.Error(),
+			ResponseTime: modelElapsedTime,
+			Timestamp:    time.Now(),
+			RequestID:    requestID,
+			Error:        err.Error(),
+			ErrorType:    myerrors.ErrorCode(err),
+		}
+	}
+	
+	metrics.RecordRequest(string(model), http.StatusOK, time.Since(modelStartTime))
+	if result.TotalTokens > 0 {
+		metrics.RecordTokens(string(model), result.TotalTokens)
+	}
+	monitoring.RecordTokenLengths(string(model), result.InputTokens, result.OutputTokens)
+	costUSD := h.recordCost(model, result.ModelVersion, result.InputTokens, result.OutputTokens)
+	h.usage.record(tenant, model, result.InputTokens, result.OutputTokens, costUSD)
+	
+	logging.LogResponse(logging.LogFields{
+		Model:        string(model),
+		Response:     result.Response,
+		ResponseTime: modelElapsedTime,
+		StatusCode:   result.StatusCode,
+		NumTokens:    result.NumTokens,
+		NumRetries:   result.NumRetries,
+		RequestID:    requestID,
+		Timestamp:    time.Now(),
+	})
+	
+	return models.QueryResponse{
+		Response:     result.Response,
+		Model:        model,
+		ModelVersion: result.ModelVersion,
+		ResponseTime: modelElapsedTime,
+		Timestamp:    time.Now(),
+		RequestID:    requestID,
+		InputTokens:  result.InputTokens,
+		OutputTokens: result.OutputTokens,
+		TotalTokens:  result.TotalTokens,
+		NumTokens:    result.NumTokens,
+		NumRetries:   result.NumRetries,
+		FinishReason: result.FinishReason,
+		ProviderRequestID: result.ProviderRequestID,
+		CostUSD:      costUSD,
+	}
 }
 
 func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
@@ -40,13 +278,20 @@ func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
 	if !h.rateLimiter.AllowClient(clientIP) {
 		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
 		handleError(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
 	
+	tenant, err := getTenant(r)
+	if err != nil {
+		handleTenantError(w, err)
+		return
+	}
+	
 	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
 	
-	requestID := uuid.New().String()
+	requestID := requestIDFor(w, r)
 	
 	var req ParallelQueryRequest
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -59,11 +304,13 @@ func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if err := json.Unmarshal(bodyBytes, &req); err != nil {
-		handleError(w, "Invalid JSON in request body", http.StatusBadRequest)
+	if err := decodeRequestBody(bodyBytes, &req); err != nil {
+		handleDecodeError(w, err)
 		return
 	}
 	
+	req.Query = sanitizeQuery(req.Query)
+	
 	if req.Query == "" {
 		handleError(w, "Query cannot be empty", http.StatusBadRequest)
 		return
@@ -74,30 +321,23 @@ func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if len(req.Models) == 0 {
-		req.Models = []models.ModelType{
-			models.OpenAI,
-			models.Gemini,
-			models.Mistral,
-			models.Claude,
-		}
+	priority := requestPriority(r, tenant)
+	req.Query = wrapPrompt(req.Query, tenant)
+	modelList, qErr := h.resolveParallelModels(req.Models, tenant)
+	if qErr != nil {
+		writeQueryError(w, qErr)
+		return
 	}
+	req.Models = modelList
 	
-	for _, model := range req.Models {
-		valid := false
-		for _, validModel := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
-			if model == validModel {
-				valid = true
-				break
-			}
-		}
-		if !valid {
-			handleError(w, "Invalid model: "+string(model), http.StatusBadRequest)
-			return
-		}
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		handleError(w, "max_tokens must be at least 1", http.StatusBadRequest)
+		return
+	}
+	if err := checkTokenCeiling(req.MaxTokens, len(req.Models)); err != nil {
+		handleError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	
-	req.Query = sanitizeQuery(req.Query)
 	
 	logging.LogRequest(logging.LogFields{
 		Model:      "parallel",
@@ -106,12 +346,12 @@ func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
 		RequestID:  requestID,
 	})
 	
-	timeout := defaultTimeout
+	timeout := h.timeout()
 	if req.Timeout > 0 {
 		timeout = time.Duration(req.Timeout) * time.Second
 	}
 	
-	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	ctx, cancel := context.WithTimeout(llm.WithRequestID(r.Context(), requestID), timeout)
 	defer cancel()
 	
 	startTime := time.Now()
@@ -120,125 +360,16 @@ func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	
-	metrics := monitoring.GetMetrics()
-	
 	for _, modelType := range req.Models {
 		wg.Add(1)
 		go func(model models.ModelType) {
 			defer wg.Done()
 			
-			metrics.IncreaseActiveRequests(string(model))
-			defer metrics.DecreaseActiveRequests(string(model))
-			
-			modelStartTime := time.Now()
-			
-			client, err := llm.Factory(model)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"model":      string(model),
-					"error":      err.Error(),
-					"request_id": requestID,
-				}).Error("Error creating LLM client")
-				
-				mu.Lock()
-				responses[string(model)] = models.QueryResponse{
-					Model:        model,
-					Response:     "Error: " + err.Error(),
-					ResponseTime: time.Since(modelStartTime).Milliseconds(),
-					Timestamp:    time.Now(),
-					RequestID:    requestID,
-					Error:        err.Error(),
-				}
-				mu.Unlock()
-				
-				metrics.RecordError("client_creation_error")
-				return
-			}
-			
-			modelVersion := ""
-			if req.ModelVersions != nil {
-				if version, ok := req.ModelVersions[string(model)]; ok {
-					modelVersion = version
-				}
-			}
-			
-			result, err := client.Query(ctx, req.Query, modelVersion)
-			
-			modelElapsedTime := time.Since(modelStartTime).Milliseconds()
-			
-			if err != nil {
-				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-					logrus.WithFields(logrus.Fields{
-						"model":      string(model),
-						"error":      "request timeout or canceled",
-						"request_id": requestID,
-					}).Warn("Request timeout or canceled")
-					
-					mu.Lock()
-					responses[string(model)] = models.QueryResponse{
-						Model:        model,
-						Response:     "Error: Request timed out or was canceled",
-						ResponseTime: modelElapsedTime,
-						Timestamp:    time.Now(),
-						RequestID:    requestID,
-						Error:        "timeout",
-					}
-					mu.Unlock()
-					
-					metrics.RecordError("timeout")
-				} else {
-					logrus.WithFields(logrus.Fields{
-						"model":      string(model),
-						"error":      err.Error(),
-						"request_id": requestID,
-					}).Error("Error querying LLM")
-					
-					mu.Lock()
-					responses[string(model)] = models.QueryResponse{
-						Model:        model,
-						Response:     "Error: " + err.Error(),
-						ResponseTime: modelElapsedTime,
-						Timestamp:    time.Now(),
-						RequestID:    requestID,
-						Error:        err.Error(),
-					}
-					mu.Unlock()
-					
-					metrics.RecordError("query_error")
-				}
-				return
-			}
-			
-			metrics.RecordRequest(string(model), http.StatusOK, time.Since(modelStartTime))
-			if result.TotalTokens > 0 {
-				metrics.RecordTokens(string(model), result.TotalTokens)
-			}
+			response := h.queryParallelModel(ctx, model, req.Query, req.ModelVersions[string(model)], llm.QueryOptions{Stop: req.Stop, MaxTokens: req.MaxTokens}, tenant, priority, requestID)
 			
 			mu.Lock()
-			responses[string(model)] = models.QueryResponse{
-				Response:     result.Response,
-				Model:        model,
-				ResponseTime: modelElapsedTime,
-				Timestamp:    time.Now(),
-				RequestID:    requestID,
-				InputTokens:  result.InputTokens,
-				OutputTokens: result.OutputTokens,
-				TotalTokens:  result.TotalTokens,
-				NumTokens:    result.NumTokens,
-				NumRetries:   result.NumRetries,
-			}
+			responses[string(model)] = response
 			mu.Unlock()
-			
-			logging.LogResponse(logging.LogFields{
-				Model:        string(model),
-				Response:     result.Response,
-				ResponseTime: modelElapsedTime,
-				StatusCode:   result.StatusCode,
-				NumTokens:    result.NumTokens,
-				NumRetries:   result.NumRetries,
-				RequestID:    requestID,
-				Timestamp:    time.Now(),
-			})
 		}(modelType)
 	}
 	
@@ -246,19 +377,30 @@ func (h *Handler) ParallelQueryHandler(w http.ResponseWriter, r *http.Request) {
 	
 	elapsedTime := time.Since(startTime).Milliseconds()
 	
+	totalCost := 0.0
+	for _, response := range responses {
+		totalCost += response.CostUSD
+	}
+	
+	statusCode, successes, failures := parallelStatusCode(responses)
+	
 	resp := ParallelQueryResponse{
 		Responses:   responses,
+		TotalCostUSD: totalCost,
 		RequestID:   requestID,
 		Timestamp:   time.Now(),
 		ElapsedTime: elapsedTime,
+		SuccessCount: successes,
+		FailureCount: failures,
 	}
 	
 	logging.LogResponse(logging.LogFields{
 		Model:        "parallel",
 		ResponseTime: elapsedTime,
+		StatusCode:   statusCode,
 		RequestID:    requestID,
 		Timestamp:    time.Now(),
 	})
 	
-	sendJSONResponse(w, resp, http.StatusOK)
+	sendJSONResponse(w, resp, statusCode)
 }
@@ -0,0 +1,439 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/pricing"
+)
+
+func TestDedupeParallelModels(t *testing.T) {
+	testCases := []struct {
+		name        string
+		requested   []models.ModelType
+		maxModels   int
+		expected    []models.ModelType
+		expectError bool
+	}{
+		{
+			name:      "Unique models",
+			requested: []models.ModelType{models.OpenAI, models.Claude},
+			maxModels: 4,
+			expected:  []models.ModelType{models.OpenAI, models.Claude},
+		},
+		{
+			name:      "Names are normalized",
+			requested: []models.ModelType{" OpenAI", "CLAUDE "},
+			maxModels: 4,
+			expected:  []models.ModelType{models.OpenAI, models.Claude},
+		},
+		{
+			name:        "Duplicate model",
+			requested:   []models.ModelType{models.OpenAI, models.Gemini, models.OpenAI},
+			maxModels:   4,
+			expectError: true,
+		},
+		{
+			name:        "Duplicate after normalization",
+			requested:   []models.ModelType{models.OpenAI, "OpenAI"},
+			maxModels:   4,
+			expectError: true,
+		},
+		{
+			name:        "Too many models",
+			requested:   []models.ModelType{models.OpenAI, models.Gemini, models.Mistral},
+			maxModels:   2,
+			expectError: true,
+		},
+		{
+			name:      "No cap",
+			requested: []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude},
+			maxModels: 0,
+			expected:  []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude},
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			modelList, err := dedupeParallelModels(tc.requested, tc.maxModels)
+			if tc.expectError {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", modelList)
+				}
+				return
+			}
+			
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			
+			if len(modelList) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, modelList)
+			}
+			for i := range tc.expected {
+				if modelList[i] != tc.expected[i] {
+					t.Errorf("Expected %v, got %v", tc.expected, modelList)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelQueryHandlerModelLimits(t *testing.T) {
+	cfg := config.GetConfig()
+	originalMax := cfg.MaxParallelModels
+	originalCeiling := cfg.MaxTokensPerRequest
+	defer func() {
+		cfg.MaxParallelModels = originalMax
+		cfg.MaxTokensPerRequest = originalCeiling
+	}()
+	cfg.MaxParallelModels = 2
+	cfg.MaxTokensPerRequest = 1000
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"Within limit", `{"query":"test","models":["openai","claude"]}`, http.StatusOK},
+		{"Default models capped", `{"query":"test"}`, http.StatusOK},
+		{"Duplicate models", `{"query":"test","models":["openai","openai"]}`, http.StatusBadRequest},
+		{"Too many models", `{"query":"test","models":["openai","claude","gemini"]}`, http.StatusBadRequest},
+		{"Within token ceiling", `{"query":"test","models":["openai","claude"],"max_tokens":500}`, http.StatusOK},
+		{"Token ceiling across models", `{"query":"test","models":["openai","claude"],"max_tokens":600}`, http.StatusBadRequest},
+		{"Invalid max_tokens", `{"query":"test","models":["openai"],"max_tokens":0}`, http.StatusBadRequest},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			
+			req := httptest.NewRequest(http.MethodPost, "/parallel", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			
+			handler.ParallelQueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestParallelQueryHandlerDefaultModels(t *testing.T) {
+	cfg := config.GetConfig()
+	originalTenantModels := cfg.TenantModels
+	originalTenantParallel := cfg.TenantParallelModels
+	originalDefaultParallel := cfg.DefaultParallelModels
+	defer func() {
+		cfg.TenantModels = originalTenantModels
+		cfg.TenantParallelModels = originalTenantParallel
+		cfg.DefaultParallelModels = originalDefaultParallel
+	}()
+	cfg.TenantModels = map[string][]models.ModelType{"acme": {models.Mistral, models.Gemini}}
+	cfg.TenantParallelModels = map[string][]models.ModelType{"acme": {models.Mistral, models.Gemini, models.OpenAI}}
+	cfg.DefaultParallelModels = []models.ModelType{models.OpenAI, models.Claude}
+	originalAPIKeys := cfg.TenantAPIKeys
+	defer func() { cfg.TenantAPIKeys = originalAPIKeys }()
+	cfg.TenantAPIKeys = map[string]string{"key-acme": "acme"}
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	tests := []struct {
+		name           string
+		tenant         string
+		unavailable    []models.ModelType
+		expectedStatus int
+		expectedModels []string
+	}{
+		{"Global default", "", nil, http.StatusOK, []string{"openai", "claude"}},
+		{"Tenant default filtered by allow-list", "acme", nil, http.StatusOK, []string{"mistral", "gemini"}},
+		{"Unavailable models skipped", "acme", []models.ModelType{models.Gemini}, http.StatusOK, []string{"mistral"}},
+		{"Nothing available", "", []models.ModelType{models.OpenAI, models.Claude}, http.StatusServiceUnavailable, nil},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler()
+			handler.router = &MockRouter{
+				getModelAvailabilityFunc: func() models.ModelAvailability {
+					availability := models.ModelAvailability{"openai": true, "gemini": true, "mistral": true, "claude": true}
+					for _, model := range tt.unavailable {
+						availability[string(model)] = false
+					}
+					return availability
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/parallel", bytes.NewBufferString(`{"query":"test"}`))
+			if tt.tenant != "" {
+				req.Header.Set(apiKeyHeader, "key-"+tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			
+			handler.ParallelQueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			
+			var resp ParallelQueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if len(resp.Responses) != len(tt.expectedModels) {
+				t.Errorf("Expected responses for %v, got %d", tt.expectedModels, len(resp.Responses))
+			}
+			for _, model := range tt.expectedModels {
+				if _, ok := resp.Responses[model]; !ok {
+					t.Errorf("Expected a response for %s", model)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelQueryHandlerExplicitModelAvailability(t *testing.T) {
+	cfg := config.GetConfig()
+	originalDisabled := cfg.DisabledModels
+	defer func() { cfg.DisabledModels = originalDisabled }()
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	tests := []struct {
+		name           string
+		disabled       []models.ModelType
+		unavailable    []models.ModelType
+		expectedStatus int
+	}{
+		{"All available", nil, nil, http.StatusOK},
+		{"Disabled model", []models.ModelType{models.Claude}, nil, http.StatusServiceUnavailable},
+		{"Unavailable model", nil, []models.ModelType{models.Claude}, http.StatusServiceUnavailable},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.DisabledModels = tt.disabled
+			
+			handler := NewHandler()
+			handler.router = &MockRouter{
+				getModelAvailabilityFunc: func() models.ModelAvailability {
+					availability := models.ModelAvailability{"openai": true, "gemini": true, "mistral": true, "claude": true}
+					for _, model := range tt.unavailable {
+						availability[string(model)] = false
+					}
+					return availability
+				},
+			}
+			
+			req := httptest.NewRequest(http.MethodPost, "/parallel", bytes.NewBufferString(`{"query":"test","models":["openai","claude"]}`))
+			w := httptest.NewRecorder()
+			
+			handler.ParallelQueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK && !strings.Contains(w.Body.String(), "claude") {
+				t.Errorf("Expected the error to name the unavailable model, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestParallelQueryHandlerCost(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	versions := map[models.ModelType]string{
+		models.OpenAI: "gpt-4o",
+		models.Claude: "claude-3-haiku-20240307",
+	}
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				return &llm.QueryResult{
+					Response:     "Mock response",
+					ModelVersion: versions[modelType],
+					InputTokens:  1000,
+					OutputTokens: 1000,
+					TotalTokens:  2000,
+				}, nil
+			},
+		}, nil
+	}
+	
+	catalogLoader, err := pricing.NewDefaultCatalogLoader()
+	if err != nil {
+		t.Fatalf("Error loading price catalog: %v", err)
+	}
+	
+	t.Run("Catalog loaded", func(t *testing.T) {
+		handler := NewHandler()
+		handler.costEstimator = pricing.NewCostEstimator(catalogLoader)
+		
+		resp := runParallelQuery(t, handler, `{"query":"test","models":["openai","claude"]}`)
+		
+		total := 0.0
+		for model, response := range resp.Responses {
+			if response.CostUSD <= 0 {
+				t.Errorf("Expected a cost for %s, got %v", model, response.CostUSD)
+			}
+			total += response.CostUSD
+		}
+		
+		if math.Abs(resp.TotalCostUSD-total) > 1e-9 {
+			t.Errorf("Expected total cost %v, got %v", total, resp.TotalCostUSD)
+		}
+	})
+	
+	t.Run("Catalog missing", func(t *testing.T) {
+		handler := NewHandler()
+		handler.costEstimator = nil
+		
+		resp := runParallelQuery(t, handler, `{"query":"test","models":["openai"]}`)
+		
+		if resp.TotalCostUSD != 0 || resp.Responses["openai"].CostUSD != 0 {
+			t.Errorf("Expected no cost without a catalog, got %+v", resp)
+		}
+	})
+}
+
+func TestParallelQueryHandlerStatusCodes(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	tests := []struct {
+		name            string
+		failures        map[models.ModelType]error
+		expectedStatus  int
+		expectedSuccess int
+		expectedFailure int
+	}{
+		{"All succeed", nil, http.StatusOK, 2, 0},
+		{"Some fail", map[models.ModelType]error{models.Claude: myerrors.NewTimeoutError("claude")}, http.StatusMultiStatus, 1, 1},
+		{"All unavailable", map[models.ModelType]error{
+			models.OpenAI: myerrors.NewUnavailableError("openai"),
+			models.Claude: myerrors.NewRateLimitError("claude"),
+		}, http.StatusServiceUnavailable, 0, 2},
+		{"All fail", map[models.ModelType]error{
+			models.OpenAI: myerrors.NewUnavailableError("openai"),
+			models.Claude: myerrors.NewEmptyResponseError("claude"),
+		}, http.StatusBadGateway, 0, 2},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+				return &MockLLMClient{
+					modelType: modelType,
+					queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+						if err := tt.failures[modelType]; err != nil {
+							return nil, err
+						}
+						return &llm.QueryResult{Response: "Mock response"}, nil
+					},
+				}, nil
+			}
+			
+			handler := NewHandler()
+			req := httptest.NewRequest(http.MethodPost, "/parallel", bytes.NewBufferString(`{"query":"test","models":["openai","claude"]}`))
+			w := httptest.NewRecorder()
+			
+			handler.ParallelQueryHandler(w, req)
+			
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			
+			var resp ParallelQueryResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if resp.SuccessCount != tt.expectedSuccess || resp.FailureCount != tt.expectedFailure {
+				t.Errorf("Expected %d succeeded and %d failed, got %d and %d", tt.expectedSuccess, tt.expectedFailure, resp.SuccessCount, resp.FailureCount)
+			}
+			
+			for model := range tt.failures {
+				if response := resp.Responses[string(model)]; response.Error == "" || response.ErrorType == "" {
+					t.Errorf("Expected error detail for %s, got %+v", model, response)
+				}
+			}
+		})
+	}
+}
+
+func runParallelQuery(t *testing.T, handler *Handler, body string) ParallelQueryResponse {
+	t.Helper()
+	
+	req := httptest.NewRequest(http.MethodPost, "/parallel", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	
+	handler.ParallelQueryHandler(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	
+	var resp ParallelQueryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return resp
+}
+
+func TestParallelQueryHandlerSubRequestIDs(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var mu sync.Mutex
+	providerIDs := make(map[models.ModelType]string)
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				mu.Lock()
+				providerIDs[modelType] = llm.RequestIDFromContext(ctx)
+				mu.Unlock()
+				return &llm.QueryResult{Response: "Mock response"}, nil
+			},
+		}, nil
+	}
+	
+	resp := runParallelQuery(t, NewHandler(), `{"query":"test","models":["openai","claude"]}`)
+	
+	for _, model := range []models.ModelType{models.OpenAI, models.Claude} {
+		expected := resp.RequestID + "/" + string(model)
+		if got := resp.Responses[string(model)].RequestID; got != expected {
+			t.Errorf("Expected %s sub-response request ID %q, got %q", model, expected, got)
+		}
+		if providerIDs[model] != expected {
+			t.Errorf("Expected %s provider call to carry %q, got %q", model, expected, providerIDs[model])
+		}
+	}
+}
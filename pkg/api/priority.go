@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+)
+
+const (
+	priorityHeader       = "X-Priority"
+	overloadedRetryAfter = 1 // Seconds a shed client should wait, slots free up as queries finish
+)
+
+var errRequestShed = errors.New("request shed by the priority queue")
+
+func requestPriority(r *http.Request, tenant string) string {
+	priority := config.GetConfig().TenantPriority(tenant)
+	requested := strings.ToLower(strings.TrimSpace(r.Header.Get(priorityHeader)))
+	if config.PriorityRank(requested) > config.PriorityRank(priority) {
+		return requested // Clients may lower their priority, never raise it
+	}
+	return priority
+}
+
+type admissionWaiter struct {
+	ready chan struct{} // Closed when the waiter is given a slot or shed
+	shed  bool
+}
+
+type admissionQueue struct {
+	mutex    sync.Mutex
+	inFlight int
+	waiting  [][]*admissionWaiter // FIFO per tier, in config.Priorities order
+}
+
+func newAdmissionQueue() *admissionQueue {
+	return &admissionQueue{waiting: make([][]*admissionWaiter, len(config.Priorities))}
+}
+
+func (q *admissionQueue) acquire(ctx context.Context, priority string) (func(), error) {
+	cfg := config.GetConfig()
+	if q == nil || cfg.MaxConcurrentRequests <= 0 {
+		return func() {}, nil
+	}
+	
+	rank := config.PriorityRank(priority)
+	if rank < 0 {
+		priority, rank = config.PriorityNormal, config.PriorityRank(config.PriorityNormal)
+	}
+	
+	q.mutex.Lock()
+	if q.inFlight < cfg.MaxConcurrentRequests && q.queued() == 0 {
+		q.inFlight++
+		q.mutex.Unlock()
+		return q.release, nil
+	}
+	
+	if q.queued() >= cfg.MaxQueuedRequests && !q.shedBelow(rank) {
+		q.mutex.Unlock()
+		monitoring.RecordShedRequest(priority)
+		return nil, errRequestShed
+	}
+	
+	waiter := &admissionWaiter{ready: make(chan struct{})}
+	q.waiting[rank] = append(q.waiting[rank], waiter)
+	q.reportDepth()
+	q.mutex.Unlock()
+	
+	select {
+	case <-waiter.ready:
+	case <-ctx.Done():
+		q.mutex.Lock()
+		select {
+		case <-waiter.ready:
+			q.mutex.Unlock()
+			if !waiter.shed {
+				q.release() // The slot arrived as the context ended, pass it on
+			}
+		default:
+			q.remove(rank, waiter)
+			q.mutex.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+	
+	if waiter.shed {
+		monitoring.RecordShedRequest(priority)
+		return nil, errRequestShed
+	}
+	return q.release, nil
+}
+
+// tryAcquire takes a slot only if one is free right now, for speculative work such as
+// hedges that should neither wait nor shed queued requests.
+func (q *admissionQueue) tryAcquire() (func(), bool) {
+	cfg := config.GetConfig()
+	if q == nil || cfg.MaxConcurrentRequests <= 0 {
+		return func() {}, true
+	}
+	
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.inFlight < cfg.MaxConcurrentRequests && q.queued() == 0 {
+		q.inFlight++
+		return q.release, true
+	}
+	return nil, false
+}
+
+func (q *admissionQueue) release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	
+	for rank, waiters := range q.waiting {
+		if len(waiters) == 0 {
+			continue
+		}
+		q.waiting[rank] = waiters[1:]
+		close(waiters[0].ready) // Hand the slot over, inFlight is unchanged
+		q.reportDepth()
+		return
+	}
+	q.inFlight--
+}
+
+func (q *admissionQueue) queued() int {
+	total := 0
+	for _, waiters := range q.waiting {
+		total += len(waiters)
+	}
+	return total
+}
+
+// Makes room for a higher tier by shedding the newest waiter of the lowest tier below it
+func (q *admissionQueue) shedBelow(rank int) bool {
+	for lower := len(q.waiting) - 1; lower > rank; lower-- {
+		waiters := q.waiting[lower]
+		if len(waiters) == 0 {
+			continue
+		}
+		victim := waiters[len(waiters)-1]
+		q.waiting[lower] = waiters[:len(waiters)-1]
+		victim.shed = true
+		close(victim.ready)
+		return true
+	}
+	return false
+}
+
+func (q *admissionQueue) remove(rank int, waiter *admissionWaiter) {
+	waiters := q.waiting[rank]
+	for i, queued := range waiters {
+		if queued == waiter {
+			q.waiting[rank] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	q.reportDepth()
+}
+
+func (q *admissionQueue) reportDepth() {
+	for rank, waiters := range q.waiting {
+		monitoring.SetPriorityQueueDepth(config.Priorities[rank], len(waiters))
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func setAdmissionLimits(t *testing.T, concurrent, queued int) {
+	cfg := config.GetConfig()
+	originalConcurrent, originalQueued := cfg.MaxConcurrentRequests, cfg.MaxQueuedRequests
+	t.Cleanup(func() { cfg.MaxConcurrentRequests, cfg.MaxQueuedRequests = originalConcurrent, originalQueued })
+	cfg.MaxConcurrentRequests, cfg.MaxQueuedRequests = concurrent, queued
+}
+
+func acquireAsync(q *admissionQueue, ctx context.Context, priority string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		release, err := q.acquire(ctx, priority)
+		if err == nil {
+			defer release()
+		}
+		result <- err
+	}()
+	return result
+}
+
+func waitForQueued(t *testing.T, q *admissionQueue, expected int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		q.mutex.Lock()
+		queued := q.queued()
+		q.mutex.Unlock()
+		if queued == expected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %d queued queries", expected)
+}
+
+func TestAdmissionQueue(t *testing.T) {
+	t.Run("Higher tiers are admitted first", func(t *testing.T) {
+		setAdmissionLimits(t, 1, 10)
+		q := newAdmissionQueue()
+		release, err := q.acquire(context.Background(), config.PriorityNormal)
+		if err != nil {
+			t.Fatalf("Expected a free slot, got %v", err)
+		}
+		
+		order := make(chan string, 2)
+		var done sync.WaitGroup
+		for _, priority := range []string{config.PriorityLow, config.PriorityHigh} {
+			priority := priority
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				next, err := q.acquire(context.Background(), priority)
+				if err != nil {
+					t.Errorf("Unexpected error for %s: %v", priority, err)
+					return
+				}
+				order <- priority
+				next()
+			}()
+			waitForQueued(t, q, map[string]int{config.PriorityLow: 1, config.PriorityHigh: 2}[priority])
+		}
+		
+		release()
+		if first, second := <-order, <-order; first != config.PriorityHigh || second != config.PriorityLow {
+			t.Errorf("Expected high before low, got %s then %s", first, second)
+		}
+		done.Wait()
+		if q.inFlight != 0 {
+			t.Errorf("Expected every slot to be returned, %d in flight", q.inFlight)
+		}
+	})
+	
+	t.Run("Low tiers are shed first when the queue is full", func(t *testing.T) {
+		setAdmissionLimits(t, 1, 1)
+		q := newAdmissionQueue()
+		release, _ := q.acquire(context.Background(), config.PriorityNormal)
+		
+		low := acquireAsync(q, context.Background(), config.PriorityLow)
+		waitForQueued(t, q, 1)
+		
+		high := acquireAsync(q, context.Background(), config.PriorityHigh)
+		if err := <-low; !errors.Is(err, errRequestShed) {
+			t.Errorf("Expected the queued low priority query to be shed, got %v", err)
+		}
+		waitForQueued(t, q, 1)
+		
+		if _, err := q.acquire(context.Background(), config.PriorityNormal); !errors.Is(err, errRequestShed) {
+			t.Errorf("Expected a query with nothing lower to shed to be rejected, got %v", err)
+		}
+		
+		release()
+		if err := <-high; err != nil {
+			t.Errorf("Expected the high priority query to run, got %v", err)
+		}
+	})
+	
+	t.Run("Canceled waiters leave the queue", func(t *testing.T) {
+		setAdmissionLimits(t, 1, 10)
+		q := newAdmissionQueue()
+		release, _ := q.acquire(context.Background(), config.PriorityNormal)
+		
+		ctx, cancel := context.WithCancel(context.Background())
+		waiting := acquireAsync(q, ctx, config.PriorityNormal)
+		waitForQueued(t, q, 1)
+		cancel()
+		
+		if err := <-waiting; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		waitForQueued(t, q, 0)
+		release()
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		if q.inFlight != 0 {
+			t.Errorf("Expected the slot to be freed, %d in flight", q.inFlight)
+		}
+	})
+	
+	t.Run("Hedges only take a free slot", func(t *testing.T) {
+		setAdmissionLimits(t, 1, 10)
+		q := newAdmissionQueue()
+		
+		release, ok := q.tryAcquire()
+		if !ok {
+			t.Fatal("Expected a free slot")
+		}
+		if _, ok := q.tryAcquire(); ok {
+			t.Error("Expected no slot while the only one is in flight")
+		}
+		
+		waiting := acquireAsync(q, context.Background(), config.PriorityLow)
+		waitForQueued(t, q, 1)
+		release()
+		if err := <-waiting; err != nil {
+			t.Errorf("Expected the queued query to get the slot, got %v", err)
+		}
+	})
+	
+	t.Run("Disabled without a concurrency limit", func(t *testing.T) {
+		setAdmissionLimits(t, 0, 0)
+		var q *admissionQueue
+		if release, err := q.acquire(context.Background(), config.PriorityLow); err != nil {
+			t.Errorf("Expected no limit, got %v", err)
+		} else {
+			release()
+		}
+	})
+}
+
+func TestRequestPriority(t *testing.T) {
+	cfg := config.GetConfig()
+	originalPriorities, originalDefault := cfg.TenantPriorities, cfg.DefaultPriority
+	defer func() { cfg.TenantPriorities, cfg.DefaultPriority = originalPriorities, originalDefault }()
+	cfg.TenantPriorities = map[string]string{"paid": config.PriorityHigh}
+	cfg.DefaultPriority = config.PriorityNormal
+	
+	tests := []struct {
+		tenant   string
+		header   string
+		expected string
+	}{
+		{"paid", "", config.PriorityHigh},
+		{"paid", "low", config.PriorityLow},
+		{"free", "", config.PriorityNormal},
+		{"free", "HIGH", config.PriorityNormal},
+		{"free", "urgent", config.PriorityNormal},
+	}
+	
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/query", nil)
+		req.Header.Set(priorityHeader, tt.header)
+		if priority := requestPriority(req, tt.tenant); priority != tt.expected {
+			t.Errorf("Tenant %s with %s %q: expected %s, got %s", tt.tenant, priorityHeader, tt.header, tt.expected, priority)
+		}
+	}
+}
+
+func TestQueryHandlerShed(t *testing.T) {
+	setAdmissionLimits(t, 1, 0)
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = mockLLMFactory
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	release, _ := handler.admission.acquire(context.Background(), config.PriorityHigh)
+	defer release()
+	
+	req := httptest.NewRequest(http.MethodPost, "/api/query", bytes.NewBufferString(`{"query":"test"}`))
+	w := httptest.NewRecorder()
+	handler.QueryHandler(w, req)
+	
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After while the server is saturated, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParallelQueryHandlerAdmission(t *testing.T) {
+	setAdmissionLimits(t, 1, 10)
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				mu.Lock()
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return &llm.QueryResult{Response: "ok"}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.router = &MockRouter{}
+	
+	t.Run("Parallel", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/parallel", bytes.NewBufferString(`{"query":"test","models":["openai","gemini","mistral"]}`))
+		w := httptest.NewRecorder()
+		handler.ParallelQueryHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	})
+	
+	t.Run("Eval", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/eval", bytes.NewBufferString(`{"prompts":["a","b"],"models":["openai","gemini"]}`))
+		w := httptest.NewRecorder()
+		handler.EvalHandler(w, req)
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	})
+	
+	if maxInFlight != 1 {
+		t.Errorf("Expected fan-out calls to respect MAX_CONCURRENT_REQUESTS=1, got %d at once", maxInFlight)
+	}
+}
@@ -103,7 +103,7 @@ func TestQueryHandlerWithMocks(t *testing.T) {
 					return models.QueryResponse{}, false // Cache miss
 				}
 			},
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusTooManyRequests,
 			expectError:    true,
 		},
 		{
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/sirupsen/logrus"
+)
+
+type modelQuotas map[models.ModelType]*RateLimiter
+
+func newModelQuotas(rpm map[models.ModelType]int) modelQuotas {
+	quotas := make(modelQuotas, len(rpm))
+	for model, limit := range rpm {
+		quotas[model] = NewRateLimiter(limit, limit)
+	}
+	return quotas
+}
+
+func (q modelQuotas) allow(model models.ModelType) bool {
+	limiter, ok := q[model]
+	return !ok || limiter.Allow()
+}
+
+type quotaClient struct {
+	llm.Client
+	quotas modelQuotas
+}
+
+func (c *quotaClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
+	if !c.quotas.allow(c.GetModelType()) {
+		logrus.WithField("model", string(c.GetModelType())).Warn("Model quota exceeded")
+		monitoring.GetMetrics().RecordError("model_quota_exceeded")
+		return nil, myerrors.NewQuotaExceededError(string(c.GetModelType()))
+	}
+	
+	return c.Client.Query(ctx, query, modelVersion, opts)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestModelQuotas(t *testing.T) {
+	quotas := newModelQuotas(map[models.ModelType]int{models.OpenAI: 2})
+	
+	if !quotas.allow(models.OpenAI) || !quotas.allow(models.OpenAI) {
+		t.Errorf("Expected requests within the quota to be allowed")
+	}
+	if quotas.allow(models.OpenAI) {
+		t.Errorf("Expected request over the quota to be rejected")
+	}
+	if !quotas.allow(models.Claude) {
+		t.Errorf("Expected models without a quota to be unlimited")
+	}
+}
+
+func TestProcessQueryModelQuotaFallback(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var queried []models.ModelType
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				queried = append(queried, modelType)
+				return &llm.QueryResult{Response: "response from " + string(modelType)}, nil
+			},
+		}, nil
+	}
+	
+	var fallbackErr error
+	handler := &Handler{
+		router: &MockRouter{
+			fallbackOnErrorFunc: func(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+				fallbackErr = err
+				return models.Gemini, nil
+			},
+		},
+		cache:       &MockCache{},
+		modelQuotas: newModelQuotas(map[models.ModelType]int{models.OpenAI: 1}),
+	}
+	
+	resp, qErr := handler.processQuery(context.Background(), models.QueryRequest{Query: "first"}, "req-1")
+	if qErr != nil || resp.Model != models.OpenAI {
+		t.Fatalf("Expected first request to use openai, got %v (%v)", resp.Model, qErr)
+	}
+	
+	resp, qErr = handler.processQuery(context.Background(), models.QueryRequest{Query: "second"}, "req-2")
+	if qErr != nil {
+		t.Fatalf("Expected fallback instead of an error, got %v", qErr)
+	}
+	if resp.Model != models.Gemini {
+		t.Errorf("Expected fallback to gemini, got %s", resp.Model)
+	}
+	if !errors.Is(fallbackErr, myerrors.ErrQuotaExceeded) || !errors.Is(fallbackErr, myerrors.ErrRateLimit) {
+		t.Errorf("Expected fallback to be triggered by a quota rate limit error, got %v", fallbackErr)
+	}
+	
+	if len(queried) != 2 || queried[1] != models.Gemini {
+		t.Errorf("Expected openai not to be called over its quota, got calls %v", queried)
+	}
+}
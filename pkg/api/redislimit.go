@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	redisLimitKeyPrefix  = "llmproxy:ratelimit:"
+	redisLimitTimeout    = 100 * time.Millisecond // Per-call deadline so a slow Redis cannot stall requests
+	redisLimitRetryDelay = 5 * time.Second        // How long to use the in-memory limiter after a Redis failure
+)
+
+var errRedisLimiterUnavailable = errors.New("redis rate limiter unavailable")
+
+// Refills the bucket from the elapsed Redis server time and takes one token when available.
+// Returns {allowed, remaining tokens}; tokens go back as a string since Lua numbers are truncated to integers.
+var redisTokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+local ttl = 60000
+if rate > 0 then
+	ttl = math.ceil(burst / rate * 1000) + 1000
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+type distributedLimiter interface {
+	Take(clientID string, refillRate, maxTokens float64) (allowed bool, tokens float64, err error)
+}
+
+type redisLimiter struct {
+	client  redis.Scripter
+	mutex   sync.Mutex
+	retryAt time.Time // Zero while Redis is healthy
+}
+
+func newRedisLimiter(redisURL string) (*redisLimiter, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout = redisLimitTimeout
+	opts.ReadTimeout = redisLimitTimeout
+	opts.WriteTimeout = redisLimitTimeout
+	opts.MaxRetries = -1
+	
+	return &redisLimiter{client: redis.NewClient(opts)}, nil
+}
+
+func (rl *redisLimiter) Take(clientID string, refillRate, maxTokens float64) (bool, float64, error) {
+	rl.mutex.Lock()
+	down := !rl.retryAt.IsZero() && time.Now().Before(rl.retryAt)
+	rl.mutex.Unlock()
+	if down {
+		return false, 0, errRedisLimiterUnavailable
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), redisLimitTimeout)
+	defer cancel()
+	
+	result, err := redisTokenBucket.Run(ctx, rl.client, []string{redisLimitKeyPrefix + clientID}, refillRate, maxTokens).Slice()
+	if err == nil && len(result) != 2 {
+		err = errors.New("unexpected rate limit script result")
+	}
+	
+	var tokens float64
+	if err == nil {
+		tokenString, _ := result[1].(string)
+		tokens, err = strconv.ParseFloat(tokenString, 64)
+	}
+	
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if err != nil {
+		if rl.retryAt.IsZero() {
+			logrus.WithError(err).Warn("Redis rate limiter unavailable, falling back to in-memory rate limiting")
+		}
+		rl.retryAt = time.Now().Add(redisLimitRetryDelay)
+		return false, 0, err
+	}
+	if !rl.retryAt.IsZero() {
+		logrus.Info("Redis rate limiter recovered")
+		rl.retryAt = time.Time{}
+	}
+	
+	allowed, _ := result[0].(int64)
+	return allowed == 1, tokens, nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisRateLimiter(t *testing.T, url string, requestsPerMinute, burst int) *RateLimiter {
+	distributed, err := newRedisLimiter(url)
+	if err != nil {
+		t.Fatalf("Failed to create redis limiter: %v", err)
+	}
+	rl := NewRateLimiter(requestsPerMinute, burst)
+	rl.distributed = distributed
+	return rl
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	t.Run("Limits are shared across instances", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		first := newTestRedisRateLimiter(t, "redis://"+server.Addr(), 1, 3)
+		second := newTestRedisRateLimiter(t, "redis://"+server.Addr(), 1, 3)
+		
+		for i, limiter := range []*RateLimiter{first, second, first} {
+			if !limiter.AllowClient("client-a") {
+				t.Fatalf("Expected request %d to be allowed", i+1)
+			}
+		}
+		if second.AllowClient("client-a") {
+			t.Error("Expected the shared burst to be exhausted")
+		}
+		if !second.AllowClient("client-b") {
+			t.Error("Expected another client to have its own bucket")
+		}
+		
+		w := httptest.NewRecorder()
+		second.SetClientHeaders(w, "client-a")
+		if remaining := w.Header().Get("X-RateLimit-Remaining"); remaining != "0" {
+			t.Errorf("Expected X-RateLimit-Remaining 0 from the shared bucket, got %q", remaining)
+		}
+	})
+	
+	t.Run("Falls back to in-memory when Redis is down", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		limiter := newTestRedisRateLimiter(t, "redis://"+server.Addr(), 1, 2)
+		if !limiter.AllowClient("client-a") {
+			t.Fatal("Expected first request to be allowed")
+		}
+		server.Close()
+		
+		if !limiter.AllowClient("client-a") {
+			t.Error("Expected the in-memory limiter to allow the remaining token")
+		}
+		if limiter.AllowClient("client-a") {
+			t.Error("Expected the in-memory limiter to enforce the burst")
+		}
+		
+		distributed := limiter.distributed.(*redisLimiter)
+		if distributed.retryAt.IsZero() {
+			t.Error("Expected Redis to be skipped until the retry delay passes")
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	jsonRPCVersion = "2.0"
+	rpcMethodQuery = "query"
+)
+
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000 // Query failed; data carries the REST error detail
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type rpcError struct {
+	Code    int                 `json:"code"`
+	Message string              `json:"message"`
+	Data    *models.ErrorDetail `json:"data,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func (h *Handler) RPCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	clientIP := getClientIP(r)
+	if !h.rateLimiter.AllowClient(clientIP) {
+		logrus.WithField("client_ip", clientIP).Warn("Rate limit exceeded")
+		h.rateLimiter.SetClientHeaders(w, clientIP)
+		writeRPCResponse(w, nil, nil, &rpcError{
+			Code:    rpcServerError,
+			Message: "Rate limit exceeded. Please try again later.",
+			Data:    &models.ErrorDetail{Message: "Rate limit exceeded. Please try again later.", Code: myerrors.CodeRateLimit},
+		})
+		return
+	}
+	
+	tenant, err := getTenant(r)
+	if err != nil {
+		code := myerrors.CodeForbidden
+		if errors.Is(err, errInvalidAPIKey) {
+			code = myerrors.CodeUnauthorized
+		}
+		writeRPCResponse(w, nil, nil, &rpcError{
+			Code:    rpcServerError,
+			Message: err.Error(),
+			Data:    &models.ErrorDetail{Message: err.Error(), Code: code},
+		})
+		return
+	}
+	
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	requestID := requestIDFor(w, r)
+	
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRPCResponse(w, nil, nil, &rpcError{Code: rpcInvalidRequest, Message: "Error reading request body"})
+		return
+	}
+	
+	var rpcReq rpcRequest
+	if err := json.Unmarshal(body, &rpcReq); err != nil {
+		if !json.Valid(body) {
+			writeRPCResponse(w, nil, nil, &rpcError{Code: rpcParseError, Message: "Parse error"})
+		} else {
+			writeRPCResponse(w, nil, nil, &rpcError{Code: rpcInvalidRequest, Message: "Invalid request"})
+		}
+		return
+	}
+	
+	if rpcReq.JSONRPC != jsonRPCVersion || rpcReq.Method == "" {
+		writeRPCResponse(w, rpcReq.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "Invalid request: jsonrpc must be \"2.0\" and method is required"})
+		return
+	}
+	
+	if len(rpcReq.ID) == 0 {
+		// A notification gets no response object, not even for errors; the query still runs
+		if rpcReq.Method == rpcMethodQuery {
+			if _, rpcErr := h.rpcQuery(r, rpcReq.Params, tenant, requestID); rpcErr != nil {
+				logrus.WithFields(logrus.Fields{
+					"rpc_code":   rpcErr.Code,
+					"request_id": requestID,
+				}).Warn("JSON-RPC notification failed: " + rpcErr.Message)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	
+	switch rpcReq.Method {
+	case rpcMethodQuery:
+		resp, rpcErr := h.rpcQuery(r, rpcReq.Params, tenant, requestID)
+		if rpcErr != nil {
+			writeRPCResponse(w, rpcReq.ID, nil, rpcErr)
+			return
+		}
+		writeRPCResponse(w, rpcReq.ID, resp, nil)
+	default:
+		writeRPCResponse(w, rpcReq.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: "Method not found: " + rpcReq.Method})
+	}
+}
+
+func (h *Handler) rpcQuery(r *http.Request, params json.RawMessage, tenant string, requestID string) (*models.QueryResponse, *rpcError) {
+	var req models.QueryRequest
+	if len(params) == 0 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: expected a query request object"}
+	}
+	if err := decodeRequestBody(params, &req); err != nil {
+		if errors.Is(err, errUnknownField) {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: " + err.Error()}
+		}
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "Invalid params: expected a query request object"}
+	}
+	
+	req, qErr := normalizeQueryRequest(req, tenant)
+	if qErr != nil {
+		detail := qErr.detail()
+		return nil, &rpcError{Code: rpcInvalidParams, Message: qErr.Message, Data: &detail}
+	}
+	req.Priority = requestPriority(r, req.Tenant)
+	
+	if req.CallbackURL != "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "callback_url is not supported over JSON-RPC"}
+	}
+	
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout())
+	defer cancel()
+	
+	resp, qErr := h.processAndCapture(ctx, req, requestID)
+	if qErr != nil {
+		detail := qErr.detail()
+		return nil, &rpcError{Code: rpcServerError, Message: qErr.Message, Data: &detail}
+	}
+	
+	return &resp, nil
+}
+
+func writeRPCResponse(w http.ResponseWriter, id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	
+	if rpcErr != nil {
+		logrus.WithFields(logrus.Fields{
+			"rpc_code": rpcErr.Code,
+		}).Warn(rpcErr.Message)
+	}
+	
+	sendJSONResponse(w, rpcResponse{
+		JSONRPC: jsonRPCVersion,
+		Result:  result,
+		Error:   rpcErr,
+		ID:      id,
+	}, http.StatusOK)
+}
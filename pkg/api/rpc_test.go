@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestRPCHandler(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				if query == "fail" {
+					return nil, myerrors.NewModelError(string(modelType), 400, myerrors.ErrInvalidResponse, false)
+				}
+				return &llm.QueryResult{Response: "response to " + query}, nil
+			},
+		}, nil
+	}
+	
+	handler := &Handler{
+		router:      &MockRouter{},
+		cache:       &MockCache{},
+		rateLimiter: NewRateLimiter(100, 10),
+	}
+	
+	testCases := []struct {
+		name          string
+		body          string
+		expectedID    string
+		expectedCode  int
+		expectedData  string
+		expectedReply string
+	}{
+		{
+			name:          "Query",
+			body:          `{"jsonrpc":"2.0","id":1,"method":"query","params":{"query":"hello"}}`,
+			expectedID:    "1",
+			expectedReply: "response to hello",
+		},
+		{
+			name:         "Parse error",
+			body:         `{"jsonrpc":`,
+			expectedID:   "null",
+			expectedCode: rpcParseError,
+		},
+		{
+			name:         "Invalid request",
+			body:         `{"method":"query","id":"a"}`,
+			expectedID:   `"a"`,
+			expectedCode: rpcInvalidRequest,
+		},
+		{
+			name:         "Method not found",
+			body:         `{"jsonrpc":"2.0","id":2,"method":"delete"}`,
+			expectedID:   "2",
+			expectedCode: rpcMethodNotFound,
+		},
+		{
+			name:         "Missing params",
+			body:         `{"jsonrpc":"2.0","id":3,"method":"query"}`,
+			expectedID:   "3",
+			expectedCode: rpcInvalidParams,
+		},
+		{
+			name:         "Invalid query",
+			body:         `{"jsonrpc":"2.0","id":4,"method":"query","params":{"query":""}}`,
+			expectedID:   "4",
+			expectedCode: rpcInvalidParams,
+			expectedData: myerrors.CodeInvalidRequest,
+		},
+		{
+			name:         "Query error",
+			body:         `{"jsonrpc":"2.0","id":5,"method":"query","params":{"query":"fail"}}`,
+			expectedID:   "5",
+			expectedCode: rpcServerError,
+			expectedData: myerrors.CodeInvalidResponse,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewBufferString(tc.body))
+			w := httptest.NewRecorder()
+			
+			handler.RPCHandler(w, req)
+			
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+			
+			var resp struct {
+				JSONRPC string                `json:"jsonrpc"`
+				Result  *models.QueryResponse `json:"result"`
+				Error   *rpcError             `json:"error"`
+				ID      json.RawMessage       `json:"id"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			
+			if resp.JSONRPC != jsonRPCVersion {
+				t.Errorf("Expected jsonrpc %q, got %q", jsonRPCVersion, resp.JSONRPC)
+			}
+			if string(resp.ID) != tc.expectedID {
+				t.Errorf("Expected id %s, got %s", tc.expectedID, resp.ID)
+			}
+			
+			if tc.expectedCode == 0 {
+				if resp.Error != nil || resp.Result == nil {
+					t.Fatalf("Expected a result, got error %+v", resp.Error)
+				}
+				if resp.Result.Response != tc.expectedReply {
+					t.Errorf("Expected response %q, got %q", tc.expectedReply, resp.Result.Response)
+				}
+				return
+			}
+			
+			if resp.Error == nil || resp.Result != nil {
+				t.Fatalf("Expected error code %d, got result %+v", tc.expectedCode, resp.Result)
+			}
+			if resp.Error.Code != tc.expectedCode {
+				t.Errorf("Expected error code %d, got %d", tc.expectedCode, resp.Error.Code)
+			}
+			if tc.expectedData != "" && (resp.Error.Data == nil || resp.Error.Data.Code != tc.expectedData) {
+				t.Errorf("Expected error data code %s, got %+v", tc.expectedData, resp.Error.Data)
+			}
+		})
+	}
+}
+
+func TestRPCHandlerNotification(t *testing.T) {
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	
+	var queried []string
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				queried = append(queried, query)
+				return &llm.QueryResult{Response: "response to " + query}, nil
+			},
+		}, nil
+	}
+	
+	handler := &Handler{
+		router:      &MockRouter{},
+		cache:       &MockCache{},
+		rateLimiter: NewRateLimiter(100, 10),
+	}
+	
+	testCases := []struct {
+		name        string
+		body        string
+		wantQueried bool
+	}{
+		{"Query", `{"jsonrpc":"2.0","method":"query","params":{"query":"hello"}}`, true},
+		{"Invalid params", `{"jsonrpc":"2.0","method":"query","params":{"query":""}}`, false},
+		{"Unknown method", `{"jsonrpc":"2.0","method":"delete"}`, false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queried = nil
+			req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewBufferString(tc.body))
+			w := httptest.NewRecorder()
+			
+			handler.RPCHandler(w, req)
+			
+			if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+				t.Errorf("Expected status %d with an empty body, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+			}
+			if (len(queried) == 1) != tc.wantQueried {
+				t.Errorf("Expected the query to run=%v, got %v", tc.wantQueried, queried)
+			}
+		})
+	}
+}
@@ -14,7 +14,7 @@ type MockLLMClient struct {
 	QueryError error
 }
 
-func (m *MockLLMClient) Query(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+func (m *MockLLMClient) Query(ctx context.Context, query string, modelVersion string, opts llm.QueryOptions) (*llm.QueryResult, error) {
 	if m.QueryFunc != nil {
 		return m.QueryFunc(ctx, query, modelVersion)
 	}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+const (
+	usageBucket        = time.Hour
+	usageRetention     = 32 * 24 * time.Hour
+	defaultUsageSince  = 24 * time.Hour
+	defaultUsageTenant = "default" // Requests without an API key
+)
+
+type usageKey struct {
+	tenant string
+	model  models.ModelType
+	hour   time.Time
+}
+
+type usageTracker struct {
+	buckets   map[usageKey]*models.UsageTotals
+	lastPrune time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		buckets: make(map[usageKey]*models.UsageTotals),
+		now:     time.Now,
+	}
+}
+
+func (u *usageTracker) record(tenant string, model models.ModelType, inputTokens, outputTokens int, costUSD float64) {
+	if u == nil {
+		return
+	}
+	if tenant == "" {
+		tenant = defaultUsageTenant
+	}
+	
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	
+	hour := u.now().UTC().Truncate(usageBucket)
+	if hour.After(u.lastPrune) {
+		u.prune(hour.Add(-usageRetention))
+		u.lastPrune = hour
+	}
+	
+	key := usageKey{tenant: tenant, model: model, hour: hour}
+	totals, ok := u.buckets[key]
+	if !ok {
+		totals = &models.UsageTotals{}
+		u.buckets[key] = totals
+	}
+	totals.Requests++
+	totals.InputTokens += int64(inputTokens)
+	totals.OutputTokens += int64(outputTokens)
+	totals.CostUSD += costUSD
+}
+
+func (u *usageTracker) prune(before time.Time) {
+	for key := range u.buckets {
+		if key.hour.Before(before) {
+			delete(u.buckets, key)
+		}
+	}
+}
+
+func (u *usageTracker) since(since time.Time, byModel bool) []models.TenantUsage {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	
+	// Hourly buckets: the one containing since is included in full
+	since = since.UTC().Truncate(usageBucket)
+	
+	tenants := make(map[string]*models.TenantUsage)
+	for key, totals := range u.buckets {
+		if key.hour.Before(since) {
+			continue
+		}
+		
+		usage, ok := tenants[key.tenant]
+		if !ok {
+			usage = &models.TenantUsage{Tenant: key.tenant}
+			if byModel {
+				usage.Models = make(map[string]models.UsageTotals)
+			}
+			tenants[key.tenant] = usage
+		}
+		addUsage(&usage.UsageTotals, *totals)
+		
+		if byModel {
+			modelTotals := usage.Models[string(key.model)]
+			addUsage(&modelTotals, *totals)
+			usage.Models[string(key.model)] = modelTotals
+		}
+	}
+	
+	result := make([]models.TenantUsage, 0, len(tenants))
+	for _, usage := range tenants {
+		result = append(result, *usage)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Tenant < result[j].Tenant })
+	return result
+}
+
+func addUsage(total *models.UsageTotals, add models.UsageTotals) {
+	total.Requests += add.Requests
+	total.InputTokens += add.InputTokens
+	total.OutputTokens += add.OutputTokens
+	total.CostUSD += add.CostUSD
+}
+
+func parseUsageSince(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return now.Add(-defaultUsageSince), true
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, true
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(-d), true
+	}
+	return time.Time{}, false
+}
+
+func (h *Handler) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	since, ok := parseUsageSince(r.URL.Query().Get("since"), h.usage.now())
+	if !ok {
+		handleError(w, "Invalid since: use an RFC 3339 time or a duration such as 24h", http.StatusBadRequest)
+		return
+	}
+	
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "model" {
+		handleError(w, "Invalid group_by: only model is supported", http.StatusBadRequest)
+		return
+	}
+	
+	tenants := h.usage.since(since, groupBy == "model")
+	
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeUsageCSV(w, tenants, groupBy == "model")
+		return
+	}
+	
+	sendJSONResponse(w, models.UsageResponse{Since: since.UTC(), Tenants: tenants}, http.StatusOK)
+}
+
+func writeUsageCSV(w http.ResponseWriter, tenants []models.TenantUsage, byModel bool) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+	
+	writer := csv.NewWriter(w)
+	header := []string{"tenant", "requests", "input_tokens", "output_tokens", "cost_usd"}
+	if byModel {
+		header = append([]string{"tenant", "model"}, header[1:]...)
+	}
+	writer.Write(header)
+	
+	row := func(prefix []string, totals models.UsageTotals) {
+		writer.Write(append(prefix,
+			strconv.FormatInt(totals.Requests, 10),
+			strconv.FormatInt(totals.InputTokens, 10),
+			strconv.FormatInt(totals.OutputTokens, 10),
+			strconv.FormatFloat(totals.CostUSD, 'f', 6, 64),
+		))
+	}
+	
+	for _, usage := range tenants {
+		if !byModel {
+			row([]string{usage.Tenant}, usage.UsageTotals)
+			continue
+		}
+		
+		modelNames := make([]string, 0, len(usage.Models))
+		for model := range usage.Models {
+			modelNames = append(modelNames, model)
+		}
+		sort.Strings(modelNames)
+		for _, model := range modelNames {
+			row([]string{usage.Tenant, model}, usage.Models[model])
+		}
+	}
+	
+	writer.Flush()
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestUsageTracker(t *testing.T) {
+	usage := newUsageTracker()
+	now := time.Date(2026, 10, 15, 12, 30, 0, 0, time.UTC)
+	usage.now = func() time.Time { return now }
+	
+	usage.record("acme", models.OpenAI, 100, 50, 0.5)
+	usage.record("acme", models.Claude, 10, 5, 0.25)
+	usage.record("", models.OpenAI, 1, 1, 0)
+	
+	now = now.Add(2 * time.Hour)
+	usage.record("acme", models.OpenAI, 200, 100, 1)
+	
+	tenants := usage.since(now.Add(-time.Hour), false)
+	if len(tenants) != 1 || tenants[0].Tenant != "acme" {
+		t.Fatalf("Expected only acme in the last hour, got %+v", tenants)
+	}
+	if tenants[0].Requests != 1 || tenants[0].InputTokens != 200 || tenants[0].CostUSD != 1 {
+		t.Errorf("Expected only the latest request, got %+v", tenants[0].UsageTotals)
+	}
+	
+	tenants = usage.since(now.Add(-24*time.Hour), true)
+	if len(tenants) != 2 || tenants[0].Tenant != "acme" || tenants[1].Tenant != defaultUsageTenant {
+		t.Fatalf("Expected acme and the default tenant, got %+v", tenants)
+	}
+	acme := tenants[0]
+	if acme.Requests != 3 || acme.InputTokens != 310 || acme.OutputTokens != 155 || acme.CostUSD != 1.75 {
+		t.Errorf("Unexpected acme totals: %+v", acme.UsageTotals)
+	}
+	if acme.Models["openai"].Requests != 2 || acme.Models["claude"].CostUSD != 0.25 {
+		t.Errorf("Unexpected per-model totals: %+v", acme.Models)
+	}
+	
+	now = now.Add(usageRetention + usageBucket)
+	usage.record("acme", models.OpenAI, 1, 1, 0)
+	if len(usage.buckets) != 1 {
+		t.Errorf("Expected buckets past retention to be pruned, got %d", len(usage.buckets))
+	}
+	
+	var unset *usageTracker
+	unset.record("acme", models.OpenAI, 1, 1, 1)
+}
+
+func TestUsageHandler(t *testing.T) {
+	cfg := config.GetConfig()
+	originalAPIKeys := cfg.TenantAPIKeys
+	defer func() { cfg.TenantAPIKeys = originalAPIKeys }()
+	cfg.TenantAPIKeys = map[string]string{"key-acme": "acme"}
+	
+	originalFactory := llm.Factory
+	defer func() { llm.Factory = originalFactory }()
+	llm.Factory = func(modelType models.ModelType) (llm.Client, error) {
+		return &MockLLMClient{
+			modelType: modelType,
+			queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+				return &llm.QueryResult{Response: "ok", InputTokens: 12, OutputTokens: 3}, nil
+			},
+		}, nil
+	}
+	
+	handler := NewHandler()
+	handler.cache = &MockCache{}
+	handler.router = &MockRouter{}
+	
+	req := httptest.NewRequest(http.MethodPost, "/api/query", bytes.NewBufferString(`{"query":"hello"}`))
+	req.Header.Set(apiKeyHeader, "key-acme")
+	w := httptest.NewRecorder()
+	handler.QueryHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected query to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	
+	t.Run("JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.UsageHandler(w, httptest.NewRequest(http.MethodGet, "/api/usage?since=1h&group_by=model", nil))
+		
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		
+		var resp models.UsageResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		if len(resp.Tenants) != 1 || resp.Tenants[0].Tenant != "acme" || resp.Tenants[0].InputTokens != 12 {
+			t.Fatalf("Expected acme usage, got %+v", resp.Tenants)
+		}
+		if resp.Tenants[0].Models["openai"].Requests != 1 {
+			t.Errorf("Expected one openai request, got %+v", resp.Tenants[0].Models)
+		}
+	})
+	
+	t.Run("CSV", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/usage", nil)
+		req.Header.Set("Accept", "text/csv")
+		w := httptest.NewRecorder()
+		handler.UsageHandler(w, req)
+		
+		if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+			t.Errorf("Expected text/csv, got %q", ct)
+		}
+		
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Error parsing CSV: %v", err)
+		}
+		if len(records) != 2 || records[0][0] != "tenant" || records[1][0] != "acme" || records[1][2] != "12" {
+			t.Errorf("Unexpected CSV: %v", records)
+		}
+	})
+	
+	t.Run("Invalid params", func(t *testing.T) {
+		for _, query := range []string{"since=yesterday", "group_by=tenant"} {
+			w := httptest.NewRecorder()
+			handler.UsageHandler(w, httptest.NewRequest(http.MethodGet, "/api/usage?"+query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, query, w.Code)
+			}
+		}
+	})
+}
+
+func TestPartialUsageClient(t *testing.T) {
+	handler := NewHandler()
+	client := handler.limitClient(&MockLLMClient{
+		modelType: models.Claude,
+		queryFunc: func(ctx context.Context, query string, modelVersion string) (*llm.QueryResult, error) {
+			return &llm.QueryResult{InputTokens: 20, OutputTokens: 8}, errors.New("second completion failed")
+		},
+	}, "acme")
+	
+	result, err := client.Query(context.Background(), "hello", "", llm.QueryOptions{N: 2})
+	if err == nil || result != nil {
+		t.Fatalf("Expected only the error to reach the caller, got %+v, %v", result, err)
+	}
+	
+	tenants := handler.usage.since(time.Now().Add(-time.Hour), false)
+	if len(tenants) != 1 || tenants[0].Tenant != "acme" || tenants[0].InputTokens != 20 || tenants[0].OutputTokens != 8 {
+		t.Errorf("Expected the completed sibling to be recorded for acme, got %+v", tenants)
+	}
+}
@@ -1,13 +1,17 @@
 package cache
 
 import (
+	"container/list"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/amorin24/llmproxy/pkg/config"
@@ -33,14 +37,25 @@ type InMemoryCache struct {
 	cache      *cache.Cache
 	maxItems   int
 	itemCount  int
+	order      *list.List               // Most recently used at the front
+	elements   map[string]*list.Element // Key to its position in order
 	cacheMutex sync.RWMutex
 }
 
 func (c *InMemoryCache) Get(key string) (interface{}, bool) {
-	c.cacheMutex.RLock()
-	defer c.cacheMutex.RUnlock()
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+	
+	value, found := c.cache.Get(key)
+	if element, exists := c.elements[key]; exists {
+		if found {
+			c.order.MoveToFront(element)
+		} else {
+			c.removeElement(element)
+		}
+	}
 	
-	return c.cache.Get(key)
+	return value, found
 }
 
 func (c *InMemoryCache) Set(key string, value interface{}, ttl time.Duration) {
@@ -48,17 +63,18 @@ func (c *InMemoryCache) Set(key string, value interface{}, ttl time.Duration) {
 	defer c.cacheMutex.Unlock()
 	
 	if c.maxItems > 0 {
-		if c.itemCount >= c.maxItems {
-			if _, exists := c.cache.Items()[key]; !exists {
-				logrus.WithFields(logrus.Fields{
-					"max_items": c.maxItems,
-					"action":    "cache_limit_reached",
-				}).Debug("Cache max items limit reached, not adding new item")
-				return
+		if element, exists := c.elements[key]; exists {
+			c.order.MoveToFront(element)
+		} else {
+			if c.itemCount >= c.maxItems {
+				c.removeExpired()
 			}
-		}
-		
-		if _, exists := c.cache.Items()[key]; !exists {
+			
+			for c.itemCount >= c.maxItems && c.order.Len() > 0 {
+				c.evictOldest()
+			}
+			
+			c.elements[key] = c.order.PushFront(key)
 			c.itemCount++
 		}
 	}
@@ -66,31 +82,75 @@ func (c *InMemoryCache) Set(key string, value interface{}, ttl time.Duration) {
 	c.cache.Set(key, value, ttl)
 }
 
+func (c *InMemoryCache) removeExpired() {
+	for element := c.order.Back(); element != nil; {
+		prev := element.Prev()
+		if _, found := c.cache.Get(element.Value.(string)); !found {
+			c.removeElement(element)
+		}
+		element = prev
+	}
+}
+
+func (c *InMemoryCache) evictOldest() {
+	element := c.order.Back()
+	c.cache.Delete(element.Value.(string))
+	c.removeElement(element)
+	
+	logrus.WithFields(logrus.Fields{
+		"max_items": c.maxItems,
+		"action":    "cache_lru_eviction",
+	}).Debug("Cache max items limit reached, evicted least recently used item")
+}
+
 func (c *InMemoryCache) Delete(key string) {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 	
-	if c.maxItems > 0 {
-		if _, exists := c.cache.Items()[key]; exists {
-			c.itemCount--
-		}
+	if element, exists := c.elements[key]; exists {
+		c.removeElement(element)
 	}
 	
 	c.cache.Delete(key)
 }
 
+func (c *InMemoryCache) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.elements, element.Value.(string))
+	c.itemCount--
+}
+
 func (c *InMemoryCache) Flush() {
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
 	
 	c.cache.Flush()
+	c.order.Init()
+	c.elements = make(map[string]*list.Element)
 	c.itemCount = 0
 }
 
+func (c *InMemoryCache) ItemCount() int {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+	
+	if c.maxItems > 0 {
+		c.removeExpired()
+		return c.itemCount
+	}
+	return c.cache.ItemCount()
+}
+
+func (c *InMemoryCache) MaxItems() int {
+	return c.maxItems
+}
+
 func NewInMemoryCache(ttl, cleanupInterval time.Duration, maxItems int) *InMemoryCache {
 	return &InMemoryCache{
 		cache:    cache.New(ttl, cleanupInterval),
 		maxItems: maxItems,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
 	}
 }
 
@@ -103,6 +163,15 @@ type Cache struct {
 	provider CacheProvider
 	enabled  bool
 	ttl      time.Duration
+	ignoreVersion bool
+	shared   bool // Tenants share entries instead of each getting their own
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+type sizedProvider interface {
+	ItemCount() int
+	MaxItems() int
 }
 
 func GetCache() *Cache {
@@ -132,12 +201,15 @@ func GetCache() *Cache {
 			provider: provider,
 			enabled:  cfg.CacheEnabled,
 			ttl:      ttl,
+			ignoreVersion: cfg.CacheKeyIgnoreVersion,
+			shared:   cfg.SharedCache,
 		}
 		
 		logrus.WithFields(logrus.Fields{
 			"enabled":   cfg.CacheEnabled,
 			"ttl":       ttl,
 			"max_items": maxItems,
+			"shared":    cfg.SharedCache,
 		}).Info("Cache initialized")
 	})
 	
@@ -149,12 +221,14 @@ func (c *Cache) Get(req models.QueryRequest) (models.QueryResponse, bool) {
 		return models.QueryResponse{}, false
 	}
 	
-	cacheKey := generateCacheKey(req)
+	cacheKey := cacheKeyFor(req, c.ignoreVersion, c.shared)
 	if cachedResponse, found := c.provider.Get(cacheKey); found {
+		c.hits.Add(1)
 		logrus.WithField("cache_key", cacheKey).Debug("Cache hit")
 		return cachedResponse.(models.QueryResponse), true
 	}
 	
+	c.misses.Add(1)
 	logrus.WithField("cache_key", cacheKey).Debug("Cache miss")
 	return models.QueryResponse{}, false
 }
@@ -164,7 +238,7 @@ func (c *Cache) Set(req models.QueryRequest, resp models.QueryResponse) {
 		return
 	}
 	
-	cacheKey := generateCacheKey(req)
+	cacheKey := cacheKeyFor(req, c.ignoreVersion, c.shared)
 	c.provider.Set(cacheKey, resp, c.ttl)
 	
 	logrus.WithFields(logrus.Fields{
@@ -174,13 +248,163 @@ func (c *Cache) Set(req models.QueryRequest, resp models.QueryResponse) {
 	}).Debug("Added response to cache")
 }
 
-func generateCacheKey(req models.QueryRequest) string {
+func (c *Cache) Stats() models.CacheStats {
+	stats := models.CacheStats{
+		Enabled:    c.enabled,
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		TTLSeconds: int(c.ttl.Seconds()),
+	}
+	
+	if sized, ok := c.provider.(sizedProvider); ok {
+		stats.Size = sized.ItemCount()
+		stats.MaxItems = sized.MaxItems()
+	}
+	return stats
+}
+
+func (c *Cache) Flush() int {
+	evicted := 0
+	if sized, ok := c.provider.(sizedProvider); ok {
+		evicted = sized.ItemCount()
+	}
+	
+	c.provider.Flush()
+	logrus.WithField("evicted", evicted).Info("Cache flushed")
+	return evicted
+}
+
+func (c *Cache) Delete(key string) bool {
+	if _, found := c.provider.Get(key); !found {
+		return false
+	}
+	
+	c.provider.Delete(key)
+	logrus.WithField("cache_key", key).Info("Cache entry evicted")
+	return true
+}
+
+func Key(req models.QueryRequest) string {
+	cfg := config.GetConfig()
+	return cacheKeyFor(req, cfg.CacheKeyIgnoreVersion, cfg.SharedCache)
+}
+
+func cacheKeyFor(req models.QueryRequest, ignoreVersion, shared bool) string {
+	data := cacheKeyData(req, ignoreVersion)
+	if shared {
+		// Tenants share entries only with tenants allowed the same models, so a response
+		// routed to a model outside a tenant's allow-list is never served to it
+		delete(data, "tenant")
+		data["allowed_models"] = allowedModelsKey(req.Tenant)
+	}
+	return hashCacheKey(req, data)
+}
+
+func allowedModelsKey(tenant string) string {
+	allowed := config.GetConfig().AllowedModels(tenant)
+	names := make([]string, 0, len(allowed))
+	for _, model := range allowed {
+		names = append(names, string(model))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func generateCacheKey(req models.QueryRequest, ignoreVersion bool) string {
+	return hashCacheKey(req, cacheKeyData(req, ignoreVersion))
+}
+
+func cacheKeyData(req models.QueryRequest, ignoreVersion bool) map[string]string {
 	data := map[string]string{
 		"query":     req.Query,
 		"model":     string(req.Model),
 		"task_type": string(req.TaskType),
 	}
 	
+	if req.ModelVersion != "" && !ignoreVersion {
+		data["model_version"] = req.ModelVersion
+	}
+	
+	if req.AutoContinue {
+		data["auto_continue"] = "true"
+	}
+	
+	if req.NoFallback {
+		data["no_fallback"] = "true"
+	}
+	
+	if req.Hedge {
+		data["hedge"] = "true"
+	}
+	
+	if len(req.Stop) > 0 {
+		stop, _ := json.Marshal(req.Stop)
+		data["stop"] = string(stop)
+	}
+	
+	if len(req.Tools) > 0 {
+		tools, _ := json.Marshal(req.Tools)
+		data["tools"] = string(tools)
+	}
+	
+	if req.ToolChoice != "" {
+		data["tool_choice"] = req.ToolChoice
+	}
+	
+	if req.N > 1 {
+		data["n"] = strconv.Itoa(req.N)
+	}
+	
+	if req.Extract != "" {
+		data["extract"] = req.Extract
+	}
+	
+	if req.OnOverflow != "" && req.OnOverflow != models.OverflowReject {
+		data["on_overflow"] = req.OnOverflow
+	}
+	
+	if req.CachePrefix != "" {
+		data["cache_prefix"] = req.CachePrefix
+	}
+	
+	if req.Seed != nil {
+		data["seed"] = strconv.Itoa(*req.Seed)
+	}
+	
+	if req.TopP != nil {
+		data["top_p"] = strconv.FormatFloat(*req.TopP, 'g', -1, 64)
+	}
+	
+	if req.FrequencyPenalty != nil {
+		data["frequency_penalty"] = strconv.FormatFloat(*req.FrequencyPenalty, 'g', -1, 64)
+	}
+	
+	if req.PresencePenalty != nil {
+		data["presence_penalty"] = strconv.FormatFloat(*req.PresencePenalty, 'g', -1, 64)
+	}
+	
+	if req.Temperature != nil {
+		data["temperature"] = strconv.FormatFloat(*req.Temperature, 'g', -1, 64)
+	}
+	
+	if req.MaxTokens != nil {
+		data["max_tokens"] = strconv.Itoa(*req.MaxTokens)
+	}
+	
+	if req.Tenant != "" {
+		data["tenant"] = req.Tenant
+	}
+	
+	if len(req.Images) > 0 {
+		encoded, _ := json.Marshal(req.Images)
+		images := sha256.Sum256(encoded)
+		data["images"] = hex.EncodeToString(images[:])
+	}
+	
+	return data
+}
+
+func hashCacheKey(req models.QueryRequest, data map[string]string) string {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Sprintf("%s:%s:%s", req.Query, req.Model, req.TaskType)
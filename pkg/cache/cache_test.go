@@ -1,10 +1,12 @@
 package cache
 
 import (
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	"github.com/amorin24/llmproxy/pkg/models"
 )
 
@@ -209,19 +211,21 @@ func TestInMemoryCache(t *testing.T) {
 		t.Errorf("Expected to find key2 with value 'value2', got %v, found: %v", val2, found2)
 	}
 
-	cache.Set("key3", "value3", 1*time.Second)
-	val3, found3 := cache.Get("key3")
-	if found3 {
-		t.Errorf("Expected not to find key3 due to max items limit, got %v", val3)
-	}
-
 	cache.Delete("key1")
 	cache.Set("key3", "value3", 1*time.Second)
-	val3, found3 = cache.Get("key3")
+	val3, found3 := cache.Get("key3")
 	if !found3 || val3 != "value3" {
 		t.Errorf("Expected to find key3 with value 'value3' after deleting key1, got %v, found: %v", val3, found3)
 	}
 
+	cache.Set("key4", "value4", 1*time.Second)
+	if _, found := cache.Get("key4"); !found {
+		t.Errorf("Expected to find key4 after reaching max items limit")
+	}
+	if _, found := cache.Get("key2"); found {
+		t.Errorf("Expected key2 to be evicted as least recently used")
+	}
+
 	cache.Flush()
 	val2, found2 = cache.Get("key2")
 	if found2 {
@@ -229,6 +233,70 @@ func TestInMemoryCache(t *testing.T) {
 	}
 }
 
+func TestInMemoryCacheLRUEviction(t *testing.T) {
+	cache := NewInMemoryCache(1*time.Second, 10*time.Second, 3)
+	
+	cache.Set("key1", "value1", 1*time.Second)
+	cache.Set("key2", "value2", 1*time.Second)
+	cache.Set("key3", "value3", 1*time.Second)
+	
+	cache.Get("key1")
+	
+	cache.Set("key4", "value4", 1*time.Second)
+	
+	if _, found := cache.Get("key2"); found {
+		t.Errorf("Expected least recently used key2 to be evicted")
+	}
+	
+	for _, key := range []string{"key1", "key3", "key4"} {
+		if _, found := cache.Get(key); !found {
+			t.Errorf("Expected to find %s after eviction", key)
+		}
+	}
+	
+	cache.Set("key3", "updated", 1*time.Second)
+	cache.Set("key5", "value5", 1*time.Second)
+	
+	if _, found := cache.Get("key1"); found {
+		t.Errorf("Expected key1 to be evicted after key3 was refreshed")
+	}
+	
+	if val, found := cache.Get("key3"); !found || val != "updated" {
+		t.Errorf("Expected to find updated key3, got %v, found: %v", val, found)
+	}
+	
+	if cache.itemCount != 3 {
+		t.Errorf("Expected item count 3, got %d", cache.itemCount)
+	}
+}
+
+func TestInMemoryCacheItemCountAfterExpiration(t *testing.T) {
+	cache := NewInMemoryCache(1*time.Second, 20*time.Millisecond, 3)
+	
+	cache.Set("long", "value", 10*time.Second)
+	cache.Set("short1", "value", 20*time.Millisecond)
+	cache.Set("short2", "value", 20*time.Millisecond)
+	
+	time.Sleep(60 * time.Millisecond)
+	
+	cache.Set("new1", "value1", 1*time.Second)
+	cache.Set("new2", "value2", 1*time.Second)
+	
+	for _, key := range []string{"long", "new1", "new2"} {
+		if _, found := cache.Get(key); !found {
+			t.Errorf("Expected to find %s after expired items were reclaimed", key)
+		}
+	}
+	
+	if cache.itemCount != 3 {
+		t.Errorf("Expected item count 3, got %d", cache.itemCount)
+	}
+	
+	if cache.itemCount != cache.cache.ItemCount() {
+		t.Errorf("Expected item count %d to match underlying cache, got %d", cache.cache.ItemCount(), cache.itemCount)
+	}
+}
+
 func TestInMemoryCacheExpiration(t *testing.T) {
 	cache := NewInMemoryCache(50*time.Millisecond, 100*time.Millisecond, 10)
 	
@@ -287,9 +355,9 @@ func TestGenerateCacheKey(t *testing.T) {
 		TaskType: models.TextGeneration,
 	}
 	
-	key1 := generateCacheKey(req1)
-	key2 := generateCacheKey(req2)
-	key3 := generateCacheKey(req3)
+	key1 := generateCacheKey(req1, false)
+	key2 := generateCacheKey(req2, false)
+	key3 := generateCacheKey(req3, false)
 	
 	if key1 != key2 {
 		t.Errorf("Expected identical cache keys for identical requests, got %s and %s", key1, key2)
@@ -305,7 +373,7 @@ func TestGenerateCacheKey(t *testing.T) {
 		TaskType: models.TextGeneration,
 	}
 	
-	key4 := generateCacheKey(req4)
+	key4 := generateCacheKey(req4, false)
 	if key1 == key4 {
 		t.Errorf("Expected different cache keys for different models, got %s for both", key1)
 	}
@@ -316,10 +384,286 @@ func TestGenerateCacheKey(t *testing.T) {
 		TaskType: models.Summarization,
 	}
 	
-	key5 := generateCacheKey(req5)
+	key5 := generateCacheKey(req5, false)
 	if key1 == key5 {
 		t.Errorf("Expected different cache keys for different task types, got %s for both", key1)
 	}
+	
+	req6 := models.QueryRequest{
+		Query:        "test query",
+		Model:        models.OpenAI,
+		ModelVersion: "gpt-4o",
+		TaskType:     models.TextGeneration,
+	}
+	
+	req7 := models.QueryRequest{
+		Query:        "test query",
+		Model:        models.OpenAI,
+		ModelVersion: "gpt-4o-mini",
+		TaskType:     models.TextGeneration,
+	}
+	
+	if generateCacheKey(req6, false) == generateCacheKey(req7, false) {
+		t.Errorf("Expected different cache keys for different model versions")
+	}
+	
+	if generateCacheKey(req6, true) != generateCacheKey(req7, true) {
+		t.Errorf("Expected identical cache keys across model versions when ignoring versions")
+	}
+	
+	if generateCacheKey(req6, true) != generateCacheKey(req1, true) {
+		t.Errorf("Expected unversioned request to share the cache key when ignoring versions")
+	}
+	
+	seed1, seed2 := 1, 2
+	req8 := req1
+	req8.Seed = &seed1
+	req9 := req1
+	req9.Seed = &seed2
+	
+	if generateCacheKey(req8, false) == generateCacheKey(req9, false) || generateCacheKey(req8, false) == key1 {
+		t.Errorf("Expected different cache keys for different seeds")
+	}
+	
+	topP, penalty := 0.9, 0.5
+	req10 := req1
+	req10.TopP = &topP
+	req11 := req1
+	req11.FrequencyPenalty = &penalty
+	req12 := req1
+	req12.PresencePenalty = &penalty
+	
+	temperature, maxTokens := 0.2, 500
+	req13 := req1
+	req13.Temperature = &temperature
+	req14 := req1
+	req14.MaxTokens = &maxTokens
+	
+	keys := map[string]bool{key1: true}
+	for _, req := range []models.QueryRequest{req10, req11, req12, req13, req14} {
+		keys[generateCacheKey(req, false)] = true
+	}
+	if len(keys) != 6 {
+		t.Errorf("Expected different cache keys for different sampling parameters")
+	}
+}
+
+func TestGetCacheIgnoreVersion(t *testing.T) {
+	cfg := config.GetConfig()
+	originalEnabled, originalIgnore := cfg.CacheEnabled, cfg.CacheKeyIgnoreVersion
+	defer func() {
+		cfg.CacheEnabled, cfg.CacheKeyIgnoreVersion = originalEnabled, originalIgnore
+		once, cacheInstance = sync.Once{}, nil
+	}()
+	
+	for _, ignore := range []bool{false, true} {
+		cfg.CacheEnabled, cfg.CacheKeyIgnoreVersion = true, ignore
+		once, cacheInstance = sync.Once{}, nil
+		c := GetCache()
+		
+		req := models.QueryRequest{Query: "test query", Model: models.OpenAI, ModelVersion: "gpt-4"}
+		c.Set(req, models.QueryResponse{Response: "from gpt-4"})
+		
+		other := req
+		other.ModelVersion = "gpt-4o"
+		if _, found := c.Get(other); found != ignore {
+			t.Errorf("With CACHE_KEY_IGNORE_VERSION=%v expected another version's lookup found=%v, got %v", ignore, ignore, found)
+		}
+	}
+}
+
+func TestCacheTenantIsolation(t *testing.T) {
+	tenantA := models.QueryRequest{Query: "test query", Model: models.OpenAI, Tenant: "tenant-a"}
+	tenantB := tenantA
+	tenantB.Tenant = "tenant-b"
+	
+	for _, tc := range []struct {
+		name   string
+		shared bool
+	}{
+		{"Isolated", false},
+		{"Shared", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Cache{
+				provider: NewInMemoryCache(time.Minute, time.Minute, 10),
+				enabled:  true,
+				ttl:      time.Minute,
+				shared:   tc.shared,
+			}
+			c.Set(tenantA, models.QueryResponse{Response: "for tenant a"})
+			
+			if _, found := c.Get(tenantA); !found {
+				t.Error("Expected the writing tenant to read its own entry")
+			}
+			if _, found := c.Get(tenantB); found != tc.shared {
+				t.Errorf("Expected another tenant's lookup found=%v, got %v", tc.shared, found)
+			}
+			if sameKey := cacheKeyFor(tenantA, false, tc.shared) == cacheKeyFor(tenantB, false, tc.shared); sameKey != tc.shared {
+				t.Errorf("Expected tenants to share a key=%v, got %v", tc.shared, sameKey)
+			}
+		})
+	}
+	
+	t.Run("Shared respects allow-lists", func(t *testing.T) {
+		cfg := config.GetConfig()
+		originalTenantModels, originalShared := cfg.TenantModels, cfg.SharedCache
+		defer func() { cfg.TenantModels, cfg.SharedCache = originalTenantModels, originalShared }()
+		cfg.TenantModels = map[string][]models.ModelType{
+			"tenant-a": {models.OpenAI, models.Claude},
+			"tenant-b": {models.Claude, models.OpenAI},
+			"free":     {models.Mistral},
+		}
+		cfg.SharedCache = true
+		
+		c := &Cache{
+			provider: NewInMemoryCache(time.Minute, time.Minute, 10),
+			enabled:  true,
+			ttl:      time.Minute,
+			shared:   true,
+		}
+		routed := models.QueryRequest{Query: "test query", Tenant: "tenant-a"}
+		c.Set(routed, models.QueryResponse{Response: "from openai", Model: models.OpenAI})
+		
+		sameModels := routed
+		sameModels.Tenant = "tenant-b"
+		if _, found := c.Get(sameModels); !found || Key(sameModels) != Key(routed) {
+			t.Error("Expected tenants allowed the same models to share entries")
+		}
+		
+		restricted := routed
+		restricted.Tenant = "free"
+		if _, found := c.Get(restricted); found {
+			t.Error("Expected a tenant limited to mistral not to read another tenant's openai answer")
+		}
+		if Key(restricted) == Key(routed) {
+			t.Error("Expected a restricted tenant not to join another tenant's in-flight request")
+		}
+	})
+}
+
+func TestCacheStatsFlushDelete(t *testing.T) {
+	c := &Cache{
+		provider: NewInMemoryCache(time.Minute, time.Minute, 10),
+		enabled:  true,
+		ttl:      time.Minute,
+	}
+	
+	req1 := models.QueryRequest{Query: "first"}
+	req2 := models.QueryRequest{Query: "second"}
+	c.Set(req1, models.QueryResponse{Response: "one"})
+	c.Set(req2, models.QueryResponse{Response: "two"})
+	c.Get(req1)
+	c.Get(models.QueryRequest{Query: "missing"})
+	
+	stats := c.Stats()
+	if !stats.Enabled || stats.Size != 2 || stats.MaxItems != 10 || stats.Hits != 1 || stats.Misses != 1 || stats.TTLSeconds != 60 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	
+	if !c.Delete(generateCacheKey(req1, false)) {
+		t.Error("Expected Delete to evict an existing key")
+	}
+	if c.Delete(generateCacheKey(req1, false)) {
+		t.Error("Expected Delete to report a missing key")
+	}
+	if _, found := c.Get(req1); found {
+		t.Error("Expected evicted entry to be gone")
+	}
+	
+	if evicted := c.Flush(); evicted != 1 {
+		t.Errorf("Expected Flush to evict 1 entry, got %d", evicted)
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("Expected empty cache after Flush, got size %d", size)
+	}
+}
+
+// Fields that never change the provider's output; every other QueryRequest field must be
+// part of the cache key, so adding a parameter without updating generateCacheKey fails here
+var cacheKeyExcludedFields = map[string]bool{
+	"RequestID":   true,
+	"CallbackURL": true,
+	"Priority":    true,
+}
+
+func TestGenerateCacheKeyCoversAllFields(t *testing.T) {
+	base := models.QueryRequest{Query: "test query"}
+	baseKey := generateCacheKey(base, false)
+	
+	requestType := reflect.TypeOf(base)
+	for i := 0; i < requestType.NumField(); i++ {
+		field := requestType.Field(i)
+		if cacheKeyExcludedFields[field.Name] {
+			continue
+		}
+		
+		t.Run(field.Name, func(t *testing.T) {
+			req := base
+			value := reflect.ValueOf(&req).Elem().Field(i)
+			if !setNonZero(value) {
+				t.Fatalf("No test value for field %s of kind %s, add one to setNonZero", field.Name, value.Kind())
+			}
+			
+			if generateCacheKey(req, false) == baseKey {
+				t.Errorf("Expected %s to change the cache key", field.Name)
+			}
+		})
+	}
+	
+	for name := range cacheKeyExcludedFields {
+		if _, ok := requestType.FieldByName(name); !ok {
+			t.Errorf("Excluded field %s no longer exists on QueryRequest", name)
+		}
+	}
+}
+
+func setNonZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString("changed")
+	case reflect.Bool:
+		value.SetBool(true)
+	case reflect.Int:
+		value.SetInt(2)
+	case reflect.Float64:
+		value.SetFloat(0.5)
+	case reflect.Ptr:
+		elem := reflect.New(value.Type().Elem())
+		if !setNonZero(elem.Elem()) {
+			return false
+		}
+		value.Set(elem)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(value.Type(), 1, 1)
+		if slice.Index(0).Kind() == reflect.Struct {
+			slice.Index(0).FieldByName("Name").SetString("changed")
+		} else if !setNonZero(slice.Index(0)) {
+			return false
+		}
+		value.Set(slice)
+	default:
+		return false
+	}
+	return true
+}
+
+func TestGenerateCacheKeyListBoundaries(t *testing.T) {
+	testCases := []struct {
+		name string
+		a, b models.QueryRequest
+	}{
+		{"Stop", models.QueryRequest{Query: "q", Stop: []string{"a", "b"}}, models.QueryRequest{Query: "q", Stop: []string{"a,b"}}},
+		{"Images", models.QueryRequest{Query: "q", Images: []string{"a", "b"}}, models.QueryRequest{Query: "q", Images: []string{"a\nb"}}},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if generateCacheKey(tc.a, false) == generateCacheKey(tc.b, false) {
+				t.Errorf("Expected different cache keys for %v and %v", tc.a, tc.b)
+			}
+		})
+	}
 }
 
 type MockCacheProvider struct {
@@ -4,32 +4,53 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
 )
 
 const (
 	defaultKeyRotationInterval = 24
+	
+	defaultDowngradeTimeouts = 3
+	defaultDowngradeWindow   = 60  // Seconds
+	defaultDowngradeCooldown = 300 // Seconds
 
 	minAPIKeyLength = 8
 
-	encryptionKeyEnvVar = "LLM_PROXY_ENCRYPTION_KEY"
+	encryptionKeyEnvVar   = "LLM_PROXY_ENCRYPTION_KEY"
+	encryptionSaltEnvVar  = "LLM_PROXY_ENCRYPTION_SALT"
+	defaultEncryptionSalt = "llmproxy-api-key-encryption"
+
+	// scrypt parameters for deriving an AES-256 key from a passphrase
+	scryptN          = 32768
+	scryptR          = 8
+	scryptP          = 1
+	derivedKeyLength = 32
 )
 
 var (
 	ErrInvalidAPIKey      = errors.New("invalid API key format")
 	ErrEncryptionKeyMissing = errors.New("encryption key not set")
 	ErrDecryptionFailed   = errors.New("failed to decrypt API key")
+	ErrInvalidEncryptionKey = errors.New("invalid encryption key")
 )
 
 var (
@@ -42,6 +63,22 @@ var (
 	claudeKeyPattern  = regexp.MustCompile(`^[a-zA-Z0-9_-]{8,}$`)
 	
 	testKeyPattern = regexp.MustCompile(`^test_[a-zA-Z0-9_-]{8,}$`)
+	
+	headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	
+	// Headers the proxy sets itself; extra headers may not replace provider credentials or framing
+	protectedHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"X-Api-Key":           true,
+		"X-Goog-Api-Key":      true,
+		"Api-Key":             true,
+		"Cookie":              true,
+		"Host":                true,
+		"Content-Type":        true,
+		"Content-Length":      true,
+		"Transfer-Encoding":   true,
+	}
 )
 
 type APIKey struct {
@@ -67,6 +104,41 @@ func (k APIKey) String() string {
 	return fmt.Sprintf("[encrypted:%s:v%d]", k.Provider, k.Version)
 }
 
+type ModelAlias struct {
+	Model        models.ModelType `json:"model"`
+	ModelVersion string           `json:"model_version,omitempty"`
+}
+
+type ModelDefaults struct {
+	Temperature    *float64 `json:"temperature,omitempty"`
+	MaxTokens      *int     `json:"max_tokens,omitempty"`
+	MaxTemperature *float64 `json:"max_temperature,omitempty"` // Higher request temperatures are clamped to this
+}
+
+type ModelCapabilities struct {
+	SupportsTools  *bool `json:"supports_tools,omitempty"`
+	SupportsVision *bool `json:"supports_vision,omitempty"`
+	SupportsJSON   *bool `json:"supports_json,omitempty"`
+	ContextWindow  *int  `json:"context_window,omitempty"` // Tokens
+}
+
+type ErrorStatus struct {
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"` // Client message, may use {model}, {version} and {detail}
+}
+
+type PromptWrapper struct {
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+}
+
+type DowngradePolicy struct {
+	Target          models.ModelType `json:"target"`
+	Timeouts        int              `json:"timeouts,omitempty"`         // Timeouts within the window that trigger the downgrade
+	WindowSeconds   int              `json:"window_seconds,omitempty"`
+	CooldownSeconds int              `json:"cooldown_seconds,omitempty"` // How long traffic is sent to the target
+}
+
 type Config struct {
 	OpenAIAPIKey      APIKey
 	GeminiAPIKey      APIKey
@@ -75,12 +147,85 @@ type Config struct {
 	Port              string
 	CacheEnabled      bool
 	CacheTTL          int  // Time to live in seconds
+	CacheKeyIgnoreVersion bool // Share cache entries across versions of the same model
+	SharedCache       bool // Share cache entries across tenants instead of keying them by tenant
+	StrictModelVersion bool // Reject unsupported model versions instead of using the default
+	DefaultModelVersions map[models.ModelType]string // Per-provider version used when a request omits one
+	SanitizeControlChars bool // Strip control characters (except newlines and tabs) from queries
+	SanitizeNormalizeUnicode bool // Normalize queries to Unicode NFC
+	SanitizeCollapseWhitespace bool // Collapse runs of spaces and blank lines in queries
 	KeyRotationHours  int  // Hours between key rotations
 	HTTPTimeout       int  // HTTP client timeout in seconds
+	AvailabilityCheckTimeout int // Provider availability probe timeout in seconds
+	AvailabilityCacheTTL     int // Seconds a provider availability result is reused (0 disables)
+	AvailabilityCheckMethods map[models.ModelType]string // Per-provider probe method: get, head or none
+	RequestTimeout    int  // Overall query deadline in seconds
+	HedgeDelayMs      int  // Milliseconds before a hedged query races a second model (0 disables hedging)
+	ShutdownTimeout   int  // Seconds in-flight requests get to finish on shutdown
+	MetricsDrainWindow int  // Seconds to wait for a final metrics scrape or push after shutdown
+	PushgatewayURL    string // Push final metrics to this Pushgateway instead of waiting for a scrape
+	MetricsSnapshotPath string // File the final JSON metrics are written to on shutdown; empty logs them
+	SlowRequestThresholdMs int // Queries slower than this are logged and counted as slow (0 disables)
+	DebugCapture      bool    // Keep redacted request/response pairs for /api/admin/captures
+	DebugCaptureSampleRate float64 // Fraction (0-1) of queries captured
+	DebugCaptureSize  int     // Captures kept in the rolling buffer
+	MaxParallelModels int  // Maximum number of models in one parallel query
+	MaxBatchSize      int  // Maximum number of queries in one batch
+	MaxFanout         int  // Maximum provider calls one eval or batch request may make (0 disables)
+	EvalTimeout       int  // Overall eval deadline in seconds, kept under the server write timeout
+	MaxTokensPerRequest int // Ceiling on max_tokens summed over every completion in a request (0 disables)
+	BatchWorkers      int  // Batch queries run concurrently
+	BatchTimeout      int  // Overall batch deadline in seconds, kept under the server write timeout
+	PriceCatalogPath  string // Price catalog override; empty uses the embedded catalog
+	CatalogStrict     bool   // Refuse to start with a catalog past its validation due date
+	IdempotencyTTL    int    // Seconds a completed Idempotency-Key response is kept for replay
+	CallbackAllowPrivateNetworks bool // Allow callback_url to target loopback, private and link-local addresses
+	StrictRequestSchema bool // Reject request bodies with fields the endpoint does not know
+	RateLimitBackend  string // Where client rate limits are kept: memory (per instance) or redis (shared)
+	RedisURL          string // Redis connection URL for the redis rate limit backend
+	CompressionEnabled bool  // Gzip responses for clients that accept it
+	CompressionMinSize int   // Smallest response body in bytes worth compressing
+	DownloadFormats   []string // Download formats operators have enabled
+	MaxDownloadSize   int      // Largest response content in bytes accepted for download (0 only applies the request body limit)
+	CostCurrency      string  // Currency cost estimates are converted to (USD when unset)
+	CostFXRate        float64 // Units of CostCurrency per US dollar
 	MaxIdleConns      int  // Maximum number of idle connections
 	MaxIdleConnsPerHost int // Maximum number of idle connections per host
 	IdleConnTimeout   int  // Idle connection timeout in seconds
+	TLSMinVersion     string   // Minimum TLS version for provider connections (1.2 or 1.3)
+	ProviderCABundle  string   // PEM file trusted instead of the system root store, empty for system roots
+	ProviderCertPins  []string // Base64 SHA-256 public key hashes, one of which must be in the provider's chain
+	TaskRouting       map[models.TaskType]models.ModelType // Task type to preferred model
+	RoutingStrategy   string // How a model is picked when the request does not name one
+	RouteByLanguage   bool   // Detect the query's language and prefer the model in LanguageRouting
+	LanguageRouting   map[string]models.ModelType // ISO 639-1 (or 639-3) language code to preferred model
+	LanguageMinConfidence float64 // Detections below this confidence (0-1) fall back to normal routing
+	ModelAliases      map[string]ModelAlias                // Stable alias to concrete model and version
+	ModelDefaults     map[models.ModelType]ModelDefaults   // Per-model parameters used when a request omits them
+	ModelCapabilities map[string]ModelCapabilities         // Per-version overrides of the built-in capability matrix
+	ErrorStatuses     map[string]ErrorStatus               // Error code to HTTP status and message, overriding the defaults
+	RetryableStatusCodes []int                             // Extra provider status codes to retry
+	ModelMaxRetries   map[models.ModelType]int // Per-provider override of the default max retries
+	FallbackOn        []string // Error categories that trigger fallback to another model, empty for all
+	ModelDowngrades   map[models.ModelType]DowngradePolicy // Model to reroute to after repeated timeouts
+	ModelRPM          map[models.ModelType]int // Server-wide requests per minute per provider (unset is unlimited)
+	ProviderExtraHeaders map[models.ModelType]map[string]string // Extra headers sent with every request to a provider
+	ModelDailyBudgetUSD   map[models.ModelType]float64 // Per-provider spend cap per UTC day (unset is unlimited)
+	ModelMonthlyBudgetUSD map[models.ModelType]float64 // Per-provider spend cap per UTC month (unset is unlimited)
+	TenantAPIKeys     map[string]string                    // API key to the tenant it authenticates
+	TenantModels      map[string][]models.ModelType        // Models each tenant may use
+	DefaultAllowedModels []models.ModelType                // Models for unknown tenants, empty allows all
+	DisabledModels    []models.ModelType                   // Models reported unavailable regardless of their probe
+	TenantParallelModels map[string][]models.ModelType     // Models a tenant's parallel query uses when it names none
+	DefaultParallelModels []models.ModelType               // Parallel default for tenants without their own, empty uses the allow-list
+	TenantPromptWrappers map[string]PromptWrapper          // Prefix/suffix wrapped around each tenant's queries
+	DefaultPromptWrapper PromptWrapper                     // Wrapper for tenants without their own
+	TenantPriorities  map[string]string                    // Priority tier of each tenant's queries: high, normal or low
+	DefaultPriority   string                               // Tier for tenants without their own
+	MaxConcurrentRequests int // Queries sent upstream at once across the server (0 disables the limit)
+	MaxQueuedRequests int     // Queries waiting for a slot before the lowest tier is shed with 429
 	lastKeyCheck      time.Time
+	keyGeneration     uint64 // Incremented whenever an API key changes
 	encryptionKey     []byte
 	mutex             sync.RWMutex
 }
@@ -123,16 +268,92 @@ func GetConfig() *Config {
 			Port:               getEnvWithDefault("PORT", "8080"),
 			CacheEnabled:       getEnvAsBool("CACHE_ENABLED", true),
 			CacheTTL:           getEnvAsInt("CACHE_TTL", 300),
+			CacheKeyIgnoreVersion: getEnvAsBool("CACHE_KEY_IGNORE_VERSION", false),
+			SharedCache:        getEnvAsBool("SHARED_CACHE", false),
+			StrictModelVersion: getEnvAsBool("STRICT_MODEL_VERSION", false),
+			DefaultModelVersions: getEnvAsDefaultModelVersions(),
+			SanitizeControlChars: getEnvAsBool("SANITIZE_CONTROL_CHARS", false),
+			SanitizeNormalizeUnicode: getEnvAsBool("SANITIZE_NORMALIZE_UNICODE", false),
+			SanitizeCollapseWhitespace: getEnvAsBool("SANITIZE_COLLAPSE_WHITESPACE", false),
 			KeyRotationHours:   getEnvAsInt("KEY_ROTATION_HOURS", defaultKeyRotationInterval),
 			HTTPTimeout:        getEnvAsInt("HTTP_TIMEOUT", 30),
+			AvailabilityCheckTimeout: getEnvAsInt("AVAILABILITY_CHECK_TIMEOUT", 5),
+			AvailabilityCacheTTL:     getEnvAsInt("AVAILABILITY_CACHE_TTL", 0),
+			AvailabilityCheckMethods: getEnvAsAvailabilityCheckMethods(),
+			RequestTimeout:     getEnvAsInt("REQUEST_TIMEOUT", 30),
+			HedgeDelayMs:       getEnvAsInt("HEDGE_DELAY_MS", 2000),
+			ShutdownTimeout:    getEnvAsInt("SHUTDOWN_TIMEOUT", 30),
+			MetricsDrainWindow: getEnvAsInt("METRICS_DRAIN_WINDOW", 5),
+			PushgatewayURL:     os.Getenv("PUSHGATEWAY_URL"),
+			MetricsSnapshotPath: os.Getenv("METRICS_SNAPSHOT_PATH"),
+			SlowRequestThresholdMs: getEnvAsInt("SLOW_REQUEST_THRESHOLD_MS", 10000),
+			DebugCapture:       getEnvAsBool("DEBUG_CAPTURE", false),
+			DebugCaptureSampleRate: getEnvAsFloat("DEBUG_CAPTURE_SAMPLE_RATE", 1),
+			DebugCaptureSize:   getEnvAsInt("DEBUG_CAPTURE_SIZE", 100),
+			MaxParallelModels:  getEnvAsInt("MAX_PARALLEL_MODELS", 4),
+			MaxBatchSize:       getEnvAsInt("MAX_BATCH_SIZE", 100),
+			MaxFanout:          getEnvAsInt("MAX_FANOUT", 200),
+			EvalTimeout:        getEnvAsInt("EVAL_TIMEOUT", 50),
+			MaxTokensPerRequest: getEnvAsInt("MAX_TOKENS_PER_REQUEST", 0),
+			BatchWorkers:       getEnvAsInt("BATCH_WORKERS", 4),
+			BatchTimeout:       getEnvAsInt("BATCH_TIMEOUT", 50),
+			PriceCatalogPath:   getEnvWithDefault("CATALOG_PATH", os.Getenv("PRICE_CATALOG_PATH")),
+			CatalogStrict:      getEnvAsBool("CATALOG_STRICT", false),
+			IdempotencyTTL:     getEnvAsInt("IDEMPOTENCY_TTL", 86400),
+			CallbackAllowPrivateNetworks: getEnvAsBool("CALLBACK_ALLOW_PRIVATE_NETWORKS", false),
+			StrictRequestSchema: getEnvAsBool("STRICT_REQUEST_SCHEMA", false),
+			RateLimitBackend:   getEnvAsRateLimitBackend("RATE_LIMIT_BACKEND"),
+			RedisURL:           getEnvWithDefault("REDIS_URL", "redis://localhost:6379/0"),
+			CompressionEnabled: getEnvAsBool("COMPRESSION_ENABLED", true),
+			CompressionMinSize: getEnvAsInt("COMPRESSION_MIN_SIZE", 1024),
+			DownloadFormats:    getEnvAsDownloadFormats("DOWNLOAD_FORMATS"),
+			MaxDownloadSize:    getEnvAsInt("MAX_DOWNLOAD_SIZE", 512*1024),
+			CostCurrency:       strings.ToUpper(strings.TrimSpace(getEnvWithDefault("COST_CURRENCY", "USD"))),
+			CostFXRate:         getEnvAsFloat("COST_FX_RATE", 1),
 			MaxIdleConns:       getEnvAsInt("MAX_IDLE_CONNS", 100),
 			MaxIdleConnsPerHost: getEnvAsInt("MAX_IDLE_CONNS_PER_HOST", 20),
 			IdleConnTimeout:    getEnvAsInt("IDLE_CONN_TIMEOUT", 90),
+			TLSMinVersion:      getEnvWithDefault("TLS_MIN_VERSION", "1.2"),
+			ProviderCABundle:   os.Getenv("PROVIDER_CA_BUNDLE"),
+			ProviderCertPins:   getEnvAsStringSlice("PROVIDER_CERT_PINS"),
+			TaskRouting:        getEnvAsTaskRouting("TASK_ROUTING"),
+			RoutingStrategy:    getEnvAsRoutingStrategy("ROUTING_STRATEGY"),
+			RouteByLanguage:    getEnvAsBool("ROUTE_BY_LANGUAGE", false),
+			LanguageRouting:    getEnvAsLanguageRouting("LANGUAGE_ROUTING"),
+			LanguageMinConfidence: getEnvAsFloat("LANGUAGE_MIN_CONFIDENCE", 0.8),
+			ModelAliases:       getEnvAsModelAliases("ALIASES"),
+			ModelDefaults:      getEnvAsModelDefaults("MODEL_DEFAULTS_JSON"),
+			ModelCapabilities:  getEnvAsModelCapabilities("MODEL_CAPABILITIES"),
+			ErrorStatuses:      getEnvAsErrorStatuses("ERROR_STATUS_MAP"),
+			RetryableStatusCodes: getEnvAsIntSlice("RETRYABLE_STATUS_CODES"),
+			ModelMaxRetries:    getEnvAsModelMaxRetries(),
+			FallbackOn:         getEnvAsFallbackOn("FALLBACK_ON"),
+			ModelDowngrades:    getEnvAsModelDowngrades("MODEL_DOWNGRADES"),
+			ModelRPM:           getEnvAsModelRPM(),
+			ProviderExtraHeaders: getEnvAsProviderExtraHeaders(),
+			ModelDailyBudgetUSD:   getEnvAsModelBudgets("DAILY_BUDGET_USD"),
+			ModelMonthlyBudgetUSD: getEnvAsModelBudgets("MONTHLY_BUDGET_USD"),
+			TenantAPIKeys:      getEnvAsTenantAPIKeys("TENANT_API_KEYS"),
+			TenantModels:       getEnvAsTenantModels("TENANT_MODELS"),
+			DefaultAllowedModels: getEnvAsModelList("DEFAULT_ALLOWED_MODELS"),
+			DisabledModels:     getEnvAsDisabledModels("DISABLED_MODELS"),
+			TenantParallelModels: getEnvAsTenantParallelModels("TENANT_PARALLEL_MODELS"),
+			DefaultParallelModels: getEnvAsModelList("PARALLEL_MODELS"),
+			TenantPromptWrappers: getEnvAsTenantPromptWrappers("TENANT_PROMPT_WRAPPERS"),
+			DefaultPromptWrapper: PromptWrapper{Prefix: os.Getenv("PROMPT_PREFIX"), Suffix: os.Getenv("PROMPT_SUFFIX")},
+			TenantPriorities:   getEnvAsTenantPriorities("TENANT_PRIORITIES"),
+			DefaultPriority:    getEnvAsPriority("DEFAULT_PRIORITY"),
+			MaxConcurrentRequests: getEnvAsInt("MAX_CONCURRENT_REQUESTS", 0),
+			MaxQueuedRequests:  getEnvAsInt("MAX_QUEUED_REQUESTS", 100),
 			lastKeyCheck:       time.Now(),
 		}
 		
 		if encryptionKey != "" {
-			config.encryptionKey = []byte(encryptionKey)
+			key, err := deriveEncryptionKey(encryptionKey, getEnvWithDefault(encryptionSaltEnvVar, defaultEncryptionSalt))
+			if err != nil {
+				logrus.Fatalf("Invalid %s: %v", encryptionKeyEnvVar, err)
+			}
+			config.encryptionKey = key
 			config.encryptAPIKeys()
 		} else {
 			logrus.Warn("No encryption key set. API keys will not be encrypted.")
@@ -233,10 +454,85 @@ func (c *Config) SetAPIKey(provider, value string) error {
 	default:
 		return fmt.Errorf("unknown provider: %s", provider)
 	}
+	c.keyGeneration++
 	
 	return nil
 }
 
+func (c *Config) TenantForAPIKey(apiKey string) (string, bool) {
+	tenant := ""
+	for key, keyTenant := range c.TenantAPIKeys {
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+			tenant = keyTenant
+		}
+	}
+	return tenant, tenant != ""
+}
+
+func (c *Config) AllowedModels(tenant string) []models.ModelType {
+	if allowed, ok := c.TenantModels[tenant]; ok && tenant != "" {
+		return allowed
+	}
+	
+	if len(c.DefaultAllowedModels) > 0 {
+		return c.DefaultAllowedModels
+	}
+	
+	return []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}
+}
+
+func (c *Config) TenantPriority(tenant string) string {
+	if priority, ok := c.TenantPriorities[tenant]; ok && tenant != "" {
+		return priority
+	}
+	if c.DefaultPriority != "" {
+		return c.DefaultPriority
+	}
+	return PriorityNormal
+}
+
+func (c *Config) ParallelModels(tenant string) []models.ModelType {
+	candidates, ok := c.TenantParallelModels[tenant]
+	if !ok || tenant == "" {
+		candidates = c.DefaultParallelModels
+	}
+	if len(candidates) == 0 {
+		return c.AllowedModels(tenant)
+	}
+	
+	var parallelModels []models.ModelType
+	for _, model := range candidates {
+		if c.IsModelAllowed(tenant, model) {
+			parallelModels = append(parallelModels, model)
+		}
+	}
+	return parallelModels
+}
+
+func (c *Config) PromptWrapper(tenant string) PromptWrapper {
+	if wrapper, ok := c.TenantPromptWrappers[tenant]; ok && tenant != "" {
+		return wrapper
+	}
+	
+	return c.DefaultPromptWrapper
+}
+
+func (c *Config) IsModelAllowed(tenant string, model models.ModelType) bool {
+	for _, allowed := range c.AllowedModels(tenant) {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) KeyGeneration() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	
+	return c.keyGeneration
+}
+
 func (c *Config) RotateAPIKey(provider, newValue string) error {
 	if err := c.validateAPIKeyFormat(provider, newValue); err != nil {
 		return err
@@ -273,6 +569,7 @@ func (c *Config) RotateAPIKey(provider, newValue string) error {
 		currentKey.Value = encrypted
 		currentKey.Encrypted = true
 	}
+	c.keyGeneration++
 	
 	logrus.WithFields(logrus.Fields{
 		"provider": provider,
@@ -287,33 +584,50 @@ func (c *Config) encryptAPIKeys() {
 		return
 	}
 	
-	if c.OpenAIAPIKey.Value != "" && !c.OpenAIAPIKey.Encrypted {
-		if encrypted, err := encrypt(c.OpenAIAPIKey.Value, c.encryptionKey); err == nil {
-			c.OpenAIAPIKey.Value = encrypted
-			c.OpenAIAPIKey.Encrypted = true
+	var encrypted []string
+	for _, apiKey := range []*APIKey{&c.OpenAIAPIKey, &c.GeminiAPIKey, &c.MistralAPIKey, &c.ClaudeAPIKey} {
+		if apiKey.Value == "" || apiKey.Encrypted {
+			continue
+		}
+		
+		value, err := encrypt(apiKey.Value, c.encryptionKey)
+		if err != nil {
+			logrus.WithError(err).WithField("provider", apiKey.Provider).Error("Failed to encrypt API key")
+			continue
 		}
+		
+		apiKey.Value = value
+		apiKey.Encrypted = true
+		encrypted = append(encrypted, apiKey.Provider)
 	}
 	
-	if c.GeminiAPIKey.Value != "" && !c.GeminiAPIKey.Encrypted {
-		if encrypted, err := encrypt(c.GeminiAPIKey.Value, c.encryptionKey); err == nil {
-			c.GeminiAPIKey.Value = encrypted
-			c.GeminiAPIKey.Encrypted = true
-		}
+	logrus.WithField("providers", encrypted).Info("Encrypted API keys")
+}
+
+func validateEncryptionKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
 	}
 	
-	if c.MistralAPIKey.Value != "" && !c.MistralAPIKey.Encrypted {
-		if encrypted, err := encrypt(c.MistralAPIKey.Value, c.encryptionKey); err == nil {
-			c.MistralAPIKey.Value = encrypted
-			c.MistralAPIKey.Encrypted = true
-		}
+	return fmt.Errorf("%w: key is %d bytes, must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256", ErrInvalidEncryptionKey, len(key))
+}
+
+func deriveEncryptionKey(passphrase, salt string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrEncryptionKeyMissing
 	}
 	
-	if c.ClaudeAPIKey.Value != "" && !c.ClaudeAPIKey.Encrypted {
-		if encrypted, err := encrypt(c.ClaudeAPIKey.Value, c.encryptionKey); err == nil {
-			c.ClaudeAPIKey.Value = encrypted
-			c.ClaudeAPIKey.Encrypted = true
-		}
+	if validateEncryptionKey([]byte(passphrase)) == nil {
+		return []byte(passphrase), nil
 	}
+	
+	key, err := scrypt.Key([]byte(passphrase), []byte(salt), scryptN, scryptR, scryptP, derivedKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEncryptionKey, err)
+	}
+	
+	return key, nil
 }
 
 func (c *Config) validateAPIKeys() {
@@ -342,6 +656,10 @@ func (c *Config) validateAPIKeys() {
 	}
 }
 
+func (c *Config) ValidateAPIKeyFormat(provider, key string) error {
+	return c.validateAPIKeyFormat(provider, key)
+}
+
 func (c *Config) validateAPIKeyFormat(provider, key string) error {
 	if key == "" {
 		return nil // Empty keys are allowed (provider will be unavailable)
@@ -501,3 +819,879 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return intValue
 }
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	floatValue := 0.0
+	_, err := fmt.Sscanf(value, "%g", &floatValue)
+	if err != nil {
+		return defaultValue
+	}
+	return floatValue
+}
+
+var providerEnvPrefixes = map[models.ModelType]string{
+	models.OpenAI:  "OPENAI",
+	models.Gemini:  "GEMINI",
+	models.Mistral: "MISTRAL",
+	models.Claude:  "CLAUDE",
+}
+
+// getEnvPerProvider reads keyTemplate with each provider's prefix, e.g. "%s_RPM"
+// for OPENAI_RPM, and keeps the values parse accepts. Unset variables are skipped
+// and invalid ones are logged and skipped.
+func getEnvPerProvider[T any](keyTemplate, description string, parse func(string) (T, error)) map[models.ModelType]T {
+	values := make(map[models.ModelType]T)
+	for model, prefix := range providerEnvPrefixes {
+		envVar := fmt.Sprintf(keyTemplate, prefix)
+		value := strings.TrimSpace(os.Getenv(envVar))
+		if value == "" {
+			continue
+		}
+		
+		parsed, err := parse(value)
+		if err != nil {
+			logrus.WithError(err).WithField("value", value).Warnf("Ignoring invalid %s in %s", description, envVar)
+			continue
+		}
+		values[model] = parsed
+	}
+	
+	return values
+}
+
+func parseIntAtLeast(min int) func(string) (int, error) {
+	return func(value string) (int, error) {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, err
+		}
+		if parsed < min {
+			return 0, fmt.Errorf("must be at least %d", min)
+		}
+		return parsed, nil
+	}
+}
+
+func parsePositiveFloat(value string) (float64, error) {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if parsed <= 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+		return 0, errors.New("must be a positive number")
+	}
+	return parsed, nil
+}
+
+func getEnvAsProviderExtraHeaders() map[models.ModelType]map[string]string {
+	return getEnvPerProvider("%s_EXTRA_HEADERS", "extra headers", parseExtraHeaders)
+}
+
+func parseExtraHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		
+		name, headerValue, found := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		headerValue = strings.TrimSpace(headerValue)
+		if !found || name == "" {
+			return nil, fmt.Errorf("expected Name:Value, got %q", part)
+		}
+		
+		if !headerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(headerValue, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid value for header %s", name)
+		}
+		
+		name = http.CanonicalHeaderKey(name)
+		if protectedHeaders[name] {
+			return nil, fmt.Errorf("header %s cannot be overridden", name)
+		}
+		
+		headers[name] = headerValue
+	}
+	return headers, nil
+}
+
+func getEnvAsStringSlice(key string) []string {
+	var values []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func getEnvAsDefaultModelVersions() map[models.ModelType]string {
+	return getEnvPerProvider("%s_DEFAULT_VERSION", "default version", func(version string) (string, error) {
+		return version, nil
+	})
+}
+
+const (
+	AvailabilityCheckGet  = "get"  // GET the provider's model list
+	AvailabilityCheckHead = "head" // HEAD the model list, for providers that rate-limit listing
+	AvailabilityCheckNone = "none" // Skip the probe and treat a configured key as available
+)
+
+func getEnvAsAvailabilityCheckMethods() map[models.ModelType]string {
+	defaultMethod := parseAvailabilityCheckMethod("AVAILABILITY_CHECK_METHOD", parseAvailabilityCheckMethod("AVAILABILITY_PROBE", AvailabilityCheckGet))
+	
+	methods := getEnvPerProvider("%s_AVAILABILITY_CHECK_METHOD", "availability check method", availabilityCheckMethod)
+	for model := range providerEnvPrefixes {
+		if _, ok := methods[model]; !ok {
+			methods[model] = defaultMethod
+		}
+	}
+	
+	return methods
+}
+
+func parseAvailabilityCheckMethod(key, defaultValue string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultValue
+	}
+	
+	method, err := availabilityCheckMethod(value)
+	if err != nil {
+		logrus.WithField("value", value).Warnf("Ignoring invalid availability check method in %s", key)
+		return defaultValue
+	}
+	return method
+}
+
+func availabilityCheckMethod(value string) (string, error) {
+	switch value = strings.ToLower(value); value {
+	case AvailabilityCheckGet, AvailabilityCheckHead, AvailabilityCheckNone:
+		return value, nil
+	case "models":
+		return AvailabilityCheckGet, nil
+	case "light":
+		return AvailabilityCheckHead, nil
+	}
+	return "", fmt.Errorf("expected get, head or none, got %q", value)
+}
+
+func (c *Config) AvailabilityCheckMethod(model models.ModelType) string {
+	if method, ok := c.AvailabilityCheckMethods[model]; ok {
+		return method
+	}
+	return AvailabilityCheckGet
+}
+
+func getEnvAsModelRPM() map[models.ModelType]int {
+	return getEnvPerProvider("%s_RPM", "requests per minute", parseIntAtLeast(1))
+}
+
+func getEnvAsModelBudgets(suffix string) map[models.ModelType]float64 {
+	return getEnvPerProvider("%s_"+suffix, "budget", parsePositiveFloat)
+}
+
+func getEnvAsModelMaxRetries() map[models.ModelType]int {
+	return getEnvPerProvider("%s_RETRY_MAX", "retry count", parseIntAtLeast(0))
+}
+
+func getEnvAsIntSlice(key string) []int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil
+	}
+	
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		
+		intValue, err := strconv.Atoi(part)
+		if err != nil {
+			logrus.WithField("value", part).Warnf("Ignoring invalid integer in %s", key)
+			continue
+		}
+		values = append(values, intValue)
+	}
+	return values
+}
+
+func getEnvAsFallbackOn(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	
+	categories, err := parseFallbackOn(value)
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, falling back on all retryable errors", key)
+		return nil
+	}
+	return categories
+}
+
+func parseFallbackOn(value string) ([]string, error) {
+	var categories []string
+	for _, part := range strings.Split(value, ",") {
+		category := strings.ToLower(strings.TrimSpace(part))
+		if category == "" {
+			continue
+		}
+		
+		known := false
+		for _, fallbackCategory := range myerrors.FallbackCategories {
+			if category == fallbackCategory {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown error category %q, expected one of %s", part, strings.Join(myerrors.FallbackCategories, ", "))
+		}
+		
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+func (c *Config) ShouldFallback(category string) bool {
+	if len(c.FallbackOn) == 0 {
+		return true
+	}
+	
+	for _, fallbackCategory := range c.FallbackOn {
+		if fallbackCategory == category {
+			return true
+		}
+	}
+	return false
+}
+
+func DefaultTaskRouting() map[models.TaskType]models.ModelType {
+	return map[models.TaskType]models.ModelType{
+		models.TextGeneration:    models.OpenAI,
+		models.Summarization:     models.Claude,
+		models.SentimentAnalysis: models.Gemini,
+		models.QuestionAnswering: models.Mistral,
+	}
+}
+
+const (
+	RoutingRandom = "random" // Pick uniformly among available models
+	RoutingSticky = "sticky" // Hash the query so the same query prefers the same model
+)
+
+func getEnvAsRoutingStrategy(key string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	switch value {
+	case "":
+		return RoutingRandom
+	case RoutingRandom, RoutingSticky:
+		return value
+	}
+	
+	logrus.WithField("value", value).Warnf("Ignoring invalid %s, using random routing", key)
+	return RoutingRandom
+}
+
+const (
+	RateLimitMemory = "memory" // Each instance keeps its own token buckets
+	RateLimitRedis  = "redis"  // Token buckets are shared by every instance through Redis
+)
+
+func getEnvAsRateLimitBackend(key string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	switch value {
+	case "":
+		return RateLimitMemory
+	case RateLimitMemory, RateLimitRedis:
+		return value
+	}
+	
+	logrus.WithField("value", value).Warnf("Ignoring invalid %s, using in-memory rate limiting", key)
+	return RateLimitMemory
+}
+
+func getEnvAsTaskRouting(key string) map[models.TaskType]models.ModelType {
+	routing, err := parseTaskRouting(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, using default task routing", key)
+		return DefaultTaskRouting()
+	}
+	return routing
+}
+
+func parseTaskRouting(value string) (map[models.TaskType]models.ModelType, error) {
+	routing := DefaultTaskRouting()
+	
+	var overrides map[string]string
+	if err := readJSONSetting(value, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to load task routing: %w", err)
+	}
+	
+	for taskType, model := range overrides {
+		taskType = strings.ToLower(strings.TrimSpace(taskType))
+		modelType := models.ModelType(strings.ToLower(strings.TrimSpace(model)))
+		
+		if taskType == "" {
+			return nil, fmt.Errorf("task routing contains an empty task type")
+		}
+		
+		if !isKnownModel(modelType) {
+			return nil, fmt.Errorf("task routing for %s: %w: %s", taskType, models.ErrInvalidModel, model)
+		}
+		
+		routing[models.TaskType(taskType)] = modelType
+	}
+	
+	return routing, nil
+}
+
+func getEnvAsLanguageRouting(key string) map[string]models.ModelType {
+	routing, err := parseLanguageRouting(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, language routing disabled", key)
+		return map[string]models.ModelType{}
+	}
+	return routing
+}
+
+func parseLanguageRouting(value string) (map[string]models.ModelType, error) {
+	var entries map[string]string
+	if err := readJSONSetting(value, &entries); err != nil {
+		return nil, fmt.Errorf("failed to load language routing: %w", err)
+	}
+	
+	routing := make(map[string]models.ModelType, len(entries))
+	for language, model := range entries {
+		language = strings.ToLower(strings.TrimSpace(language))
+		modelType := models.ModelType(strings.ToLower(strings.TrimSpace(model)))
+		
+		if language == "" {
+			return nil, fmt.Errorf("language routing contains an empty language")
+		}
+		
+		if !isKnownModel(modelType) {
+			return nil, fmt.Errorf("language routing for %s: %w: %s", language, models.ErrInvalidModel, model)
+		}
+		
+		routing[language] = modelType
+	}
+	
+	return routing, nil
+}
+
+func getEnvAsModelAliases(key string) map[string]ModelAlias {
+	aliases, err := parseModelAliases(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, model aliases disabled", key)
+		return map[string]ModelAlias{}
+	}
+	return aliases
+}
+
+func parseModelAliases(value string) (map[string]ModelAlias, error) {
+	aliases := map[string]ModelAlias{}
+	
+	var raw map[string]ModelAlias
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load model aliases: %w", err)
+	}
+	
+	for name, alias := range raw {
+		name = strings.ToLower(strings.TrimSpace(name))
+		alias.Model = models.ModelType(strings.ToLower(strings.TrimSpace(string(alias.Model))))
+		alias.ModelVersion = strings.TrimSpace(alias.ModelVersion)
+		
+		if name == "" {
+			return nil, fmt.Errorf("model aliases contain an empty alias name")
+		}
+		
+		if isKnownModel(models.ModelType(name)) {
+			return nil, fmt.Errorf("alias %s shadows a model name", name)
+		}
+		
+		if !isKnownModel(alias.Model) {
+			return nil, fmt.Errorf("alias %s: %w: %s", name, models.ErrInvalidModel, alias.Model)
+		}
+		
+		aliases[name] = alias
+	}
+	
+	return aliases, nil
+}
+
+func getEnvAsModelDowngrades(key string) map[models.ModelType]DowngradePolicy {
+	downgrades, err := parseModelDowngrades(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, timeout downgrades disabled", key)
+		return map[models.ModelType]DowngradePolicy{}
+	}
+	return downgrades
+}
+
+func parseModelDowngrades(value string) (map[models.ModelType]DowngradePolicy, error) {
+	downgrades := map[models.ModelType]DowngradePolicy{}
+	
+	var raw map[string]DowngradePolicy
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load model downgrades: %w", err)
+	}
+	
+	for name, policy := range raw {
+		modelType := models.ModelType(strings.ToLower(strings.TrimSpace(name)))
+		if !isKnownModel(modelType) {
+			return nil, fmt.Errorf("%w: %s", models.ErrInvalidModel, name)
+		}
+		
+		policy.Target = models.ModelType(strings.ToLower(strings.TrimSpace(string(policy.Target))))
+		if !isKnownModel(policy.Target) {
+			return nil, fmt.Errorf("model %s: downgrade target: %w: %s", modelType, models.ErrInvalidModel, policy.Target)
+		}
+		if policy.Target == modelType {
+			return nil, fmt.Errorf("model %s: downgrade target must be a different model", modelType)
+		}
+		
+		if policy.Timeouts < 0 || policy.WindowSeconds < 0 || policy.CooldownSeconds < 0 {
+			return nil, fmt.Errorf("model %s: downgrade settings must not be negative", modelType)
+		}
+		if policy.Timeouts == 0 {
+			policy.Timeouts = defaultDowngradeTimeouts
+		}
+		if policy.WindowSeconds == 0 {
+			policy.WindowSeconds = defaultDowngradeWindow
+		}
+		if policy.CooldownSeconds == 0 {
+			policy.CooldownSeconds = defaultDowngradeCooldown
+		}
+		
+		downgrades[modelType] = policy
+	}
+	
+	return downgrades, nil
+}
+
+func getEnvAsModelDefaults(key string) map[models.ModelType]ModelDefaults {
+	defaults, err := parseModelDefaults(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, using built-in model defaults", key)
+		return map[models.ModelType]ModelDefaults{}
+	}
+	return defaults
+}
+
+func parseModelDefaults(value string) (map[models.ModelType]ModelDefaults, error) {
+	defaults := map[models.ModelType]ModelDefaults{}
+	
+	var raw map[string]ModelDefaults
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load model defaults: %w", err)
+	}
+	
+	for name, modelDefaults := range raw {
+		modelType := models.ModelType(strings.ToLower(strings.TrimSpace(name)))
+		if !isKnownModel(modelType) {
+			return nil, fmt.Errorf("%w: %s", models.ErrInvalidModel, name)
+		}
+		
+		if modelDefaults.Temperature != nil && (*modelDefaults.Temperature < 0 || *modelDefaults.Temperature > 2) {
+			return nil, fmt.Errorf("%s: temperature must be between 0 and 2", modelType)
+		}
+		
+		if modelDefaults.MaxTokens != nil && *modelDefaults.MaxTokens < 1 {
+			return nil, fmt.Errorf("%s: max_tokens must be at least 1", modelType)
+		}
+		
+		if modelDefaults.MaxTemperature != nil && (*modelDefaults.MaxTemperature < 0 || *modelDefaults.MaxTemperature > 2) {
+			return nil, fmt.Errorf("%s: max_temperature must be between 0 and 2", modelType)
+		}
+		
+		defaults[modelType] = modelDefaults
+	}
+	
+	return defaults, nil
+}
+
+func getEnvAsModelCapabilities(key string) map[string]ModelCapabilities {
+	capabilities, err := parseModelCapabilities(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, using built-in model capabilities", key)
+		return map[string]ModelCapabilities{}
+	}
+	return capabilities
+}
+
+func parseModelCapabilities(value string) (map[string]ModelCapabilities, error) {
+	capabilities := map[string]ModelCapabilities{}
+	
+	var raw map[string]ModelCapabilities
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load model capabilities: %w", err)
+	}
+	
+	for version, modelCapabilities := range raw {
+		version = strings.TrimSpace(version)
+		if version == "" {
+			return nil, fmt.Errorf("model capabilities contain an empty model version")
+		}
+		
+		if modelCapabilities.ContextWindow != nil && *modelCapabilities.ContextWindow < 1 {
+			return nil, fmt.Errorf("%s: context_window must be at least 1", version)
+		}
+		
+		capabilities[version] = modelCapabilities
+	}
+	
+	return capabilities, nil
+}
+
+func getEnvAsErrorStatuses(key string) map[string]ErrorStatus {
+	statuses, err := parseErrorStatuses(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, using the default error statuses", key)
+		return map[string]ErrorStatus{}
+	}
+	return statuses
+}
+
+func parseErrorStatuses(value string) (map[string]ErrorStatus, error) {
+	statuses := map[string]ErrorStatus{}
+	
+	var raw map[string]ErrorStatus
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load error statuses: %w", err)
+	}
+	
+	for code, status := range raw {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			return nil, fmt.Errorf("error statuses contain an empty error code")
+		}
+		
+		known := false
+		for _, errorCode := range myerrors.Codes {
+			if code == errorCode {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown error code %q", code)
+		}
+		
+		if status.Status < 400 || status.Status > 599 {
+			return nil, fmt.Errorf("%s: status must be between 400 and 599", code)
+		}
+		
+		statuses[code] = status
+	}
+	
+	return statuses, nil
+}
+
+func getEnvAsModelList(key string) []models.ModelType {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	
+	modelList, err := parseModelList(strings.Split(value, ","))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return modelList
+}
+
+func parseModelList(values []string) ([]models.ModelType, error) {
+	var modelList []models.ModelType
+	for _, value := range values {
+		modelType := models.ModelType(strings.ToLower(strings.TrimSpace(value)))
+		if modelType == "" {
+			continue
+		}
+		
+		if !isKnownModel(modelType) {
+			return nil, fmt.Errorf("%w: %s", models.ErrInvalidModel, value)
+		}
+		
+		modelList = append(modelList, modelType)
+	}
+	return modelList, nil
+}
+
+func getEnvAsDisabledModels(key string) []models.ModelType {
+	var disabled []models.ModelType
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		modelType := models.ModelType(strings.ToLower(strings.TrimSpace(value)))
+		if modelType == "" {
+			continue
+		}
+		
+		if !isKnownModel(modelType) {
+			logrus.WithField("model", value).Warnf("Ignoring unknown model in %s", key)
+			continue
+		}
+		disabled = append(disabled, modelType)
+	}
+	
+	if len(disabled) > 0 {
+		logrus.WithField("models", disabled).Warn("Models disabled by configuration")
+	}
+	return disabled
+}
+
+func (c *Config) IsModelDisabled(model models.ModelType) bool {
+	for _, disabled := range c.DisabledModels {
+		if disabled == model {
+			return true
+		}
+	}
+	return false
+}
+
+var DownloadFormats = []string{"txt", "pdf", "docx"}
+
+func getEnvAsDownloadFormats(key string) []string {
+	value := os.Getenv(key)
+	if strings.TrimSpace(value) == "" {
+		return DownloadFormats
+	}
+	
+	formats := []string{}
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" {
+			continue
+		}
+		
+		if !IsKnownDownloadFormat(format) {
+			logrus.WithField("format", format).Warnf("Ignoring unknown download format in %s", key)
+			continue
+		}
+		formats = append(formats, format)
+	}
+	return formats
+}
+
+func IsKnownDownloadFormat(format string) bool {
+	for _, known := range DownloadFormats {
+		if known == format {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) IsDownloadFormatEnabled(format string) bool {
+	for _, enabled := range c.DownloadFormats {
+		if enabled == format {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnvAsTenantAPIKeys(key string) map[string]string {
+	apiKeys, err := parseTenantAPIKeys(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, tenant API keys disabled", key)
+		return map[string]string{}
+	}
+	return apiKeys
+}
+
+func parseTenantAPIKeys(value string) (map[string]string, error) {
+	var raw map[string][]string
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load tenant API keys: %w", err)
+	}
+	
+	apiKeys := map[string]string{}
+	for tenant, keys := range raw {
+		tenant = strings.TrimSpace(tenant)
+		if tenant == "" {
+			return nil, fmt.Errorf("tenant API keys contain an empty tenant")
+		}
+		
+		for _, apiKey := range keys {
+			apiKey = strings.TrimSpace(apiKey)
+			if apiKey == "" {
+				return nil, fmt.Errorf("tenant %s: empty API key", tenant)
+			}
+			if other, ok := apiKeys[apiKey]; ok && other != tenant {
+				return nil, fmt.Errorf("tenant %s: API key is already assigned to tenant %s", tenant, other)
+			}
+			apiKeys[apiKey] = tenant
+		}
+	}
+	
+	return apiKeys, nil
+}
+
+func getEnvAsTenantModels(key string) map[string][]models.ModelType {
+	tenantModels, err := parseTenantModels(os.Getenv(key))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return tenantModels
+}
+
+func parseTenantModels(value string) (map[string][]models.ModelType, error) {
+	tenantModels := map[string][]models.ModelType{}
+	
+	var raw map[string][]string
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load tenant models: %w", err)
+	}
+	
+	for tenant, values := range raw {
+		tenant = strings.TrimSpace(tenant)
+		if tenant == "" {
+			return nil, fmt.Errorf("tenant models contain an empty tenant")
+		}
+		
+		modelList, err := parseModelList(values)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		
+		tenantModels[tenant] = modelList
+	}
+	
+	return tenantModels, nil
+}
+
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow} // Highest first
+
+func PriorityRank(priority string) int {
+	for rank, known := range Priorities {
+		if priority == known {
+			return rank
+		}
+	}
+	return -1
+}
+
+func getEnvAsPriority(key string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	if value == "" {
+		return PriorityNormal
+	}
+	if PriorityRank(value) < 0 {
+		logrus.WithField("value", value).Warnf("Ignoring invalid %s, using normal priority", key)
+		return PriorityNormal
+	}
+	return value
+}
+
+func getEnvAsTenantPriorities(key string) map[string]string {
+	priorities, err := parseTenantPriorities(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, tenant priorities disabled", key)
+		return map[string]string{}
+	}
+	return priorities
+}
+
+func parseTenantPriorities(value string) (map[string]string, error) {
+	var raw map[string]string
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load tenant priorities: %w", err)
+	}
+	
+	priorities := make(map[string]string, len(raw))
+	for tenant, priority := range raw {
+		tenant = strings.TrimSpace(tenant)
+		if tenant == "" {
+			return nil, fmt.Errorf("tenant priorities contain an empty tenant")
+		}
+		
+		priority = strings.ToLower(strings.TrimSpace(priority))
+		if PriorityRank(priority) < 0 {
+			return nil, fmt.Errorf("tenant %s: unknown priority %q, expected high, normal or low", tenant, priority)
+		}
+		
+		priorities[tenant] = priority
+	}
+	
+	return priorities, nil
+}
+
+func getEnvAsTenantParallelModels(key string) map[string][]models.ModelType {
+	tenantModels, err := parseTenantModels(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, tenant parallel defaults disabled", key)
+		return map[string][]models.ModelType{}
+	}
+	return tenantModels
+}
+
+func getEnvAsTenantPromptWrappers(key string) map[string]PromptWrapper {
+	wrappers, err := parseTenantPromptWrappers(os.Getenv(key))
+	if err != nil {
+		logrus.WithError(err).Warnf("Invalid %s, tenant prompt wrappers disabled", key)
+		return map[string]PromptWrapper{}
+	}
+	return wrappers
+}
+
+func parseTenantPromptWrappers(value string) (map[string]PromptWrapper, error) {
+	wrappers := map[string]PromptWrapper{}
+	
+	var raw map[string]PromptWrapper
+	if err := readJSONSetting(value, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load tenant prompt wrappers: %w", err)
+	}
+	
+	for tenant, wrapper := range raw {
+		tenant = strings.TrimSpace(tenant)
+		if tenant == "" {
+			return nil, fmt.Errorf("tenant prompt wrappers contain an empty tenant")
+		}
+		
+		wrappers[tenant] = wrapper
+	}
+	
+	return wrappers, nil
+}
+
+func readJSONSetting(value string, target interface{}) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	
+	data := []byte(value)
+	if !strings.HasPrefix(value, "{") && !strings.HasPrefix(value, "[") {
+		fileData, err := os.ReadFile(value)
+		if err != nil {
+			return err
+		}
+		data = fileData
+	}
+	
+	return json.Unmarshal(data, target)
+}
+
+func isKnownModel(model models.ModelType) bool {
+	switch model {
+	case models.OpenAI, models.Gemini, models.Mistral, models.Claude:
+		return true
+	}
+	return false
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
+
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/sirupsen/logrus"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -163,3 +169,706 @@ func TestGetEnvAsInt(t *testing.T) {
 		}
 	}
 }
+
+func TestGetEnvAsFloat(t *testing.T) {
+	testCases := []struct {
+		envValue      string
+		defaultValue  float64
+		expectedValue float64
+	}{
+		{"0.92", 1, 0.92},
+		{"150", 1, 150},
+		{"invalid", 1, 1},
+		{"", 1, 1},
+	}
+	
+	for _, tc := range testCases {
+		if tc.envValue == "" {
+			os.Unsetenv("TEST_FLOAT_VAR")
+		} else {
+			os.Setenv("TEST_FLOAT_VAR", tc.envValue)
+		}
+		
+		result := getEnvAsFloat("TEST_FLOAT_VAR", tc.defaultValue)
+		if result != tc.expectedValue {
+			t.Errorf("For env value '%s' and default %g, expected %g, got %g", 
+				tc.envValue, tc.defaultValue, tc.expectedValue, result)
+		}
+	}
+	os.Unsetenv("TEST_FLOAT_VAR")
+}
+
+func TestParseTaskRouting(t *testing.T) {
+	t.Run("Empty value uses defaults", func(t *testing.T) {
+		routing, err := parseTaskRouting("")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if routing[models.Summarization] != models.Claude {
+			t.Errorf("Expected summarization to route to claude, got %s", routing[models.Summarization])
+		}
+		
+		if len(routing) != len(DefaultTaskRouting()) {
+			t.Errorf("Expected %d task types, got %d", len(DefaultTaskRouting()), len(routing))
+		}
+	})
+	
+	t.Run("Inline JSON overrides and extends defaults", func(t *testing.T) {
+		routing, err := parseTaskRouting(`{"summarization":"mistral","Translation":"Gemini"}`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if routing[models.Summarization] != models.Mistral {
+			t.Errorf("Expected summarization to route to mistral, got %s", routing[models.Summarization])
+		}
+		
+		if routing["translation"] != models.Gemini {
+			t.Errorf("Expected translation to route to gemini, got %s", routing["translation"])
+		}
+		
+		if routing[models.TextGeneration] != models.OpenAI {
+			t.Errorf("Expected text_generation to keep routing to openai, got %s", routing[models.TextGeneration])
+		}
+	})
+	
+	t.Run("JSON file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "routing.json")
+		if err := os.WriteFile(path, []byte(`{"question_answering":"claude"}`), 0600); err != nil {
+			t.Fatalf("Failed to write routing file: %v", err)
+		}
+		
+		routing, err := parseTaskRouting(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if routing[models.QuestionAnswering] != models.Claude {
+			t.Errorf("Expected question_answering to route to claude, got %s", routing[models.QuestionAnswering])
+		}
+	})
+	
+	t.Run("Invalid values", func(t *testing.T) {
+		invalid := []string{
+			`{"summarization":"unknown"}`,
+			`{"summarization":`,
+			`{"":"openai"}`,
+			filepath.Join(t.TempDir(), "missing.json"),
+		}
+		
+		for _, value := range invalid {
+			if _, err := parseTaskRouting(value); err == nil {
+				t.Errorf("Expected error for %q, got nil", value)
+			}
+		}
+	})
+}
+
+func TestParseModelDefaults(t *testing.T) {
+	t.Run("Empty value", func(t *testing.T) {
+		defaults, err := parseModelDefaults("")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if len(defaults) != 0 {
+			t.Errorf("Expected no defaults, got %d", len(defaults))
+		}
+	})
+	
+	t.Run("Valid defaults", func(t *testing.T) {
+		defaults, err := parseModelDefaults(`{"Claude":{"max_tokens":1024},"openai":{"temperature":0.2,"max_tokens":300,"max_temperature":1}}`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if claude := defaults[models.Claude]; claude.Temperature != nil || claude.MaxTokens == nil || *claude.MaxTokens != 1024 {
+			t.Errorf("Unexpected claude defaults: %+v", claude)
+		}
+		
+		if openai := defaults[models.OpenAI]; openai.Temperature == nil || *openai.Temperature != 0.2 || openai.MaxTokens == nil || *openai.MaxTokens != 300 || openai.MaxTemperature == nil || *openai.MaxTemperature != 1 {
+			t.Errorf("Unexpected openai defaults: %+v", openai)
+		}
+	})
+	
+	t.Run("Invalid defaults", func(t *testing.T) {
+		invalid := []string{
+			`{"unknown":{"max_tokens":100}}`,
+			`{"openai":{"temperature":3}}`,
+			`{"openai":{"max_tokens":0}}`,
+			`{"openai":{"max_temperature":-1}}`,
+			`{"openai":`,
+		}
+		
+		for _, value := range invalid {
+			if _, err := parseModelDefaults(value); err == nil {
+				t.Errorf("Expected error for %q, got nil", value)
+			}
+		}
+	})
+}
+
+func TestParseErrorStatuses(t *testing.T) {
+	statuses, err := parseErrorStatuses(`{"unavailable":{"status":502},"RATE_LIMIT":{"status":503,"message":"Busy, retry soon"}}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if statuses["UNAVAILABLE"].Status != 502 || statuses["UNAVAILABLE"].Message != "" {
+		t.Errorf("Unexpected unavailable status: %+v", statuses["UNAVAILABLE"])
+	}
+	if statuses["RATE_LIMIT"].Status != 503 || statuses["RATE_LIMIT"].Message != "Busy, retry soon" {
+		t.Errorf("Unexpected rate limit status: %+v", statuses["RATE_LIMIT"])
+	}
+	
+	invalid := []string{
+		`{"unavailable":{"status":200}}`,
+		`{"unavailable":{}}`,
+		`{" ":{"status":502}}`,
+		`{"unavailabel":{"status":502}}`,
+		`{"unavailable":`,
+	}
+	for _, value := range invalid {
+		if _, err := parseErrorStatuses(value); err == nil {
+			t.Errorf("Expected error for %q, got nil", value)
+		}
+	}
+}
+
+func TestParseModelAliases(t *testing.T) {
+	t.Run("Empty value", func(t *testing.T) {
+		aliases, err := parseModelAliases("")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if len(aliases) != 0 {
+			t.Errorf("Expected no aliases, got %d", len(aliases))
+		}
+	})
+	
+	t.Run("Valid aliases", func(t *testing.T) {
+		aliases, err := parseModelAliases(`{"Fast":{"model":"Gemini","model_version":"gemini-1.5-flash"},"smart":{"model":"openai","model_version":"gpt-4o"},"cheap":{"model":"mistral"}}`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if aliases["fast"].Model != models.Gemini || aliases["fast"].ModelVersion != "gemini-1.5-flash" {
+			t.Errorf("Unexpected fast alias: %+v", aliases["fast"])
+		}
+		
+		if aliases["smart"].Model != models.OpenAI || aliases["smart"].ModelVersion != "gpt-4o" {
+			t.Errorf("Unexpected smart alias: %+v", aliases["smart"])
+		}
+		
+		if aliases["cheap"].Model != models.Mistral || aliases["cheap"].ModelVersion != "" {
+			t.Errorf("Unexpected cheap alias: %+v", aliases["cheap"])
+		}
+	})
+	
+	t.Run("Invalid aliases", func(t *testing.T) {
+		invalid := []string{
+			`{"fast":{"model":"unknown"}}`,
+			`{"openai":{"model":"claude"}}`,
+			`{"":{"model":"openai"}}`,
+			`{"fast":`,
+		}
+		
+		for _, value := range invalid {
+			if _, err := parseModelAliases(value); err == nil {
+				t.Errorf("Expected error for %q, got nil", value)
+			}
+		}
+	})
+}
+
+func TestGetEnvAsIntSlice(t *testing.T) {
+	originalValue := os.Getenv("TEST_INT_SLICE")
+	defer os.Setenv("TEST_INT_SLICE", originalValue)
+	
+	os.Setenv("TEST_INT_SLICE", "")
+	if values := getEnvAsIntSlice("TEST_INT_SLICE"); values != nil {
+		t.Errorf("Expected nil for empty value, got %v", values)
+	}
+	
+	os.Setenv("TEST_INT_SLICE", " 502, 503,abc,,529 ")
+	values := getEnvAsIntSlice("TEST_INT_SLICE")
+	expected := []int{502, 503, 529}
+	
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, values)
+		}
+	}
+}
+
+func TestParseTenantModels(t *testing.T) {
+	t.Run("Empty value", func(t *testing.T) {
+		tenantModels, err := parseTenantModels("")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if len(tenantModels) != 0 {
+			t.Errorf("Expected no tenants, got %d", len(tenantModels))
+		}
+	})
+	
+	t.Run("Valid tenants", func(t *testing.T) {
+		tenantModels, err := parseTenantModels(`{"free":["Mistral"],"pro":["openai"," claude "]}`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if len(tenantModels["free"]) != 1 || tenantModels["free"][0] != models.Mistral {
+			t.Errorf("Unexpected free models: %v", tenantModels["free"])
+		}
+		
+		if len(tenantModels["pro"]) != 2 || tenantModels["pro"][0] != models.OpenAI || tenantModels["pro"][1] != models.Claude {
+			t.Errorf("Unexpected pro models: %v", tenantModels["pro"])
+		}
+	})
+	
+	t.Run("Invalid tenants", func(t *testing.T) {
+		invalid := []string{
+			`{"free":["unknown"]}`,
+			`{"":["openai"]}`,
+			`{"free":"openai"}`,
+			`{"free":`,
+		}
+		
+		for _, value := range invalid {
+			if _, err := parseTenantModels(value); err == nil {
+				t.Errorf("Expected error for %q, got nil", value)
+			}
+		}
+	})
+}
+
+func TestInvalidModelAllowListsAreFatal(t *testing.T) {
+	logger := logrus.StandardLogger()
+	originalExit := logger.ExitFunc
+	defer func() { logger.ExitFunc = originalExit }()
+	
+	for key, value := range map[string]string{
+		"DEFAULT_ALLOWED_MODELS": "openai,mistrall",
+		"TENANT_MODELS":          `{"free":["mistral"],"pro":["openai","unknown"]}`,
+	} {
+		t.Run(key, func(t *testing.T) {
+			os.Setenv(key, value)
+			defer os.Unsetenv(key)
+			
+			exited := false
+			logger.ExitFunc = func(int) { exited = true }
+			
+			if key == "TENANT_MODELS" {
+				getEnvAsTenantModels(key)
+			} else {
+				getEnvAsModelList(key)
+			}
+			if !exited {
+				t.Errorf("Expected an invalid %s to stop startup", key)
+			}
+		})
+	}
+}
+
+func TestAllowedModels(t *testing.T) {
+	cfg := &Config{
+		TenantModels: map[string][]models.ModelType{
+			"free": {models.Mistral},
+		},
+	}
+	
+	if !cfg.IsModelAllowed("free", models.Mistral) || cfg.IsModelAllowed("free", models.OpenAI) {
+		t.Errorf("Expected free tenant to be limited to mistral, got %v", cfg.AllowedModels("free"))
+	}
+	
+	if allowed := cfg.AllowedModels("unknown"); len(allowed) != 4 {
+		t.Errorf("Expected all models for unknown tenant, got %v", allowed)
+	}
+	
+	cfg.DefaultAllowedModels = []models.ModelType{models.Gemini}
+	if !cfg.IsModelAllowed("", models.Gemini) || cfg.IsModelAllowed("", models.Claude) {
+		t.Errorf("Expected default allow-list for anonymous callers, got %v", cfg.AllowedModels(""))
+	}
+	
+	if !cfg.IsModelAllowed("free", models.Mistral) {
+		t.Errorf("Expected tenant allow-list to take precedence over the default")
+	}
+}
+
+func TestParallelModels(t *testing.T) {
+	cfg := &Config{
+		TenantModels: map[string][]models.ModelType{
+			"free": {models.Mistral, models.Gemini},
+		},
+		TenantParallelModels: map[string][]models.ModelType{
+			"free": {models.Gemini, models.OpenAI},
+		},
+	}
+	
+	if got := cfg.ParallelModels("unknown"); len(got) != 4 {
+		t.Errorf("Expected the allow-list without parallel defaults, got %v", got)
+	}
+	
+	if got := cfg.ParallelModels("free"); len(got) != 1 || got[0] != models.Gemini {
+		t.Errorf("Expected disallowed models filtered from the tenant default, got %v", got)
+	}
+	
+	cfg.DefaultParallelModels = []models.ModelType{models.Claude, models.Mistral}
+	if got := cfg.ParallelModels(""); len(got) != 2 || got[0] != models.Claude || got[1] != models.Mistral {
+		t.Errorf("Expected the global parallel default, got %v", got)
+	}
+	
+	cfg.DefaultAllowedModels = []models.ModelType{models.Mistral}
+	if got := cfg.ParallelModels(""); len(got) != 1 || got[0] != models.Mistral {
+		t.Errorf("Expected the global default filtered by the allow-list, got %v", got)
+	}
+}
+
+func TestGetEnvAsDisabledModels(t *testing.T) {
+	os.Setenv("TEST_DISABLED_MODELS", " Gemini,bedrock,,claude")
+	defer os.Unsetenv("TEST_DISABLED_MODELS")
+	
+	disabled := getEnvAsDisabledModels("TEST_DISABLED_MODELS")
+	if len(disabled) != 2 || disabled[0] != models.Gemini || disabled[1] != models.Claude {
+		t.Fatalf("Expected [gemini claude], got %v", disabled)
+	}
+	
+	cfg := &Config{DisabledModels: disabled}
+	if !cfg.IsModelDisabled(models.Gemini) || cfg.IsModelDisabled(models.OpenAI) {
+		t.Errorf("Unexpected IsModelDisabled results for %v", disabled)
+	}
+}
+
+func TestGetEnvAsAvailabilityCheckMethods(t *testing.T) {
+	os.Setenv("AVAILABILITY_PROBE", "light")
+	os.Setenv("GEMINI_AVAILABILITY_CHECK_METHOD", "models")
+	defer os.Unsetenv("AVAILABILITY_PROBE")
+	defer os.Unsetenv("GEMINI_AVAILABILITY_CHECK_METHOD")
+	
+	methods := getEnvAsAvailabilityCheckMethods()
+	if methods[models.OpenAI] != AvailabilityCheckHead {
+		t.Errorf("Expected AVAILABILITY_PROBE=light to default to %s, got %s", AvailabilityCheckHead, methods[models.OpenAI])
+	}
+	if methods[models.Gemini] != AvailabilityCheckGet {
+		t.Errorf("Expected models to select %s, got %s", AvailabilityCheckGet, methods[models.Gemini])
+	}
+}
+
+func TestGetEnvPerProvider(t *testing.T) {
+	for key, value := range map[string]string{
+		"OPENAI_RPM":              "60",
+		"GEMINI_RPM":              "60abc",
+		"MISTRAL_RPM":             "0",
+		"CLAUDE_RETRY_MAX":        "0",
+		"OPENAI_RETRY_MAX":        "-1",
+		"CLAUDE_DAILY_BUDGET_USD": "12.5",
+		"OPENAI_DAILY_BUDGET_USD": "5 dollars",
+	} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+	
+	rpm := getEnvAsModelRPM()
+	if len(rpm) != 1 || rpm[models.OpenAI] != 60 {
+		t.Errorf("Expected only OPENAI_RPM=60, got %v", rpm)
+	}
+	
+	retries := getEnvAsModelMaxRetries()
+	if len(retries) != 1 || retries[models.Claude] != 0 {
+		t.Errorf("Expected only CLAUDE_RETRY_MAX=0, got %v", retries)
+	}
+	
+	budgets := getEnvAsModelBudgets("DAILY_BUDGET_USD")
+	if len(budgets) != 1 || budgets[models.Claude] != 12.5 {
+		t.Errorf("Expected only CLAUDE_DAILY_BUDGET_USD=12.5, got %v", budgets)
+	}
+}
+
+func TestGetEnvAsDownloadFormats(t *testing.T) {
+	os.Setenv("TEST_DOWNLOAD_FORMATS", " TXT,html,,pdf")
+	defer os.Unsetenv("TEST_DOWNLOAD_FORMATS")
+	
+	formats := getEnvAsDownloadFormats("TEST_DOWNLOAD_FORMATS")
+	if len(formats) != 2 || formats[0] != "txt" || formats[1] != "pdf" {
+		t.Fatalf("Expected [txt pdf], got %v", formats)
+	}
+	
+	cfg := &Config{DownloadFormats: formats}
+	if !cfg.IsDownloadFormatEnabled("pdf") || cfg.IsDownloadFormatEnabled("docx") {
+		t.Errorf("Unexpected IsDownloadFormatEnabled results for %v", formats)
+	}
+	
+	if defaults := getEnvAsDownloadFormats("UNSET_DOWNLOAD_FORMATS"); len(defaults) != len(DownloadFormats) {
+		t.Errorf("Expected every format enabled by default, got %v", defaults)
+	}
+}
+
+func TestParseLanguageRouting(t *testing.T) {
+	routing, err := parseLanguageRouting(`{" ES ":"Mistral","zh":"gemini"}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(routing) != 2 || routing["es"] != models.Mistral || routing["zh"] != models.Gemini {
+		t.Errorf("Unexpected language routing: %v", routing)
+	}
+	
+	if _, err := parseLanguageRouting(`{"es":"llama"}`); err == nil {
+		t.Error("Expected error for unknown model, got nil")
+	}
+	
+	if routing, err := parseLanguageRouting(""); err != nil || len(routing) != 0 {
+		t.Errorf("Expected empty routing for an unset value, got %v, %v", routing, err)
+	}
+}
+
+func TestParseTenantPriorities(t *testing.T) {
+	priorities, err := parseTenantPriorities(`{" paid ":"HIGH","free":"low"}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	cfg := &Config{TenantPriorities: priorities, DefaultPriority: PriorityNormal}
+	if cfg.TenantPriority("paid") != PriorityHigh || cfg.TenantPriority("free") != PriorityLow || cfg.TenantPriority("other") != PriorityNormal {
+		t.Errorf("Unexpected tenant priorities: %v", priorities)
+	}
+	
+	if _, err := parseTenantPriorities(`{"paid":"urgent"}`); err == nil {
+		t.Error("Expected error for unknown priority, got nil")
+	}
+}
+
+func TestParseTenantAPIKeys(t *testing.T) {
+	apiKeys, err := parseTenantAPIKeys(`{" acme ":["key-1"," key-2 "],"free":["key-3"]}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	cfg := &Config{TenantAPIKeys: apiKeys}
+	if tenant, ok := cfg.TenantForAPIKey("key-2"); !ok || tenant != "acme" {
+		t.Errorf("Expected key-2 to authenticate acme, got %q, %v", tenant, ok)
+	}
+	if _, ok := cfg.TenantForAPIKey("key-4"); ok {
+		t.Error("Expected unknown key to be rejected")
+	}
+	
+	if _, err := parseTenantAPIKeys(`{"acme":["key-1"],"free":["key-1"]}`); err == nil {
+		t.Error("Expected error for a key shared by two tenants, got nil")
+	}
+	if _, err := parseTenantAPIKeys(`{"acme":[""]}`); err == nil {
+		t.Error("Expected error for an empty key, got nil")
+	}
+}
+
+func TestParseFallbackOn(t *testing.T) {
+	categories, err := parseFallbackOn(" Unavailable, timeout,,")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(categories) != 2 || categories[0] != "unavailable" || categories[1] != "timeout" {
+		t.Errorf("Expected [unavailable timeout], got %v", categories)
+	}
+	
+	if _, err := parseFallbackOn("unavailable,5xx"); err == nil {
+		t.Error("Expected error for unknown category, got nil")
+	}
+}
+
+func TestParseModelDowngrades(t *testing.T) {
+	downgrades, err := parseModelDowngrades(`{"OpenAI":{"target":" Mistral ","timeouts":5},"claude":{"target":"gemini","window_seconds":30,"cooldown_seconds":120}}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	expected := map[models.ModelType]DowngradePolicy{
+		models.OpenAI: {Target: models.Mistral, Timeouts: 5, WindowSeconds: defaultDowngradeWindow, CooldownSeconds: defaultDowngradeCooldown},
+		models.Claude: {Target: models.Gemini, Timeouts: defaultDowngradeTimeouts, WindowSeconds: 30, CooldownSeconds: 120},
+	}
+	if !reflect.DeepEqual(downgrades, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, downgrades)
+	}
+	
+	invalid := []string{
+		`{"bedrock":{"target":"openai"}}`,
+		`{"openai":{"target":"bedrock"}}`,
+		`{"openai":{"target":"openai"}}`,
+		`{"openai":{"target":"mistral","timeouts":-1}}`,
+		`{"openai":`,
+	}
+	for _, value := range invalid {
+		if _, err := parseModelDowngrades(value); err == nil {
+			t.Errorf("Expected error for %q, got nil", value)
+		}
+	}
+}
+
+func TestParseExtraHeaders(t *testing.T) {
+	headers, err := parseExtraHeaders(" openai-organization: org-123 ,OpenAI-Project:proj:456,")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	expected := map[string]string{"Openai-Organization": "org-123", "Openai-Project": "proj:456"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("Expected %v, got %v", expected, headers)
+	}
+	
+	invalid := []string{
+		"OpenAI-Organization",
+		":org-123",
+		"Bad Header:value",
+		"authorization:Bearer sk-other",
+		"X-API-Key:other",
+		"Host:example.com",
+	}
+	for _, value := range invalid {
+		if _, err := parseExtraHeaders(value); err == nil {
+			t.Errorf("Expected error for %q, got nil", value)
+		}
+	}
+}
+
+func TestParseModelCapabilities(t *testing.T) {
+	capabilities, err := parseModelCapabilities(`{" gpt-4o ":{"supports_vision":false,"context_window":4096}}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	override, ok := capabilities["gpt-4o"]
+	if !ok || override.SupportsVision == nil || *override.SupportsVision || override.ContextWindow == nil || *override.ContextWindow != 4096 || override.SupportsTools != nil {
+		t.Errorf("Unexpected capabilities: %+v", capabilities)
+	}
+	
+	for _, value := range []string{`{"":{"supports_tools":true}}`, `{"gpt-4o":{"context_window":0}}`, `{"gpt-4o":{"supports_tools":"yes"}}`} {
+		if _, err := parseModelCapabilities(value); err == nil {
+			t.Errorf("Expected error for %q, got nil", value)
+		}
+	}
+}
+
+func TestShouldFallback(t *testing.T) {
+	cfg := &Config{}
+	for _, category := range []string{"timeout", "rate_limit", "unavailable", "budget_exceeded"} {
+		if !cfg.ShouldFallback(category) {
+			t.Errorf("Expected fallback on %s when FALLBACK_ON is unset", category)
+		}
+	}
+	
+	cfg.FallbackOn = []string{"unavailable", "timeout"}
+	if !cfg.ShouldFallback("unavailable") || !cfg.ShouldFallback("timeout") {
+		t.Error("Expected fallback on configured categories")
+	}
+	if cfg.ShouldFallback("rate_limit") {
+		t.Error("Expected no fallback on rate_limit")
+	}
+}
+
+func TestParseTenantPromptWrappers(t *testing.T) {
+	wrappers, err := parseTenantPromptWrappers(`{" acme ":{"prefix":"Answer in JSON."},"beta":{"suffix":"Cite sources."}}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if wrappers["acme"].Prefix != "Answer in JSON." || wrappers["beta"].Suffix != "Cite sources." {
+		t.Errorf("Unexpected wrappers: %+v", wrappers)
+	}
+	
+	for _, value := range []string{`{"":{"prefix":"x"}}`, `{"acme":`} {
+		if _, err := parseTenantPromptWrappers(value); err == nil {
+			t.Errorf("Expected error for %q, got nil", value)
+		}
+	}
+}
+
+func TestPromptWrapper(t *testing.T) {
+	cfg := &Config{
+		TenantPromptWrappers: map[string]PromptWrapper{"acme": {Prefix: "tenant"}},
+		DefaultPromptWrapper: PromptWrapper{Prefix: "default"},
+	}
+	
+	if wrapper := cfg.PromptWrapper("acme"); wrapper.Prefix != "tenant" {
+		t.Errorf("Expected tenant wrapper, got %+v", wrapper)
+	}
+	
+	for _, tenant := range []string{"other", ""} {
+		if wrapper := cfg.PromptWrapper(tenant); wrapper.Prefix != "default" {
+			t.Errorf("Expected default wrapper for tenant %q, got %+v", tenant, wrapper)
+		}
+	}
+}
+
+func TestValidateEncryptionKey(t *testing.T) {
+	for _, length := range []int{16, 24, 32} {
+		if err := validateEncryptionKey(make([]byte, length)); err != nil {
+			t.Errorf("Expected %d-byte key to be valid, got %v", length, err)
+		}
+	}
+	
+	for _, length := range []int{0, 8, 20, 33} {
+		err := validateEncryptionKey(make([]byte, length))
+		if !errors.Is(err, ErrInvalidEncryptionKey) {
+			t.Errorf("Expected ErrInvalidEncryptionKey for %d-byte key, got %v", length, err)
+		}
+	}
+}
+
+func TestDeriveEncryptionKey(t *testing.T) {
+	passphrases := map[string]string{
+		"short passphrase": "secret",
+		"long passphrase":  "correct horse battery staple, but considerably longer than thirty-two bytes",
+		"raw 32-byte key":  "0123456789abcdef0123456789abcdef",
+	}
+	
+	for name, passphrase := range passphrases {
+		t.Run(name, func(t *testing.T) {
+			key, err := deriveEncryptionKey(passphrase, defaultEncryptionSalt)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			
+			encrypted, err := encrypt("sk-test-api-key", key)
+			if err != nil {
+				t.Fatalf("Expected no error encrypting, got %v", err)
+			}
+			
+			decrypted, err := decrypt(encrypted, key)
+			if err != nil {
+				t.Fatalf("Expected no error decrypting, got %v", err)
+			}
+			if decrypted != "sk-test-api-key" {
+				t.Errorf("Expected round-trip to return the original value, got %q", decrypted)
+			}
+		})
+	}
+	
+	t.Run("raw keys are used as-is", func(t *testing.T) {
+		key, _ := deriveEncryptionKey("0123456789abcdef", defaultEncryptionSalt)
+		if string(key) != "0123456789abcdef" {
+			t.Errorf("Expected 16-byte key to be used as-is, got %x", key)
+		}
+	})
+	
+	t.Run("passphrases derive a 32-byte key", func(t *testing.T) {
+		key, _ := deriveEncryptionKey("secret", defaultEncryptionSalt)
+		if len(key) != derivedKeyLength {
+			t.Errorf("Expected %d-byte key, got %d bytes", derivedKeyLength, len(key))
+		}
+		
+		other, _ := deriveEncryptionKey("secret", "other-salt")
+		if string(key) == string(other) {
+			t.Errorf("Expected different salts to derive different keys")
+		}
+	})
+	
+	t.Run("empty passphrase", func(t *testing.T) {
+		if _, err := deriveEncryptionKey("", defaultEncryptionSalt); !errors.Is(err, ErrEncryptionKeyMissing) {
+			t.Errorf("Expected ErrEncryptionKeyMissing, got %v", err)
+		}
+	})
+}
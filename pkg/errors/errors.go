@@ -12,8 +12,65 @@ var (
     ErrEmptyResponse  = errors.New("empty response from LLM")
     ErrAPIKeyMissing  = errors.New("API key not configured")
     ErrUnavailable    = errors.New("service unavailable")
+    ErrUnsupportedModelVersion = errors.New("unsupported model version")
+    ErrToolsUnsupported = errors.New("tool calling not supported by this model")
+    ErrImagesUnsupported = errors.New("image input not supported by this model")
+    ErrModelNotAllowed = errors.New("model not allowed for tenant")
+    ErrExtractionFailed = errors.New("response extraction failed")
+    ErrContextWindowExceeded = errors.New("query exceeds the model's context window")
+    ErrBudgetExceeded = errors.New("spending budget exhausted")
+    // ErrQuotaExceeded is a rate limit imposed by the proxy itself rather than the provider.
+    ErrQuotaExceeded = fmt.Errorf("%w: model quota exhausted", ErrRateLimit)
 )
 
+const (
+    CodeInvalidRequest   = "INVALID_REQUEST"
+    CodeUnsupportedModelVersion = "UNSUPPORTED_MODEL_VERSION"
+    CodeToolsUnsupported = "TOOLS_UNSUPPORTED"
+    CodeImagesUnsupported = "IMAGES_UNSUPPORTED"
+    CodeModelNotAllowed  = "MODEL_NOT_ALLOWED"
+    CodeExtractionFailed = "EXTRACTION_FAILED"
+    CodeContextWindowExceeded = "CONTEXT_WINDOW_EXCEEDED"
+    CodeBudgetExceeded   = "BUDGET_EXCEEDED"
+    CodeInvalidJSON      = "INVALID_JSON"
+    CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+    CodeRequestTooLarge  = "REQUEST_TOO_LARGE"
+    CodeIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+    CodeIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+    CodeUnauthorized     = "UNAUTHORIZED"
+    CodeForbidden        = "FORBIDDEN"
+    CodeNotFound         = "NOT_FOUND"
+    CodeNotImplemented   = "NOT_IMPLEMENTED"
+    CodeRateLimit        = "RATE_LIMIT"
+    CodeTimeout          = "TIMEOUT"
+    CodeCanceled         = "CANCELED"
+    CodeUnavailable      = "UNAVAILABLE"
+    CodeAPIKeyMissing    = "API_KEY_MISSING"
+    CodeEmptyResponse    = "EMPTY_RESPONSE"
+    CodeInvalidResponse  = "INVALID_RESPONSE"
+    CodeProviderError    = "PROVIDER_ERROR"
+    CodeAllModelsFailed  = "ALL_MODELS_FAILED"
+    CodeInternal         = "INTERNAL_ERROR"
+)
+
+var Codes = []string{
+    CodeInvalidRequest, CodeUnsupportedModelVersion, CodeToolsUnsupported, CodeImagesUnsupported,
+    CodeModelNotAllowed, CodeExtractionFailed, CodeContextWindowExceeded, CodeBudgetExceeded,
+    CodeInvalidJSON, CodeMethodNotAllowed, CodeRequestTooLarge, CodeIdempotencyKeyInProgress,
+    CodeIdempotencyKeyReused, CodeUnauthorized, CodeForbidden, CodeNotFound, CodeNotImplemented, CodeRateLimit,
+    CodeTimeout, CodeCanceled, CodeUnavailable, CodeAPIKeyMissing, CodeEmptyResponse,
+    CodeInvalidResponse, CodeProviderError, CodeAllModelsFailed, CodeInternal,
+}
+
+const (
+    CategoryTimeout        = "timeout"
+    CategoryRateLimit      = "rate_limit"
+    CategoryUnavailable    = "unavailable"
+    CategoryBudgetExceeded = "budget_exceeded"
+)
+
+var FallbackCategories = []string{CategoryTimeout, CategoryRateLimit, CategoryUnavailable, CategoryBudgetExceeded}
+
 type ModelError struct {
     Model     string
     Code      int
@@ -63,3 +120,80 @@ func NewEmptyResponseError(model string) *ModelError {
 func NewUnavailableError(model string) *ModelError {
     return NewModelError(model, 503, ErrUnavailable, true)
 }
+
+func NewUnsupportedModelVersionError(model string, version string) *ModelError {
+    return NewModelError(model, 400, fmt.Errorf("%w: %s", ErrUnsupportedModelVersion, version), false)
+}
+
+func NewContextWindowExceededError(model string, version string, tokens int, window int) *ModelError {
+    return NewModelError(model, 400, fmt.Errorf("%w: estimated %d input tokens, %s accepts %d", ErrContextWindowExceeded, tokens, version, window), false)
+}
+
+func NewModelNotAllowedError(model string) *ModelError {
+    return NewModelError(model, 403, ErrModelNotAllowed, false)
+}
+
+func NewBudgetExceededError(model string) *ModelError {
+    return NewModelError(model, 429, ErrBudgetExceeded, true)
+}
+
+func NewQuotaExceededError(model string) *ModelError {
+    return NewModelError(model, 429, ErrQuotaExceeded, true)
+}
+
+func ErrorCode(err error) string {
+    switch {
+    case err == nil:
+        return ""
+    case errors.Is(err, ErrTimeout):
+        return CodeTimeout
+    case errors.Is(err, ErrRateLimit):
+        return CodeRateLimit
+    case errors.Is(err, ErrAPIKeyMissing):
+        return CodeAPIKeyMissing
+    case errors.Is(err, ErrUnavailable):
+        return CodeUnavailable
+    case errors.Is(err, ErrEmptyResponse):
+        return CodeEmptyResponse
+    case errors.Is(err, ErrInvalidResponse):
+        return CodeInvalidResponse
+    case errors.Is(err, ErrUnsupportedModelVersion):
+        return CodeUnsupportedModelVersion
+    case errors.Is(err, ErrToolsUnsupported):
+        return CodeToolsUnsupported
+    case errors.Is(err, ErrImagesUnsupported):
+        return CodeImagesUnsupported
+    case errors.Is(err, ErrModelNotAllowed):
+        return CodeModelNotAllowed
+    case errors.Is(err, ErrExtractionFailed):
+        return CodeExtractionFailed
+    case errors.Is(err, ErrContextWindowExceeded):
+        return CodeContextWindowExceeded
+    case errors.Is(err, ErrBudgetExceeded):
+        return CodeBudgetExceeded
+    }
+
+    var modelErr *ModelError
+    if errors.As(err, &modelErr) {
+        return CodeProviderError
+    }
+
+    return CodeInternal
+}
+
+func FallbackCategory(err error) string {
+    switch {
+    case errors.Is(err, ErrTimeout):
+        return CategoryTimeout
+    case errors.Is(err, ErrRateLimit):
+        return CategoryRateLimit
+    case errors.Is(err, ErrBudgetExceeded):
+        return CategoryBudgetExceeded
+    }
+
+    var modelErr *ModelError
+    if errors.As(err, &modelErr) && modelErr.Retryable {
+        return CategoryUnavailable
+    }
+    return ""
+}
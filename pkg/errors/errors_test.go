@@ -555,3 +555,62 @@ func TestConcurrentErrorHandling(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Nil error", nil, ""},
+		{"Timeout error", NewTimeoutError("openai"), CodeTimeout},
+		{"Rate limit error", NewRateLimitError("openai"), CodeRateLimit},
+		{"Unavailable error", NewUnavailableError("claude"), CodeUnavailable},
+		{"API key missing", NewModelError("gemini", 401, ErrAPIKeyMissing, false), CodeAPIKeyMissing},
+		{"Empty response", NewEmptyResponseError("mistral"), CodeEmptyResponse},
+		{"Invalid response", NewInvalidResponseError("mistral", errors.New("bad json")), CodeInvalidResponse},
+		{"Unsupported model version", NewUnsupportedModelVersionError("openai", "gpt-4oo"), CodeUnsupportedModelVersion},
+		{"Tools unsupported", NewModelError("mistral", 400, ErrToolsUnsupported, false), CodeToolsUnsupported},
+		{"Images unsupported", NewModelError("mistral", 400, ErrImagesUnsupported, false), CodeImagesUnsupported},
+		{"Model not allowed", NewModelNotAllowedError("openai"), CodeModelNotAllowed},
+		{"Context window exceeded", NewContextWindowExceededError("openai", "gpt-4", 9000, 8192), CodeContextWindowExceeded},
+		{"Budget exceeded", NewBudgetExceededError("openai"), CodeBudgetExceeded},
+		{"Extraction failed", fmt.Errorf("%w: no fenced code block", ErrExtractionFailed), CodeExtractionFailed},
+		{"Other model error", NewModelError("openai", 400, errors.New("context length exceeded"), false), CodeProviderError},
+		{"Wrapped model error", fmt.Errorf("wrapped: %w", NewRateLimitError("openai")), CodeRateLimit},
+		{"Plain error", errors.New("something broke"), CodeInternal},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := ErrorCode(tc.err); code != tc.expected {
+				t.Errorf("Expected code %q, got %q", tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestFallbackCategory(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Timeout error", NewTimeoutError("openai"), CategoryTimeout},
+		{"Rate limit error", NewRateLimitError("openai"), CategoryRateLimit},
+		{"Budget exceeded", NewBudgetExceededError("openai"), CategoryBudgetExceeded},
+		{"Unavailable error", NewUnavailableError("claude"), CategoryUnavailable},
+		{"Provider 5xx", NewModelError("gemini", 502, errors.New("bad gateway"), true), CategoryUnavailable},
+		{"Wrapped rate limit", fmt.Errorf("wrapped: %w", NewRateLimitError("openai")), CategoryRateLimit},
+		{"Non-retryable model error", NewModelError("openai", 400, errors.New("bad request"), false), ""},
+		{"Plain error", errors.New("something broke"), ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if category := FallbackCategory(tc.err); category != tc.expected {
+				t.Errorf("Expected category %q, got %q", tc.expected, category)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+var headingHalfPoints = []int{32, 28, 26, 24, 22, 22} // Font sizes of Heading1-Heading6
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/><Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/></Types>`
+
+const docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`
+
+const docxDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+// MarkdownDOCX converts markdown to a Word document with heading, list and code formatting.
+func MarkdownDOCX(markdown string) ([]byte, error) {
+	var body bytes.Buffer
+	for _, b := range parseMarkdown(markdown) {
+		switch b.Kind {
+		case headingBlock:
+			level := min(max(b.Level, 1), len(headingHalfPoints))
+			fmt.Fprintf(&body, `<w:p><w:pPr><w:pStyle w:val="Heading%d"/></w:pPr>`, level)
+			writeDOCXRuns(&body, b.Spans)
+			body.WriteString(`</w:p>`)
+		case listItemBlock:
+			indent := 360 * b.Level
+			if b.Marker == "" {
+				fmt.Fprintf(&body, `<w:p><w:pPr><w:ind w:left="%d"/></w:pPr>`, indent)
+			} else {
+				fmt.Fprintf(&body, `<w:p><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr><w:r><w:t>%s</w:t><w:tab/></w:r>`, indent, escapeXML(b.Marker))
+			}
+			writeDOCXRuns(&body, b.Spans)
+			body.WriteString(`</w:p>`)
+		case codeBlock:
+			body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Code"/></w:pPr><w:r>`)
+			for i, line := range strings.Split(strings.ReplaceAll(b.Code, "\t", "    "), "\n") {
+				if i > 0 {
+					body.WriteString(`<w:br/>`)
+				}
+				fmt.Fprintf(&body, `<w:t xml:space="preserve">%s</w:t>`, escapeXML(line))
+			}
+			body.WriteString(`</w:r></w:p>`)
+		default:
+			body.WriteString(`<w:p>`)
+			writeDOCXRuns(&body, b.Spans)
+			body.WriteString(`</w:p>`)
+		}
+	}
+	
+	document := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<w:document xmlns:w="` + wordNamespace + `"><w:body>` + body.String() +
+		`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1134" w:right="1134" w:bottom="1134" w:left="1134" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr></w:body></w:document>`
+	
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRels},
+		{"word/_rels/document.xml.rels", docxDocumentRels},
+		{"word/styles.xml", docxStyles()},
+		{"word/document.xml", document},
+	} {
+		writer, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	
+	return out.Bytes(), nil
+}
+
+func writeDOCXRuns(body *bytes.Buffer, spans []span) {
+	for _, s := range spans {
+		body.WriteString(`<w:r>`)
+		if s.Code || s.Bold || s.Italic {
+			body.WriteString(`<w:rPr>`)
+			if s.Code {
+				body.WriteString(`<w:rFonts w:ascii="Courier New" w:hAnsi="Courier New"/>`)
+			}
+			if s.Bold {
+				body.WriteString(`<w:b/>`)
+			}
+			if s.Italic {
+				body.WriteString(`<w:i/>`)
+			}
+			body.WriteString(`</w:rPr>`)
+		}
+		for i, line := range strings.Split(s.Text, "\n") {
+			if i > 0 {
+				body.WriteString(`<w:br/>`)
+			}
+			fmt.Fprintf(body, `<w:t xml:space="preserve">%s</w:t>`, escapeXML(line))
+		}
+		body.WriteString(`</w:r>`)
+	}
+}
+
+func docxStyles() string {
+	var styles strings.Builder
+	styles.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	styles.WriteString(`<w:styles xmlns:w="` + wordNamespace + `">`)
+	styles.WriteString(`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:pPr><w:spacing w:after="120"/></w:pPr><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri"/><w:sz w:val="22"/></w:rPr></w:style>`)
+	for i, size := range headingHalfPoints {
+		fmt.Fprintf(&styles, `<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%d"/></w:rPr></w:style>`, i+1, i+1, i, size)
+	}
+	styles.WriteString(`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/></w:pPr><w:rPr><w:rFonts w:ascii="Courier New" w:hAnsi="Courier New"/><w:sz w:val="19"/></w:rPr></w:style>`)
+	styles.WriteString(`</w:styles>`)
+	return styles.String()
+}
+
+func escapeXML(s string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownDOCX(t *testing.T) {
+	data, err := MarkdownDOCX("# Report\n\nThe **result** is <42>.\n\n1. first\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Expected a zip archive: %v", err)
+	}
+	
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file.Name, err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		parts[file.Name] = string(content)
+	}
+	
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("Expected part %s", name)
+		}
+	}
+	
+	document := parts["word/document.xml"]
+	for _, want := range []string{`<w:pStyle w:val="Heading1"/>`, `<w:b/>`, `&lt;42&gt;`, `<w:t>1.</w:t><w:tab/>`} {
+		if !strings.Contains(document, want) {
+			t.Errorf("Expected document to contain %q", want)
+		}
+	}
+}
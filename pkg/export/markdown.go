@@ -0,0 +1,122 @@
+package export
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	RenderPlain    = "plain"    // Write the response as-is
+	RenderMarkdown = "markdown" // Parse the response as markdown and lay it out
+)
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	listItemBlock
+	codeBlock
+)
+
+type span struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Code   bool
+}
+
+type block struct {
+	Kind   blockKind
+	Level  int    // Heading level, or list nesting depth starting at 1
+	Marker string // List item bullet or number, empty on an item's later paragraphs
+	Spans  []span
+	Code   string
+}
+
+func parseMarkdown(markdown string) []block {
+	source := []byte(markdown)
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+	return appendBlocks(nil, doc, source, 0)
+}
+
+func appendBlocks(blocks []block, node ast.Node, source []byte, depth int) []block {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch n := child.(type) {
+		case *ast.Heading:
+			blocks = append(blocks, block{Kind: headingBlock, Level: n.Level, Spans: inlineSpans(nil, n, source, span{})})
+		case *ast.Paragraph, *ast.TextBlock:
+			blocks = append(blocks, block{Kind: paragraphBlock, Spans: inlineSpans(nil, n, source, span{})})
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			blocks = append(blocks, block{Kind: codeBlock, Code: strings.TrimRight(string(n.Lines().Value(source)), "\n")})
+		case *ast.List:
+			number := n.Start
+			for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+				marker := "•"
+				if n.IsOrdered() {
+					marker = strconv.Itoa(number) + "."
+					number++
+				}
+				
+				itemBlocks := appendBlocks(nil, item, source, depth+1)
+				for i := range itemBlocks {
+					if itemBlocks[i].Kind != paragraphBlock {
+						continue
+					}
+					itemBlocks[i].Kind = listItemBlock
+					itemBlocks[i].Level = depth + 1
+					itemBlocks[i].Marker = marker
+					marker = ""
+				}
+				blocks = append(blocks, itemBlocks...)
+			}
+		default:
+			blocks = appendBlocks(blocks, child, source, depth)
+		}
+	}
+	return blocks
+}
+
+func inlineSpans(spans []span, node ast.Node, source []byte, style span) []span {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch n := child.(type) {
+		case *ast.Text:
+			s := style
+			s.Text = string(n.Value(source))
+			if n.HardLineBreak() {
+				s.Text += "\n"
+			} else if n.SoftLineBreak() {
+				s.Text += " "
+			}
+			spans = append(spans, s)
+		case *ast.String:
+			s := style
+			s.Text = string(n.Value)
+			spans = append(spans, s)
+		case *ast.AutoLink:
+			s := style
+			s.Text = string(n.Label(source))
+			spans = append(spans, s)
+		case *ast.CodeSpan:
+			inner := style
+			inner.Code = true
+			spans = inlineSpans(spans, n, source, inner)
+		case *ast.Emphasis:
+			inner := style
+			if n.Level >= 2 {
+				inner.Bold = true
+			} else {
+				inner.Italic = true
+			}
+			spans = inlineSpans(spans, n, source, inner)
+		case *ast.RawHTML:
+		default:
+			spans = inlineSpans(spans, child, source, style)
+		}
+	}
+	return spans
+}
@@ -0,0 +1,38 @@
+package export
+
+import (
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	blocks := parseMarkdown("# Title\n\nSome **bold** and *italic* `code`.\n\n- one\n- two\n  1. nested\n\n```go\nfmt.Println(1)\n```\n")
+	
+	if len(blocks) != 6 {
+		t.Fatalf("Expected 6 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	
+	if blocks[0].Kind != headingBlock || blocks[0].Level != 1 || blocks[0].Spans[0].Text != "Title" {
+		t.Errorf("Expected level 1 heading 'Title', got %+v", blocks[0])
+	}
+	
+	var bold, italic, code bool
+	for _, s := range blocks[1].Spans {
+		bold = bold || (s.Bold && s.Text == "bold")
+		italic = italic || (s.Italic && s.Text == "italic")
+		code = code || (s.Code && s.Text == "code")
+	}
+	if !bold || !italic || !code {
+		t.Errorf("Expected bold, italic and code spans, got %+v", blocks[1].Spans)
+	}
+	
+	if blocks[2].Kind != listItemBlock || blocks[2].Marker != "•" || blocks[2].Level != 1 {
+		t.Errorf("Expected top-level bullet item, got %+v", blocks[2])
+	}
+	if blocks[4].Kind != listItemBlock || blocks[4].Marker != "1." || blocks[4].Level != 2 {
+		t.Errorf("Expected nested numbered item, got %+v", blocks[4])
+	}
+	
+	if blocks[5].Kind != codeBlock || blocks[5].Code != "fmt.Println(1)" {
+		t.Errorf("Expected code block, got %+v", blocks[5])
+	}
+}
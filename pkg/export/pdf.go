@@ -0,0 +1,325 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+)
+
+const (
+	pageWidth  = 595.0 // A4 in points
+	pageHeight = 842.0
+	pageMargin = 56.0
+	bodySize   = 11.0
+	codeSize   = 9.5
+	listIndent = 18.0
+)
+
+var headingSizes = map[int]float64{1: 20, 2: 16, 3: 13.5}
+
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+	fontItalic
+	fontBoldItalic
+	fontCode
+)
+
+var pdfFontNames = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier"}
+
+// Glyph widths in 1/1000 em for characters 32-126 of the standard Helvetica faces
+var helveticaWidths = []int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = []int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// WinAnsiEncoding codes for common characters outside Latin-1
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+type pdfRun struct {
+	font pdfFont
+	x    float64
+	text []byte
+}
+
+type pdfLayout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// MarkdownPDF lays out markdown as an A4 PDF using the standard Helvetica and Courier fonts.
+func MarkdownPDF(markdown string) ([]byte, error) {
+	layout := &pdfLayout{}
+	layout.newPage()
+	
+	for i, b := range parseMarkdown(markdown) {
+		switch b.Kind {
+		case headingBlock:
+			size, ok := headingSizes[b.Level]
+			if !ok {
+				size = bodySize + 1
+			}
+			if i > 0 {
+				layout.space(size * 0.8)
+			}
+			layout.paragraph(b.Spans, 0, size, true, "")
+			layout.space(2)
+		case listItemBlock:
+			layout.space(2)
+			layout.paragraph(b.Spans, listIndent*float64(b.Level), bodySize, false, b.Marker)
+		case codeBlock:
+			layout.space(6)
+			layout.code(b.Code)
+			layout.space(6)
+		default:
+			layout.space(6)
+			layout.paragraph(b.Spans, 0, bodySize, false, "")
+		}
+	}
+	
+	return layout.document()
+}
+
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = pageHeight - pageMargin
+}
+
+func (l *pdfLayout) space(points float64) {
+	l.y -= points
+}
+
+func (l *pdfLayout) line(runs []pdfRun, size, leading float64) {
+	if l.y-leading < pageMargin {
+		l.newPage()
+	}
+	l.y -= leading
+	
+	page := l.pages[len(l.pages)-1]
+	for _, run := range runs {
+		fmt.Fprintf(page, "BT /F%d %.1f Tf %.2f %.2f Td (%s) Tj ET\n", run.font+1, size, run.x, l.y, escapePDFString(run.text))
+	}
+}
+
+func (l *pdfLayout) paragraph(spans []span, indent, size float64, bold bool, marker string) {
+	left := pageMargin + indent
+	width := pageWidth - pageMargin - left
+	leading := size * 1.3
+	
+	var runs []pdfRun
+	x := 0.0
+	pendingSpace := false
+	addText := func(font pdfFont, word []byte) {
+		if n := len(runs); n > 0 && runs[n-1].font == font {
+			runs[n-1].text = append(runs[n-1].text, word...)
+		} else {
+			runs = append(runs, pdfRun{font: font, x: left + x, text: append([]byte{}, word...)})
+		}
+		x += textWidth(word, font, size)
+	}
+	flush := func() {
+		if marker != "" {
+			markerText := winAnsi(marker)
+			runs = append(runs, pdfRun{font: fontRegular, x: left - textWidth(markerText, fontRegular, size) - 4, text: markerText})
+			marker = ""
+		}
+		l.line(runs, size, leading)
+		runs = nil
+		x = 0
+		pendingSpace = false
+	}
+	
+	for _, s := range spans {
+		font := fontFor(s, bold)
+		for i, segment := range strings.Split(s.Text, "\n") {
+			if i > 0 {
+				flush()
+			}
+			for j, word := range strings.Split(segment, " ") {
+				if j > 0 && x > 0 {
+					pendingSpace = true
+				}
+				if word == "" {
+					continue
+				}
+				
+				encoded := winAnsi(word)
+				wordWidth := textWidth(encoded, font, size)
+				spaceWidth := 0.0
+				if pendingSpace {
+					spaceWidth = textWidth([]byte{' '}, font, size)
+				}
+				if x > 0 && x+spaceWidth+wordWidth > width {
+					flush()
+				} else if pendingSpace {
+					addText(font, []byte{' '})
+				}
+				pendingSpace = false
+				
+				for x+textWidth(encoded, font, size) > width && len(encoded) > 1 {
+					cut := fitChars(encoded, font, size, width-x)
+					addText(font, encoded[:cut])
+					flush()
+					encoded = encoded[cut:]
+				}
+				addText(font, encoded)
+			}
+		}
+	}
+	if len(runs) > 0 || marker != "" {
+		flush()
+	}
+}
+
+func (l *pdfLayout) code(code string) {
+	left := pageMargin + 12
+	maxChars := int((pageWidth - pageMargin - left) / (codeSize * 0.6))
+	
+	for _, line := range strings.Split(strings.ReplaceAll(code, "\t", "    "), "\n") {
+		encoded := winAnsi(line)
+		for len(encoded) > maxChars {
+			l.line([]pdfRun{{font: fontCode, x: left, text: encoded[:maxChars]}}, codeSize, codeSize*1.25)
+			encoded = encoded[maxChars:]
+		}
+		l.line([]pdfRun{{font: fontCode, x: left, text: encoded}}, codeSize, codeSize*1.25)
+	}
+}
+
+func (l *pdfLayout) document() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	
+	fontsStart := 3
+	pagesStart := fontsStart + len(pdfFontNames)
+	
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pagesStart+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	
+	var fonts strings.Builder
+	for i, name := range pdfFontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fmt.Fprintf(&fonts, "/F%d %d 0 R ", i+1, fontsStart+i)
+	}
+	
+	for i, page := range l.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s>> >> /Contents %d 0 R >>", pageWidth, pageHeight, fonts.String(), pagesStart+2*i+1))
+		
+		var content bytes.Buffer
+		writer := zlib.NewWriter(&content)
+		if _, err := writer.Write(page.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+	
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	
+	return out.Bytes(), nil
+}
+
+func fontFor(s span, bold bool) pdfFont {
+	switch {
+	case s.Code:
+		return fontCode
+	case (s.Bold || bold) && s.Italic:
+		return fontBoldItalic
+	case s.Bold || bold:
+		return fontBold
+	case s.Italic:
+		return fontItalic
+	}
+	return fontRegular
+}
+
+func textWidth(text []byte, font pdfFont, size float64) float64 {
+	units := 0
+	for _, c := range text {
+		switch {
+		case font == fontCode:
+			units += 600
+		case c >= 32 && c <= 126 && (font == fontBold || font == fontBoldItalic):
+			units += helveticaBoldWidths[c-32]
+		case c >= 32 && c <= 126:
+			units += helveticaWidths[c-32]
+		case c == 0x97:
+			units += 1000
+		case c == 0x95:
+			units += 350
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+func fitChars(text []byte, font pdfFont, size, width float64) int {
+	for n := len(text) - 1; n > 1; n-- {
+		if textWidth(text[:n], font, size) <= width {
+			return n
+		}
+	}
+	return 1
+}
+
+func winAnsi(s string) []byte {
+	encoded := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 32 && r <= 126, r >= 0xA0 && r <= 0xFF:
+			encoded = append(encoded, byte(r))
+		case winAnsiExtras[r] != 0:
+			encoded = append(encoded, winAnsiExtras[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func escapePDFString(text []byte) []byte {
+	escaped := make([]byte, 0, len(text))
+	for _, c := range text {
+		if c == '(' || c == ')' || c == '\\' {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, c)
+	}
+	return escaped
+}
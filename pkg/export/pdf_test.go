@@ -0,0 +1,60 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownPDF(t *testing.T) {
+	t.Run("Single page", func(t *testing.T) {
+		data, err := MarkdownPDF("# Report\n\nThe **result** is (42).")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		
+		if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.HasSuffix(bytes.TrimSpace(data), []byte("%%EOF")) {
+			t.Errorf("Expected a complete PDF document")
+		}
+		if count := bytes.Count(data, []byte("/Type /Page ")); count != 1 {
+			t.Errorf("Expected 1 page, got %d", count)
+		}
+		
+		content := pdfContent(t, data)
+		for _, want := range []string{"(Report) Tj", "( result) Tj", `\(42\)`} {
+			if !strings.Contains(content, want) {
+				t.Errorf("Expected content stream to contain %q", want)
+			}
+		}
+	})
+	
+	t.Run("Multiple pages", func(t *testing.T) {
+		data, err := MarkdownPDF(strings.Repeat("A paragraph that fills up the page.\n\n", 200))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		
+		if count := bytes.Count(data, []byte("/Type /Page ")); count < 2 {
+			t.Errorf("Expected multiple pages, got %d", count)
+		}
+	})
+}
+
+func pdfContent(t *testing.T, data []byte) string {
+	var content strings.Builder
+	for _, match := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		reader, err := zlib.NewReader(bytes.NewReader(match[1]))
+		if err != nil {
+			t.Fatalf("Failed to open content stream: %v", err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Failed to read content stream: %v", err)
+		}
+		content.Write(decoded)
+	}
+	return content.String()
+}
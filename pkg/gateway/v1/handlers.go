@@ -2,13 +2,18 @@ package v1
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"strings"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	"github.com/amorin24/llmproxy/pkg/context"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/llm"
 	"github.com/amorin24/llmproxy/pkg/models"
 	"github.com/amorin24/llmproxy/pkg/pricing"
 	"github.com/amorin24/llmproxy/pkg/tracing"
+	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel/attribute"
 )
 
@@ -18,9 +23,18 @@ type GatewayHandler struct {
 }
 
 func NewGatewayHandler(catalogLoader *pricing.CatalogLoader) *GatewayHandler {
+	costEstimator := pricing.NewCostEstimator(catalogLoader)
+
+	cfg := config.GetConfig()
+	if cfg.CostCurrency != "" && cfg.CostCurrency != pricing.DefaultCurrency {
+		if err := costEstimator.SetCurrency(cfg.CostCurrency, cfg.CostFXRate); err != nil {
+			logrus.WithError(err).Warn("Invalid cost currency, reporting estimates in USD")
+		}
+	}
+
 	return &GatewayHandler{
 		catalogLoader: catalogLoader,
-		costEstimator: pricing.NewCostEstimator(catalogLoader),
+		costEstimator: costEstimator,
 	}
 }
 
@@ -35,22 +49,36 @@ func (h *GatewayHandler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
 
 	if r.Method != http.MethodPost {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", myerrors.CodeMethodNotAllowed, "")
 		return
 	}
 
 	var req GatewayQueryRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON: "+err.Error(), "INVALID_JSON", "")
+	decoder := json.NewDecoder(r.Body)
+	if config.GetConfig().StrictRequestSchema {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON: "+err.Error(), myerrors.CodeInvalidJSON, "")
 		return
 	}
+	if _, err := decoder.Token(); err != io.EOF {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON: unexpected data after the JSON body", myerrors.CodeInvalidJSON, "")
+		return
+	}
+
+	requestID := req.RequestID
+	if requestID == "" {
+		requestID = llm.RequestIDFromContext(r.Context())
+	}
 
 	var reqCtx *context.RequestContext
-	if req.RequestID != "" {
-		reqCtx = context.NewRequestContextWithID(r.Context(), req.RequestID)
+	if requestID != "" {
+		reqCtx = context.NewRequestContextWithID(r.Context(), requestID)
 	} else {
 		reqCtx = context.NewRequestContext(r.Context())
 	}
+	w.Header().Set("X-Request-ID", reqCtx.RequestID)
 
 	if req.Tenant != "" {
 		reqCtx.WithTenant(req.Tenant)
@@ -61,35 +89,32 @@ func (h *GatewayHandler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := validateGatewayQueryRequest(req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, err.Error(), "INVALID_REQUEST", reqCtx.RequestID)
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), myerrors.CodeInvalidRequest, reqCtx.RequestID)
 		return
 	}
 
-	response := GatewayQueryResponse{
-		RequestID:      reqCtx.RequestID,
-		Response:       "Phase 0: Gateway API endpoint created. Full implementation in Phase 1+",
-		Model:          req.Model,
-		ModelVersion:   req.ModelVersion,
-		Cached:         false,
-		ResponseTimeMs: reqCtx.ElapsedMilliseconds(),
-		Tenant:         reqCtx.Tenant,
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	sendErrorResponse(w, http.StatusNotImplemented, "Gateway queries are not implemented yet, use /api/query", myerrors.CodeNotImplemented, reqCtx.RequestID)
 }
 
 func (h *GatewayHandler) CostEstimateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "METHOD_NOT_ALLOWED", "")
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", myerrors.CodeMethodNotAllowed, "")
 		return
 	}
 
 	var req CostEstimateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON: "+err.Error(), "INVALID_JSON", "")
+	decoder := json.NewDecoder(r.Body)
+	if config.GetConfig().StrictRequestSchema {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON: "+err.Error(), myerrors.CodeInvalidJSON, "")
+		return
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON: unexpected data after the JSON body", myerrors.CodeInvalidJSON, "")
 		return
 	}
 
@@ -124,6 +149,8 @@ func (h *GatewayHandler) CostEstimateHandler(w http.ResponseWriter, r *http.Requ
 		InputTokens:         estimate.InputTokens,
 		OutputTokens:        estimate.OutputTokens,
 		EstimatedCostUSD:    estimate.EstimatedCostUSD,
+		EstimatedCost:       estimate.EstimatedCost,
+		Currency:            estimate.Currency,
 		PricePerInputToken:  estimate.PricePerInputToken,
 		PricePerOutputToken: estimate.PricePerOutputToken,
 	}
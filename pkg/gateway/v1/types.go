@@ -63,6 +63,10 @@ type CostEstimateResponse struct {
 	
 	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
 	
+	EstimatedCost float64 `json:"estimated_cost"`
+	
+	Currency string `json:"currency"`
+	
 	PricePerInputToken float64 `json:"price_per_input_token"`
 	
 	PricePerOutputToken float64 `json:"price_per_output_token"`
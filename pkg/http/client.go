@@ -1,7 +1,17 @@
 package http
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,13 +23,9 @@ var (
 	defaultClient     *http.Client
 	defaultClientOnce sync.Once
 	
-	sharedTransport = &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 20,
-		IdleConnTimeout:     90 * time.Second,
-		DisableCompression:  false,
-		ForceAttemptHTTP2:   true,
-	}
+	sharedTransport     *http.Transport
+	sharedTransportErr  error
+	sharedTransportOnce sync.Once
 )
 
 type ClientConfig struct {
@@ -28,6 +34,9 @@ type ClientConfig struct {
 	MaxIdleConns       int
 	MaxIdleConnsPerHost int
 	IdleConnTimeout    time.Duration
+	MinTLSVersion      uint16
+	RootCAs            *x509.CertPool // Nil trusts the system root store
+	PinnedKeys         []string       // Base64 SHA-256 public key hashes, empty disables pinning
 }
 
 func DefaultClientConfig() ClientConfig {
@@ -37,49 +46,175 @@ func DefaultClientConfig() ClientConfig {
 		MaxIdleConns:       100,
 		MaxIdleConnsPerHost: 20,
 		IdleConnTimeout:    90 * time.Second,
+		MinTLSVersion:      tls.VersionTLS12,
 	}
 }
 
-func GetClient() *http.Client {
-	defaultClientOnce.Do(func() {
-		cfg := config.GetConfig()
-		timeout := 30 * time.Second
-		
-		if cfg.HTTPTimeout > 0 {
-			timeout = time.Duration(cfg.HTTPTimeout) * time.Second
+func clientConfigFromConfig(cfg *config.Config) (ClientConfig, error) {
+	clientConfig := DefaultClientConfig()
+	
+	if cfg.HTTPTimeout > 0 {
+		clientConfig.Timeout = time.Duration(cfg.HTTPTimeout) * time.Second
+	}
+	if cfg.MaxIdleConns > 0 {
+		clientConfig.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		clientConfig.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		clientConfig.IdleConnTimeout = time.Duration(cfg.IdleConnTimeout) * time.Second
+	}
+	
+	if cfg.TLSMinVersion != "" {
+		version, err := parseTLSVersion(cfg.TLSMinVersion)
+		if err != nil {
+			return clientConfig, err
+		}
+		clientConfig.MinTLSVersion = version
+	}
+	
+	if cfg.ProviderCABundle != "" {
+		pem, err := os.ReadFile(cfg.ProviderCABundle)
+		if err != nil {
+			return clientConfig, fmt.Errorf("reading CA bundle: %w", err)
 		}
 		
-		defaultClient = &http.Client{
-			Timeout:   timeout,
-			Transport: sharedTransport,
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return clientConfig, fmt.Errorf("no certificates found in CA bundle %s", cfg.ProviderCABundle)
+		}
+		clientConfig.RootCAs = pool
+	}
+	
+	for _, pin := range cfg.ProviderCertPins {
+		pin = strings.TrimPrefix(pin, "sha256/")
+		if hash, err := base64.StdEncoding.DecodeString(pin); err != nil || len(hash) != sha256.Size {
+			return clientConfig, fmt.Errorf("invalid certificate pin %q: expected a base64 SHA-256 hash", pin)
+		}
+		clientConfig.PinnedKeys = append(clientConfig.PinnedKeys, pin)
+	}
+	
+	return clientConfig, nil
+}
+
+func parseTLSVersion(value string) (uint16, error) {
+	switch strings.TrimSpace(value) {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q: expected 1.2 or 1.3", value)
+}
+
+func newTLSConfig(config ClientConfig) *tls.Config {
+	tlsConfig := &tls.Config{
+		MinVersion: config.MinTLSVersion,
+		RootCAs:    config.RootCAs,
+	}
+	
+	if len(config.PinnedKeys) > 0 {
+		pins := make(map[string]bool, len(config.PinnedKeys))
+		for _, pin := range config.PinnedKeys {
+			pins[pin] = true
 		}
 		
-		logrus.WithFields(logrus.Fields{
-			"timeout":             timeout,
-			"max_idle_conns":      sharedTransport.MaxIdleConns,
-			"max_idle_conns_host": sharedTransport.MaxIdleConnsPerHost,
-			"idle_conn_timeout":   sharedTransport.IdleConnTimeout,
-		}).Debug("Initialized shared HTTP client")
-	})
+		// VerifyConnection also runs on resumed sessions, unlike VerifyPeerCertificate
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, chain := range state.VerifiedChains {
+				for _, cert := range chain {
+					hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(hash[:])] {
+						return nil
+					}
+				}
+			}
+			return errors.New("no pinned public key in certificate chain for " + state.ServerName)
+		}
+	}
 	
-	return defaultClient
+	return tlsConfig
 }
 
-func GetClientWithConfig(config ClientConfig) *http.Client {
-	transport := &http.Transport{
+func newTransport(config ClientConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: config.KeepAlive,
+	}
+	
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
 		MaxIdleConns:        config.MaxIdleConns,
 		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
 		IdleConnTimeout:     config.IdleConnTimeout,
+		TLSClientConfig:     newTLSConfig(config),
 		DisableCompression:  false,
 		ForceAttemptHTTP2:   true,
 	}
+}
+
+func GetClient() *http.Client {
+	defaultClientOnce.Do(func() {
+		transport := GetTransport()
+		clientConfig, _ := clientConfigFromConfig(config.GetConfig())
+		
+		defaultClient = &http.Client{
+			Timeout:   clientConfig.Timeout,
+			Transport: transport,
+		}
+		
+		logrus.WithFields(logrus.Fields{
+			"timeout":             clientConfig.Timeout,
+			"max_idle_conns":      transport.MaxIdleConns,
+			"max_idle_conns_host": transport.MaxIdleConnsPerHost,
+			"idle_conn_timeout":   transport.IdleConnTimeout,
+			"tls_min_version":     tls.VersionName(transport.TLSClientConfig.MinVersion),
+			"ca_bundle":           clientConfig.RootCAs != nil,
+			"pinned_keys":         len(clientConfig.PinnedKeys),
+		}).Debug("Initialized shared HTTP client")
+	})
 	
+	return defaultClient
+}
+
+func GetClientWithConfig(config ClientConfig) *http.Client {
 	return &http.Client{
 		Timeout:   config.Timeout,
-		Transport: transport,
+		Transport: newTransport(config),
 	}
 }
 
+// Init builds the shared provider transport and reports an invalid TLS configuration,
+// so the server can refuse to start instead of failing on the first provider call.
+func Init() error {
+	GetTransport()
+	return sharedTransportErr
+}
+
 func GetTransport() *http.Transport {
+	sharedTransportOnce.Do(func() {
+		sharedTransport, sharedTransportErr = newProviderTransport(config.GetConfig())
+		if sharedTransportErr != nil {
+			logrus.WithError(sharedTransportErr).Error("Provider requests will fail until the TLS configuration is fixed")
+		}
+	})
+	
 	return sharedTransport
 }
+
+// newProviderTransport never falls back to unpinned TLS: with an invalid configuration
+// the transport fails every connection with the configuration error.
+func newProviderTransport(cfg *config.Config) (*http.Transport, error) {
+	clientConfig, err := clientConfigFromConfig(cfg)
+	if err != nil {
+		err = fmt.Errorf("invalid provider TLS configuration: %w", err)
+		transport := newTransport(DefaultClientConfig())
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, err
+		}
+		return transport, err
+	}
+	return newTransport(clientConfig), nil
+}
@@ -1,10 +1,20 @@
 package http
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,6 +55,7 @@ func TestDefaultClientConfig(t *testing.T) {
 	assert.Equal(t, 100, config.MaxIdleConns, "Default max idle connections should be 100")
 	assert.Equal(t, 20, config.MaxIdleConnsPerHost, "Default max idle connections per host should be 20")
 	assert.Equal(t, 90*time.Second, config.IdleConnTimeout, "Default idle connection timeout should be 90 seconds")
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinTLSVersion, "Default minimum TLS version should be 1.2")
 }
 
 func TestGetTransport(t *testing.T) {
@@ -54,3 +65,132 @@ func TestGetTransport(t *testing.T) {
 	assert.Equal(t, 20, transport.MaxIdleConnsPerHost, "Transport MaxIdleConnsPerHost should match the expected value")
 	assert.Equal(t, 90*time.Second, transport.IdleConnTimeout, "Transport IdleConnTimeout should match the expected value")
 }
+
+func TestNewProviderTransportInvalidConfig(t *testing.T) {
+	transport, err := newProviderTransport(&config.Config{TLSMinVersion: "1.1"})
+	assert.Error(t, err)
+	
+	_, dialErr := transport.DialContext(context.Background(), "tcp", "example.com:443")
+	assert.ErrorIs(t, dialErr, err, "An invalid TLS configuration should fail connections, not fall back")
+}
+
+func TestWebhookClientIgnoresProviderPins(t *testing.T) {
+	transport := NewWebhookClient(time.Second, true).Transport.(*http.Transport)
+	assert.Nil(t, transport.TLSClientConfig.VerifyConnection, "Callbacks should not be checked against provider pins")
+	assert.Nil(t, transport.TLSClientConfig.RootCAs, "Callbacks should trust the system roots")
+}
+
+func TestClientConfigFromConfig(t *testing.T) {
+	cfg := &config.Config{
+		HTTPTimeout:         12,
+		MaxIdleConns:        250,
+		MaxIdleConnsPerHost: 50,
+		IdleConnTimeout:     30,
+	}
+	
+	clientConfig, err := clientConfigFromConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 12*time.Second, clientConfig.Timeout, "Timeout should come from HTTPTimeout")
+	assert.Equal(t, 250, clientConfig.MaxIdleConns, "MaxIdleConns should come from config")
+	assert.Equal(t, 50, clientConfig.MaxIdleConnsPerHost, "MaxIdleConnsPerHost should come from config")
+	assert.Equal(t, 30*time.Second, clientConfig.IdleConnTimeout, "IdleConnTimeout should come from config")
+	
+	transport := newTransport(clientConfig)
+	assert.Equal(t, 250, transport.MaxIdleConns, "Transport should apply configured MaxIdleConns")
+	assert.Equal(t, 50, transport.MaxIdleConnsPerHost, "Transport should apply configured MaxIdleConnsPerHost")
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout, "Transport should apply configured IdleConnTimeout")
+}
+
+func TestClientConfigFromConfigDefaults(t *testing.T) {
+	clientConfig, err := clientConfigFromConfig(&config.Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultClientConfig(), clientConfig, "Unset config values should fall back to defaults")
+}
+
+func TestGetClientUsesSharedTransport(t *testing.T) {
+	assert.Same(t, GetTransport(), GetClient().Transport, "Shared client should use the shared transport")
+}
+
+func TestClientConfigFromConfigTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	assert.NoError(t, err)
+	
+	clientConfig, err := clientConfigFromConfig(&config.Config{
+		TLSMinVersion:    "1.3",
+		ProviderCABundle: bundle,
+		ProviderCertPins: []string{"sha256/" + publicKeyPin(server.Certificate())},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), clientConfig.MinTLSVersion, "MinTLSVersion should come from TLSMinVersion")
+	assert.NotNil(t, clientConfig.RootCAs, "RootCAs should be loaded from the CA bundle")
+	assert.Equal(t, []string{publicKeyPin(server.Certificate())}, clientConfig.PinnedKeys, "Pins should be stored without the sha256/ prefix")
+	
+	invalidConfigs := map[string]*config.Config{
+		"Unsupported TLS version": {TLSMinVersion: "1.0"},
+		"Missing CA bundle":       {ProviderCABundle: filepath.Join(t.TempDir(), "missing.pem")},
+		"Invalid pin":             {ProviderCertPins: []string{"not-a-hash"}},
+	}
+	for name, cfg := range invalidConfigs {
+		_, err := clientConfigFromConfig(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTransportTLSVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	
+	get := func(clientConfig ClientConfig) error {
+		clientConfig.RootCAs = roots
+		resp, err := GetClientWithConfig(clientConfig).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	
+	clientConfig := DefaultClientConfig()
+	assert.NoError(t, get(clientConfig), "Server trusted by the CA bundle should be accepted")
+	
+	clientConfig.PinnedKeys = []string{publicKeyPin(server.Certificate())}
+	assert.NoError(t, get(clientConfig), "Server with a pinned key should be accepted")
+	
+	clientConfig.PinnedKeys = []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}
+	assert.Error(t, get(clientConfig), "Server without a pinned key should be rejected")
+	
+	clientConfig = DefaultClientConfig()
+	clientConfig.RootCAs = x509.NewCertPool()
+	_, err := GetClientWithConfig(clientConfig).Get(server.URL)
+	assert.Error(t, err, "Server not trusted by the CA bundle should be rejected")
+}
+
+func TestTransportMinTLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	
+	clientConfig := DefaultClientConfig()
+	clientConfig.RootCAs = roots
+	clientConfig.MinTLSVersion = tls.VersionTLS13
+	
+	_, err := GetClientWithConfig(clientConfig).Get(server.URL)
+	assert.Error(t, err, "Server limited to TLS 1.2 should be rejected when TLS 1.3 is required")
+}
+
+func publicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.0.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	
+	for _, tt := range tests {
+		assert.Equal(t, tt.public, IsPublicIP(net.ParseIP(tt.ip)), tt.ip)
+	}
+}
+
+func TestCheckPublicHost(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, CheckPublicHost(ctx, "93.184.216.34"))
+	assert.ErrorIs(t, CheckPublicHost(ctx, "169.254.169.254"), ErrNonPublicAddress)
+	assert.ErrorIs(t, CheckPublicHost(ctx, "localhost"), ErrNonPublicAddress)
+}
+
+func TestNewWebhookClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	
+	_, err := NewWebhookClient(time.Second, false).Get(server.URL)
+	assert.True(t, errors.Is(err, ErrNonPublicAddress), "expected loopback dial to be refused, got %v", err)
+	
+	resp, err := NewWebhookClient(time.Second, true).Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	httpclient "github.com/amorin24/llmproxy/pkg/http"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+type availabilityResult struct {
+	available bool
+	checkedAt time.Time
+}
+
+var (
+	availabilityResults      = make(map[models.ModelType]availabilityResult)
+	availabilityResultsMutex sync.Mutex
+	
+	rejectedCredentials = make(map[models.ModelType]uint64) // Fingerprint of the probe credentials a provider rejected
+)
+
+// Bounds how much of a 400 probe response is read to look for Gemini's invalid key reason
+const maxProbeErrorBody = 4096
+
+func ClearAvailabilityCache() {
+	availabilityResultsMutex.Lock()
+	defer availabilityResultsMutex.Unlock()
+	
+	availabilityResults = make(map[models.ModelType]availabilityResult)
+	rejectedCredentials = make(map[models.ModelType]uint64)
+}
+
+func checkAvailability(client *http.Client, modelType models.ModelType, url string, headers map[string]string) bool {
+	cfg := config.GetConfig()
+	cacheTTL := time.Duration(cfg.AvailabilityCacheTTL) * time.Second
+	credentials := credentialFingerprint(url, headers)
+	
+	availabilityResultsMutex.Lock()
+	rejected, ok := rejectedCredentials[modelType]
+	availabilityResultsMutex.Unlock()
+	if ok && rejected == credentials {
+		return false
+	}
+	
+	if cacheTTL > 0 {
+		availabilityResultsMutex.Lock()
+		result, ok := availabilityResults[modelType]
+		availabilityResultsMutex.Unlock()
+		
+		if ok && time.Since(result.checkedAt) < cacheTTL {
+			return result.available
+		}
+	}
+	
+	available, rejectedKey := probeAvailability(client, modelType, cfg.AvailabilityCheckMethod(modelType), url, headers, time.Duration(cfg.AvailabilityCheckTimeout)*time.Second)
+	if rejectedKey {
+		logrus.WithField("model", modelType).Error("API key rejected by availability check, model unavailable until the key changes")
+		availabilityResultsMutex.Lock()
+		rejectedCredentials[modelType] = credentials
+		availabilityResultsMutex.Unlock()
+		return false
+	}
+	
+	if cacheTTL > 0 {
+		availabilityResultsMutex.Lock()
+		availabilityResults[modelType] = availabilityResult{available: available, checkedAt: time.Now()}
+		availabilityResultsMutex.Unlock()
+	}
+	
+	return available
+}
+
+type availabilityProber interface {
+	availabilityProbe() (string, map[string]string)
+}
+
+// Checks a candidate key without caching the result or replacing the configured key
+var ProbeAPIKey = func(modelType models.ModelType, apiKey string) (bool, time.Duration, error) {
+	return probeAPIKey(httpclient.GetClient(), modelType, apiKey)
+}
+
+func probeAPIKey(client *http.Client, modelType models.ModelType, apiKey string) (bool, time.Duration, error) {
+	var prober availabilityProber
+	switch modelType {
+	case models.OpenAI:
+		prober = &OpenAIClient{apiKey: apiKey}
+	case models.Gemini:
+		prober = &GeminiClient{apiKey: apiKey}
+	case models.Mistral:
+		prober = &MistralClient{apiKey: apiKey}
+	case models.Claude:
+		prober = &ClaudeClient{apiKey: apiKey}
+	default:
+		return false, 0, myerrors.NewModelError(string(modelType), 400, myerrors.ErrUnavailable, false)
+	}
+	
+	cfg := config.GetConfig()
+	method := cfg.AvailabilityCheckMethod(modelType)
+	if method == config.AvailabilityCheckNone {
+		method = config.AvailabilityCheckGet // A validation has to reach the provider
+	}
+	
+	url, headers := prober.availabilityProbe()
+	start := time.Now()
+	reachable, _ := probeAvailability(client, modelType, method, url, headers, time.Duration(cfg.AvailabilityCheckTimeout)*time.Second)
+	return reachable, time.Since(start), nil
+}
+
+func credentialFingerprint(url string, headers map[string]string) uint64 {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	for _, key := range keys {
+		h.Write([]byte("\n" + key + ":" + headers[key]))
+	}
+	return h.Sum64()
+}
+
+func probeAvailability(client *http.Client, modelType models.ModelType, method, url string, headers map[string]string, timeout time.Duration) (bool, bool) {
+	if method == config.AvailabilityCheckNone {
+		return true, false
+	}
+	
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, nil)
+	if err != nil {
+		logrus.WithError(err).WithField("model", modelType).Error("Error creating availability request")
+		return false, false
+	}
+	
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	setExtraHeaders(modelType, req.Header)
+	
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.WithError(err).WithField("model", modelType).Error("Error checking availability")
+		return false, false
+	}
+	defer resp.Body.Close()
+	
+	return resp.StatusCode == http.StatusOK, keyRejected(modelType, resp)
+}
+
+// keyRejected reports whether a probe response means the key itself is bad: 401 or 403 from any
+// provider, or Gemini's 400 with reason API_KEY_INVALID.
+func keyRejected(modelType models.ModelType, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	case http.StatusBadRequest:
+		if modelType != models.Gemini {
+			return false
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeErrorBody))
+		return err == nil && strings.Contains(string(body), "API_KEY_INVALID")
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package llm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestCheckAvailability(t *testing.T) {
+	cfg := config.GetConfig()
+	originalMethods := cfg.AvailabilityCheckMethods
+	originalTTL := cfg.AvailabilityCacheTTL
+	defer func() {
+		cfg.AvailabilityCheckMethods = originalMethods
+		cfg.AvailabilityCacheTTL = originalTTL
+		ClearAvailabilityCache()
+	}()
+	
+	var calls int32
+	var lastMethod string
+	httpClient := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				lastMethod = req.Method
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+				}, nil
+			},
+		},
+	}
+	
+	t.Run("HEAD method", func(t *testing.T) {
+		cfg.AvailabilityCheckMethods = map[models.ModelType]string{models.OpenAI: config.AvailabilityCheckHead}
+		if !checkAvailability(httpClient, models.OpenAI, "https://example.com/v1/models", nil) {
+			t.Errorf("Expected model to be available")
+		}
+		if lastMethod != http.MethodHead {
+			t.Errorf("Expected %s request, got %s", http.MethodHead, lastMethod)
+		}
+	})
+	
+	t.Run("No probe", func(t *testing.T) {
+		cfg.AvailabilityCheckMethods = map[models.ModelType]string{models.OpenAI: config.AvailabilityCheckNone}
+		before := atomic.LoadInt32(&calls)
+		if !checkAvailability(httpClient, models.OpenAI, "https://example.com/v1/models", nil) {
+			t.Errorf("Expected model to be available without a probe")
+		}
+		if atomic.LoadInt32(&calls) != before {
+			t.Errorf("Expected no availability request")
+		}
+	})
+	
+	t.Run("Cached result", func(t *testing.T) {
+		cfg.AvailabilityCheckMethods = nil
+		cfg.AvailabilityCacheTTL = 60
+		ClearAvailabilityCache()
+		
+		before := atomic.LoadInt32(&calls)
+		for i := 0; i < 3; i++ {
+			checkAvailability(httpClient, models.Mistral, "https://example.com/v1/models", nil)
+		}
+		if got := atomic.LoadInt32(&calls) - before; got != 1 {
+			t.Errorf("Expected 1 availability request, got %d", got)
+		}
+		if lastMethod != http.MethodGet {
+			t.Errorf("Expected default %s request, got %s", http.MethodGet, lastMethod)
+		}
+		
+		ClearAvailabilityCache()
+		checkAvailability(httpClient, models.Mistral, "https://example.com/v1/models", nil)
+		if got := atomic.LoadInt32(&calls) - before; got != 2 {
+			t.Errorf("Expected a new request after clearing the cache, got %d requests", got)
+		}
+	})
+	
+	t.Run("Rejected key", func(t *testing.T) {
+		cfg.AvailabilityCheckMethods = nil
+		cfg.AvailabilityCacheTTL = 0
+		
+		var probes int32
+		unauthorizedClient := &http.Client{
+			Transport: &mockTransport{
+				roundTripFunc: func(req *http.Request) (*http.Response, error) {
+					atomic.AddInt32(&probes, 1)
+					status := http.StatusOK
+					if req.Header.Get("Authorization") == "Bearer revoked" {
+						status = http.StatusUnauthorized
+					}
+					return &http.Response{
+						StatusCode: status,
+						Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+					}, nil
+				},
+			},
+		}
+		
+		revoked := map[string]string{"Authorization": "Bearer revoked"}
+		for i := 0; i < 3; i++ {
+			if checkAvailability(unauthorizedClient, models.Gemini, "https://example.com/v1/models", revoked) {
+				t.Errorf("Expected model with a rejected key to be unavailable")
+			}
+		}
+		if got := atomic.LoadInt32(&probes); got != 1 {
+			t.Errorf("Expected a rejected key to be probed once, got %d probes", got)
+		}
+		
+		if !checkAvailability(unauthorizedClient, models.Gemini, "https://example.com/v1/models", map[string]string{"Authorization": "Bearer rotated"}) {
+			t.Errorf("Expected model to be available after the key changes")
+		}
+		
+		ClearAvailabilityCache()
+		before := atomic.LoadInt32(&probes)
+		checkAvailability(unauthorizedClient, models.Gemini, "https://example.com/v1/models", revoked)
+		if got := atomic.LoadInt32(&probes) - before; got != 1 {
+			t.Errorf("Expected clearing the cache to re-probe a rejected key, got %d probes", got)
+		}
+	})
+	
+	t.Run("Rejection statuses", func(t *testing.T) {
+		cfg.AvailabilityCheckMethods = nil
+		cfg.AvailabilityCacheTTL = 0
+		
+		testCases := []struct {
+			name     string
+			model    models.ModelType
+			status   int
+			body     string
+			rejected bool
+		}{
+			{"Unauthorized", models.OpenAI, http.StatusUnauthorized, `{}`, true},
+			{"Forbidden", models.Claude, http.StatusForbidden, `{}`, true},
+			{"Gemini invalid key", models.Gemini, http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT","details":[{"reason":"API_KEY_INVALID"}]}}`, true},
+			{"Gemini other bad request", models.Gemini, http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT"}}`, false},
+			{"Bad request from another provider", models.Mistral, http.StatusBadRequest, `{"reason":"API_KEY_INVALID"}`, false},
+			{"Server error", models.OpenAI, http.StatusInternalServerError, `{}`, false},
+		}
+		
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				ClearAvailabilityCache()
+				
+				var probes int32
+				client := &http.Client{
+					Transport: &mockTransport{
+						roundTripFunc: func(req *http.Request) (*http.Response, error) {
+							atomic.AddInt32(&probes, 1)
+							return &http.Response{
+								StatusCode: tc.status,
+								Body:       ioutil.NopCloser(strings.NewReader(tc.body)),
+							}, nil
+						},
+					},
+				}
+				
+				headers := map[string]string{"Authorization": "Bearer key"}
+				checkAvailability(client, tc.model, "https://example.com/v1/models", headers)
+				checkAvailability(client, tc.model, "https://example.com/v1/models", headers)
+				if rejected := atomic.LoadInt32(&probes) == 1; rejected != tc.rejected {
+					t.Errorf("Expected key rejected=%v, got %d probes", tc.rejected, probes)
+				}
+			})
+		}
+		ClearAvailabilityCache()
+	})
+}
+
+func TestProbeAPIKey(t *testing.T) {
+	client := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				status := http.StatusUnauthorized
+				if req.Header.Get("Authorization") == "Bearer candidate_key" {
+					status = http.StatusOK
+				}
+				return &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+				}, nil
+			},
+		},
+	}
+	
+	reachable, _, err := probeAPIKey(client, models.Mistral, "candidate_key")
+	if err != nil || !reachable {
+		t.Errorf("Expected accepted key to be reachable, got %v, %v", reachable, err)
+	}
+	if reachable, _, _ := probeAPIKey(client, models.Mistral, "test_revoked_key"); reachable {
+		t.Error("Expected a rejected key to be unreachable, even with a test_ prefix")
+	}
+	
+	if _, _, err := ProbeAPIKey(models.ModelType("bedrock"), "candidate_key"); err == nil {
+		t.Error("Expected error for unknown provider, got nil")
+	}
+	
+	url, headers := (&ClaudeClient{apiKey: "candidate_key"}).availabilityProbe()
+	if url != "https://api.anthropic.com/v1/models" || headers["x-api-key"] != "candidate_key" {
+		t.Errorf("Expected Claude probe to carry the candidate key, got %s %v", url, headers)
+	}
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"fmt"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+type Capabilities struct {
+	SupportsTools  bool `json:"supports_tools"`
+	SupportsVision bool `json:"supports_vision"`
+	SupportsJSON   bool `json:"supports_json"`  // Provider-enforced JSON output
+	ContextWindow  int  `json:"context_window"` // Tokens, 0 when unknown
+}
+
+var noJSONModeModelVersions = map[string]bool{
+	"gpt-4":             true,
+	"gemini-pro":        true,
+	"gemini-pro-vision": true,
+}
+
+func ModelCapabilities(modelType models.ModelType, version string) Capabilities {
+	version = ValidateModelVersion(modelType, version)
+	
+	capabilities := Capabilities{
+		SupportsTools:  modelType != models.Mistral,
+		SupportsVision: modelType != models.Mistral && !textOnlyModelVersions[version],
+		SupportsJSON:   modelType != models.Claude && !noJSONModeModelVersions[version],
+		ContextWindow:  ContextWindows[version],
+	}
+	
+	override, ok := config.GetConfig().ModelCapabilities[version]
+	if !ok {
+		return capabilities
+	}
+	if override.SupportsTools != nil {
+		capabilities.SupportsTools = *override.SupportsTools
+	}
+	if override.SupportsVision != nil {
+		capabilities.SupportsVision = *override.SupportsVision
+	}
+	if override.SupportsJSON != nil {
+		capabilities.SupportsJSON = *override.SupportsJSON
+	}
+	if override.ContextWindow != nil {
+		capabilities.ContextWindow = *override.ContextWindow
+	}
+	return capabilities
+}
+
+func checkTools(modelType models.ModelType, version string, tools []models.ToolDefinition) error {
+	if len(tools) == 0 || ModelCapabilities(modelType, version).SupportsTools {
+		return nil
+	}
+	return myerrors.NewModelError(string(modelType), 400, fmt.Errorf("%w: %s", myerrors.ErrToolsUnsupported, ValidateModelVersion(modelType, version)), false)
+}
@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+func TestModelCapabilities(t *testing.T) {
+	testCases := []struct {
+		name      string
+		modelType models.ModelType
+		version   string
+		expected  Capabilities
+	}{
+		{"Vision and tools", models.OpenAI, "gpt-4o", Capabilities{SupportsTools: true, SupportsVision: true, SupportsJSON: true, ContextWindow: 128000}},
+		{"Text-only version", models.OpenAI, "gpt-4", Capabilities{SupportsTools: true, SupportsVision: false, SupportsJSON: false, ContextWindow: 8192}},
+		{"No tools or vision", models.Mistral, "mistral-large-latest", Capabilities{SupportsTools: false, SupportsVision: false, SupportsJSON: true, ContextWindow: 128000}},
+		{"No JSON mode", models.Claude, "claude-3-haiku-20240307", Capabilities{SupportsTools: true, SupportsVision: true, SupportsJSON: false, ContextWindow: 200000}},
+		{"Default version", models.Gemini, "", Capabilities{SupportsTools: true, SupportsVision: true, SupportsJSON: true, ContextWindow: 1048576}},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ModelCapabilities(tc.modelType, tc.version); got != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestModelCapabilitiesOverrides(t *testing.T) {
+	cfg := config.GetConfig()
+	originalCapabilities := cfg.ModelCapabilities
+	defer func() { cfg.ModelCapabilities = originalCapabilities }()
+	
+	enabled, disabled, window := true, false, 4096
+	cfg.ModelCapabilities = map[string]config.ModelCapabilities{
+		"mistral-large-latest": {SupportsTools: &enabled},
+		"gpt-4o":               {SupportsVision: &disabled, ContextWindow: &window},
+	}
+	
+	if capabilities := ModelCapabilities(models.Mistral, "mistral-large-latest"); !capabilities.SupportsTools || capabilities.ContextWindow != 128000 {
+		t.Errorf("Expected only supports_tools overridden, got %+v", capabilities)
+	}
+	
+	if SupportsImages(models.OpenAI, "gpt-4o") {
+		t.Error("Expected vision disabled by the override")
+	}
+	
+	if err := checkTools(models.Mistral, "mistral-large-latest", []models.ToolDefinition{{Name: "lookup"}}); err != nil {
+		t.Errorf("Expected tools allowed by the override, got %v", err)
+	}
+	
+	var modelErr *myerrors.ModelError
+	err := CheckContextWindow(models.OpenAI, "gpt-4o", strings.Repeat("a", 5*window))
+	if !errors.As(err, &modelErr) || !errors.Is(err, myerrors.ErrContextWindowExceeded) {
+		t.Errorf("Expected the overridden context window to apply, got %v", err)
+	}
+}
+
+func TestCheckTools(t *testing.T) {
+	tools := []models.ToolDefinition{{Name: "lookup"}}
+	
+	if err := checkTools(models.OpenAI, "gpt-4o", tools); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := checkTools(models.Mistral, "mistral-small-latest", nil); err != nil {
+		t.Errorf("Expected no error without tools, got %v", err)
+	}
+	
+	var modelErr *myerrors.ModelError
+	err := checkTools(models.Mistral, "mistral-small-latest", tools)
+	if !errors.As(err, &modelErr) || modelErr.Code != 400 || !errors.Is(err, myerrors.ErrToolsUnsupported) {
+		t.Errorf("Expected tools unsupported error with code 400, got %v", err)
+	}
+}
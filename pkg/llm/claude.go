@@ -28,23 +28,62 @@ type ClaudeRequest struct {
 	Messages    []ClaudeMessage `json:"messages"`
 	Temperature float64 `json:"temperature"`
 	MaxTokens   int     `json:"max_tokens"`
+	StopSequences []string `json:"stop_sequences,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Tools       []ClaudeTool      `json:"tools,omitempty"`
+	ToolChoice  *ClaudeToolChoice `json:"tool_choice,omitempty"`
+}
+
+type ClaudeTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type ClaudeToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type ClaudeMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // A string, or content blocks for multimodal input
+}
+
+type ClaudeContentBlock struct {
+	Type   string             `json:"type"`
+	Text   string             `json:"text,omitempty"`
+	Source *ClaudeImageSource `json:"source,omitempty"`
+	CacheControl *ClaudeCacheControl `json:"cache_control,omitempty"`
+}
+
+type ClaudeCacheControl struct {
+	Type string `json:"type"`
+}
+
+type ClaudeImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
 }
 
 type ClaudeResponse struct {
 	Id      string `json:"id"`
 	Content []struct {
-		Text string `json:"text"`
-		Type string `json:"type"`
+		Text  string          `json:"text"`
+		Type  string          `json:"type"`
+		ID    string          `json:"id"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
 	} `json:"content"`
-	Model     string `json:"model"`
-	Usage     struct {
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
 		InputTokens  int `json:"input_tokens"`
 		OutputTokens int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 	} `json:"usage"`
 	Error struct {
 		Type    string `json:"type"`
@@ -64,29 +103,114 @@ func (c *ClaudeClient) GetModelType() models.ModelType {
 	return models.Claude
 }
 
-func (c *ClaudeClient) Query(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func (c *ClaudeClient) Query(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	if c.apiKey == "" {
 		return nil, myerrors.NewModelError(string(models.Claude), 401, myerrors.ErrAPIKeyMissing, false)
 	}
 
-	modelVersion = ValidateModelVersion(models.Claude, modelVersion)
+	modelVersion, err := ResolveModelVersion(models.Claude, modelVersion, config.GetConfig().StrictModelVersion)
+	if err != nil {
+		return nil, err
+	}
 
-	retryFunc := func() (interface{}, error) {
-		return c.executeQuery(ctx, query, modelVersion)
+	if err := checkTools(models.Claude, modelVersion, opts.Tools); err != nil {
+		return nil, err
 	}
 
-	result, err := retry.Do(ctx, retryFunc, retry.DefaultConfig)
-	if err != nil {
+	if err := checkImages(models.Claude, modelVersion, opts.Images, true); err != nil {
 		return nil, err
 	}
 
-	return result.(*QueryResult), nil
+	queryOnce := func(ctx context.Context) (*QueryResult, error) {
+		retryFunc := func() (interface{}, error) {
+			return c.executeQuery(ctx, query, modelVersion, opts)
+		}
+		result, err := retry.Do(ctx, retryFunc, RetryConfig(models.Claude))
+		if err != nil {
+			return nil, err
+		}
+		return result.(*QueryResult), nil
+	}
+
+	if opts.N > 1 {
+		return queryConcurrently(ctx, opts.N, queryOnce)
+	}
+
+	return queryOnce(ctx)
+}
+
+func newClaudeRequest(query string, modelVersion string, opts QueryOptions) ClaudeRequest {
+	return ClaudeRequest{
+		Model: modelVersion,
+		Messages: []ClaudeMessage{
+			{
+				Role:    "user",
+				Content: claudeContent(query, opts.Images, opts.CachePrefix),
+			},
+		},
+		Temperature:   opts.temperature(models.Claude),
+		MaxTokens:     opts.maxTokens(models.Claude),
+		StopSequences: opts.Stop,
+		TopP:          opts.TopP,
+		Tools:         claudeTools(opts.Tools),
+		ToolChoice:    claudeToolChoice(opts.ToolChoice),
+	}
+}
+
+func claudeContent(query string, images []string, cachePrefix string) interface{} {
+	if len(images) == 0 && cachePrefix == "" {
+		return query
+	}
+	
+	var blocks []ClaudeContentBlock
+	if cachePrefix != "" {
+		blocks = append(blocks, ClaudeContentBlock{Type: "text", Text: cachePrefix, CacheControl: &ClaudeCacheControl{Type: "ephemeral"}})
+	}
+	for _, image := range parseImages(images) {
+		source := &ClaudeImageSource{Type: "base64", MediaType: image.MediaType, Data: image.Data}
+		if image.URL != "" {
+			source = &ClaudeImageSource{Type: "url", URL: image.URL}
+		}
+		blocks = append(blocks, ClaudeContentBlock{Type: "image", Source: source})
+	}
+	return append(blocks, ClaudeContentBlock{Type: "text", Text: query})
+}
+
+func claudeTools(tools []models.ToolDefinition) []ClaudeTool {
+	var claudeTools []ClaudeTool
+	for _, tool := range tools {
+		schema := tool.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		
+		claudeTools = append(claudeTools, ClaudeTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+	return claudeTools
+}
+
+func claudeToolChoice(toolChoice string) *ClaudeToolChoice {
+	switch toolChoice {
+	case "":
+		return nil
+	case models.ToolChoiceAuto, models.ToolChoiceNone:
+		return &ClaudeToolChoice{Type: toolChoice}
+	case models.ToolChoiceRequired:
+		return &ClaudeToolChoice{Type: "any"}
+	default:
+		return &ClaudeToolChoice{Type: "tool", Name: toolChoice}
+	}
 }
 
-func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	startTime := time.Now()
 	result := &QueryResult{
-		NumRetries: 0,
+		NumRetries:   0,
+		ModelVersion: modelVersion,
 	}
 
 	if strings.HasPrefix(c.apiKey, "test_") {
@@ -105,17 +229,7 @@ func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVers
 		return result, nil
 	}
 
-	reqBody, err := json.Marshal(ClaudeRequest{
-		Model: modelVersion,
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: query,
-			},
-		},
-		Temperature: 0.7,
-		MaxTokens:   150,
-	})
+	reqBody, err := json.Marshal(newClaudeRequest(query, modelVersion, opts))
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.Claude), 500, fmt.Errorf("error marshaling request: %v", err), false)
 	}
@@ -129,6 +243,9 @@ func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVers
 	req.Header.Set("x-api-key", c.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
+	setExtraHeaders(models.Claude, req.Header)
+	setCorrelationHeaders(ctx, req)
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
@@ -138,6 +255,8 @@ func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVers
 	}
 	defer resp.Body.Close()
 
+	result.ProviderRequestID = providerRequestID(models.Claude, resp.Header)
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.Claude), 500, fmt.Errorf("error reading response: %v", err), false)
@@ -145,7 +264,7 @@ func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVers
 
 	var claudeResp ClaudeResponse
 	err = json.Unmarshal(body, &claudeResp)
-	if err != nil {
+	if err != nil && resp.StatusCode == http.StatusOK {
 		return nil, myerrors.NewInvalidResponseError(string(models.Claude), err)
 	}
 
@@ -153,6 +272,8 @@ func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVers
 	result.ResponseTime = time.Since(startTime).Milliseconds()
 
 	if resp.StatusCode != http.StatusOK {
+		logProviderError(ctx, models.Claude, result.ProviderRequestID, resp.StatusCode)
+		
 		if resp.StatusCode == http.StatusTooManyRequests {
 			return nil, myerrors.NewRateLimitError(string(models.Claude))
 		}
@@ -169,9 +290,25 @@ func (c *ClaudeClient) executeQuery(ctx context.Context, query string, modelVers
 		return nil, myerrors.NewEmptyResponseError(string(models.Claude))
 	}
 
-	result.Response = claudeResp.Content[0].Text
+	for _, content := range claudeResp.Content {
+		switch content.Type {
+		case "tool_use":
+			result.ToolCalls = append(result.ToolCalls, models.ToolCall{
+				ID:        content.ID,
+				Name:      content.Name,
+				Arguments: content.Input,
+			})
+		default:
+			if result.Response == "" {
+				result.Response = content.Text
+			}
+		}
+	}
+	result.FinishReason = claudeResp.StopReason
 	result.InputTokens = claudeResp.Usage.InputTokens
 	result.OutputTokens = claudeResp.Usage.OutputTokens
+	result.CacheReadTokens = claudeResp.Usage.CacheReadInputTokens
+	result.CacheWriteTokens = claudeResp.Usage.CacheCreationInputTokens
 	result.TotalTokens = result.InputTokens + result.OutputTokens
 	result.NumTokens = result.TotalTokens // For backward compatibility
 	EstimateTokens(result, query, result.Response)
@@ -189,24 +326,13 @@ func (c *ClaudeClient) CheckAvailability() bool {
 		return true
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.anthropic.com/v1/models", nil)
-	if err != nil {
-		logrus.WithError(err).Error("Error creating Claude availability request")
-		return false
-	}
-
-	req.Header.Set("x-api-key", c.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	url, headers := c.availabilityProbe()
+	return checkAvailability(c.client, models.Claude, url, headers)
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		logrus.WithError(err).Error("Error checking Claude availability")
-		return false
+func (c *ClaudeClient) availabilityProbe() (string, map[string]string) {
+	return "https://api.anthropic.com/v1/models", map[string]string{
+		"x-api-key":         c.apiKey,
+		"anthropic-version": "2023-06-01",
 	}
-	defer resp.Body.Close()
-
-	return resp.StatusCode == http.StatusOK
 }
@@ -127,7 +127,7 @@ func TestClaudeClient_Query(t *testing.T) {
 				client: httpClient,
 			}
 			
-			result, err := client.Query(context.Background(), "Test query", "claude-3-sonnet-20240229")
+			result, err := client.Query(context.Background(), "Test query", "claude-3-sonnet-20240229", QueryOptions{})
 			
 			if tc.expectError {
 				if err == nil {
@@ -245,3 +245,182 @@ func TestClaudeClient_CheckAvailability(t *testing.T) {
 		})
 	}
 }
+
+func TestClaudeRequest_Stop(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stop     []string
+		expected bool
+	}{
+		{
+			name:     "Stop sequences set",
+			stop:     []string{"\n\n", "END"},
+			expected: true,
+		},
+		{
+			name:     "No stop sequences",
+			stop:     nil,
+			expected: false,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newClaudeRequest("test query", "claude-3-haiku", QueryOptions{Stop: tc.stop}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			stop, found := decoded["stop_sequences"]
+			if found != tc.expected {
+				t.Fatalf("Expected stop_sequences present=%v, got %v in %s", tc.expected, found, body)
+			}
+			
+			if found && len(stop.([]interface{})) != len(tc.stop) {
+				t.Errorf("Expected %d stop sequences, got %v", len(tc.stop), stop)
+			}
+		})
+	}
+}
+
+func TestClaudeClient_ToolCalls(t *testing.T) {
+	var sent map[string]interface{}
+	httpClient := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&sent)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"content": [
+							{"type": "text", "text": "Let me check."},
+							{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+						],
+						"stop_reason": "tool_use",
+						"usage": {"input_tokens": 10, "output_tokens": 5}
+					}`)),
+				}, nil
+			},
+		},
+	}
+	
+	client := &ClaudeClient{apiKey: "test-key", client: httpClient}
+	opts := QueryOptions{
+		Tools:      []models.ToolDefinition{{Name: "get_weather"}},
+		ToolChoice: models.ToolChoiceRequired,
+	}
+	
+	result, err := client.Query(context.Background(), "Weather in Paris?", "claude-3-haiku-20240307", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	tools, ok := sent["tools"].([]interface{})
+	if !ok || len(tools) != 1 {
+		t.Fatalf("Expected 1 tool in request, got %v", sent["tools"])
+	}
+	if tools[0].(map[string]interface{})["input_schema"] == nil {
+		t.Errorf("Expected input_schema to default to an object schema, got %v", tools[0])
+	}
+	
+	if toolChoice, ok := sent["tool_choice"].(map[string]interface{}); !ok || toolChoice["type"] != "any" {
+		t.Errorf("Expected tool_choice type any, got %v", sent["tool_choice"])
+	}
+	
+	if result.Response != "Let me check." {
+		t.Errorf("Expected text response, got %q", result.Response)
+	}
+	
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].ID != "toolu_1" || string(result.ToolCalls[0].Arguments) != `{"city": "Paris"}` {
+		t.Errorf("Unexpected tool calls: %+v", result.ToolCalls)
+	}
+}
+
+func TestClaudeRequest_Images(t *testing.T) {
+	body, err := json.Marshal(newClaudeRequest("Describe this", "claude-3-haiku-20240307", QueryOptions{Images: []string{testPNG}}))
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+	
+	var decoded struct {
+		Messages []struct {
+			Content []ClaudeContentBlock `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling request: %v", err)
+	}
+	
+	blocks := decoded.Messages[0].Content
+	if len(blocks) != 2 || blocks[0].Type != "image" || blocks[1].Text != "Describe this" {
+		t.Fatalf("Unexpected content blocks: %+v", blocks)
+	}
+	
+	source := blocks[0].Source
+	if source.Type != "base64" || source.MediaType != "image/png" || source.Data != testPNG {
+		t.Errorf("Unexpected image source: %+v", source)
+	}
+}
+
+func TestClaudeRequest_TopP(t *testing.T) {
+	topP := 0.8
+	body, err := json.Marshal(newClaudeRequest("test query", "claude-3-haiku-20240307", QueryOptions{TopP: &topP}))
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+	
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling request: %v", err)
+	}
+	
+	if decoded["top_p"] != 0.8 {
+		t.Errorf("Expected top_p 0.8, got %v in %s", decoded["top_p"], body)
+	}
+}
+
+func TestClaudeClient_PromptCaching(t *testing.T) {
+	var sent struct {
+		Messages []struct {
+			Content []ClaudeContentBlock `json:"content"`
+		} `json:"messages"`
+	}
+	httpClient := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&sent)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"content": [{"type": "text", "text": "Done."}],
+						"stop_reason": "end_turn",
+						"usage": {"input_tokens": 10, "output_tokens": 5, "cache_creation_input_tokens": 1200, "cache_read_input_tokens": 300}
+					}`)),
+				}, nil
+			},
+		},
+	}
+	
+	client := &ClaudeClient{apiKey: "test-key", client: httpClient}
+	result, err := client.Query(context.Background(), "Summarize this", "claude-3-haiku-20240307", QueryOptions{CachePrefix: "You are a careful summarizer."})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	blocks := sent.Messages[0].Content
+	if len(blocks) != 2 || blocks[0].Text != "You are a careful summarizer." || blocks[1].Text != "Summarize this" {
+		t.Fatalf("Unexpected content blocks: %+v", blocks)
+	}
+	if blocks[0].CacheControl == nil || blocks[0].CacheControl.Type != "ephemeral" || blocks[1].CacheControl != nil {
+		t.Errorf("Expected only the prefix block to be marked cacheable, got %+v", blocks)
+	}
+	
+	if result.CacheWriteTokens != 1200 || result.CacheReadTokens != 300 {
+		t.Errorf("Expected cache write 1200 and read 300 tokens, got %d and %d", result.CacheWriteTokens, result.CacheReadTokens)
+	}
+}
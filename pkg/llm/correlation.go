@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type requestIDKey struct{}
+
+// Response headers carrying the provider's own request ID; Gemini does not return one
+var providerRequestIDHeaders = map[models.ModelType]string{
+	models.OpenAI:  "x-request-id",
+	models.Claude:  "request-id",
+	models.Mistral: "mistral-correlation-id",
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+func setCorrelationHeaders(ctx context.Context, req *http.Request) {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+func providerRequestID(modelType models.ModelType, header http.Header) string {
+	if name, ok := providerRequestIDHeaders[modelType]; ok {
+		return header.Get(name)
+	}
+	return ""
+}
+
+func logProviderError(ctx context.Context, modelType models.ModelType, providerRequestID string, statusCode int) {
+	logrus.WithFields(logrus.Fields{
+		"model":               string(modelType),
+		"status_code":         statusCode,
+		"request_id":          RequestIDFromContext(ctx),
+		"provider_request_id": providerRequestID,
+	}).Warn("Provider returned an error")
+}
@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	myerrors "github.com/amorin24/llmproxy/pkg/errors"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func correlationClient(statusCode int, header string, body string, sent *http.Header) *http.Client {
+	return &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				*sent = req.Header.Clone()
+				resp := &http.Response{
+					StatusCode: statusCode,
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(strings.NewReader(body)),
+				}
+				if header != "" {
+					resp.Header.Set(header, "provider-req-123")
+				}
+				return resp, nil
+			},
+		},
+	}
+}
+
+func TestProviderRequestCorrelation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		header    string
+		body      string
+		newClient func(httpClient *http.Client) Client
+	}{
+		{
+			name:   "OpenAI",
+			header: "x-request-id",
+			body:   `{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`,
+			newClient: func(httpClient *http.Client) Client {
+				return &OpenAIClient{apiKey: "test-key", client: httpClient}
+			},
+		},
+		{
+			name:   "Claude",
+			header: "request-id",
+			body:   `{"content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn"}`,
+			newClient: func(httpClient *http.Client) Client {
+				return &ClaudeClient{apiKey: "test-key", client: httpClient}
+			},
+		},
+		{
+			name:   "Mistral",
+			header: "mistral-correlation-id",
+			body:   `{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`,
+			newClient: func(httpClient *http.Client) Client {
+				return &MistralClient{apiKey: "test-key", client: httpClient}
+			},
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent http.Header
+			client := tc.newClient(correlationClient(http.StatusOK, tc.header, tc.body, &sent))
+			
+			result, err := client.Query(WithRequestID(context.Background(), "req-abc"), "hello", "", QueryOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			
+			if sent.Get("X-Request-ID") != "req-abc" {
+				t.Errorf("Expected X-Request-ID req-abc to be forwarded, got %q", sent.Get("X-Request-ID"))
+			}
+			if result.ProviderRequestID != "provider-req-123" {
+				t.Errorf("Expected provider request ID provider-req-123, got %q", result.ProviderRequestID)
+			}
+		})
+	}
+}
+
+func TestProviderRequestCorrelationOnError(t *testing.T) {
+	var sent http.Header
+	client := &OpenAIClient{
+		apiKey: "test-key",
+		client: correlationClient(http.StatusBadRequest, "x-request-id", `{"error":{"message":"bad request"}}`, &sent),
+	}
+	
+	_, err := client.Query(context.Background(), "hello", "", QueryOptions{})
+	
+	var modelErr *myerrors.ModelError
+	if !errors.As(err, &modelErr) || modelErr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a 400 model error, got %v", err)
+	}
+	if sent.Get("X-Request-ID") != "" {
+		t.Errorf("Expected no X-Request-ID without a request ID in the context, got %q", sent.Get("X-Request-ID"))
+	}
+}
+
+func TestSetCorrelationHeadersTraceparent(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
+	setCorrelationHeaders(WithRequestID(ctx, "req-abc"), req)
+	
+	if got := req.Header.Get("traceparent"); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Unexpected traceparent %q", got)
+	}
+	if got := req.Header.Get("X-Request-ID"); got != "req-abc" {
+		t.Errorf("Expected X-Request-ID req-abc, got %q", got)
+	}
+}
+
+func TestProviderRequestIDUnknownProvider(t *testing.T) {
+	header := http.Header{}
+	header.Set("x-request-id", "abc")
+	
+	if id := providerRequestID(models.Gemini, header); id != "" {
+		t.Errorf("Expected no provider request ID for Gemini, got %q", id)
+	}
+}
@@ -26,6 +26,25 @@ type GeminiClient struct {
 type GeminiRequest struct {
 	Contents []GeminiContent `json:"contents"`
 	GenerationConfig GeminiGenerationConfig `json:"generationConfig"`
+	Tools      []GeminiTool      `json:"tools,omitempty"`
+	ToolConfig *GeminiToolConfig `json:"toolConfig,omitempty"`
+}
+
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type GeminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
 }
 
 type GeminiContent struct {
@@ -33,19 +52,32 @@ type GeminiContent struct {
 }
 
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text       string            `json:"text,omitempty"`
+	InlineData *GeminiInlineData `json:"inlineData,omitempty"`
+}
+
+type GeminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
 }
 
 type GeminiGenerationConfig struct {
 	Temperature float64 `json:"temperature"`
 	MaxOutputTokens int `json:"maxOutputTokens"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+	Seed *int `json:"seed,omitempty"`
+	TopP *float64 `json:"topP,omitempty"`
 }
 
 type GeminiResponse struct {
 	Candidates []struct {
 		Content struct {
 			Parts []struct {
-				Text string `json:"text"`
+				Text         string `json:"text"`
+				FunctionCall *struct {
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall,omitempty"`
 			} `json:"parts"`
 		} `json:"content"`
 		FinishReason string `json:"finishReason"`
@@ -72,29 +104,117 @@ func (c *GeminiClient) GetModelType() models.ModelType {
 	return models.Gemini
 }
 
-func (c *GeminiClient) Query(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func (c *GeminiClient) Query(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	if c.apiKey == "" {
 		return nil, myerrors.NewModelError(string(models.Gemini), 401, myerrors.ErrAPIKeyMissing, false)
 	}
 
-	modelVersion = ValidateModelVersion(models.Gemini, modelVersion)
+	modelVersion, err := ResolveModelVersion(models.Gemini, modelVersion, config.GetConfig().StrictModelVersion)
+	if err != nil {
+		return nil, err
+	}
 
-	retryFunc := func() (interface{}, error) {
-		return c.executeQuery(ctx, query, modelVersion)
+	if err := checkTools(models.Gemini, modelVersion, opts.Tools); err != nil {
+		return nil, err
 	}
 
-	result, err := retry.Do(ctx, retryFunc, retry.DefaultConfig)
-	if err != nil {
+	if err := checkImages(models.Gemini, modelVersion, opts.Images, false); err != nil {
 		return nil, err
 	}
 
-	return result.(*QueryResult), nil
+	queryOnce := func(ctx context.Context) (*QueryResult, error) {
+		retryFunc := func() (interface{}, error) {
+			return c.executeQuery(ctx, query, modelVersion, opts)
+		}
+		result, err := retry.Do(ctx, retryFunc, RetryConfig(models.Gemini))
+		if err != nil {
+			return nil, err
+		}
+		return result.(*QueryResult), nil
+	}
+
+	if opts.N > 1 {
+		return queryConcurrently(ctx, opts.N, queryOnce)
+	}
+
+	return queryOnce(ctx)
+}
+
+func newGeminiRequest(query string, opts QueryOptions) GeminiRequest {
+	return GeminiRequest{
+		Contents: []GeminiContent{
+			{
+				Parts: geminiParts(withCachePrefix(query, opts), opts.Images),
+			},
+		},
+		GenerationConfig: GeminiGenerationConfig{
+			Temperature: opts.temperature(models.Gemini),
+			MaxOutputTokens: opts.maxTokens(models.Gemini),
+			StopSequences: opts.Stop,
+			Seed: opts.Seed,
+			TopP: opts.TopP,
+		},
+		Tools:      geminiTools(opts.Tools),
+		ToolConfig: geminiToolConfig(opts.ToolChoice),
+	}
+}
+
+func geminiParts(query string, images []string) []GeminiPart {
+	parts := []GeminiPart{
+		{
+			Text: query,
+		},
+	}
+	
+	for _, image := range parseImages(images) {
+		parts = append(parts, GeminiPart{
+			InlineData: &GeminiInlineData{MimeType: image.MediaType, Data: image.Data},
+		})
+	}
+	return parts
 }
 
-func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func geminiTools(tools []models.ToolDefinition) []GeminiTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	
+	declarations := make([]GeminiFunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		declarations = append(declarations, GeminiFunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Parameters,
+		})
+	}
+	return []GeminiTool{{FunctionDeclarations: declarations}}
+}
+
+func geminiToolConfig(toolChoice string) *GeminiToolConfig {
+	if toolChoice == "" {
+		return nil
+	}
+	
+	toolConfig := &GeminiToolConfig{}
+	switch toolChoice {
+	case models.ToolChoiceAuto:
+		toolConfig.FunctionCallingConfig.Mode = "AUTO"
+	case models.ToolChoiceNone:
+		toolConfig.FunctionCallingConfig.Mode = "NONE"
+	case models.ToolChoiceRequired:
+		toolConfig.FunctionCallingConfig.Mode = "ANY"
+	default:
+		toolConfig.FunctionCallingConfig.Mode = "ANY"
+		toolConfig.FunctionCallingConfig.AllowedFunctionNames = []string{toolChoice}
+	}
+	return toolConfig
+}
+
+func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	startTime := time.Now()
 	result := &QueryResult{
-		NumRetries: 0,
+		NumRetries:   0,
+		ModelVersion: modelVersion,
 	}
 
 	if strings.HasPrefix(c.apiKey, "test_") {
@@ -113,21 +233,7 @@ func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVers
 		return result, nil
 	}
 
-	reqBody, err := json.Marshal(GeminiRequest{
-		Contents: []GeminiContent{
-			{
-				Parts: []GeminiPart{
-					{
-						Text: query,
-					},
-				},
-			},
-		},
-		GenerationConfig: GeminiGenerationConfig{
-			Temperature: 0.7,
-			MaxOutputTokens: 150,
-		},
-	})
+	reqBody, err := json.Marshal(newGeminiRequest(query, opts))
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.Gemini), 500, fmt.Errorf("error marshaling request: %v", err), false)
 	}
@@ -140,6 +246,9 @@ func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVers
 
 	req.Header.Set("Content-Type", "application/json")
 
+	setExtraHeaders(models.Gemini, req.Header)
+	setCorrelationHeaders(ctx, req)
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
@@ -149,6 +258,8 @@ func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVers
 	}
 	defer resp.Body.Close()
 
+	result.ProviderRequestID = providerRequestID(models.Gemini, resp.Header)
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.Gemini), 500, fmt.Errorf("error reading response: %v", err), false)
@@ -156,7 +267,7 @@ func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVers
 
 	var geminiResp GeminiResponse
 	err = json.Unmarshal(body, &geminiResp)
-	if err != nil {
+	if err != nil && resp.StatusCode == http.StatusOK {
 		return nil, myerrors.NewInvalidResponseError(string(models.Gemini), err)
 	}
 
@@ -164,6 +275,8 @@ func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVers
 	result.ResponseTime = time.Since(startTime).Milliseconds()
 
 	if resp.StatusCode != http.StatusOK {
+		logProviderError(ctx, models.Gemini, result.ProviderRequestID, resp.StatusCode)
+		
 		if resp.StatusCode == http.StatusTooManyRequests || geminiResp.Error.Code == 429 {
 			return nil, myerrors.NewRateLimitError(string(models.Gemini))
 		}
@@ -181,6 +294,15 @@ func (c *GeminiClient) executeQuery(ctx context.Context, query string, modelVers
 	}
 
 	result.Response = geminiResp.Candidates[0].Content.Parts[0].Text
+	for _, part := range geminiResp.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil {
+			result.ToolCalls = append(result.ToolCalls, models.ToolCall{
+				Name:      part.FunctionCall.Name,
+				Arguments: part.FunctionCall.Args,
+			})
+		}
+	}
+	result.FinishReason = geminiResp.Candidates[0].FinishReason
 	
 	if len(geminiResp.Candidates) > 0 && geminiResp.Candidates[0].TokenCount.TotalTokens > 0 {
 		result.TotalTokens = geminiResp.Candidates[0].TokenCount.TotalTokens
@@ -202,22 +324,10 @@ func (c *GeminiClient) CheckAvailability() bool {
 		return true
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models?key=%s", c.apiKey)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		logrus.WithError(err).Error("Error creating Gemini availability request")
-		return false
-	}
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		logrus.WithError(err).Error("Error checking Gemini availability")
-		return false
-	}
-	defer resp.Body.Close()
+	url, headers := c.availabilityProbe()
+	return checkAvailability(c.client, models.Gemini, url, headers)
+}
 
-	return resp.StatusCode == http.StatusOK
+func (c *GeminiClient) availabilityProbe() (string, map[string]string) {
+	return fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models?key=%s", c.apiKey), nil
 }
@@ -130,7 +130,7 @@ func TestGeminiClient_Query(t *testing.T) {
 				client: httpClient,
 			}
 			
-			result, err := client.Query(context.Background(), "Test query", "gemini-pro")
+			result, err := client.Query(context.Background(), "Test query", "gemini-pro", QueryOptions{})
 			
 			if tc.expectError {
 				if err == nil {
@@ -230,3 +230,108 @@ func TestGeminiClient_CheckAvailability(t *testing.T) {
 		})
 	}
 }
+
+func TestGeminiRequest_Stop(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stop     []string
+		expected bool
+	}{
+		{
+			name:     "Stop sequences set",
+			stop:     []string{"\n\n", "END"},
+			expected: true,
+		},
+		{
+			name:     "No stop sequences",
+			stop:     nil,
+			expected: false,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newGeminiRequest("test query", QueryOptions{Stop: tc.stop}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			generationConfig := decoded["generationConfig"].(map[string]interface{})
+			stop, found := generationConfig["stopSequences"]
+			if found != tc.expected {
+				t.Fatalf("Expected stopSequences present=%v, got %v in %s", tc.expected, found, body)
+			}
+			
+			if found && len(stop.([]interface{})) != len(tc.stop) {
+				t.Errorf("Expected %d stop sequences, got %v", len(tc.stop), stop)
+			}
+		})
+	}
+}
+
+func TestGeminiClient_ToolCalls(t *testing.T) {
+	var sent map[string]interface{}
+	httpClient := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&sent)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"candidates": [{
+							"content": {"parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+							"finishReason": "STOP"
+						}]
+					}`)),
+				}, nil
+			},
+		},
+	}
+	
+	client := &GeminiClient{apiKey: "test-key", client: httpClient}
+	opts := QueryOptions{
+		Tools:      []models.ToolDefinition{{Name: "get_weather", Parameters: json.RawMessage(`{"type":"object"}`)}},
+		ToolChoice: models.ToolChoiceAuto,
+	}
+	
+	result, err := client.Query(context.Background(), "Weather in Paris?", "gemini-1.5-pro", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	tools, ok := sent["tools"].([]interface{})
+	if !ok || len(tools) != 1 {
+		t.Fatalf("Expected 1 tool in request, got %v", sent["tools"])
+	}
+	declarations := tools[0].(map[string]interface{})["functionDeclarations"].([]interface{})
+	if len(declarations) != 1 || declarations[0].(map[string]interface{})["name"] != "get_weather" {
+		t.Errorf("Expected get_weather function declaration, got %v", declarations)
+	}
+	
+	toolConfig := sent["toolConfig"].(map[string]interface{})["functionCallingConfig"].(map[string]interface{})
+	if toolConfig["mode"] != "AUTO" {
+		t.Errorf("Expected AUTO mode, got %v", toolConfig["mode"])
+	}
+	
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Name != "get_weather" || string(result.ToolCalls[0].Arguments) != `{"city": "Paris"}` {
+		t.Errorf("Unexpected tool calls: %+v", result.ToolCalls)
+	}
+}
+
+func TestGeminiRequest_Images(t *testing.T) {
+	request := newGeminiRequest("Describe this", QueryOptions{Images: []string{testPNG}})
+	
+	parts := request.Contents[0].Parts
+	if len(parts) != 2 || parts[0].Text != "Describe this" || parts[1].InlineData == nil {
+		t.Fatalf("Unexpected parts: %+v", parts)
+	}
+	
+	if parts[1].InlineData.MimeType != "image/png" || parts[1].InlineData.Data != testPNG {
+		t.Errorf("Unexpected inline data: %+v", parts[1].InlineData)
+	}
+}
@@ -2,9 +2,20 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	myerrors "github.com/amorin24/llmproxy/pkg/errors"
 	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/retry"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -48,27 +59,80 @@ var SupportedModelVersions = map[models.ModelType][]string{
 	},
 }
 
+var builtinDefaultVersions = map[models.ModelType]string{
+	models.OpenAI:  DefaultOpenAIVersion,
+	models.Gemini:  DefaultGeminiVersion,
+	models.Mistral: DefaultMistralVersion,
+	models.Claude:  DefaultClaudeVersion,
+}
+
 func ValidateModelVersion(modelType models.ModelType, version string) string {
-	if version == "" {
-		switch modelType {
-		case models.OpenAI:
-			return DefaultOpenAIVersion
-		case models.Gemini:
-			return DefaultGeminiVersion
-		case models.Mistral:
-			return DefaultMistralVersion
-		case models.Claude:
-			return DefaultClaudeVersion
-		}
+	if version != "" && isSupportedVersion(modelType, version) {
+		return version
+	}
+
+	return DefaultModelVersion(modelType)
+}
+
+func DefaultModelVersion(modelType models.ModelType) string {
+	if version, ok := config.GetConfig().DefaultModelVersions[modelType]; ok && isSupportedVersion(modelType, version) {
+		return version
 	}
 
+	return builtinDefaultVersions[modelType]
+}
+
+func isSupportedVersion(modelType models.ModelType, version string) bool {
 	for _, supportedVersion := range SupportedModelVersions[modelType] {
 		if version == supportedVersion {
-			return version
+			return true
+		}
+	}
+	return false
+}
+
+func RetryConfig(modelType models.ModelType) retry.Config {
+	cfg := retry.DefaultConfig
+	cfg.RetryableStatusCodes = config.GetConfig().RetryableStatusCodes
+	if maxRetries, ok := config.GetConfig().ModelMaxRetries[modelType]; ok {
+		cfg.MaxRetries = maxRetries
+	}
+	
+	return cfg
+}
+
+func setExtraHeaders(modelType models.ModelType, header http.Header) {
+	for name, value := range config.GetConfig().ProviderExtraHeaders[modelType] {
+		header.Set(name, value)
+	}
+}
+
+func LogDefaultModelVersions() {
+	configured := config.GetConfig().DefaultModelVersions
+
+	for _, modelType := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		if version, ok := configured[modelType]; ok && !isSupportedVersion(modelType, version) {
+			logrus.WithFields(logrus.Fields{
+				"model":            string(modelType),
+				"configured":       version,
+				"builtin_default":  builtinDefaultVersions[modelType],
+			}).Warn("Configured default model version is not supported, using built-in default")
 		}
+
+		logrus.WithFields(logrus.Fields{
+			"model":           string(modelType),
+			"default_version": DefaultModelVersion(modelType),
+		}).Info("Resolved default model version")
 	}
+}
 
-	return ValidateModelVersion(modelType, "")
+func ResolveModelVersion(modelType models.ModelType, version string, strict bool) (string, error) {
+	resolved := ValidateModelVersion(modelType, version)
+	if strict && version != "" && resolved != version {
+		return "", myerrors.NewUnsupportedModelVersionError(string(modelType), version)
+	}
+
+	return resolved, nil
 }
 
 type QueryResult struct {
@@ -80,16 +144,357 @@ type QueryResult struct {
 	TotalTokens     int
 	NumTokens       int // Deprecated: Use TotalTokens instead
 	NumRetries      int
+	FinishReason    string
+	ModelVersion    string
+	ProviderRequestID string // Request ID reported by the provider, for support tickets
+	CacheReadTokens  int
+	CacheWriteTokens int
+	ToolCalls       []models.ToolCall
+	Candidates      []string // All completions when more than one was requested
 	Error           error
 }
 
+type QueryOptions struct {
+	Stop       []string
+	Tools      []models.ToolDefinition
+	ToolChoice string
+	Images     []string
+	N          int // Number of completions, 0 or 1 for a single one
+	Seed       *int
+	TopP             *float64
+	FrequencyPenalty *float64
+	PresencePenalty  *float64
+	Temperature      *float64 // Nil uses the model's configured default
+	MaxTokens        *int     // Nil uses the model's configured default
+	CachePrefix      string   // Sent before the query and marked cacheable where the provider supports it
+}
+
+const (
+	defaultTemperature = 0.7
+	defaultMaxTokens   = 150
+)
+
+func (opts QueryOptions) temperature(modelType models.ModelType) float64 {
+	if opts.Temperature != nil {
+		return *opts.Temperature
+	}
+	if defaults, ok := config.GetConfig().ModelDefaults[modelType]; ok && defaults.Temperature != nil {
+		return *defaults.Temperature
+	}
+	return defaultTemperature
+}
+
+func (opts QueryOptions) maxTokens(modelType models.ModelType) int {
+	if opts.MaxTokens != nil {
+		return *opts.MaxTokens
+	}
+	if defaults, ok := config.GetConfig().ModelDefaults[modelType]; ok && defaults.MaxTokens != nil {
+		return *defaults.MaxTokens
+	}
+	return defaultMaxTokens
+}
+
+func withCachePrefix(query string, opts QueryOptions) string {
+	if opts.CachePrefix == "" {
+		return query
+	}
+	return opts.CachePrefix + "\n\n" + query
+}
+
+func numCompletions(n int) int {
+	if n > 1 {
+		return n
+	}
+	return 0
+}
+
+// queryConcurrently runs n completions in parallel. The first failure cancels the
+// rest; completions that already finished are still returned alongside the error
+// so their usage can be billed.
+func queryConcurrently(ctx context.Context, n int, query func(ctx context.Context) (*QueryResult, error)) (*QueryResult, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", n)
+	}
+	
+	results := make([]*QueryResult, n)
+	group, groupCtx := errgroup.WithContext(ctx)
+	for i := 0; i < n; i++ {
+		group.Go(func() error {
+			result, err := query(groupCtx)
+			if err != nil {
+				return err
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	
+	if err := group.Wait(); err != nil {
+		var completed []*QueryResult
+		for _, result := range results {
+			if result != nil {
+				completed = append(completed, result)
+			}
+		}
+		if len(completed) == 0 {
+			return nil, err
+		}
+		return mergeCandidates(completed), err
+	}
+	
+	return mergeCandidates(results), nil
+}
+
+func mergeCandidates(results []*QueryResult) *QueryResult {
+	merged := *results[0]
+	merged.Candidates = make([]string, 0, len(results))
+	
+	for i, result := range results {
+		merged.Candidates = append(merged.Candidates, result.Response)
+		if i == 0 {
+			continue
+		}
+		
+		merged.InputTokens += result.InputTokens
+		merged.OutputTokens += result.OutputTokens
+		merged.TotalTokens += result.TotalTokens
+		merged.NumTokens += result.NumTokens
+		merged.CacheReadTokens += result.CacheReadTokens
+		merged.CacheWriteTokens += result.CacheWriteTokens
+		merged.NumRetries += result.NumRetries
+		if result.ResponseTime > merged.ResponseTime {
+			merged.ResponseTime = result.ResponseTime
+		}
+	}
+	
+	return &merged
+}
+
+var ContextWindows = map[string]int{
+	"gpt-4.1":                        1047576,
+	"gpt-4o":                         128000,
+	"gpt-4-turbo":                    128000,
+	"gpt-4":                          8192,
+	"gpt-3.5-turbo":                  16385,
+	"o4-mini":                        200000,
+	"o3":                             200000,
+	"gemini-2.5-flash-preview-04-17": 1048576,
+	"gemini-2.5-pro-preview-03-25":   1048576,
+	"gemini-2.0-flash":               1048576,
+	"gemini-2.0-flash-lite":          1048576,
+	"gemini-1.5-flash":               1048576,
+	"gemini-1.5-flash-8b":            1048576,
+	"gemini-1.5-pro":                 2097152,
+	"gemini-pro":                     32760,
+	"gemini-pro-vision":              16384,
+	"mistral-small-latest":           32000,
+	"mistral-medium-latest":          128000,
+	"mistral-large-latest":           128000,
+	"codestral-latest":               256000,
+	"claude-3-haiku-20240307":        200000,
+	"claude-3-sonnet-20240229":       200000,
+	"claude-3-opus-20240229":         200000,
+}
+
+func CheckContextWindow(modelType models.ModelType, version string, query string) error {
+	version = ValidateModelVersion(modelType, version)
+	
+	window := ModelCapabilities(modelType, version).ContextWindow
+	if window == 0 {
+		return nil
+	}
+	
+	if tokens := EstimateTokenCount(query); tokens > window {
+		return myerrors.NewContextWindowExceededError(string(modelType), version, tokens, window)
+	}
+	
+	return nil
+}
+
+// TruncateToContextWindow shortens query so prefix+query+suffix fits the model's window next to
+// the max_tokens output budget. prefix and suffix (tenant prompt wrapper, cache prefix) are never
+// cut; when they and max_tokens leave no room for the query, a context window error is returned.
+func TruncateToContextWindow(modelType models.ModelType, version string, prefix, query, suffix string, opts QueryOptions, keepTail bool) (string, bool, error) {
+	version = ValidateModelVersion(modelType, version)
+	
+	window := ModelCapabilities(modelType, version).ContextWindow
+	if window == 0 {
+		return query, false, nil
+	}
+	
+	budget := window - opts.maxTokens(modelType)
+	if budget <= EstimateTokenCount(prefix+suffix) {
+		return query, false, myerrors.NewModelError(string(modelType), 400, fmt.Errorf("%w: max_tokens %d leaves no room for the query, %s accepts %d", myerrors.ErrContextWindowExceeded, opts.maxTokens(modelType), version, window), false)
+	}
+	if EstimateTokenCount(prefix+query+suffix) <= budget {
+		return query, false, nil
+	}
+	
+	runes := []rune(query)
+	keep := func(n int) string {
+		if keepTail {
+			return string(runes[len(runes)-n:])
+		}
+		return string(runes[:n])
+	}
+	
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if EstimateTokenCount(prefix+keep(mid)+suffix) <= budget {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	
+	return keep(low), true, nil
+}
+
+var textOnlyModelVersions = map[string]bool{
+	"gpt-3.5-turbo": true,
+	"gpt-4":         true,
+	"gemini-pro":    true,
+}
+
+func SupportsImages(modelType models.ModelType, version string) bool {
+	return ModelCapabilities(modelType, version).SupportsVision
+}
+
+type imageInput struct {
+	URL       string // Remote image
+	MediaType string // Inline images only
+	Data      string // Base64 data of inline images
+}
+
+func (i imageInput) dataURL() string {
+	if i.URL != "" {
+		return i.URL
+	}
+	return "data:" + i.MediaType + ";base64," + i.Data
+}
+
+func ValidateImage(image string) error {
+	_, err := parseImage(image)
+	return err
+}
+
+func parseImage(image string) (imageInput, error) {
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		return imageInput{URL: image}, nil
+	}
+	
+	data := image
+	mediaType := ""
+	if strings.HasPrefix(image, "data:") {
+		header, payload, found := strings.Cut(strings.TrimPrefix(image, "data:"), ",")
+		if !found || !strings.HasSuffix(header, ";base64") {
+			return imageInput{}, errors.New("image data URL must be base64 encoded")
+		}
+		mediaType = strings.TrimSuffix(header, ";base64")
+		data = payload
+	}
+	
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return imageInput{}, errors.New("image must be a URL or base64 encoded data")
+	}
+	
+	if mediaType == "" {
+		mediaType = http.DetectContentType(decoded)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return imageInput{}, fmt.Errorf("unsupported image type: %s", mediaType)
+	}
+	
+	return imageInput{MediaType: mediaType, Data: data}, nil
+}
+
+func parseImages(images []string) []imageInput {
+	var inputs []imageInput
+	for _, image := range images {
+		if input, err := parseImage(image); err == nil {
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+func checkImages(modelType models.ModelType, version string, images []string, allowURLs bool) error {
+	if len(images) == 0 {
+		return nil
+	}
+	
+	if !SupportsImages(modelType, version) {
+		return myerrors.NewModelError(string(modelType), 400, fmt.Errorf("%w: %s", myerrors.ErrImagesUnsupported, version), false)
+	}
+	
+	for _, image := range images {
+		input, err := parseImage(image)
+		if err != nil {
+			return myerrors.NewModelError(string(modelType), 400, err, false)
+		}
+		if input.URL != "" && !allowURLs {
+			return myerrors.NewModelError(string(modelType), 400, fmt.Errorf("%w: image URLs, send base64 data instead", myerrors.ErrImagesUnsupported), false)
+		}
+	}
+	
+	return nil
+}
+
 type Client interface {
-	Query(ctx context.Context, query string, modelVersion string) (*QueryResult, error)
+	// Query may return a partial result with an error when some of several
+	// completions (QueryOptions.N) finished before another failed.
+	Query(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error)
 	CheckAvailability() bool
 	GetModelType() models.ModelType
 }
 
+type pooledClient struct {
+	client        Client
+	keyGeneration uint64
+}
+
+var (
+	clientPool      = make(map[models.ModelType]pooledClient)
+	clientPoolMutex sync.RWMutex
+)
+
 var Factory = func(modelType models.ModelType) (Client, error) {
+	return getPooledClient(modelType)
+}
+
+func getPooledClient(modelType models.ModelType) (Client, error) {
+	generation := config.GetConfig().KeyGeneration()
+	
+	clientPoolMutex.RLock()
+	pooled, ok := clientPool[modelType]
+	clientPoolMutex.RUnlock()
+	
+	if ok && pooled.keyGeneration == generation {
+		return pooled.client, nil
+	}
+	
+	client, err := newClient(modelType)
+	if err != nil {
+		return nil, err
+	}
+	
+	clientPoolMutex.Lock()
+	clientPool[modelType] = pooledClient{client: client, keyGeneration: generation}
+	clientPoolMutex.Unlock()
+	
+	return client, nil
+}
+
+func resetClientPool() {
+	clientPoolMutex.Lock()
+	defer clientPoolMutex.Unlock()
+	
+	clientPool = make(map[models.ModelType]pooledClient)
+}
+
+func newClient(modelType models.ModelType) (Client, error) {
 	switch modelType {
 	case models.OpenAI:
 		return NewOpenAIClient(), nil
@@ -103,6 +508,28 @@ var Factory = func(modelType models.ModelType) (Client, error) {
 		return nil, myerrors.NewModelError(string(modelType), 400, myerrors.ErrUnavailable, false)
 	}
 }
+
+func IsTruncated(finishReason string) bool {
+	switch strings.ToLower(finishReason) {
+	case "length", "max_tokens":
+		return true
+	}
+	return false
+}
+
+func toolArguments(arguments string) json.RawMessage {
+	if arguments == "" {
+		return json.RawMessage("{}")
+	}
+	
+	if json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	
+	encoded, _ := json.Marshal(arguments)
+	return encoded
+}
+
 func EstimateTokenCount(text string) int {
 	if text == "" {
 		return 0
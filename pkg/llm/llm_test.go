@@ -3,12 +3,17 @@ package llm
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	myerrors "github.com/amorin24/llmproxy/pkg/errors"
 	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/retry"
 )
 
 func isRetryableError(err error) bool {
@@ -33,7 +38,7 @@ func QueryWithTimeout(client Client, query string, modelVersion string, timeout
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	
-	return client.Query(ctx, query, modelVersion)
+	return client.Query(ctx, query, modelVersion, QueryOptions{})
 }
 
 func TestEstimateTokens(t *testing.T) {
@@ -242,6 +247,67 @@ func TestFactory(t *testing.T) {
 	}
 }
 
+func TestFactoryReusesClients(t *testing.T) {
+	resetClientPool()
+	defer resetClientPool()
+	
+	first, err := Factory(models.OpenAI)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	second, err := Factory(models.OpenAI)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if first != second {
+		t.Errorf("Expected the same client instance to be reused")
+	}
+	
+	cfg := config.GetConfig()
+	originalKey, _ := cfg.GetAPIKey("openai")
+	defer cfg.SetAPIKey("openai", originalKey)
+	
+	if err := cfg.RotateAPIKey("openai", "sk-rotated1234567890abcdefghijklmnopqrstuvwxyzABCD"); err != nil {
+		t.Fatalf("Error rotating key: %v", err)
+	}
+	
+	rotated, err := Factory(models.OpenAI)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if rotated == first {
+		t.Errorf("Expected a new client after key rotation")
+	}
+	
+	if rotated.(*OpenAIClient).apiKey != "sk-rotated1234567890abcdefghijklmnopqrstuvwxyzABCD" {
+		t.Errorf("Expected new client to use the rotated key")
+	}
+}
+
+func BenchmarkFactoryPooled(b *testing.B) {
+	resetClientPool()
+	b.ReportAllocs()
+	
+	for i := 0; i < b.N; i++ {
+		if _, err := Factory(models.OpenAI); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFactoryUnpooled(b *testing.B) {
+	b.ReportAllocs()
+	
+	for i := 0; i < b.N; i++ {
+		if _, err := newClient(models.OpenAI); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 type MockClient struct {
 	GetModelTypeFunc func() models.ModelType
 	QueryFunc        func(ctx context.Context, query string, modelVersion string) (*QueryResult, error)
@@ -252,7 +318,7 @@ func (m *MockClient) GetModelType() models.ModelType {
 	return m.GetModelTypeFunc()
 }
 
-func (m *MockClient) Query(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func (m *MockClient) Query(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	return m.QueryFunc(ctx, query, modelVersion)
 }
 
@@ -355,3 +421,514 @@ func TestEstimateTokenCount(t *testing.T) {
 		})
 	}
 }
+
+func TestIsTruncated(t *testing.T) {
+	testCases := []struct {
+		finishReason string
+		expected     bool
+	}{
+		{"length", true},      // OpenAI, Mistral
+		{"MAX_TOKENS", true},  // Gemini
+		{"max_tokens", true},  // Claude
+		{"stop", false},
+		{"STOP", false},
+		{"end_turn", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.finishReason, func(t *testing.T) {
+			if result := IsTruncated(tc.finishReason); result != tc.expected {
+				t.Errorf("Expected IsTruncated(%q) = %v, got %v", tc.finishReason, tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestResolveModelVersion(t *testing.T) {
+	testCases := []struct {
+		name        string
+		version     string
+		strict      bool
+		expected    string
+		expectError bool
+	}{
+		{"Supported version", "gpt-4o", false, "gpt-4o", false},
+		{"Supported version strict", "gpt-4o", true, "gpt-4o", false},
+		{"Empty version uses default", "", false, DefaultOpenAIVersion, false},
+		{"Empty version strict uses default", "", true, DefaultOpenAIVersion, false},
+		{"Unsupported version falls back", "gpt-4oo", false, DefaultOpenAIVersion, false},
+		{"Unsupported version strict", "gpt-4oo", true, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := ResolveModelVersion(models.OpenAI, tc.version, tc.strict)
+			if tc.expectError {
+				var modelErr *myerrors.ModelError
+				if !errors.As(err, &modelErr) || modelErr.Code != 400 || !errors.Is(err, myerrors.ErrUnsupportedModelVersion) {
+					t.Fatalf("Expected unsupported model version error with code 400, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if version != tc.expected {
+				t.Errorf("Expected version %q, got %q", tc.expected, version)
+			}
+		})
+	}
+}
+
+func TestQueryConcurrently(t *testing.T) {
+	var mutex sync.Mutex
+	calls := 0
+	query := func(ctx context.Context) (*QueryResult, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		return &QueryResult{
+			Response:     fmt.Sprintf("candidate %d", calls),
+			InputTokens:  10,
+			OutputTokens: 5,
+			TotalTokens:  15,
+			NumTokens:    15,
+		}, nil
+	}
+
+	result, err := queryConcurrently(context.Background(), 3, query)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(result.Candidates) != 3 {
+		t.Fatalf("Expected 3 candidates, got %d", len(result.Candidates))
+	}
+	if result.Response != result.Candidates[0] {
+		t.Errorf("Expected response %q to match the first candidate %q", result.Response, result.Candidates[0])
+	}
+	if result.InputTokens != 30 || result.OutputTokens != 15 || result.TotalTokens != 45 {
+		t.Errorf("Expected aggregated tokens 30/15/45, got %d/%d/%d", result.InputTokens, result.OutputTokens, result.TotalTokens)
+	}
+
+	failing := func(ctx context.Context) (*QueryResult, error) {
+		return nil, myerrors.NewRateLimitError(string(models.Claude))
+	}
+	if _, err := queryConcurrently(context.Background(), 2, failing); !errors.Is(err, myerrors.ErrRateLimit) {
+		t.Errorf("Expected rate limit error, got %v", err)
+	}
+
+	if _, err := queryConcurrently(context.Background(), 0, query); err == nil {
+		t.Error("Expected error for zero concurrency, got nil")
+	}
+
+	var started sync.WaitGroup
+	started.Add(3)
+	mixed := func(ctx context.Context) (*QueryResult, error) {
+		mutex.Lock()
+		calls++
+		call := calls
+		mutex.Unlock()
+		started.Done()
+
+		switch call % 3 {
+		case 0:
+			return &QueryResult{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}, nil
+		case 1:
+			started.Wait()
+			return nil, myerrors.NewRateLimitError(string(models.Claude))
+		default:
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+	}
+	calls = 0
+	result, err = queryConcurrently(context.Background(), 3, mixed)
+	if !errors.Is(err, myerrors.ErrRateLimit) {
+		t.Fatalf("Expected rate limit error after canceling siblings, got %v", err)
+	}
+	if result == nil || result.InputTokens != 10 || result.OutputTokens != 5 {
+		t.Errorf("Expected usage of the completed sibling alongside the error, got %+v", result)
+	}
+}
+
+func TestCheckContextWindow(t *testing.T) {
+	testCases := []struct {
+		name        string
+		modelType   models.ModelType
+		version     string
+		query       string
+		expectError bool
+	}{
+		{"Short query", models.OpenAI, "gpt-4", "Hello", false},
+		{"Query exceeds window", models.OpenAI, "gpt-4", strings.Repeat("a", 4*8192+4), true},
+		{"Query fits larger window", models.OpenAI, "gpt-4o", strings.Repeat("a", 4*8192+4), false},
+		{"Unknown model", models.ModelType("unknown"), "", strings.Repeat("a", 4*8192+4), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckContextWindow(tc.modelType, tc.version, tc.query)
+			if tc.expectError {
+				var modelErr *myerrors.ModelError
+				if !errors.As(err, &modelErr) || modelErr.Code != 400 || !errors.Is(err, myerrors.ErrContextWindowExceeded) {
+					t.Fatalf("Expected context window error with code 400, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTruncateToContextWindow(t *testing.T) {
+	maxTokens := 8000
+	opts := QueryOptions{MaxTokens: &maxTokens}
+	query := "HEAD" + strings.Repeat("a", 4*8192) + "TAIL"
+	
+	t.Run("Fits", func(t *testing.T) {
+		got, truncated, _ := TruncateToContextWindow(models.OpenAI, "gpt-4", "", "Hello", "", opts, false)
+		if truncated || got != "Hello" {
+			t.Errorf("Expected query unchanged, got %q (truncated=%v)", got, truncated)
+		}
+	})
+	
+	t.Run("Truncate tail", func(t *testing.T) {
+		got, truncated, _ := TruncateToContextWindow(models.OpenAI, "gpt-4", "", query, "", opts, false)
+		if !truncated {
+			t.Fatal("Expected query to be truncated")
+		}
+		if !strings.HasPrefix(got, "HEAD") || strings.HasSuffix(got, "TAIL") {
+			t.Errorf("Expected the start of the query to be kept")
+		}
+		if tokens := EstimateTokenCount(got); tokens > 8192-maxTokens {
+			t.Errorf("Expected at most %d tokens, got %d", 8192-maxTokens, tokens)
+		}
+	})
+	
+	t.Run("Truncate head", func(t *testing.T) {
+		got, truncated, _ := TruncateToContextWindow(models.OpenAI, "gpt-4", "", query, "", opts, true)
+		if !truncated {
+			t.Fatal("Expected query to be truncated")
+		}
+		if strings.HasPrefix(got, "HEAD") || !strings.HasSuffix(got, "TAIL") {
+			t.Errorf("Expected the end of the query to be kept")
+		}
+		if tokens := EstimateTokenCount(got); tokens > 8192-maxTokens {
+			t.Errorf("Expected at most %d tokens, got %d", 8192-maxTokens, tokens)
+		}
+	})
+	
+	t.Run("Unknown model", func(t *testing.T) {
+		got, truncated, _ := TruncateToContextWindow(models.ModelType("unknown"), "", "", query, "", opts, false)
+		if truncated || got != query {
+			t.Errorf("Expected query unchanged for unknown model")
+		}
+	})
+	
+	t.Run("Prefix and suffix count against the budget", func(t *testing.T) {
+		prefix, suffix := strings.Repeat("p", 4*100), "\n\nThanks."
+		got, truncated, err := TruncateToContextWindow(models.OpenAI, "gpt-4", prefix, query, suffix, opts, true)
+		if err != nil || !truncated {
+			t.Fatalf("Expected query to be truncated, got %v", err)
+		}
+		if tokens := EstimateTokenCount(prefix + got + suffix); tokens > 8192-maxTokens {
+			t.Errorf("Expected at most %d tokens with the prefix and suffix, got %d", 8192-maxTokens, tokens)
+		}
+	})
+	
+	t.Run("No room for the query", func(t *testing.T) {
+		maxTokens := 8192
+		_, _, err := TruncateToContextWindow(models.OpenAI, "gpt-4", "", query, "", QueryOptions{MaxTokens: &maxTokens}, false)
+		if !errors.Is(err, myerrors.ErrContextWindowExceeded) {
+			t.Errorf("Expected a context window error when max_tokens fills the window, got %v", err)
+		}
+	})
+}
+
+func TestDefaultModelVersion(t *testing.T) {
+	cfg := config.GetConfig()
+	original := cfg.DefaultModelVersions
+	defer func() { cfg.DefaultModelVersions = original }()
+
+	cfg.DefaultModelVersions = map[models.ModelType]string{
+		models.OpenAI: "gpt-4o",
+		models.Claude: "claude-unknown",
+	}
+
+	testCases := []struct {
+		name      string
+		modelType models.ModelType
+		version   string
+		expected  string
+	}{
+		{"Configured default", models.OpenAI, "", "gpt-4o"},
+		{"Configured default for unsupported version", models.OpenAI, "gpt-4oo", "gpt-4o"},
+		{"Explicit version wins", models.OpenAI, "gpt-4", "gpt-4"},
+		{"Unsupported configured default", models.Claude, "", DefaultClaudeVersion},
+		{"No configured default", models.Gemini, "", DefaultGeminiVersion},
+		{"Unknown model", models.ModelType("unknown"), "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if version := ValidateModelVersion(tc.modelType, tc.version); version != tc.expected {
+				t.Errorf("Expected version %q, got %q", tc.expected, version)
+			}
+		})
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	cfg := config.GetConfig()
+	original, originalCodes := cfg.ModelMaxRetries, cfg.RetryableStatusCodes
+	defer func() { cfg.ModelMaxRetries, cfg.RetryableStatusCodes = original, originalCodes }()
+
+	cfg.RetryableStatusCodes = []int{529}
+	cfg.ModelMaxRetries = map[models.ModelType]int{
+		models.OpenAI: 0,
+		models.Claude: 6,
+	}
+
+	testCases := []struct {
+		name      string
+		modelType models.ModelType
+		expected  int
+	}{
+		{"Fewer retries", models.OpenAI, 0},
+		{"More retries", models.Claude, 6},
+		{"No override", models.Gemini, retry.DefaultConfig.MaxRetries},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retryConfig := RetryConfig(tc.modelType)
+			if retryConfig.MaxRetries != tc.expected {
+				t.Errorf("Expected %d max retries, got %d", tc.expected, retryConfig.MaxRetries)
+			}
+			if retryConfig.InitialBackoff != retry.DefaultConfig.InitialBackoff {
+				t.Errorf("Expected default backoff to be kept, got %v", retryConfig.InitialBackoff)
+			}
+			if len(retryConfig.RetryableStatusCodes) != 1 || retryConfig.RetryableStatusCodes[0] != 529 {
+				t.Errorf("Expected configured retryable status codes, got %v", retryConfig.RetryableStatusCodes)
+			}
+		})
+	}
+}
+
+func TestNonJSONErrorResponses(t *testing.T) {
+	const page = "<html><body>502 Bad Gateway</body></html>"
+	type executor interface {
+		executeQuery(context.Context, string, string, QueryOptions) (*QueryResult, error)
+	}
+	clients := map[models.ModelType]func(*http.Client) executor{
+		models.OpenAI: func(c *http.Client) executor {
+			return &OpenAIClient{apiKey: "test-key", client: c}
+		},
+		models.Claude: func(c *http.Client) executor {
+			return &ClaudeClient{apiKey: "test-key", client: c}
+		},
+		models.Gemini: func(c *http.Client) executor {
+			return &GeminiClient{apiKey: "test-key", client: c}
+		},
+		models.Mistral: func(c *http.Client) executor {
+			return &MistralClient{apiKey: "test-key", client: c}
+		},
+	}
+	
+	for modelType, newClient := range clients {
+		for _, tc := range []struct {
+			statusCode int
+			retryable  bool
+		}{
+			{http.StatusBadGateway, true},
+			{http.StatusConflict, false},
+		} {
+			t.Run(fmt.Sprintf("%s %d", modelType, tc.statusCode), func(t *testing.T) {
+				var sent http.Header
+				client := newClient(correlationClient(tc.statusCode, "", page, &sent))
+				_, err := client.executeQuery(context.Background(), "hello", "", QueryOptions{})
+				
+				var modelErr *myerrors.ModelError
+				if !errors.As(err, &modelErr) {
+					t.Fatalf("Expected ModelError, got %v", err)
+				}
+				if modelErr.Code != tc.statusCode || modelErr.Retryable != tc.retryable {
+					t.Errorf("Expected code %d retryable=%v, got code %d retryable=%v", tc.statusCode, tc.retryable, modelErr.Code, modelErr.Retryable)
+				}
+				if errors.Is(err, myerrors.ErrInvalidResponse) {
+					t.Errorf("Expected the upstream status rather than an invalid response error, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestQueryOptionsModelDefaults(t *testing.T) {
+	cfg := config.GetConfig()
+	original := cfg.ModelDefaults
+	defer func() { cfg.ModelDefaults = original }()
+
+	claudeMaxTokens, openAITemperature := 1024, 0.2
+	cfg.ModelDefaults = map[models.ModelType]config.ModelDefaults{
+		models.Claude: {MaxTokens: &claudeMaxTokens},
+		models.OpenAI: {Temperature: &openAITemperature},
+	}
+
+	requestTemperature, requestMaxTokens := 1.0, 50
+	testCases := []struct {
+		name                string
+		modelType           models.ModelType
+		opts                QueryOptions
+		expectedTemperature float64
+		expectedMaxTokens   int
+	}{
+		{"Model max tokens", models.Claude, QueryOptions{}, defaultTemperature, 1024},
+		{"Model temperature", models.OpenAI, QueryOptions{}, 0.2, defaultMaxTokens},
+		{"Built-in defaults", models.Gemini, QueryOptions{}, defaultTemperature, defaultMaxTokens},
+		{"Request overrides", models.Claude, QueryOptions{Temperature: &requestTemperature, MaxTokens: &requestMaxTokens}, 1.0, 50},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if temperature := tc.opts.temperature(tc.modelType); temperature != tc.expectedTemperature {
+				t.Errorf("Expected temperature %g, got %g", tc.expectedTemperature, temperature)
+			}
+			if maxTokens := tc.opts.maxTokens(tc.modelType); maxTokens != tc.expectedMaxTokens {
+				t.Errorf("Expected max tokens %d, got %d", tc.expectedMaxTokens, maxTokens)
+			}
+		})
+	}
+
+	request := newClaudeRequest("test query", "claude-3-haiku-20240307", QueryOptions{})
+	if request.MaxTokens != 1024 || request.Temperature != defaultTemperature {
+		t.Errorf("Expected claude request to use model defaults, got temperature %g and max tokens %d", request.Temperature, request.MaxTokens)
+	}
+}
+
+const testPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+func TestParseImage(t *testing.T) {
+	testCases := []struct {
+		name          string
+		image         string
+		expectError   bool
+		expectedURL   string
+		expectedMedia string
+	}{
+		{"Remote URL", "https://example.com/cat.png", false, "https://example.com/cat.png", ""},
+		{"Raw base64", testPNG, false, "", "image/png"},
+		{"Data URL", "data:image/jpeg;base64," + testPNG, false, "", "image/jpeg"},
+		{"Data URL without base64", "data:image/png,abc", true, "", ""},
+		{"Invalid base64", "not an image!", true, "", ""},
+		{"Non-image data", "aGVsbG8gd29ybGQ=", true, "", ""},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := parseImage(tc.image)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", input)
+				}
+				return
+			}
+			
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if input.URL != tc.expectedURL || input.MediaType != tc.expectedMedia {
+				t.Errorf("Expected URL %q and media type %q, got %+v", tc.expectedURL, tc.expectedMedia, input)
+			}
+		})
+	}
+}
+
+func TestCheckImages(t *testing.T) {
+	testCases := []struct {
+		name        string
+		modelType   models.ModelType
+		version     string
+		images      []string
+		allowURLs   bool
+		expectError bool
+	}{
+		{"No images", models.Mistral, "mistral-small-latest", nil, false, false},
+		{"Vision model", models.OpenAI, "gpt-4o", []string{testPNG}, true, false},
+		{"Text-only model", models.OpenAI, "gpt-3.5-turbo", []string{testPNG}, true, true},
+		{"Text-only provider", models.Mistral, "mistral-small-latest", []string{testPNG}, false, true},
+		{"URL not allowed", models.Gemini, "gemini-1.5-pro", []string{"https://example.com/cat.png"}, false, true},
+		{"URL allowed", models.Claude, "claude-3-haiku-20240307", []string{"https://example.com/cat.png"}, true, false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkImages(tc.modelType, tc.version, tc.images, tc.allowURLs)
+			if !tc.expectError {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			
+			var modelErr *myerrors.ModelError
+			if !errors.As(err, &modelErr) || modelErr.Code != 400 || !errors.Is(err, myerrors.ErrImagesUnsupported) {
+				t.Errorf("Expected images unsupported error with code 400, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProviderExtraHeaders(t *testing.T) {
+	cfg := config.GetConfig()
+	originalHeaders := cfg.ProviderExtraHeaders
+	defer func() { cfg.ProviderExtraHeaders = originalHeaders }()
+	cfg.ProviderExtraHeaders = map[models.ModelType]map[string]string{
+		models.OpenAI: {"Openai-Organization": "org-123", "Openai-Project": "proj-456"},
+		models.Claude: {"Anthropic-Beta": "tools-2024-04-04"},
+	}
+	
+	t.Run("OpenAI", func(t *testing.T) {
+		var sent http.Header
+		client := &OpenAIClient{apiKey: "test-key", client: correlationClient(http.StatusOK, "", `{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`, &sent)}
+		if _, err := client.Query(context.Background(), "hello", "", QueryOptions{}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if sent.Get("OpenAI-Organization") != "org-123" || sent.Get("OpenAI-Project") != "proj-456" {
+			t.Errorf("Expected configured headers to be sent, got %v", sent)
+		}
+		if sent.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Expected the auth header to be untouched, got %q", sent.Get("Authorization"))
+		}
+	})
+	
+	t.Run("Claude", func(t *testing.T) {
+		var sent http.Header
+		client := &ClaudeClient{apiKey: "test-key", client: correlationClient(http.StatusOK, "", `{"content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn"}`, &sent)}
+		if _, err := client.Query(context.Background(), "hello", "", QueryOptions{}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if sent.Get("Anthropic-Beta") != "tools-2024-04-04" || sent.Get("OpenAI-Organization") != "" {
+			t.Errorf("Expected only Claude's headers to be sent, got %v", sent)
+		}
+	})
+	
+	t.Run("Mistral without extra headers", func(t *testing.T) {
+		var sent http.Header
+		client := &MistralClient{apiKey: "test-key", client: correlationClient(http.StatusOK, "", `{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`, &sent)}
+		if _, err := client.Query(context.Background(), "hello", "", QueryOptions{}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		
+		if sent.Get("OpenAI-Organization") != "" || sent.Get("Anthropic-Beta") != "" {
+			t.Errorf("Expected no extra headers, got %v", sent)
+		}
+	})
+}
@@ -28,6 +28,10 @@ type MistralRequest struct {
 	Messages    []Message `json:"messages"`
 	Temperature float64   `json:"temperature"`
 	MaxTokens   int       `json:"max_tokens"`
+	Stop        []string  `json:"stop,omitempty"`
+	N           int       `json:"n,omitempty"`
+	RandomSeed  *int      `json:"random_seed,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
 }
 
 type MistralResponse struct {
@@ -61,18 +65,29 @@ func (c *MistralClient) GetModelType() models.ModelType {
 	return models.Mistral
 }
 
-func (c *MistralClient) Query(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func (c *MistralClient) Query(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	if c.apiKey == "" {
 		return nil, myerrors.NewModelError(string(models.Mistral), 401, myerrors.ErrAPIKeyMissing, false)
 	}
 
-	modelVersion = ValidateModelVersion(models.Mistral, modelVersion)
+	modelVersion, err := ResolveModelVersion(models.Mistral, modelVersion, config.GetConfig().StrictModelVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTools(models.Mistral, modelVersion, opts.Tools); err != nil {
+		return nil, err
+	}
+
+	if err := checkImages(models.Mistral, modelVersion, opts.Images, false); err != nil {
+		return nil, err
+	}
 
 	retryFunc := func() (interface{}, error) {
-		return c.executeQuery(ctx, query, modelVersion)
+		return c.executeQuery(ctx, query, modelVersion, opts)
 	}
 
-	result, err := retry.Do(ctx, retryFunc, retry.DefaultConfig)
+	result, err := retry.Do(ctx, retryFunc, RetryConfig(models.Mistral))
 	if err != nil {
 		return nil, err
 	}
@@ -80,10 +95,29 @@ func (c *MistralClient) Query(ctx context.Context, query string, modelVersion st
 	return result.(*QueryResult), nil
 }
 
-func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func newMistralRequest(query string, modelVersion string, opts QueryOptions) MistralRequest {
+	return MistralRequest{
+		Model: modelVersion,
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: withCachePrefix(query, opts),
+			},
+		},
+		Temperature: opts.temperature(models.Mistral),
+		MaxTokens:   opts.maxTokens(models.Mistral),
+		Stop:        opts.Stop,
+		N:           numCompletions(opts.N),
+		RandomSeed:  opts.Seed,
+		TopP:        opts.TopP,
+	}
+}
+
+func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	startTime := time.Now()
 	result := &QueryResult{
-		NumRetries: 0,
+		NumRetries:   0,
+		ModelVersion: modelVersion,
 	}
 
 	if strings.HasPrefix(c.apiKey, "test_") {
@@ -102,17 +136,7 @@ func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVer
 		return result, nil
 	}
 
-	reqBody, err := json.Marshal(MistralRequest{
-		Model: modelVersion,
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: query,
-			},
-		},
-		Temperature: 0.7,
-		MaxTokens:   150,
-	})
+	reqBody, err := json.Marshal(newMistralRequest(query, modelVersion, opts))
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.Mistral), 500, fmt.Errorf("error marshaling request: %v", err), false)
 	}
@@ -125,6 +149,9 @@ func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVer
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	setExtraHeaders(models.Mistral, req.Header)
+	setCorrelationHeaders(ctx, req)
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
@@ -134,6 +161,8 @@ func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVer
 	}
 	defer resp.Body.Close()
 
+	result.ProviderRequestID = providerRequestID(models.Mistral, resp.Header)
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.Mistral), 500, fmt.Errorf("error reading response: %v", err), false)
@@ -141,7 +170,7 @@ func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVer
 
 	var mistralResp MistralResponse
 	err = json.Unmarshal(body, &mistralResp)
-	if err != nil {
+	if err != nil && resp.StatusCode == http.StatusOK {
 		return nil, myerrors.NewInvalidResponseError(string(models.Mistral), err)
 	}
 
@@ -149,6 +178,8 @@ func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVer
 	result.ResponseTime = time.Since(startTime).Milliseconds()
 
 	if resp.StatusCode != http.StatusOK {
+		logProviderError(ctx, models.Mistral, result.ProviderRequestID, resp.StatusCode)
+		
 		if resp.StatusCode == http.StatusTooManyRequests {
 			return nil, myerrors.NewRateLimitError(string(models.Mistral))
 		}
@@ -166,6 +197,12 @@ func (c *MistralClient) executeQuery(ctx context.Context, query string, modelVer
 	}
 
 	result.Response = mistralResp.Choices[0].Message.Content
+	result.FinishReason = mistralResp.Choices[0].FinishReason
+	if len(mistralResp.Choices) > 1 {
+		for _, choice := range mistralResp.Choices {
+			result.Candidates = append(result.Candidates, choice.Message.Content)
+		}
+	}
 	result.InputTokens = mistralResp.Usage.PromptTokens
 	result.OutputTokens = mistralResp.Usage.CompletionTokens
 	result.TotalTokens = mistralResp.Usage.TotalTokens
@@ -185,23 +222,10 @@ func (c *MistralClient) CheckAvailability() bool {
 		return true
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.mistral.ai/v1/models", nil)
-	if err != nil {
-		logrus.WithError(err).Error("Error creating Mistral availability request")
-		return false
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		logrus.WithError(err).Error("Error checking Mistral availability")
-		return false
-	}
-	defer resp.Body.Close()
+	url, headers := c.availabilityProbe()
+	return checkAvailability(c.client, models.Mistral, url, headers)
+}
 
-	return resp.StatusCode == http.StatusOK
+func (c *MistralClient) availabilityProbe() (string, map[string]string) {
+	return "https://api.mistral.ai/v1/models", map[string]string{"Authorization": "Bearer " + c.apiKey}
 }
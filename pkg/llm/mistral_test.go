@@ -128,7 +128,7 @@ func TestMistralClient_Query(t *testing.T) {
 				client: httpClient,
 			}
 			
-			result, err := client.Query(context.Background(), "Test query", "mistral-medium")
+			result, err := client.Query(context.Background(), "Test query", "mistral-medium", QueryOptions{})
 			
 			if tc.expectError {
 				if err == nil {
@@ -238,3 +238,106 @@ func TestMistralClient_CheckAvailability(t *testing.T) {
 		})
 	}
 }
+
+func TestMistralRequest_Stop(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stop     []string
+		expected bool
+	}{
+		{
+			name:     "Stop sequences set",
+			stop:     []string{"\n\n", "END"},
+			expected: true,
+		},
+		{
+			name:     "No stop sequences",
+			stop:     nil,
+			expected: false,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newMistralRequest("test query", "mistral-small", QueryOptions{Stop: tc.stop}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			stop, found := decoded["stop"]
+			if found != tc.expected {
+				t.Fatalf("Expected stop present=%v, got %v in %s", tc.expected, found, body)
+			}
+			
+			if found && len(stop.([]interface{})) != len(tc.stop) {
+				t.Errorf("Expected %d stop sequences, got %v", len(tc.stop), stop)
+			}
+		})
+	}
+}
+
+func TestMistralClient_ToolsUnsupported(t *testing.T) {
+	client := &MistralClient{apiKey: "test-key", client: &http.Client{}}
+	
+	_, err := client.Query(context.Background(), "Weather in Paris?", "", QueryOptions{
+		Tools: []models.ToolDefinition{{Name: "get_weather"}},
+	})
+	
+	var modelErr *myerrors.ModelError
+	if !errors.As(err, &modelErr) || modelErr.Code != http.StatusBadRequest || !errors.Is(err, myerrors.ErrToolsUnsupported) {
+		t.Errorf("Expected tools unsupported error, got %v", err)
+	}
+}
+
+func TestMistralRequest_N(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        int
+		expected float64
+	}{
+		{"Multiple completions", 3, 3},
+		{"Single completion", 1, 0},
+		{"Not set", 0, 0},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newMistralRequest("test query", "mistral-small", QueryOptions{N: tc.n}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			n, _ := decoded["n"].(float64)
+			if n != tc.expected {
+				t.Errorf("Expected n %v, got %v", tc.expected, decoded["n"])
+			}
+		})
+	}
+}
+
+func TestMistralRequest_Seed(t *testing.T) {
+	seed := 7
+	body, err := json.Marshal(newMistralRequest("test query", "mistral-small", QueryOptions{Seed: &seed}))
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+	
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling request: %v", err)
+	}
+	
+	if decoded["random_seed"] != float64(7) {
+		t.Errorf("Expected random_seed 7, got %v in %s", decoded["random_seed"], body)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -28,23 +29,67 @@ type OpenAIRequest struct {
 	Messages    []Message `json:"messages"`
 	Temperature float64   `json:"temperature"`
 	MaxTokens   int       `json:"max_tokens"`
+	Stop        []string  `json:"stop,omitempty"`
+	N           int       `json:"n,omitempty"`
+	Seed        *int      `json:"seed,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	Tools       []OpenAITool `json:"tools,omitempty"`
+	ToolChoice  interface{}  `json:"tool_choice,omitempty"`
+	PromptCacheKey string    `json:"prompt_cache_key,omitempty"` // Routes requests sharing a prefix to the same prompt cache
+}
+
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+type OpenAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type OpenAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // A string, or content parts for multimodal input
+}
+
+type OpenAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+}
+
+type OpenAIImageURL struct {
+	URL string `json:"url"`
 }
 
 type OpenAIResponse struct {
 	Choices []struct {
 		Message struct {
-			Content string `json:"content"`
+			Content   string           `json:"content"`
+			ToolCalls []OpenAIToolCall `json:"tool_calls"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 	Usage struct {
 		PromptTokens     int `json:"prompt_tokens"`
 		CompletionTokens int `json:"completion_tokens"`
 		TotalTokens      int `json:"total_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
 	} `json:"usage"`
 	Error struct {
 		Message string `json:"message"`
@@ -65,18 +110,29 @@ func (c *OpenAIClient) GetModelType() models.ModelType {
 	return models.OpenAI
 }
 
-func (c *OpenAIClient) Query(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func (c *OpenAIClient) Query(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	if c.apiKey == "" {
 		return nil, myerrors.NewModelError(string(models.OpenAI), 401, myerrors.ErrAPIKeyMissing, false)
 	}
 
-	modelVersion = ValidateModelVersion(models.OpenAI, modelVersion)
+	modelVersion, err := ResolveModelVersion(models.OpenAI, modelVersion, config.GetConfig().StrictModelVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTools(models.OpenAI, modelVersion, opts.Tools); err != nil {
+		return nil, err
+	}
+
+	if err := checkImages(models.OpenAI, modelVersion, opts.Images, true); err != nil {
+		return nil, err
+	}
 
 	retryFunc := func() (interface{}, error) {
-		return c.executeQuery(ctx, query, modelVersion)
+		return c.executeQuery(ctx, query, modelVersion, opts)
 	}
 
-	result, err := retry.Do(ctx, retryFunc, retry.DefaultConfig)
+	result, err := retry.Do(ctx, retryFunc, RetryConfig(models.OpenAI))
 	if err != nil {
 		return nil, err
 	}
@@ -84,10 +140,88 @@ func (c *OpenAIClient) Query(ctx context.Context, query string, modelVersion str
 	return result.(*QueryResult), nil
 }
 
-func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVersion string) (*QueryResult, error) {
+func newOpenAIRequest(query string, modelVersion string, opts QueryOptions) OpenAIRequest {
+	return OpenAIRequest{
+		Model: modelVersion,
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: openAIContent(withCachePrefix(query, opts), opts.Images),
+			},
+		},
+		Temperature: opts.temperature(models.OpenAI),
+		MaxTokens:   opts.maxTokens(models.OpenAI),
+		Stop:        opts.Stop,
+		N:           numCompletions(opts.N),
+		Seed:        opts.Seed,
+		TopP:        opts.TopP,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		PresencePenalty:  opts.PresencePenalty,
+		Tools:       openAITools(opts.Tools),
+		ToolChoice:  openAIToolChoice(opts),
+		PromptCacheKey: promptCacheKey(opts.CachePrefix),
+	}
+}
+
+func promptCacheKey(cachePrefix string) string {
+	if cachePrefix == "" {
+		return ""
+	}
+	
+	hash := fnv.New64a()
+	hash.Write([]byte(cachePrefix))
+	return fmt.Sprintf("llmproxy-%x", hash.Sum64())
+}
+
+func openAIContent(query string, images []string) interface{} {
+	if len(images) == 0 {
+		return query
+	}
+	
+	parts := []OpenAIContentPart{{Type: "text", Text: query}}
+	for _, image := range parseImages(images) {
+		parts = append(parts, OpenAIContentPart{
+			Type:     "image_url",
+			ImageURL: &OpenAIImageURL{URL: image.dataURL()},
+		})
+	}
+	return parts
+}
+
+func openAITools(tools []models.ToolDefinition) []OpenAITool {
+	var openAITools []OpenAITool
+	for _, tool := range tools {
+		openAITools = append(openAITools, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return openAITools
+}
+
+func openAIToolChoice(opts QueryOptions) interface{} {
+	switch opts.ToolChoice {
+	case "":
+		return nil
+	case models.ToolChoiceAuto, models.ToolChoiceNone, models.ToolChoiceRequired:
+		return opts.ToolChoice
+	default:
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": opts.ToolChoice},
+		}
+	}
+}
+
+func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVersion string, opts QueryOptions) (*QueryResult, error) {
 	startTime := time.Now()
 	result := &QueryResult{
-		NumRetries: 0,
+		NumRetries:   0,
+		ModelVersion: modelVersion,
 	}
 
 	if strings.HasPrefix(c.apiKey, "test_") {
@@ -106,17 +240,7 @@ func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVers
 		return result, nil
 	}
 
-	reqBody, err := json.Marshal(OpenAIRequest{
-		Model: modelVersion,
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: query,
-			},
-		},
-		Temperature: 0.7,
-		MaxTokens:   150,
-	})
+	reqBody, err := json.Marshal(newOpenAIRequest(query, modelVersion, opts))
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.OpenAI), 500, fmt.Errorf("error marshaling request: %v", err), false)
 	}
@@ -129,6 +253,9 @@ func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	setExtraHeaders(models.OpenAI, req.Header)
+	setCorrelationHeaders(ctx, req)
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
@@ -138,14 +265,18 @@ func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVers
 	}
 	defer resp.Body.Close()
 
+	result.ProviderRequestID = providerRequestID(models.OpenAI, resp.Header)
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, myerrors.NewModelError(string(models.OpenAI), 500, fmt.Errorf("error reading response: %v", err), false)
 	}
 
 	var openAIResp OpenAIResponse
+	// Error bodies from proxies and load balancers are often HTML or plain
+	// text, so a decode failure only matters for a successful response.
 	err = json.Unmarshal(body, &openAIResp)
-	if err != nil {
+	if err != nil && resp.StatusCode == http.StatusOK {
 		return nil, myerrors.NewInvalidResponseError(string(models.OpenAI), err)
 	}
 
@@ -153,6 +284,8 @@ func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVers
 	result.ResponseTime = time.Since(startTime).Milliseconds()
 
 	if resp.StatusCode != http.StatusOK {
+		logProviderError(ctx, models.OpenAI, result.ProviderRequestID, resp.StatusCode)
+		
 		if resp.StatusCode == http.StatusTooManyRequests {
 			return nil, myerrors.NewRateLimitError(string(models.OpenAI))
 		}
@@ -170,10 +303,24 @@ func (c *OpenAIClient) executeQuery(ctx context.Context, query string, modelVers
 	}
 
 	result.Response = openAIResp.Choices[0].Message.Content
+	result.FinishReason = openAIResp.Choices[0].FinishReason
+	if len(openAIResp.Choices) > 1 {
+		for _, choice := range openAIResp.Choices {
+			result.Candidates = append(result.Candidates, choice.Message.Content)
+		}
+	}
+	for _, call := range openAIResp.Choices[0].Message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, models.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: toolArguments(call.Function.Arguments),
+		})
+	}
 	result.InputTokens = openAIResp.Usage.PromptTokens
 	result.OutputTokens = openAIResp.Usage.CompletionTokens
 	result.TotalTokens = openAIResp.Usage.TotalTokens
 	result.NumTokens = result.TotalTokens // For backward compatibility
+	result.CacheReadTokens = openAIResp.Usage.PromptTokensDetails.CachedTokens
 
 	return result, nil
 }
@@ -188,23 +335,10 @@ func (c *OpenAIClient) CheckAvailability() bool {
 		return true
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.openai.com/v1/models", nil)
-	if err != nil {
-		logrus.WithError(err).Error("Error creating OpenAI availability request")
-		return false
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		logrus.WithError(err).Error("Error checking OpenAI availability")
-		return false
-	}
-	defer resp.Body.Close()
+	url, headers := c.availabilityProbe()
+	return checkAvailability(c.client, models.OpenAI, url, headers)
+}
 
-	return resp.StatusCode == http.StatusOK
+func (c *OpenAIClient) availabilityProbe() (string, map[string]string) {
+	return "https://api.openai.com/v1/models", map[string]string{"Authorization": "Bearer " + c.apiKey}
 }
@@ -128,7 +128,7 @@ func TestOpenAIClient_Query(t *testing.T) {
 				client: httpClient,
 			}
 			
-			result, err := client.Query(context.Background(), "Test query", "gpt-3.5-turbo")
+			result, err := client.Query(context.Background(), "Test query", "gpt-3.5-turbo", QueryOptions{})
 			
 			if tc.expectError {
 				if err == nil {
@@ -175,6 +175,11 @@ func TestOpenAIClient_Query(t *testing.T) {
 					if result.TotalTokens != expectedTotalTokens {
 						t.Errorf("Expected total tokens %d, got %d", expectedTotalTokens, result.TotalTokens)
 					}
+					
+					expectedFinishReason := openaiResp.Choices[0].FinishReason
+					if result.FinishReason != expectedFinishReason {
+						t.Errorf("Expected finish reason '%s', got '%s'", expectedFinishReason, result.FinishReason)
+					}
 				}
 			}
 		})
@@ -238,3 +243,264 @@ func TestOpenAIClient_CheckAvailability(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenAIRequest_Stop(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stop     []string
+		expected bool
+	}{
+		{
+			name:     "Stop sequences set",
+			stop:     []string{"\n\n", "END"},
+			expected: true,
+		},
+		{
+			name:     "No stop sequences",
+			stop:     nil,
+			expected: false,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newOpenAIRequest("test query", "gpt-3.5-turbo", QueryOptions{Stop: tc.stop}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			stop, found := decoded["stop"]
+			if found != tc.expected {
+				t.Fatalf("Expected stop present=%v, got %v in %s", tc.expected, found, body)
+			}
+			
+			if found && len(stop.([]interface{})) != len(tc.stop) {
+				t.Errorf("Expected %d stop sequences, got %v", len(tc.stop), stop)
+			}
+		})
+	}
+}
+
+func TestOpenAIClient_ToolCalls(t *testing.T) {
+	var sent map[string]interface{}
+	httpClient := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&sent)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"choices": [{
+							"message": {
+								"content": "",
+								"tool_calls": [{
+									"id": "call_1",
+									"type": "function",
+									"function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}
+								}]
+							},
+							"finish_reason": "tool_calls"
+						}]
+					}`)),
+				}, nil
+			},
+		},
+	}
+	
+	client := &OpenAIClient{apiKey: "test-key", client: httpClient}
+	opts := QueryOptions{
+		Tools: []models.ToolDefinition{
+			{Name: "get_weather", Description: "Get the weather", Parameters: json.RawMessage(`{"type":"object"}`)},
+		},
+		ToolChoice: "get_weather",
+	}
+	
+	result, err := client.Query(context.Background(), "Weather in Paris?", "gpt-4o", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	tools, ok := sent["tools"].([]interface{})
+	if !ok || len(tools) != 1 {
+		t.Fatalf("Expected 1 tool in request, got %v", sent["tools"])
+	}
+	if tools[0].(map[string]interface{})["type"] != "function" {
+		t.Errorf("Expected function tool, got %v", tools[0])
+	}
+	
+	toolChoice, ok := sent["tool_choice"].(map[string]interface{})
+	if !ok || toolChoice["function"].(map[string]interface{})["name"] != "get_weather" {
+		t.Errorf("Expected named tool_choice, got %v", sent["tool_choice"])
+	}
+	
+	if len(result.ToolCalls) != 1 {
+		t.Fatalf("Expected 1 tool call, got %d", len(result.ToolCalls))
+	}
+	
+	call := result.ToolCalls[0]
+	if call.ID != "call_1" || call.Name != "get_weather" || string(call.Arguments) != `{"city":"Paris"}` {
+		t.Errorf("Unexpected tool call: %+v", call)
+	}
+}
+
+func TestOpenAIRequest_Images(t *testing.T) {
+	body, err := json.Marshal(newOpenAIRequest("Describe this", "gpt-4o", QueryOptions{Images: []string{testPNG}}))
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+	
+	var decoded struct {
+		Messages []struct {
+			Content []OpenAIContentPart `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling request: %v", err)
+	}
+	
+	parts := decoded.Messages[0].Content
+	if len(parts) != 2 || parts[0].Text != "Describe this" || parts[1].Type != "image_url" {
+		t.Fatalf("Unexpected content parts: %+v", parts)
+	}
+	
+	if parts[1].ImageURL.URL != "data:image/png;base64,"+testPNG {
+		t.Errorf("Expected data URL, got %q", parts[1].ImageURL.URL)
+	}
+}
+
+func TestOpenAIRequest_N(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        int
+		expected float64
+	}{
+		{"Multiple completions", 3, 3},
+		{"Single completion", 1, 0},
+		{"Not set", 0, 0},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newOpenAIRequest("test query", "gpt-3.5-turbo", QueryOptions{N: tc.n}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			n, _ := decoded["n"].(float64)
+			if n != tc.expected {
+				t.Errorf("Expected n %v, got %v", tc.expected, decoded["n"])
+			}
+		})
+	}
+}
+
+func TestOpenAIRequest_Seed(t *testing.T) {
+	seed := 42
+	testCases := []struct {
+		name     string
+		seed     *int
+		expected interface{}
+	}{
+		{"Seed set", &seed, float64(42)},
+		{"Zero seed", new(int), float64(0)},
+		{"Not set", nil, nil},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(newOpenAIRequest("test query", "gpt-3.5-turbo", QueryOptions{Seed: tc.seed}))
+			if err != nil {
+				t.Fatalf("Error marshaling request: %v", err)
+			}
+			
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("Error unmarshaling request: %v", err)
+			}
+			
+			if decoded["seed"] != tc.expected {
+				t.Errorf("Expected seed %v, got %v in %s", tc.expected, decoded["seed"], body)
+			}
+		})
+	}
+}
+
+func TestOpenAIRequest_SamplingParameters(t *testing.T) {
+	topP, frequencyPenalty, presencePenalty := 0.9, 0.5, -0.5
+	body, err := json.Marshal(newOpenAIRequest("test query", "gpt-3.5-turbo", QueryOptions{
+		TopP:             &topP,
+		FrequencyPenalty: &frequencyPenalty,
+		PresencePenalty:  &presencePenalty,
+	}))
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+	
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling request: %v", err)
+	}
+	
+	expected := map[string]float64{"top_p": 0.9, "frequency_penalty": 0.5, "presence_penalty": -0.5}
+	for field, value := range expected {
+		if decoded[field] != value {
+			t.Errorf("Expected %s %v, got %v in %s", field, value, decoded[field], body)
+		}
+	}
+	
+	body, _ = json.Marshal(newOpenAIRequest("test query", "gpt-3.5-turbo", QueryOptions{}))
+	for field := range expected {
+		if strings.Contains(string(body), field) {
+			t.Errorf("Expected %s to be omitted when unset, got %s", field, body)
+		}
+	}
+}
+
+func TestOpenAIClient_PromptCaching(t *testing.T) {
+	var sent OpenAIRequest
+	httpClient := &http.Client{
+		Transport: &mockTransport{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&sent)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"choices": [{"message": {"content": "Done."}, "finish_reason": "stop"}],
+						"usage": {"prompt_tokens": 1500, "completion_tokens": 5, "total_tokens": 1505, "prompt_tokens_details": {"cached_tokens": 1024}}
+					}`)),
+				}, nil
+			},
+		},
+	}
+	
+	client := &OpenAIClient{apiKey: "test-key", client: httpClient}
+	opts := QueryOptions{CachePrefix: "You are a careful summarizer."}
+	result, err := client.Query(context.Background(), "Summarize this", "gpt-4o", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if content, _ := sent.Messages[0].Content.(string); content != "You are a careful summarizer.\n\nSummarize this" {
+		t.Errorf("Expected the prefix before the query, got %q", sent.Messages[0].Content)
+	}
+	if sent.PromptCacheKey == "" || sent.PromptCacheKey != promptCacheKey(opts.CachePrefix) {
+		t.Errorf("Expected a prompt_cache_key derived from the prefix, got %q", sent.PromptCacheKey)
+	}
+	if result.CacheReadTokens != 1024 {
+		t.Errorf("Expected 1024 cache read tokens, got %d", result.CacheReadTokens)
+	}
+	
+	if newOpenAIRequest("query", "gpt-4o", QueryOptions{}).PromptCacheKey != "" {
+		t.Errorf("Expected no prompt_cache_key without a prefix")
+	}
+}
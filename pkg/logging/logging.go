@@ -1,12 +1,23 @@
 package logging
 
 import (
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	sampleRate    = 1.0 // Fraction of successful requests logged
+	slowThreshold time.Duration // Requests at least this slow are always logged (0 disables)
+)
+
 type LogFields struct {
 	Model           string
 	Query           string
@@ -18,6 +29,7 @@ type LogFields struct {
 	StatusCode      int
 	Timestamp       time.Time
 	RequestID       string
+	ProviderRequestID string
 	InputTokens     int
 	OutputTokens    int
 	TotalTokens     int
@@ -28,9 +40,18 @@ type LogFields struct {
 }
 
 func SetupLogging() {
-	logrus.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: time.RFC3339Nano,
-	})
+	logFormat := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	switch logFormat {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339Nano,
+		})
+	default:
+		logrus.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+		})
+	}
 	
 	logrus.SetOutput(os.Stdout)
 	
@@ -42,12 +63,62 @@ func SetupLogging() {
 	level, err := logrus.ParseLevel(logLevel)
 	if err != nil {
 		logrus.SetLevel(logrus.InfoLevel)
+		logrus.WithField("value", logLevel).Warn("Invalid LOG_LEVEL, using info")
 	} else {
 		logrus.SetLevel(level)
 	}
+	
+	if logFormat != "" && logFormat != "json" && logFormat != "text" {
+		logrus.WithField("value", logFormat).Warn("Invalid LOG_FORMAT, using json")
+	}
+	
+	rate := 1.0
+	if value := os.Getenv("LOG_SAMPLE_RATE"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			logrus.WithField("value", value).Warn("Invalid LOG_SAMPLE_RATE, logging every request")
+		} else {
+			rate = parsed
+		}
+	}
+	
+	SetSampling(rate, time.Duration(config.GetConfig().SlowRequestThresholdMs)*time.Millisecond)
+}
+
+func SetSampling(rate float64, threshold time.Duration) {
+	sampleRate = rate
+	slowThreshold = threshold
+}
+
+// ShouldLog reports whether a finished request is logged. Failed and slow requests always
+// are; the rest are sampled by request ID, so a request's log lines are kept or dropped together.
+func ShouldLog(requestID string, failed bool, duration time.Duration) bool {
+	if failed || (slowThreshold > 0 && duration >= slowThreshold) {
+		return true
+	}
+	return sampled(requestID)
+}
+
+func sampled(requestID string) bool {
+	switch {
+	case sampleRate >= 1:
+		return true
+	case sampleRate <= 0:
+		return false
+	case requestID == "":
+		return rand.Float64() < sampleRate
+	}
+	
+	hash := fnv.New32a()
+	hash.Write([]byte(requestID))
+	return float64(hash.Sum32())/math.MaxUint32 < sampleRate
 }
 
 func LogRequest(fields LogFields) {
+	if !sampled(fields.RequestID) {
+		return
+	}
+	
 	if fields.Timestamp.IsZero() {
 		fields.Timestamp = time.Now()
 	}
@@ -62,6 +133,10 @@ func LogRequest(fields LogFields) {
 }
 
 func LogResponse(fields LogFields) {
+	if !ShouldLog(fields.RequestID, fields.Error != "", time.Duration(fields.ResponseTime)*time.Millisecond) {
+		return
+	}
+	
 	logFields := logrus.Fields{
 		"model":         fields.Model,
 		"response_time": fields.ResponseTime,
@@ -103,6 +178,10 @@ func LogResponse(fields LogFields) {
 		logFields["num_retries"] = fields.NumRetries
 	}
 	
+	if fields.ProviderRequestID != "" {
+		logFields["provider_request_id"] = fields.ProviderRequestID
+	}
+	
 	if fields.OriginalModel != "" && fields.FallbackModel != "" {
 		logFields["original_model"] = fields.OriginalModel
 		logFields["fallback_model"] = fields.FallbackModel
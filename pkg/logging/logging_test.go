@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSetupLogging(t *testing.T) {
+	originalFormatter := logrus.StandardLogger().Formatter
+	originalLevel := logrus.GetLevel()
+	defer func() {
+		logrus.SetFormatter(originalFormatter)
+		logrus.SetLevel(originalLevel)
+		os.Unsetenv("LOG_FORMAT")
+		os.Unsetenv("LOG_LEVEL")
+	}()
+	
+	tests := []struct {
+		name      string
+		format    string
+		level     string
+		wantJSON  bool
+		wantLevel logrus.Level
+	}{
+		{name: "Defaults", wantJSON: true, wantLevel: logrus.InfoLevel},
+		{name: "JSON format", format: "json", level: "debug", wantJSON: true, wantLevel: logrus.DebugLevel},
+		{name: "Text format", format: "TEXT", level: "warn", wantJSON: false, wantLevel: logrus.WarnLevel},
+		{name: "Invalid values", format: "xml", level: "loud", wantJSON: true, wantLevel: logrus.InfoLevel},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("LOG_FORMAT", tt.format)
+			os.Setenv("LOG_LEVEL", tt.level)
+			
+			SetupLogging()
+			
+			formatter := logrus.StandardLogger().Formatter
+			if _, ok := formatter.(*logrus.JSONFormatter); ok != tt.wantJSON {
+				t.Errorf("Expected JSON formatter %v, got %T", tt.wantJSON, formatter)
+			}
+			if _, ok := formatter.(*logrus.TextFormatter); ok == tt.wantJSON {
+				t.Errorf("Expected text formatter %v, got %T", !tt.wantJSON, formatter)
+			}
+			if logrus.GetLevel() != tt.wantLevel {
+				t.Errorf("Expected level %v, got %v", tt.wantLevel, logrus.GetLevel())
+			}
+		})
+	}
+}
+
+func TestSetupLoggingSampling(t *testing.T) {
+	cfg := config.GetConfig()
+	originalThreshold := cfg.SlowRequestThresholdMs
+	defer func() {
+		os.Unsetenv("LOG_SAMPLE_RATE")
+		cfg.SlowRequestThresholdMs = originalThreshold
+		SetSampling(1, 0)
+	}()
+	
+	tests := []struct {
+		name          string
+		rate          string
+		thresholdMs   int
+		wantRate      float64
+		wantThreshold time.Duration
+	}{
+		{name: "Defaults", wantRate: 1},
+		{name: "Valid values", rate: "0.25", thresholdMs: 1500, wantRate: 0.25, wantThreshold: 1500 * time.Millisecond},
+		{name: "Out of range", rate: "1.5", wantRate: 1},
+		{name: "Invalid values", rate: "half", wantRate: 1},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("LOG_SAMPLE_RATE", tt.rate)
+			cfg.SlowRequestThresholdMs = tt.thresholdMs
+			
+			SetupLogging()
+			
+			if sampleRate != tt.wantRate || slowThreshold != tt.wantThreshold {
+				t.Errorf("Expected rate %v and threshold %v, got %v and %v", tt.wantRate, tt.wantThreshold, sampleRate, slowThreshold)
+			}
+		})
+	}
+}
+
+func TestShouldLog(t *testing.T) {
+	defer SetSampling(1, 0)
+	
+	SetSampling(0, time.Second)
+	if ShouldLog("req-1", false, 10*time.Millisecond) {
+		t.Error("Expected fast successful request to be dropped at rate 0")
+	}
+	if !ShouldLog("req-1", true, 10*time.Millisecond) {
+		t.Error("Expected failed request to be logged")
+	}
+	if !ShouldLog("req-1", false, time.Second) {
+		t.Error("Expected slow request to be logged")
+	}
+	
+	SetSampling(0, 0)
+	if ShouldLog("req-1", false, time.Second) {
+		t.Error("Expected a zero threshold to disable slow request logging")
+	}
+	
+	SetSampling(0.3, time.Second)
+	logged := 0
+	for i := 0; i < 10000; i++ {
+		requestID := fmt.Sprintf("req-%d", i)
+		if ShouldLog(requestID, false, 0) != ShouldLog(requestID, false, 0) {
+			t.Fatalf("Expected a stable sampling decision for %s", requestID)
+		}
+		if ShouldLog(requestID, false, 0) {
+			logged++
+		}
+	}
+	if logged < 2700 || logged > 3300 {
+		t.Errorf("Expected about 30%% of requests logged, got %d of 10000", logged)
+	}
+}
+
+func TestLogResponseSampling(t *testing.T) {
+	var buf bytes.Buffer
+	originalOutput, originalFormatter := logrus.StandardLogger().Out, logrus.StandardLogger().Formatter
+	logrus.SetOutput(&buf)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer func() {
+		logrus.SetOutput(originalOutput)
+		logrus.SetFormatter(originalFormatter)
+		SetSampling(1, 0)
+	}()
+	
+	SetSampling(0, time.Second)
+	
+	LogRequest(LogFields{Model: "openai", RequestID: "ok"})
+	LogResponse(LogFields{Model: "openai", RequestID: "ok", ResponseTime: 10})
+	if buf.Len() != 0 {
+		t.Errorf("Expected sampled-out request and response to be dropped, got %q", buf.String())
+	}
+	
+	LogResponse(LogFields{Model: "openai", RequestID: "failed", Error: "boom", ErrorType: "query_error"})
+	LogResponse(LogFields{Model: "openai", RequestID: "slow", ResponseTime: 1500})
+	output := buf.String()
+	if !strings.Contains(output, `"request_id":"failed"`) || !strings.Contains(output, `"request_id":"slow"`) {
+		t.Errorf("Expected failed and slow responses to be logged, got %q", output)
+	}
+}
@@ -1,6 +1,17 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrEmptyQuery      = errors.New("query cannot be empty")
+	ErrQueryTooLong    = errors.New("query exceeds maximum length")
+	ErrInvalidModel    = errors.New("invalid model")
+	ErrInvalidTaskType = errors.New("invalid task type")
+)
 
 type ModelType string
 
@@ -27,11 +38,61 @@ type QueryRequest struct {
 	ModelVersion string    `json:"model_version,omitempty"` // Optional - specific version of the model to use
 	TaskType     TaskType  `json:"task_type,omitempty"`    // Optional - helps with model selection
 	RequestID    string    `json:"request_id,omitempty"`   // Optional - for tracking requests
+	AutoContinue bool      `json:"auto_continue,omitempty"` // Optional - re-query when the response is cut off by max tokens
+	CallbackURL  string    `json:"callback_url,omitempty"`  // Optional - run asynchronously and POST the result here
+	NoFallback   bool      `json:"no_fallback,omitempty"`   // Optional - return the model's error instead of falling back
+	Hedge        bool      `json:"hedge,omitempty"`         // Optional - race a second model if the first has not answered within HEDGE_DELAY_MS
+	Stop         []string  `json:"stop,omitempty"`          // Optional - stop sequences, ignored by providers without support
+	Tools        []ToolDefinition `json:"tools,omitempty"`    // Optional - functions the model may call
+	ToolChoice   string    `json:"tool_choice,omitempty"`   // Optional - "auto", "none", "required" or a tool name
+	Images       []string  `json:"images,omitempty"`        // Optional - base64 data, data URLs or http(s) URLs
+	Extract      string    `json:"extract,omitempty"`       // Optional - "code" or "json", return only the extracted block
+	OnOverflow   string    `json:"on_overflow,omitempty"`   // Optional - "reject" (default), "truncate_head" or "truncate_tail"
+	CachePrefix  string    `json:"cache_prefix,omitempty"`  // Optional - stable prompt prefix sent before the query and marked cacheable by the provider
+	N            int       `json:"n,omitempty"`             // Optional - number of completions to generate
+	Seed         *int      `json:"seed,omitempty"`          // Optional - sampling seed for reproducible outputs, ignored by providers without support
+	TopP         *float64  `json:"top_p,omitempty"`         // Optional - nucleus sampling, 0 to 1
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"` // Optional - -2 to 2, OpenAI only
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`  // Optional - -2 to 2, OpenAI only
+	Temperature  *float64  `json:"temperature,omitempty"`   // Optional - 0 to 2, defaults to the model's configured default
+	MaxTokens    *int      `json:"max_tokens,omitempty"`    // Optional - response token limit, defaults to the model's configured default
+	Tenant       string    `json:"-"`                       // Resolved from the API key (TENANT_API_KEYS), selects the model allow-list
+	Priority     string    `json:"-"`                       // Tier from the tenant or X-Priority header, orders queued queries
+}
+
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+const (
+	ExtractCode = "code"
+	ExtractJSON = "json"
+)
+
+const (
+	OverflowReject       = "reject"
+	OverflowTruncateHead = "truncate_head" // Drop the start of the query, keep the end
+	OverflowTruncateTail = "truncate_tail" // Drop the end of the query, keep the start
+)
+
+type ToolDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // JSON schema of the arguments
+}
+
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
 }
 
 type QueryResponse struct {
 	Response      string    `json:"response"`
 	Model         ModelType `json:"model"`
+	ModelVersion  string    `json:"model_version,omitempty"` // Version actually used by the provider
 	ResponseTime  int64     `json:"response_time_ms"`
 	Timestamp     time.Time `json:"timestamp"`
 	Cached        bool      `json:"cached"`
@@ -41,14 +102,196 @@ type QueryResponse struct {
 	OutputTokens  int       `json:"output_tokens,omitempty"`
 	TotalTokens   int       `json:"total_tokens,omitempty"`
 	NumTokens     int       `json:"num_tokens,omitempty"` // Deprecated: Use TotalTokens instead
+	CacheReadTokens  int    `json:"cache_read_tokens,omitempty"`  // Input tokens served from the provider's prompt cache
+	CacheWriteTokens int    `json:"cache_write_tokens,omitempty"` // Input tokens written to the provider's prompt cache
 	NumRetries    int       `json:"num_retries,omitempty"`
 	RequestID     string    `json:"request_id,omitempty"`
+	ProviderRequestID string `json:"provider_request_id,omitempty"` // Provider's own request ID, for support tickets
 	OriginalModel ModelType `json:"original_model,omitempty"` // If fallback occurred
+	FallbackChain []ModelType `json:"fallback_chain,omitempty"` // Models tried in order, if fallback occurred
+	FinishReason  string    `json:"finish_reason,omitempty"`  // Provider stop reason, e.g. "length" when truncated
+	Continuations int       `json:"continuations,omitempty"`  // Number of auto-continue follow-up calls
+	Truncated     bool      `json:"truncated,omitempty"`      // Query was cut to fit the context window
+	Clamped       string    `json:"clamped,omitempty"`        // Note on parameters lowered to the model's limits
+	HedgeModel    ModelType `json:"hedge_model,omitempty"`    // Model raced against the primary, if a hedge was launched
+	DetectedLanguage string `json:"detected_language,omitempty"` // Query language when ROUTE_BY_LANGUAGE is on and detection was confident
+	ToolCalls     []ToolCall `json:"tool_calls,omitempty"`
+	Candidates    []string  `json:"candidates,omitempty"` // All completions when n > 1, the first is also in Response
+	CostUSD       float64   `json:"cost_usd,omitempty"`   // Cost from the price catalog, omitted when unknown
+	Timings       *Timings  `json:"timings,omitempty"`
+}
+
+type Timings struct {
+	RoutingMs  int64           `json:"routing_ms"`
+	QueueMs    int64           `json:"queue_ms,omitempty"` // Time an async job waited before running
+	ProviderMs int64           `json:"provider_ms"`        // Provider round-trips, including retries and backoff
+	OverheadMs int64           `json:"overhead_ms"`
+	TotalMs    int64           `json:"total_ms"`
+	Attempts   []AttemptTiming `json:"attempts,omitempty"`
+}
+
+type AttemptTiming struct {
+	Model      ModelType `json:"model"`
+	Attempt    int       `json:"attempt"`
+	DurationMs int64     `json:"duration_ms"`
+	BackoffMs  int64     `json:"backoff_ms,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type ErrorDetail struct {
+	Message         string `json:"message"`
+	Code            string `json:"code"`
+	Model           string `json:"model,omitempty"`
+	ProviderStatus  int    `json:"provider_status,omitempty"`  // HTTP status returned by the provider
+	ProviderMessage string `json:"provider_message,omitempty"` // Provider's original error message, truncated
+}
+
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+type Job struct {
+	ID                string         `json:"id"`
+	RequestID         string         `json:"request_id"`
+	Status            JobStatus      `json:"status"`
+	Result            *QueryResponse `json:"result,omitempty"`
+	Error             *ErrorDetail   `json:"error,omitempty"`
+	CallbackURL       string         `json:"callback_url,omitempty"`
+	CallbackAttempts  int            `json:"callback_attempts"`
+	CallbackDelivered bool           `json:"callback_delivered"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+type Capture struct {
+	RequestID    string    `json:"request_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Model        ModelType `json:"model,omitempty"`
+	ModelVersion string    `json:"model_version,omitempty"`
+	Request      QueryRequest `json:"request"` // Normalized request with its options, query and cache prefix redacted
+	Response     string    `json:"response"` // Redacted
+	DurationMs   int64     `json:"duration_ms"`
+	InputTokens  int       `json:"input_tokens,omitempty"`
+	OutputTokens int       `json:"output_tokens,omitempty"`
+	Cached       bool      `json:"cached"`
+	StatusCode   int       `json:"status_code"`
+	Error        *ErrorDetail `json:"error,omitempty"`
 }
 
+type CapturesResponse struct {
+	Enabled  bool      `json:"enabled"`
+	Captures []Capture `json:"captures"`
+}
+
+type CacheStats struct {
+	Enabled    bool   `json:"enabled"`
+	Size       int    `json:"size"`
+	MaxItems   int    `json:"max_items"` // 0 when the provider has no item limit
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+type CacheEvictResponse struct {
+	Key     string `json:"key,omitempty"`
+	Evicted int    `json:"evicted"`
+}
+
+type CacheKeyResponse struct {
+	Key string `json:"key"`
+}
+
+type ValidateKeyRequest struct {
+	Provider string `json:"provider"`
+	Key      string `json:"key"`
+}
+
+type ValidateKeyResponse struct {
+	Provider    string `json:"provider"`
+	FormatValid bool   `json:"format_valid"`
+	FormatError string `json:"format_error,omitempty"`
+	Reachable   bool   `json:"reachable"`
+	LatencyMs   int64  `json:"latency_ms"` // Duration of the live check
+}
+
+type ModelAvailability map[string]bool // Keyed by model name, so new providers need no struct changes
+
+// Deprecated: StatusResponse only covers the original four providers. Use
+// ModelAvailability instead.
 type StatusResponse struct {
 	OpenAI  bool `json:"openai"`
 	Gemini  bool `json:"gemini"`
 	Mistral bool `json:"mistral"`
 	Claude  bool `json:"claude"`
 }
+
+func NewStatusResponse(availability ModelAvailability) StatusResponse {
+	return StatusResponse{
+		OpenAI:  availability[string(OpenAI)],
+		Gemini:  availability[string(Gemini)],
+		Mistral: availability[string(Mistral)],
+		Claude:  availability[string(Claude)],
+	}
+}
+
+func (s StatusResponse) ModelAvailability() ModelAvailability {
+	return ModelAvailability{
+		string(OpenAI):  s.OpenAI,
+		string(Gemini):  s.Gemini,
+		string(Mistral): s.Mistral,
+		string(Claude):  s.Claude,
+	}
+}
+
+type ModelHealth struct {
+	Available      bool         `json:"available"`
+	RecentRequests int          `json:"recent_requests"`
+	ErrorRate      float64      `json:"error_rate"`
+	P50LatencyMs   float64      `json:"p50_latency_ms"`
+	P95LatencyMs   float64      `json:"p95_latency_ms"`
+	LastErrorTime  *time.Time   `json:"last_error_time,omitempty"`
+	Budget         *ModelBudget `json:"budget,omitempty"` // Omitted when the model has no budget
+}
+
+type BudgetUsage struct {
+	LimitUSD     float64 `json:"limit_usd"`
+	SpentUSD     float64 `json:"spent_usd"`
+	RemainingUSD float64 `json:"remaining_usd"`
+}
+
+type ModelBudget struct {
+	Daily   *BudgetUsage `json:"daily,omitempty"`
+	Monthly *BudgetUsage `json:"monthly,omitempty"`
+}
+
+type UsageTotals struct {
+	Requests     int64   `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+type TenantUsage struct {
+	Tenant string `json:"tenant"`
+	UsageTotals
+	Models map[string]UsageTotals `json:"models,omitempty"` // Set when grouped by model
+}
+
+type UsageResponse struct {
+	Since   time.Time     `json:"since"`
+	Tenants []TenantUsage `json:"tenants"`
+}
+
+type DetailedStatusResponse struct {
+	Models    map[ModelType]ModelHealth `json:"models"`
+	Timestamp time.Time                 `json:"timestamp"`
+}
@@ -2,11 +2,17 @@ package monitoring
 
 import (
 	"net/http"
+	"regexp"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/llm"
+	"github.com/amorin24/llmproxy/pkg/logging"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:/-]{1,128}$`) // Incoming X-Request-ID values accepted as-is
+
 type ResponseWriter struct {
 	http.ResponseWriter
 	StatusCode int
@@ -17,6 +23,17 @@ func (rw *ResponseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush lets streamed responses (batch results) reach the client through the middleware.
+func (rw *ResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -30,13 +47,15 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 		
 		duration := time.Since(start)
 		
-		logrus.WithFields(logrus.Fields{
-			"method":     r.Method,
-			"path":       r.URL.Path,
-			"status":     rw.StatusCode,
-			"duration":   duration.Milliseconds(),
-			"user_agent": r.UserAgent(),
-		}).Info("Request processed")
+		if logging.ShouldLog(llm.RequestIDFromContext(r.Context()), rw.StatusCode >= http.StatusBadRequest, duration) {
+			logrus.WithFields(logrus.Fields{
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"status":     rw.StatusCode,
+				"duration":   duration.Milliseconds(),
+				"user_agent": r.UserAgent(),
+			}).Info("Request processed")
+		}
 		
 		if r.URL.Path == "/api/query" {
 			RequestsTotal.WithLabelValues("api", http.StatusText(rw.StatusCode)).Inc()
@@ -55,11 +74,16 @@ func RequestLogger(next http.Handler) http.Handler {
 		
 		next.ServeHTTP(rw, r)
 		
+		duration := time.Since(start)
+		if !logging.ShouldLog(llm.RequestIDFromContext(r.Context()), rw.StatusCode >= http.StatusBadRequest, duration) {
+			return
+		}
+		
 		logrus.WithFields(logrus.Fields{
 			"method":     r.Method,
 			"path":       r.URL.Path,
 			"status":     rw.StatusCode,
-			"duration":   time.Since(start).Milliseconds(),
+			"duration":   duration.Milliseconds(),
 			"remote_ip":  r.RemoteAddr,
 			"user_agent": r.UserAgent(),
 		}).Info("HTTP Request")
@@ -70,6 +94,13 @@ func RequestLoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		r = r.WithContext(llm.WithRequestID(r.Context(), requestID))
+		
 		rw := &ResponseWriter{
 			ResponseWriter: w,
 			StatusCode:     http.StatusOK, // Default to 200 OK
@@ -79,15 +110,18 @@ func RequestLoggerMiddleware(next http.Handler) http.Handler {
 		
 		duration := time.Since(start)
 		
-		logrus.WithFields(logrus.Fields{
-			"method":     r.Method,
-			"path":       r.URL.Path,
-			"status":     rw.StatusCode,
-			"duration":   duration.Milliseconds(),
-			"remote_ip":  r.RemoteAddr,
-			"user_agent": r.UserAgent(),
-			"referer":    r.Referer(),
-		}).Info("HTTP Request")
+		if logging.ShouldLog(requestID, rw.StatusCode >= http.StatusBadRequest, duration) {
+			logrus.WithFields(logrus.Fields{
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"status":     rw.StatusCode,
+				"duration":   duration.Milliseconds(),
+				"remote_ip":  r.RemoteAddr,
+				"user_agent": r.UserAgent(),
+				"referer":    r.Referer(),
+				"request_id": requestID,
+			}).Info("HTTP Request")
+		}
 		
 		if r.URL.Path == "/api/query" || r.URL.Path == "/api/parallel" {
 			IncreaseActiveRequests("api")
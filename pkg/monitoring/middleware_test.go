@@ -0,0 +1,47 @@
+package monitoring
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amorin24/llmproxy/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMiddlewareSamplesByRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	originalOutput, originalLevel := logrus.StandardLogger().Out, logrus.GetLevel()
+	logrus.SetOutput(&buf)
+	logrus.SetLevel(logrus.InfoLevel)
+	defer func() {
+		logrus.SetOutput(originalOutput)
+		logrus.SetLevel(originalLevel)
+		logging.SetSampling(1, 0)
+	}()
+	logging.SetSampling(0.5, 0)
+	
+	handler := RequestLoggerMiddleware(MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	
+	for i := 0; i < 20; i++ {
+		requestID := fmt.Sprintf("req-%d", i)
+		buf.Reset()
+		
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		req.Header.Set("X-Request-ID", requestID)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		
+		want := logging.ShouldLog(requestID, false, 0)
+		if logged := strings.Contains(buf.String(), "Request processed"); logged != want {
+			t.Errorf("%s: expected MetricsMiddleware logged=%v, got %v", requestID, want, logged)
+		}
+		if logged := strings.Contains(buf.String(), "HTTP Request"); logged != want {
+			t.Errorf("%s: expected RequestLoggerMiddleware logged=%v, got %v", requestID, want, logged)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package monitoring
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,9 +20,23 @@ type Metrics struct {
 	ActiveRequests     map[string]int            `json:"active_requests"`
 	ModelAvailability  map[string]bool           `json:"model_availability"`
 	ErrorsTotal        map[string]int            `json:"errors_total"`
+	LastErrorTime      map[string]time.Time      `json:"last_error_time"`
+	CoalescedRequests  int                       `json:"coalesced_requests"`
+	StampedesPrevented int                       `json:"stampedes_prevented"`
+	recentFailures     map[string][]bool
 	mutex              sync.RWMutex
 }
 
+type ModelStats struct {
+	RecentRequests int        `json:"recent_requests"`
+	ErrorRate      float64    `json:"error_rate"`
+	P50LatencyMs   float64    `json:"p50_latency_ms"`
+	P95LatencyMs   float64    `json:"p95_latency_ms"`
+	LastErrorTime  *time.Time `json:"last_error_time,omitempty"`
+}
+
+const recentRequestWindow = 100
+
 var (
 	metrics     *Metrics
 	metricsOnce sync.Once
@@ -35,6 +51,8 @@ func GetMetrics() *Metrics {
 			ActiveRequests:    make(map[string]int),
 			ModelAvailability: make(map[string]bool),
 			ErrorsTotal:       make(map[string]int),
+			LastErrorTime:     make(map[string]time.Time),
+			recentFailures:    make(map[string][]bool),
 		}
 	})
 	return metrics
@@ -52,9 +70,67 @@ func (m *Metrics) RecordRequest(model string, status int, duration time.Duration
 	}
 	m.RequestDurations[model] = append(m.RequestDurations[model], duration)
 	
-	if len(m.RequestDurations[model]) > 100 {
-		m.RequestDurations[model] = m.RequestDurations[model][len(m.RequestDurations[model])-100:]
+	if len(m.RequestDurations[model]) > recentRequestWindow {
+		m.RequestDurations[model] = m.RequestDurations[model][len(m.RequestDurations[model])-recentRequestWindow:]
+	}
+	
+	failed := status >= http.StatusBadRequest
+	if failed {
+		m.LastErrorTime[model] = time.Now()
 	}
+	
+	m.recentFailures[model] = append(m.recentFailures[model], failed)
+	if len(m.recentFailures[model]) > recentRequestWindow {
+		m.recentFailures[model] = m.recentFailures[model][len(m.recentFailures[model])-recentRequestWindow:]
+	}
+}
+
+func (m *Metrics) GetModelStats(model string) ModelStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	return m.modelStats(model)
+}
+
+func (m *Metrics) modelStats(model string) ModelStats {
+	stats := ModelStats{}
+	
+	outcomes := m.recentFailures[model]
+	stats.RecentRequests = len(outcomes)
+	if len(outcomes) > 0 {
+		failures := 0
+		for _, failed := range outcomes {
+			if failed {
+				failures++
+			}
+		}
+		stats.ErrorRate = float64(failures) / float64(len(outcomes))
+	}
+	
+	durations := make([]time.Duration, len(m.RequestDurations[model]))
+	copy(durations, m.RequestDurations[model])
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.P50LatencyMs = percentileMs(durations, 0.50)
+	stats.P95LatencyMs = percentileMs(durations, 0.95)
+	
+	if lastError, ok := m.LastErrorTime[model]; ok {
+		stats.LastErrorTime = &lastError
+	}
+	
+	return stats
+}
+
+func percentileMs(sorted []time.Duration, percentile float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	
+	rank := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	
+	return float64(sorted[rank]) / float64(time.Millisecond)
 }
 
 func (m *Metrics) RecordTokens(model string, tokens int) {
@@ -78,6 +154,20 @@ func (m *Metrics) RecordCacheMiss() {
 	m.CacheMisses++
 }
 
+func (m *Metrics) RecordCoalescedRequest() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	m.CoalescedRequests++
+}
+
+func (m *Metrics) RecordStampedePrevented() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	m.StampedesPrevented++
+}
+
 func (m *Metrics) IncreaseActiveRequests(model string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -126,15 +216,23 @@ func (m *Metrics) GetMetricsData() map[string]interface{} {
 		avgDurations[model] = float64(sum) / float64(len(durations)) / float64(time.Millisecond)
 	}
 	
+	modelStats := make(map[string]ModelStats)
+	for model := range m.recentFailures {
+		modelStats[model] = m.modelStats(model)
+	}
+	
 	return map[string]interface{}{
 		"requests_total":      m.RequestsTotal,
 		"avg_request_duration_ms": avgDurations,
 		"tokens_processed":    m.TokensProcessed,
 		"cache_hits":          m.CacheHits,
 		"cache_misses":        m.CacheMisses,
+		"coalesced_requests":  m.CoalescedRequests,
+		"stampedes_prevented": m.StampedesPrevented,
 		"active_requests":     m.ActiveRequests,
 		"model_availability":  m.ModelAvailability,
 		"errors_total":        m.ErrorsTotal,
+		"model_stats":         modelStats,
 		"timestamp":           time.Now().Unix(),
 	}
 }
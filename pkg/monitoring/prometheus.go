@@ -34,6 +34,24 @@ var (
 		[]string{"model", "type"},
 	)
 
+	InputTokens = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llmproxy_input_tokens",
+			Help:    "The number of input (prompt) tokens per request by model",
+			Buckets: prometheus.ExponentialBuckets(16, 2, 12), // 16 to 32768 tokens
+		},
+		[]string{"model"},
+	)
+
+	OutputTokens = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llmproxy_output_tokens",
+			Help:    "The number of output (completion) tokens per request by model",
+			Buckets: prometheus.ExponentialBuckets(8, 2, 12), // 8 to 16384 tokens
+		},
+		[]string{"model"},
+	)
+
 	CacheHits = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "llmproxy_cache_hits_total",
@@ -42,6 +60,20 @@ var (
 		[]string{"result"},
 	)
 
+	CoalescedRequests = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llmproxy_coalesced_requests_total",
+			Help: "The total number of requests that attached to an identical in-flight request",
+		},
+	)
+
+	StampedesPrevented = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "llmproxy_stampedes_prevented_total",
+			Help: "The total number of cache refills skipped because the entry was filled while waiting for the refill lock",
+		},
+	)
+
 	ActiveRequests = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "llmproxy_active_requests",
@@ -90,6 +122,77 @@ var (
 		},
 	)
 
+	BudgetUtilization = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llmproxy_budget_utilization_ratio",
+			Help: "Spend as a fraction of the budget by model and period (daily or monthly)",
+		},
+		[]string{"model", "period"},
+	)
+
+	BudgetAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llmproxy_budget_alerts_total",
+			Help: "Budget thresholds crossed by model, period, and level (warning or exhausted)",
+		},
+		[]string{"model", "period", "level"},
+	)
+
+	RequestsAborted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llmproxy_requests_aborted_total",
+			Help: "Provider calls canceled because the client disconnected, by model",
+		},
+		[]string{"model"},
+	)
+
+	SlowRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llmproxy_slow_requests_total",
+			Help: "Queries slower than SLOW_REQUEST_THRESHOLD_MS, by model",
+		},
+		[]string{"model"},
+	)
+
+	ModelDowngrades = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llmproxy_model_downgrades_total",
+			Help: "Times a model was downgraded to its target after repeated timeouts",
+		},
+		[]string{"model", "target"},
+	)
+
+	DowngradedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llmproxy_downgraded_requests_total",
+			Help: "Requests routed to a downgrade target while their model was cooling down",
+		},
+		[]string{"model", "target"},
+	)
+
+	PriorityQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llmproxy_priority_queue_depth",
+			Help: "Queries waiting for a MAX_CONCURRENT_REQUESTS slot, by priority tier",
+		},
+		[]string{"priority"},
+	)
+
+	ShedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llmproxy_shed_requests_total",
+			Help: "Queries rejected with 429 because the priority queue was full, by priority tier",
+		},
+		[]string{"priority"},
+	)
+
+	CatalogStale = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "llmproxy_catalog_stale",
+			Help: "Whether the loaded price catalog is past its validation due date (1=stale, 0=current)",
+		},
+	)
+
 	EstimatedVsActualCost = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "llmproxy_estimated_vs_actual_cost_ratio",
@@ -110,6 +213,15 @@ func RecordTokens(model string, inputTokens, outputTokens int) {
 	TokensProcessed.WithLabelValues(model, "output").Add(float64(outputTokens))
 }
 
+func RecordTokenLengths(model string, inputTokens, outputTokens int) {
+	if inputTokens > 0 {
+		InputTokens.WithLabelValues(model).Observe(float64(inputTokens))
+	}
+	if outputTokens > 0 {
+		OutputTokens.WithLabelValues(model).Observe(float64(outputTokens))
+	}
+}
+
 func RecordCacheHit() {
 	CacheHits.WithLabelValues("hit").Inc()
 }
@@ -118,6 +230,14 @@ func RecordCacheMiss() {
 	CacheHits.WithLabelValues("miss").Inc()
 }
 
+func RecordCoalescedRequest() {
+	CoalescedRequests.Inc()
+}
+
+func RecordStampedePrevented() {
+	StampedesPrevented.Inc()
+}
+
 func IncreaseActiveRequests(model string) {
 	ActiveRequests.WithLabelValues(model).Inc()
 }
@@ -147,6 +267,46 @@ func RecordCostSavingsFromCache(costUSD float64) {
 	CostSavingsFromCache.Add(costUSD)
 }
 
+func SetBudgetUtilization(model string, period string, ratio float64) {
+	BudgetUtilization.WithLabelValues(model, period).Set(ratio)
+}
+
+func RecordBudgetAlert(model string, period string, level string) {
+	BudgetAlerts.WithLabelValues(model, period, level).Inc()
+}
+
+func RecordRequestAborted(model string) {
+	RequestsAborted.WithLabelValues(model).Inc()
+}
+
+func RecordSlowRequest(model string) {
+	SlowRequests.WithLabelValues(model).Inc()
+}
+
+func RecordModelDowngrade(model string, target string) {
+	ModelDowngrades.WithLabelValues(model, target).Inc()
+}
+
+func RecordDowngradedRequest(model string, target string) {
+	DowngradedRequests.WithLabelValues(model, target).Inc()
+}
+
+func SetPriorityQueueDepth(priority string, depth int) {
+	PriorityQueueDepth.WithLabelValues(priority).Set(float64(depth))
+}
+
+func RecordShedRequest(priority string) {
+	ShedRequests.WithLabelValues(priority).Inc()
+}
+
+func SetCatalogStale(stale bool) {
+	value := 0.0
+	if stale {
+		value = 1.0
+	}
+	CatalogStale.Set(value)
+}
+
 func RecordEstimatedVsActualCost(provider string, model string, estimatedCost float64, actualCost float64) {
 	if estimatedCost > 0 {
 		ratio := actualCost / estimatedCost
@@ -0,0 +1,99 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/sirupsen/logrus"
+)
+
+const pushgatewayJob = "llmproxy"
+
+type DrainOptions struct {
+	Addr           string        // Address the final scrape is served on
+	Window         time.Duration // How long to wait for a final scrape or push
+	PushgatewayURL string        // Push final metrics here instead of waiting for a scrape
+	SnapshotPath   string        // File the final JSON metrics are written to; empty logs them
+}
+
+// DrainMetrics runs after the server has shut down so the final totals reach Prometheus and the JSON snapshot.
+func DrainMetrics(opts DrainOptions) {
+	if opts.PushgatewayURL != "" {
+		if err := pushMetrics(opts.PushgatewayURL, opts.Window); err != nil {
+			logrus.WithError(err).Error("Error pushing final metrics to Pushgateway")
+		} else {
+			logrus.WithField("pushgateway", opts.PushgatewayURL).Info("Pushed final metrics to Pushgateway")
+		}
+	} else if opts.Window > 0 {
+		awaitFinalScrape(opts.Addr, opts.Window)
+	}
+	
+	if err := writeMetricsSnapshot(opts.SnapshotPath); err != nil {
+		logrus.WithError(err).Error("Error writing final metrics snapshot")
+	}
+}
+
+func pushMetrics(url string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	
+	return push.New(url, pushgatewayJob).Gatherer(prometheus.DefaultGatherer).PushContext(ctx)
+}
+
+func awaitFinalScrape(addr string, window time.Duration) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logrus.WithError(err).Warn("Could not serve final metrics scrape")
+		return
+	}
+	
+	scraped := make(chan struct{})
+	var once sync.Once
+	promHandler := promhttp.Handler()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		promHandler.ServeHTTP(w, r)
+		once.Do(func() { close(scraped) })
+	})
+	mux.HandleFunc("/api/metrics", MetricsHandler)
+	
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	
+	logrus.WithField("window", window).Info("Waiting for a final metrics scrape")
+	select {
+	case <-scraped:
+		logrus.Info("Final metrics scrape completed")
+	case <-time.After(window):
+		logrus.Warn("No metrics scrape during the shutdown drain window")
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+func writeMetricsSnapshot(path string) error {
+	data := GetMetrics().GetMetricsData()
+	if path == "" {
+		logrus.WithField("metrics", data).Info("Final metrics snapshot")
+		return nil
+	}
+	
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, body, 0644)
+}
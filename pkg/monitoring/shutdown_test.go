@@ -0,0 +1,84 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainMetricsPushesAndWritesSnapshot(t *testing.T) {
+	var pushes int32
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/job/"+pushgatewayJob) {
+			atomic.AddInt32(&pushes, 1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer pushgateway.Close()
+	
+	RequestsTotal.WithLabelValues("openai", "200").Inc()
+	GetMetrics().RecordRequest("openai", http.StatusOK, 10*time.Millisecond)
+	
+	snapshotPath := filepath.Join(t.TempDir(), "metrics.json")
+	DrainMetrics(DrainOptions{
+		Window:         time.Second,
+		PushgatewayURL: pushgateway.URL,
+		SnapshotPath:   snapshotPath,
+	})
+	
+	if atomic.LoadInt32(&pushes) != 1 {
+		t.Errorf("Expected one push to the Pushgateway, got %d", pushes)
+	}
+	
+	body, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatalf("Expected a metrics snapshot file: %v", err)
+	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		t.Fatalf("Expected the snapshot to be JSON: %v", err)
+	}
+	if _, ok := snapshot["requests_total"]; !ok {
+		t.Errorf("Expected requests_total in the snapshot, got %v", snapshot)
+	}
+}
+
+func TestDrainMetricsWaitsForFinalScrape(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error reserving a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	
+	done := make(chan struct{})
+	go func() {
+		DrainMetrics(DrainOptions{Addr: addr, Window: 5 * time.Second})
+		close(done)
+	}()
+	
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://" + addr + "/metrics"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Expected the drain listener to serve /metrics: %v", err)
+	}
+	resp.Body.Close()
+	
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the drain to end after the final scrape")
+	}
+}
@@ -1,6 +1,7 @@
 package pricing
 
 import (
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -8,8 +9,15 @@ import (
 	"time"
 
 	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/sirupsen/logrus"
 )
 
+const validationDateLayout = "2006-01-02"
+
+//go:embed price-catalog.json
+var defaultCatalog []byte
+
 type ModelPricing struct {
 	InputPer1kTokens  float64 `json:"input_per_1k_tokens"`
 	OutputPer1kTokens float64 `json:"output_per_1k_tokens"`
@@ -34,7 +42,7 @@ type PriceCatalog struct {
 
 type CatalogLoader struct {
 	catalog     *PriceCatalog
-	catalogPath string
+	catalogPath string // Empty for the embedded default catalog
 	mu          sync.RWMutex
 }
 
@@ -50,13 +58,33 @@ func NewCatalogLoader(catalogPath string) (*CatalogLoader, error) {
 	return loader, nil
 }
 
+func NewDefaultCatalogLoader() (*CatalogLoader, error) {
+	return NewCatalogLoader("")
+}
+
+func LoadCatalog(catalogPath string) (*CatalogLoader, error) {
+	if catalogPath != "" {
+		loader, err := NewCatalogLoader(catalogPath)
+		if err == nil {
+			return loader, nil
+		}
+		logrus.WithError(err).WithField("path", catalogPath).Warn("Price catalog override not loaded, using embedded catalog")
+	}
+	
+	return NewDefaultCatalogLoader()
+}
+
 func (cl *CatalogLoader) Load() error {
 	cl.mu.Lock()
 	defer cl.mu.Unlock()
 	
-	data, err := os.ReadFile(cl.catalogPath)
-	if err != nil {
-		return fmt.Errorf("failed to read catalog file: %w", err)
+	data := defaultCatalog
+	if cl.catalogPath != "" {
+		var err error
+		data, err = os.ReadFile(cl.catalogPath)
+		if err != nil {
+			return fmt.Errorf("failed to read catalog file: %w", err)
+		}
 	}
 	
 	var catalog PriceCatalog
@@ -65,9 +93,53 @@ func (cl *CatalogLoader) Load() error {
 	}
 	
 	cl.catalog = &catalog
+	cl.checkValidation()
 	return nil
 }
 
+func (cl *CatalogLoader) checkValidation() {
+	fields := logrus.Fields{
+		"path":                cl.catalogPath,
+		"version":             cl.catalog.Version,
+		"next_validation_due": cl.catalog.Validation.NextValidationDue,
+	}
+	if cl.catalogPath == "" {
+		fields["path"] = "embedded"
+	}
+	
+	if _, err := cl.catalog.validationDue(); err != nil {
+		logrus.WithFields(fields).WithError(err).Warn("Price catalog has an invalid next_validation_due date")
+	}
+	
+	stale := cl.catalog.isStale(time.Now())
+	if stale {
+		logrus.WithFields(fields).Warn("Price catalog is past its validation due date, cost estimates may use outdated prices")
+	}
+	monitoring.SetCatalogStale(stale)
+}
+
+func (c *PriceCatalog) validationDue() (time.Time, error) {
+	if c.Validation.NextValidationDue == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(validationDateLayout, c.Validation.NextValidationDue)
+}
+
+func (c *PriceCatalog) isStale(now time.Time) bool {
+	due, err := c.validationDue()
+	if err != nil || due.IsZero() {
+		return false
+	}
+	return !now.Before(due.AddDate(0, 0, 1))
+}
+
+func (cl *CatalogLoader) IsStale() bool {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	
+	return cl.catalog != nil && cl.catalog.isStale(time.Now())
+}
+
 func (cl *CatalogLoader) Reload() error {
 	return cl.Load()
 }
@@ -0,0 +1,121 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewDefaultCatalogLoader(t *testing.T) {
+	loader, err := NewDefaultCatalogLoader()
+	if err != nil {
+		t.Fatalf("Expected embedded catalog to load, got %v", err)
+	}
+	
+	if _, err := loader.GetPricing("openai", "gpt-4o"); err != nil {
+		t.Errorf("Expected gpt-4o pricing in embedded catalog, got %v", err)
+	}
+	
+	if err := loader.Reload(); err != nil {
+		t.Errorf("Expected embedded catalog to reload, got %v", err)
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	
+	overridePath := filepath.Join(dir, "catalog.json")
+	override := `{"version":"test","providers":{"openai":{"custom-model":{"input_per_1k_tokens":1,"output_per_1k_tokens":2}}}}`
+	if err := os.WriteFile(overridePath, []byte(override), 0644); err != nil {
+		t.Fatalf("Error writing catalog: %v", err)
+	}
+	
+	invalidPath := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalidPath, []byte("{"), 0644); err != nil {
+		t.Fatalf("Error writing catalog: %v", err)
+	}
+	
+	embedded, err := NewDefaultCatalogLoader()
+	if err != nil {
+		t.Fatalf("Error loading embedded catalog: %v", err)
+	}
+	
+	testCases := []struct {
+		name            string
+		path            string
+		expectedVersion string
+	}{
+		{"No override", "", embedded.GetVersion()},
+		{"Override", overridePath, "test"},
+		{"Missing override", filepath.Join(dir, "missing.json"), embedded.GetVersion()},
+		{"Invalid override", invalidPath, embedded.GetVersion()},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			loader, err := LoadCatalog(tc.path)
+			if err != nil {
+				t.Fatalf("Expected catalog to load, got %v", err)
+			}
+			
+			if version := loader.GetVersion(); version != tc.expectedVersion {
+				t.Errorf("Expected version %q, got %q", tc.expectedVersion, version)
+			}
+		})
+	}
+}
+
+func TestPriceCatalogIsStale(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	
+	testCases := []struct {
+		name     string
+		due      string
+		expected bool
+	}{
+		{"Past due", "2026-09-30", true},
+		{"Due today", "2026-10-15", false},
+		{"Due yesterday", "2026-10-14", true},
+		{"Not yet due", "2026-11-30", false},
+		{"No due date", "", false},
+		{"Invalid due date", "next month", false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var catalog PriceCatalog
+			catalog.Validation.NextValidationDue = tc.due
+			
+			if stale := catalog.isStale(now); stale != tc.expected {
+				t.Errorf("Expected stale %v for due date %q, got %v", tc.expected, tc.due, stale)
+			}
+		})
+	}
+}
+
+func TestCatalogLoaderIsStale(t *testing.T) {
+	dir := t.TempDir()
+	
+	for _, tc := range []struct {
+		due      string
+		expected bool
+	}{
+		{"2000-01-01", true},
+		{"2999-01-01", false},
+	} {
+		path := filepath.Join(dir, tc.due+".json")
+		catalog := `{"version":"test","providers":{},"validation":{"next_validation_due":"` + tc.due + `"}}`
+		if err := os.WriteFile(path, []byte(catalog), 0644); err != nil {
+			t.Fatalf("Error writing catalog: %v", err)
+		}
+		
+		loader, err := NewCatalogLoader(path)
+		if err != nil {
+			t.Fatalf("Error loading catalog: %v", err)
+		}
+		if stale := loader.IsStale(); stale != tc.expected {
+			t.Errorf("Expected stale %v for due date %s, got %v", tc.expected, tc.due, stale)
+		}
+	}
+}
@@ -7,24 +7,49 @@ import (
 	"github.com/amorin24/llmproxy/pkg/models"
 )
 
+const DefaultCurrency = "USD"
+
 type CostEstimate struct {
 	Provider              string
 	ModelVersion          string
 	InputTokens           int
 	OutputTokens          int
 	EstimatedCostUSD      float64
+	EstimatedCost         float64 // EstimatedCostUSD converted to Currency
+	Currency              string
 	PricePerInputToken    float64
 	PricePerOutputToken   float64
 }
 
 type CostEstimator struct {
 	catalogLoader *CatalogLoader
+	currency      string
+	fxRate        float64 // Units of currency per US dollar
 }
 
 func NewCostEstimator(catalogLoader *CatalogLoader) *CostEstimator {
 	return &CostEstimator{
 		catalogLoader: catalogLoader,
+		currency:      DefaultCurrency,
+		fxRate:        1,
+	}
+}
+
+func (ce *CostEstimator) SetCurrency(currency string, fxRate float64) error {
+	if currency == "" {
+		return fmt.Errorf("currency is required")
 	}
+	if fxRate <= 0 {
+		return fmt.Errorf("exchange rate for %s must be positive, got %g", currency, fxRate)
+	}
+	
+	ce.currency = currency
+	ce.fxRate = fxRate
+	return nil
+}
+
+func (ce *CostEstimator) Currency() string {
+	return ce.currency
 }
 
 func (ce *CostEstimator) EstimatePreCall(provider string, modelVersion string, inputTokens int, expectedOutputTokens int) (*CostEstimate, error) {
@@ -43,6 +68,8 @@ func (ce *CostEstimator) EstimatePreCall(provider string, modelVersion string, i
 		InputTokens:         inputTokens,
 		OutputTokens:        expectedOutputTokens,
 		EstimatedCostUSD:    totalCost,
+		EstimatedCost:       totalCost * ce.fxRate,
+		Currency:            ce.currency,
 		PricePerInputToken:  pricing.InputPer1kTokens,
 		PricePerOutputToken: pricing.OutputPer1kTokens,
 	}, nil
@@ -64,6 +91,8 @@ func (ce *CostEstimator) EstimatePostCall(provider string, modelVersion string,
 		InputTokens:         inputTokens,
 		OutputTokens:        outputTokens,
 		EstimatedCostUSD:    totalCost,
+		EstimatedCost:       totalCost * ce.fxRate,
+		Currency:            ce.currency,
 		PricePerInputToken:  pricing.InputPer1kTokens,
 		PricePerOutputToken: pricing.OutputPer1kTokens,
 	}, nil
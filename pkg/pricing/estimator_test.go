@@ -0,0 +1,50 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCostEstimatorCurrency(t *testing.T) {
+	loader, err := NewDefaultCatalogLoader()
+	if err != nil {
+		t.Fatalf("Error loading catalog: %v", err)
+	}
+	
+	estimator := NewCostEstimator(loader)
+	
+	usd, err := estimator.EstimatePostCall("openai", "gpt-4o", 1000, 1000)
+	if err != nil {
+		t.Fatalf("Error estimating cost: %v", err)
+	}
+	if usd.Currency != DefaultCurrency || usd.EstimatedCost != usd.EstimatedCostUSD {
+		t.Errorf("Expected USD estimate by default, got %g %s (USD %g)", usd.EstimatedCost, usd.Currency, usd.EstimatedCostUSD)
+	}
+	
+	if err := estimator.SetCurrency("EUR", 0.9); err != nil {
+		t.Fatalf("Error setting currency: %v", err)
+	}
+	
+	eur, err := estimator.EstimatePreCall("openai", "gpt-4o", 1000, 1000)
+	if err != nil {
+		t.Fatalf("Error estimating cost: %v", err)
+	}
+	if eur.Currency != "EUR" {
+		t.Errorf("Expected currency EUR, got %s", eur.Currency)
+	}
+	if eur.EstimatedCostUSD != usd.EstimatedCostUSD {
+		t.Errorf("Expected USD cost %g to be unchanged, got %g", usd.EstimatedCostUSD, eur.EstimatedCostUSD)
+	}
+	if math.Abs(eur.EstimatedCost-usd.EstimatedCostUSD*0.9) > 1e-12 {
+		t.Errorf("Expected converted cost %g, got %g", usd.EstimatedCostUSD*0.9, eur.EstimatedCost)
+	}
+	
+	for _, rate := range []float64{0, -1} {
+		if err := estimator.SetCurrency("GBP", rate); err == nil {
+			t.Errorf("Expected error for exchange rate %g", rate)
+		}
+	}
+	if estimator.Currency() != "EUR" {
+		t.Errorf("Expected invalid rate to keep currency EUR, got %s", estimator.Currency())
+	}
+}
@@ -5,6 +5,7 @@ import (
     "errors"
     "math"
     "math/rand"
+    "sync"
     "time"
 
     myerrors "github.com/amorin24/llmproxy/pkg/errors"
@@ -12,11 +13,12 @@ import (
 )
 
 type Config struct {
-    MaxRetries     int
-    InitialBackoff time.Duration
-    MaxBackoff     time.Duration
-    BackoffFactor  float64
-    Jitter         float64
+    MaxRetries           int
+    InitialBackoff       time.Duration
+    MaxBackoff           time.Duration
+    BackoffFactor        float64
+    Jitter               float64
+    RetryableStatusCodes []int
 }
 
 var DefaultConfig = Config{
@@ -27,19 +29,88 @@ var DefaultConfig = Config{
     Jitter:         0.1,
 }
 
+type Attempt struct {
+    Number   int
+    Duration time.Duration
+    Backoff  time.Duration
+    Err      error
+}
+
+type Recorder struct {
+    mutex    sync.Mutex
+    attempts []Attempt
+}
+
+type recorderKey struct{}
+
+func NewRecorder() *Recorder {
+    return &Recorder{}
+}
+
+func WithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+    return context.WithValue(ctx, recorderKey{}, recorder)
+}
+
+func RecorderFromContext(ctx context.Context) *Recorder {
+    recorder, _ := ctx.Value(recorderKey{}).(*Recorder)
+    return recorder
+}
+
+func (r *Recorder) record(attempt Attempt) int {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    
+    r.attempts = append(r.attempts, attempt)
+    return len(r.attempts) - 1
+}
+
+func (r *Recorder) setBackoff(index int, backoff time.Duration) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    
+    r.attempts[index].Backoff = backoff
+}
+
+func (r *Recorder) Attempts() []Attempt {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    
+    attempts := make([]Attempt, len(r.attempts))
+    copy(attempts, r.attempts)
+    return attempts
+}
+
+func (r *Recorder) Len() int {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    
+    return len(r.attempts)
+}
+
 func Do(ctx context.Context, f func() (interface{}, error), cfg Config) (interface{}, error) {
     var err error
     var result interface{}
     
+    recorder := RecorderFromContext(ctx)
+    
     for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+        attemptStart := time.Now()
         result, err = f()
         
+        recordIndex := -1
+        if recorder != nil {
+            recordIndex = recorder.record(Attempt{
+                Number:   attempt + 1,
+                Duration: time.Since(attemptStart),
+                Err:      err,
+            })
+        }
+        
         if err == nil {
             return result, nil
         }
         
-        var modelErr *myerrors.ModelError
-        if !errors.As(err, &modelErr) || !modelErr.Retryable {
+        if !isRetryable(err, cfg) {
             return nil, err
         }
         
@@ -49,6 +120,10 @@ func Do(ctx context.Context, f func() (interface{}, error), cfg Config) (interfa
         
         backoff := calculateBackoff(attempt, cfg)
         
+        if recordIndex >= 0 {
+            recorder.setBackoff(recordIndex, backoff)
+        }
+        
         logrus.WithFields(logrus.Fields{
             "attempt":      attempt + 1,
             "max_attempts": cfg.MaxRetries + 1,
@@ -69,6 +144,25 @@ func Do(ctx context.Context, f func() (interface{}, error), cfg Config) (interfa
     return nil, err
 }
 
+func isRetryable(err error, cfg Config) bool {
+    var modelErr *myerrors.ModelError
+    if !errors.As(err, &modelErr) {
+        return false
+    }
+    
+    if modelErr.Retryable {
+        return true
+    }
+    
+    for _, code := range cfg.RetryableStatusCodes {
+        if modelErr.Code == code {
+            return true
+        }
+    }
+    
+    return false
+}
+
 func calculateBackoff(attempt int, cfg Config) time.Duration {
     backoff := float64(cfg.InitialBackoff) * math.Pow(cfg.BackoffFactor, float64(attempt))
     
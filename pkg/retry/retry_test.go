@@ -392,6 +392,106 @@ func TestRetryWithCustomConfig(t *testing.T) {
 	}
 }
 
+func TestRetryRecordsAttempts(t *testing.T) {
+	cfg := Config{
+		MaxRetries:     3,
+		InitialBackoff: 2 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		BackoffFactor:  2.0,
+		Jitter:         0.0,
+	}
+	
+	recorder := NewRecorder()
+	ctx := WithRecorder(context.Background(), recorder)
+	
+	calls := 0
+	_, err := Do(ctx, func() (interface{}, error) {
+		calls++
+		if calls < 3 {
+			return nil, myerrors.NewRateLimitError("test")
+		}
+		return "success", nil
+	}, cfg)
+	
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	attempts := recorder.Attempts()
+	if len(attempts) != 3 {
+		t.Fatalf("Expected 3 recorded attempts, got %d", len(attempts))
+	}
+	
+	for i, attempt := range attempts {
+		if attempt.Number != i+1 {
+			t.Errorf("Expected attempt number %d, got %d", i+1, attempt.Number)
+		}
+	}
+	
+	if attempts[0].Err == nil || attempts[1].Err == nil || attempts[2].Err != nil {
+		t.Errorf("Expected the first two attempts to fail and the last to succeed")
+	}
+	
+	if attempts[0].Backoff != 2*time.Millisecond || attempts[1].Backoff != 4*time.Millisecond {
+		t.Errorf("Expected backoffs of 2ms and 4ms, got %v and %v", attempts[0].Backoff, attempts[1].Backoff)
+	}
+	
+	if attempts[2].Backoff != 0 {
+		t.Errorf("Expected no backoff after the final attempt, got %v", attempts[2].Backoff)
+	}
+	
+	if _, err := Do(context.Background(), func() (interface{}, error) { return "ok", nil }, cfg); err != nil {
+		t.Errorf("Expected no error without a recorder, got %v", err)
+	}
+}
+
+func TestRetryableStatusCodes(t *testing.T) {
+	cfg := Config{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		BackoffFactor:  2.0,
+	}
+	
+	attempts := 0
+	f := func() (interface{}, error) {
+		attempts++
+		return nil, myerrors.NewModelError("test", 409, errors.New("conflict"), false)
+	}
+	
+	if _, err := Do(context.Background(), f, cfg); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt without configured status codes, got %d", attempts)
+	}
+	
+	cfg.RetryableStatusCodes = []int{409, 529}
+	attempts = 0
+	
+	_, err := Do(context.Background(), f, cfg)
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts with 409 configured as retryable, got %d", attempts)
+	}
+	
+	var modelErr *myerrors.ModelError
+	if !errors.As(err, &modelErr) || modelErr.Retryable {
+		t.Errorf("Expected returned error to keep the provider's classification")
+	}
+	
+	attempts = 0
+	_, err = Do(context.Background(), func() (interface{}, error) {
+		attempts++
+		return nil, errors.New("plain error")
+	}, cfg)
+	if err == nil || attempts != 1 {
+		t.Errorf("Expected plain errors not to be retried, got %d attempts", attempts)
+	}
+}
+
 func TestConcurrentRetries(t *testing.T) {
 	numGoroutines := 10
 	var wg sync.WaitGroup
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"time"
+
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/logging"
+	"github.com/amorin24/llmproxy/pkg/models"
+	"github.com/amorin24/llmproxy/pkg/monitoring"
+	"github.com/sirupsen/logrus"
+)
+
+type downgradeState struct {
+	timeouts []time.Time // Recent timeouts inside the policy window
+	until    time.Time   // End of the current downgrade, zero when not downgraded
+}
+
+func (r *Router) RecordTimeout(model models.ModelType) {
+	policy, ok := config.GetConfig().ModelDowngrades[model]
+	if !ok {
+		return
+	}
+	
+	r.downgradeMutex.Lock()
+	defer r.downgradeMutex.Unlock()
+	
+	state := r.downgrades[model]
+	if state == nil {
+		state = &downgradeState{}
+		r.downgrades[model] = state
+	}
+	
+	now := r.now()
+	if now.Before(state.until) {
+		return
+	}
+	
+	windowStart := now.Add(-time.Duration(policy.WindowSeconds) * time.Second)
+	recent := state.timeouts[:0]
+	for _, timeout := range state.timeouts {
+		if timeout.After(windowStart) {
+			recent = append(recent, timeout)
+		}
+	}
+	state.timeouts = append(recent, now)
+	
+	if len(state.timeouts) < policy.Timeouts {
+		return
+	}
+	
+	state.timeouts = nil
+	state.until = now.Add(time.Duration(policy.CooldownSeconds) * time.Second)
+	
+	logrus.WithFields(logrus.Fields{
+		"model":            string(model),
+		"target":           string(policy.Target),
+		"timeouts":         policy.Timeouts,
+		"window_seconds":   policy.WindowSeconds,
+		"cooldown_seconds": policy.CooldownSeconds,
+	}).Warn("Model timing out repeatedly, downgrading its traffic")
+	monitoring.RecordModelDowngrade(string(model), string(policy.Target))
+}
+
+func (r *Router) downgradeTarget(model models.ModelType) (models.ModelType, bool) {
+	policy, ok := config.GetConfig().ModelDowngrades[model]
+	if !ok {
+		return "", false
+	}
+	
+	r.downgradeMutex.Lock()
+	defer r.downgradeMutex.Unlock()
+	
+	state := r.downgrades[model]
+	if state == nil || !r.now().Before(state.until) {
+		return "", false
+	}
+	return policy.Target, true
+}
+
+func (r *Router) applyDowngrade(model models.ModelType, req models.QueryRequest) models.ModelType {
+	target, ok := r.downgradeTarget(model)
+	if !ok {
+		return model
+	}
+	
+	if !config.GetConfig().IsModelAllowed(req.Tenant, target) || !r.isModelAvailable(target) || !supportsRequest(target, req) {
+		logrus.WithFields(logrus.Fields{
+			"model":  string(model),
+			"target": string(target),
+		}).Debug("Downgrade target not usable, keeping model")
+		return model
+	}
+	
+	logging.LogRouterActivity(string(model), string(target), string(req.TaskType), "timeout_downgrade")
+	monitoring.RecordDowngradedRequest(string(model), string(target))
+	return target
+}
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"github.com/abadojack/whatlanggo"
+	"github.com/amorin24/llmproxy/pkg/config"
+	"github.com/amorin24/llmproxy/pkg/models"
+)
+
+const languageSampleRunes = 1000 // Detection gains little from more text, and long queries would cost more
+
+func DetectLanguage(query string) string {
+	sample := []rune(query)
+	if len(sample) > languageSampleRunes {
+		sample = sample[:languageSampleRunes]
+	}
+	
+	info := whatlanggo.Detect(string(sample))
+	if info.Confidence < config.GetConfig().LanguageMinConfidence {
+		return ""
+	}
+	
+	if code := info.Lang.Iso6391(); code != "" {
+		return code
+	}
+	return info.Lang.Iso6393()
+}
+
+func (r *Router) routeByLanguageFrom(language string, modelTypes []models.ModelType) (models.ModelType, bool) {
+	model, ok := config.GetConfig().LanguageRouting[language]
+	if !ok || !containsModel(modelTypes, model) || !r.isModelAvailable(model) {
+		return "", false
+	}
+	return model, true
+}
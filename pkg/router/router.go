@@ -3,12 +3,15 @@ package router
 import (
 	"context"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"os"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	myerrors "github.com/amorin24/llmproxy/pkg/errors"
 	"github.com/amorin24/llmproxy/pkg/llm"
 	"github.com/amorin24/llmproxy/pkg/logging"
@@ -18,6 +21,8 @@ import (
 
 const defaultAvailabilityTTL = 300 // 5 minutes
 
+var allModelTypes = []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}
+
 type Router struct {
 	availableModels     map[models.ModelType]bool
 	testMode            bool // Flag to indicate if we're in test mode
@@ -26,6 +31,11 @@ type Router struct {
 	availabilityMutex   sync.RWMutex
 	randomSource        *rand.Rand
 	randomSourceMutex   sync.Mutex
+	taskRouting         map[models.TaskType]models.ModelType
+	taskRoutingMutex    sync.RWMutex
+	downgrades          map[models.ModelType]*downgradeState
+	downgradeMutex      sync.Mutex
+	now                 func() time.Time
 }
 
 func NewRouter() *Router {
@@ -38,16 +48,47 @@ func NewRouter() *Router {
 		}
 	}
 	
-	source := rand.NewSource(time.Now().UnixNano())
+	seed := time.Now().UnixNano()
+	if seedStr := os.Getenv("ROUTER_SEED"); seedStr != "" {
+		if parsedSeed, err := strconv.ParseInt(seedStr, 10, 64); err == nil {
+			seed = parsedSeed
+		} else {
+			logrus.WithField("value", seedStr).Warn("Invalid ROUTER_SEED, using a random seed")
+		}
+	}
 	
-	return &Router{
+	source := rand.NewSource(seed)
+	
+	r := &Router{
 		availableModels:   make(map[models.ModelType]bool),
 		testMode:          false,
 		availabilityTTL:   time.Duration(ttl) * time.Second,
 		randomSource:      rand.New(source),
+		downgrades:        make(map[models.ModelType]*downgradeState),
+		now:               time.Now,
+	}
+	r.SetTaskRouting(config.GetConfig().TaskRouting)
+	
+	return r
+}
+
+func (r *Router) SetTaskRouting(routing map[models.TaskType]models.ModelType) {
+	r.taskRoutingMutex.Lock()
+	defer r.taskRoutingMutex.Unlock()
+	
+	r.taskRouting = make(map[models.TaskType]models.ModelType, len(routing))
+	for taskType, model := range routing {
+		r.taskRouting[taskType] = model
 	}
 }
 
+func (r *Router) SetRandomSeed(seed int64) {
+	r.randomSourceMutex.Lock()
+	defer r.randomSourceMutex.Unlock()
+	
+	r.randomSource = rand.New(rand.NewSource(seed))
+}
+
 func (r *Router) SetTestMode(enabled bool) {
 	r.testMode = enabled
 }
@@ -106,25 +147,73 @@ func (r *Router) ensureAvailabilityUpdated() {
 	}
 }
 
+func (r *Router) RefreshAvailability() models.ModelAvailability {
+	r.availabilityMutex.Lock()
+	r.lastUpdated = time.Time{}
+	r.availabilityMutex.Unlock()
+	
+	llm.ClearAvailabilityCache()
+	r.UpdateAvailability()
+	
+	return r.GetModelAvailability()
+}
+
+// Deprecated: use GetModelAvailability, which includes every provider.
 func (r *Router) GetAvailability() models.StatusResponse {
+	return models.NewStatusResponse(r.GetModelAvailability())
+}
+
+func (r *Router) GetModelAvailability() models.ModelAvailability {
 	r.ensureAvailabilityUpdated()
 	
 	r.availabilityMutex.RLock()
 	defer r.availabilityMutex.RUnlock()
 	
-	return models.StatusResponse{
-		OpenAI:  r.availableModels[models.OpenAI],
-		Gemini:  r.availableModels[models.Gemini],
-		Mistral: r.availableModels[models.Mistral],
-		Claude:  r.availableModels[models.Claude],
+	availability := make(models.ModelAvailability, len(allModelTypes))
+	for _, modelType := range allModelTypes {
+		availability[string(modelType)] = false
 	}
+	for modelType := range r.availableModels {
+		availability[string(modelType)] = r.available(modelType)
+	}
+	
+	return availability
+}
+
+// RouteRequest also returns the language detected for the query, or "" when
+// ROUTE_BY_LANGUAGE is off or detection was not confident enough.
+func (r *Router) RouteRequest(ctx context.Context, req models.QueryRequest) (models.ModelType, string, error) {
+	var language string
+	if config.GetConfig().RouteByLanguage {
+		language = DetectLanguage(req.Query)
+	}
+	
+	model, err := r.route(ctx, req, language)
+	if err != nil || req.NoFallback {
+		return model, language, err
+	}
+	
+	return r.applyDowngrade(model, req), language, nil
 }
 
-func (r *Router) RouteRequest(ctx context.Context, req models.QueryRequest) (models.ModelType, error) {
+func (r *Router) route(ctx context.Context, req models.QueryRequest, language string) (models.ModelType, error) {
 	if ctx.Err() != nil {
 		return "", ctx.Err()
 	}
 	
+	cfg := config.GetConfig()
+	if req.Model != "" && !cfg.IsModelAllowed(req.Tenant, req.Model) {
+		logrus.WithFields(logrus.Fields{
+			"model":  req.Model,
+			"tenant": req.Tenant,
+		}).Warn("Requested model not allowed for tenant")
+		return "", myerrors.NewModelNotAllowedError(string(req.Model))
+	}
+	allowedModels := capableModels(req, cfg.AllowedModels(req.Tenant))
+	if len(allowedModels) == 0 {
+		return "", unsupportedRequestError(req)
+	}
+	
 	if req.Model != "" {
 		if r.isModelAvailable(req.Model) {
 			logging.LogRouterActivity(string(req.Model), string(req.Model), string(req.TaskType), "user_preference")
@@ -137,8 +226,15 @@ func (r *Router) RouteRequest(ctx context.Context, req models.QueryRequest) (mod
 		return "", ctx.Err()
 	}
 
+	if language != "" {
+		if model, ok := r.routeByLanguageFrom(language, allowedModels); ok {
+			logging.LogRouterActivity("", string(model), string(req.TaskType), "language")
+			return model, nil
+		}
+	}
+
 	if req.TaskType != "" {
-		model, err := r.routeByTaskType(req.TaskType)
+		model, err := r.routeByTaskTypeFrom(req.TaskType, req.Query, allowedModels)
 		if err == nil {
 			logging.LogRouterActivity("", string(model), string(req.TaskType), "task_type")
 			return model, nil
@@ -150,7 +246,7 @@ func (r *Router) RouteRequest(ctx context.Context, req models.QueryRequest) (mod
 		return "", ctx.Err()
 	}
 
-	model, err := r.getRandomAvailableModel()
+	model, err := r.pickModelFrom(req.Query, allowedModels)
 	if err != nil {
 		return "", myerrors.NewUnavailableError("all")
 	}
@@ -159,7 +255,7 @@ func (r *Router) RouteRequest(ctx context.Context, req models.QueryRequest) (mod
 	return model, nil
 }
 
-func (r *Router) FallbackOnError(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error) (models.ModelType, error) {
+func (r *Router) FallbackOnError(ctx context.Context, originalModel models.ModelType, req models.QueryRequest, err error, exclude ...models.ModelType) (models.ModelType, error) {
 	if ctx.Err() != nil {
 		return "", ctx.Err()
 	}
@@ -168,8 +264,17 @@ func (r *Router) FallbackOnError(ctx context.Context, originalModel models.Model
 	if !errors.As(err, &modelErr) || !modelErr.Retryable {
 		return "", err
 	}
+	
+	// The proxy's own per-model quota says nothing about the request, so it always falls back.
+	if category := myerrors.FallbackCategory(err); !errors.Is(err, myerrors.ErrQuotaExceeded) && !config.GetConfig().ShouldFallback(category) {
+		logrus.WithFields(logrus.Fields{
+			"model":    originalModel,
+			"category": category,
+		}).Debug("Fallback disabled for error category")
+		return "", err
+	}
 
-	availableModels := r.getAvailableModelsExcept(originalModel)
+	availableModels := r.getAvailableModelsFrom(capableModels(req, config.GetConfig().AllowedModels(req.Tenant)), append([]models.ModelType{originalModel}, exclude...)...)
 	if len(availableModels) == 0 {
 		return "", myerrors.NewUnavailableError("all")
 	}
@@ -204,43 +309,69 @@ func (r *Router) isModelAvailable(model models.ModelType) bool {
 	r.availabilityMutex.RLock()
 	defer r.availabilityMutex.RUnlock()
 	
-	return r.availableModels[model]
+	return r.available(model)
+}
+
+func (r *Router) available(model models.ModelType) bool {
+	return r.availableModels[model] && !config.GetConfig().IsModelDisabled(model)
 }
 
 func (r *Router) routeByTaskType(taskType models.TaskType) (models.ModelType, error) {
-	switch taskType {
-	case models.TextGeneration:
-		if r.isModelAvailable(models.OpenAI) {
-			return models.OpenAI, nil
-		}
-	case models.Summarization:
-		if r.isModelAvailable(models.Claude) {
-			return models.Claude, nil
-		}
-	case models.SentimentAnalysis:
-		if r.isModelAvailable(models.Gemini) {
-			return models.Gemini, nil
-		}
-	case models.QuestionAnswering:
-		if r.isModelAvailable(models.Mistral) {
-			return models.Mistral, nil
+	return r.routeByTaskTypeFrom(taskType, "", allModelTypes)
+}
+
+func (r *Router) routeByTaskTypeFrom(taskType models.TaskType, query string, modelTypes []models.ModelType) (models.ModelType, error) {
+	r.taskRoutingMutex.RLock()
+	model, ok := r.taskRouting[taskType]
+	r.taskRoutingMutex.RUnlock()
+	
+	if ok && containsModel(modelTypes, model) && r.isModelAvailable(model) {
+		return model, nil
+	}
+
+	return r.pickModelFrom(query, modelTypes)
+}
+
+func (r *Router) pickModelFrom(query string, modelTypes []models.ModelType) (models.ModelType, error) {
+	if config.GetConfig().RoutingStrategy == config.RoutingSticky && query != "" {
+		if model := stickyModel(query, modelTypes); r.isModelAvailable(model) {
+			return model, nil
 		}
 	}
+	
+	return r.getRandomModelFrom(modelTypes)
+}
 
-	return r.getRandomAvailableModel()
+// Rendezvous hashing over all candidates, so a query only moves when its own model is removed
+func stickyModel(query string, modelTypes []models.ModelType) models.ModelType {
+	var best models.ModelType
+	var bestScore uint64
+	for _, model := range modelTypes {
+		hash := fnv.New64a()
+		hash.Write([]byte(model))
+		hash.Write([]byte{0})
+		hash.Write([]byte(query))
+		if score := hash.Sum64(); best == "" || score > bestScore {
+			best, bestScore = model, score
+		}
+	}
+	return best
 }
 
 func (r *Router) getRandomAvailableModel() (models.ModelType, error) {
+	return r.getRandomModelFrom(allModelTypes)
+}
+
+func (r *Router) getRandomModelFrom(modelTypes []models.ModelType) (models.ModelType, error) {
 	r.ensureAvailabilityUpdated()
 	
 	r.availabilityMutex.RLock()
 	defer r.availabilityMutex.RUnlock()
 	
 	var availableModelTypes []models.ModelType
-	modelTypes := []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}
 
 	for _, modelType := range modelTypes {
-		if r.availableModels[modelType] {
+		if r.available(modelType) {
 			availableModelTypes = append(availableModelTypes, modelType)
 		}
 	}
@@ -257,19 +388,59 @@ func (r *Router) getRandomAvailableModel() (models.ModelType, error) {
 }
 
 func (r *Router) getAvailableModelsExcept(excludeModel models.ModelType) []models.ModelType {
+	return r.getAvailableModelsFrom(allModelTypes, excludeModel)
+}
+
+func (r *Router) getAvailableModelsFrom(modelTypes []models.ModelType, excludeModels ...models.ModelType) []models.ModelType {
 	r.ensureAvailabilityUpdated()
 	
 	r.availabilityMutex.RLock()
 	defer r.availabilityMutex.RUnlock()
 	
 	var availableModelTypes []models.ModelType
-	modelTypes := []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}
 
 	for _, modelType := range modelTypes {
-		if modelType != excludeModel && r.availableModels[modelType] {
+		if !containsModel(excludeModels, modelType) && r.available(modelType) {
 			availableModelTypes = append(availableModelTypes, modelType)
 		}
 	}
 
 	return availableModelTypes
 }
+
+// supportsRequest checks the capability matrix for the request's tools and images, so
+// routing and fallback never pick a model that would reject them.
+func supportsRequest(model models.ModelType, req models.QueryRequest) bool {
+	if len(req.Tools) == 0 && len(req.Images) == 0 {
+		return true
+	}
+	
+	capabilities := llm.ModelCapabilities(model, req.ModelVersion)
+	return (len(req.Tools) == 0 || capabilities.SupportsTools) && (len(req.Images) == 0 || capabilities.SupportsVision)
+}
+
+func capableModels(req models.QueryRequest, modelTypes []models.ModelType) []models.ModelType {
+	var capable []models.ModelType
+	for _, model := range modelTypes {
+		if supportsRequest(model, req) {
+			capable = append(capable, model)
+		}
+	}
+	return capable
+}
+
+func unsupportedRequestError(req models.QueryRequest) error {
+	if len(req.Tools) > 0 {
+		return myerrors.NewModelError("all", 400, fmt.Errorf("%w: no allowed model supports tools", myerrors.ErrToolsUnsupported), false)
+	}
+	return myerrors.NewModelError("all", 400, fmt.Errorf("%w: no allowed model supports images", myerrors.ErrImagesUnsupported), false)
+}
+
+func containsModel(modelTypes []models.ModelType, model models.ModelType) bool {
+	for _, modelType := range modelTypes {
+		if modelType == model {
+			return true
+		}
+	}
+	return false
+}
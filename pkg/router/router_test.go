@@ -3,10 +3,12 @@ package router
 import (
 	"context"
 	"errors"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/amorin24/llmproxy/pkg/config"
 	myerrors "github.com/amorin24/llmproxy/pkg/errors"
 	"github.com/amorin24/llmproxy/pkg/models"
 )
@@ -157,7 +159,7 @@ func TestRouteRequest(t *testing.T) {
 				ctx = context.Background()
 			}
 
-			model, err := r.RouteRequest(ctx, tc.request)
+			model, _, err := r.RouteRequest(ctx, tc.request)
 
 			if tc.expectError {
 				if err == nil {
@@ -396,6 +398,32 @@ func TestGetAvailability(t *testing.T) {
 	}
 }
 
+func TestGetModelAvailability(t *testing.T) {
+	r := NewRouter()
+	
+	r.SetTestMode(true)
+	
+	r.SetModelAvailability(models.OpenAI, true)
+	r.SetModelAvailability(models.ModelType("bedrock"), true)
+	
+	availability := r.GetModelAvailability()
+	
+	expected := models.ModelAvailability{
+		"openai":  true,
+		"gemini":  false,
+		"mistral": false,
+		"claude":  false,
+		"bedrock": true,
+	}
+	if !reflect.DeepEqual(availability, expected) {
+		t.Errorf("Expected availability %v, got %v", expected, availability)
+	}
+	
+	if status := r.GetAvailability(); status != models.NewStatusResponse(availability) {
+		t.Errorf("Expected deprecated status to match the availability map, got %+v", status)
+	}
+}
+
 func TestGetRandomAvailableModel(t *testing.T) {
 	r := NewRouter()
 	
@@ -564,6 +592,36 @@ func TestRouteByTaskType(t *testing.T) {
 	}
 }
 
+func TestRouteByTaskTypeCustomRouting(t *testing.T) {
+	r := NewRouter()
+	r.SetTestMode(true)
+	
+	r.SetTaskRouting(map[models.TaskType]models.ModelType{
+		models.Summarization: models.Mistral,
+		"translation":        models.Gemini,
+	})
+	
+	r.SetModelAvailability(models.Claude, true)
+	r.SetModelAvailability(models.Mistral, true)
+	r.SetModelAvailability(models.Gemini, true)
+	
+	model, err := r.routeByTaskType(models.Summarization)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if model != models.Mistral {
+		t.Errorf("Expected model %s, got %s", models.Mistral, model)
+	}
+	
+	model, err = r.routeByTaskType("translation")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if model != models.Gemini {
+		t.Errorf("Expected model %s, got %s", models.Gemini, model)
+	}
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	r := NewRouter()
 	r.SetTestMode(true)
@@ -656,3 +714,464 @@ func TestEnsureAvailabilityUpdated(t *testing.T) {
 		t.Errorf("Expected lastUpdated to change after TTL expired")
 	}
 }
+
+func TestRouteRequestTenantAllowList(t *testing.T) {
+	cfg := config.GetConfig()
+	originalTenantModels := cfg.TenantModels
+	defer func() { cfg.TenantModels = originalTenantModels }()
+	cfg.TenantModels = map[string][]models.ModelType{"free": {models.Mistral}}
+	
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	
+	t.Run("Disallowed model rejected", func(t *testing.T) {
+		_, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: "test", Model: models.OpenAI, Tenant: "free"})
+		
+		var modelErr *myerrors.ModelError
+		if !errors.As(err, &modelErr) || modelErr.Code != 403 || !errors.Is(err, myerrors.ErrModelNotAllowed) {
+			t.Fatalf("Expected model not allowed error with code 403, got %v", err)
+		}
+	})
+	
+	t.Run("Task type and random selection limited to allowed models", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			model, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: "test", TaskType: models.Summarization, Tenant: "free"})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if model != models.Mistral {
+				t.Fatalf("Expected %s, got %s", models.Mistral, model)
+			}
+		}
+	})
+	
+	t.Run("Fallback limited to allowed models", func(t *testing.T) {
+		_, err := r.FallbackOnError(context.Background(), models.Mistral, models.QueryRequest{Query: "test", Tenant: "free"}, myerrors.NewRateLimitError(string(models.Mistral)))
+		if err == nil {
+			t.Fatal("Expected error when no other allowed model exists, got nil")
+		}
+	})
+	
+	t.Run("Unknown tenant uses default allow-list", func(t *testing.T) {
+		model, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: "test", Model: models.OpenAI, Tenant: "other"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if model != models.OpenAI {
+			t.Errorf("Expected %s, got %s", models.OpenAI, model)
+		}
+	})
+}
+
+func TestFallbackOnErrorCategories(t *testing.T) {
+	cfg := config.GetConfig()
+	originalFallbackOn := cfg.FallbackOn
+	defer func() { cfg.FallbackOn = originalFallbackOn }()
+	
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	
+	testCases := []struct {
+		name           string
+		fallbackOn     []string
+		err            error
+		expectFallback bool
+	}{
+		{"Rate limit with default", nil, myerrors.NewRateLimitError("openai"), true},
+		{"Timeout with default", nil, myerrors.NewTimeoutError("openai"), true},
+		{"Rate limit excluded", []string{"unavailable", "timeout"}, myerrors.NewRateLimitError("openai"), false},
+		{"Timeout included", []string{"unavailable", "timeout"}, myerrors.NewTimeoutError("openai"), true},
+		{"Unavailable included", []string{"unavailable", "timeout"}, myerrors.NewUnavailableError("openai"), true},
+		{"Provider 5xx included", []string{"unavailable", "timeout"}, myerrors.NewModelError("openai", 502, errors.New("bad gateway"), true), true},
+		{"Budget exceeded excluded", []string{"unavailable", "timeout"}, myerrors.NewBudgetExceededError("openai"), false},
+		{"Budget exceeded included", []string{"budget_exceeded"}, myerrors.NewBudgetExceededError("openai"), true},
+		{"Timeout excluded", []string{"rate_limit"}, myerrors.NewTimeoutError("openai"), false},
+		{"Quota exceeded always falls back", []string{"timeout"}, myerrors.NewQuotaExceededError("openai"), true},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.FallbackOn = tc.fallbackOn
+			
+			model, err := r.FallbackOnError(context.Background(), models.OpenAI, models.QueryRequest{Query: "test"}, tc.err)
+			if tc.expectFallback {
+				if err != nil {
+					t.Fatalf("Expected fallback, got error %v", err)
+				}
+				if model == models.OpenAI {
+					t.Errorf("Expected a model other than %s", models.OpenAI)
+				}
+				return
+			}
+			
+			if err != tc.err {
+				t.Errorf("Expected the original error without fallback, got model %q and error %v", model, err)
+			}
+		})
+	}
+}
+
+func TestFallbackOnErrorExcludesTriedModels(t *testing.T) {
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	
+	tried := []models.ModelType{models.OpenAI, models.Gemini, models.Mistral}
+	for i := 0; i < 10; i++ {
+		model, err := r.FallbackOnError(context.Background(), models.Mistral, models.QueryRequest{Query: "test"}, myerrors.NewRateLimitError("mistral"), tried...)
+		if err != nil {
+			t.Fatalf("Expected fallback, got error %v", err)
+		}
+		if model != models.Claude {
+			t.Fatalf("Expected the only untried model %s, got %s", models.Claude, model)
+		}
+	}
+	
+	_, err := r.FallbackOnError(context.Background(), models.Claude, models.QueryRequest{Query: "test"}, myerrors.NewRateLimitError("claude"), append(tried, models.Claude)...)
+	if !errors.Is(err, myerrors.ErrUnavailable) {
+		t.Errorf("Expected unavailable once every model was tried, got %v", err)
+	}
+}
+
+func TestRouteRequestCapabilities(t *testing.T) {
+	cfg := config.GetConfig()
+	originalTenantModels := cfg.TenantModels
+	defer func() { cfg.TenantModels = originalTenantModels }()
+	cfg.TenantModels = map[string][]models.ModelType{"free": {models.Mistral}}
+	
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	tools := []models.ToolDefinition{{Name: "lookup"}}
+	
+	t.Run("Routing skips models without tool support", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			model, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: "test", Tools: tools})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if model == models.Mistral {
+				t.Fatalf("Expected a model that supports tools, got %s", model)
+			}
+		}
+	})
+	
+	t.Run("No capable model allowed", func(t *testing.T) {
+		_, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: "test", Tools: tools, Tenant: "free"})
+		if !errors.Is(err, myerrors.ErrToolsUnsupported) {
+			t.Errorf("Expected tools unsupported, got %v", err)
+		}
+	})
+	
+	t.Run("Fallback skips models without vision", func(t *testing.T) {
+		req := models.QueryRequest{Query: "test", Images: []string{"data:image/png;base64,AAAA"}}
+		_, err := r.FallbackOnError(context.Background(), models.OpenAI, req, myerrors.NewRateLimitError("openai"), models.Gemini, models.Claude)
+		if !errors.Is(err, myerrors.ErrUnavailable) {
+			t.Errorf("Expected no fallback to a text-only model, got %v", err)
+		}
+	})
+}
+
+func TestStickyRouting(t *testing.T) {
+	cfg := config.GetConfig()
+	originalStrategy := cfg.RoutingStrategy
+	defer func() { cfg.RoutingStrategy = originalStrategy }()
+	cfg.RoutingStrategy = config.RoutingSticky
+	
+	allModels := []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude}
+	newRouter := func(seed int64) *Router {
+		r := NewRouter()
+		r.SetTestMode(true)
+		r.SetRandomSeed(seed)
+		for _, model := range allModels {
+			r.SetModelAvailability(model, true)
+		}
+		return r
+	}
+	
+	queries := []string{"first query", "second query", "third query", "fourth query", "fifth query", "sixth query"}
+	replicaA, replicaB := newRouter(1), newRouter(2)
+	picked := make(map[models.ModelType]bool)
+	
+	for _, query := range queries {
+		req := models.QueryRequest{Query: query}
+		model, _, err := replicaA.RouteRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		picked[model] = true
+		
+		for i := 0; i < 5; i++ {
+			if again, _, _ := replicaA.RouteRequest(context.Background(), req); again != model {
+				t.Errorf("Expected %q to keep routing to %s, got %s", query, model, again)
+			}
+		}
+		if other, _, _ := replicaB.RouteRequest(context.Background(), req); other != model {
+			t.Errorf("Expected replicas to agree on %q: %s vs %s", query, model, other)
+		}
+		if model != stickyModel(query, allModels) {
+			t.Errorf("Expected %q to route to its hashed model", query)
+		}
+	}
+	
+	if len(picked) < 2 {
+		t.Errorf("Expected queries to spread over several models, got %v", picked)
+	}
+	
+	t.Run("Hashed model unavailable", func(t *testing.T) {
+		query := queries[0]
+		hashed := stickyModel(query, allModels)
+		
+		r := newRouter(3)
+		r.SetModelAvailability(hashed, false)
+		
+		for i := 0; i < 10; i++ {
+			model, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: query})
+			if err != nil {
+				t.Fatalf("Expected a random fallback, got error %v", err)
+			}
+			if model == hashed {
+				t.Fatalf("Expected a model other than the unavailable %s", hashed)
+			}
+		}
+	})
+}
+
+func TestDisabledModels(t *testing.T) {
+	cfg := config.GetConfig()
+	originalDisabled := cfg.DisabledModels
+	defer func() { cfg.DisabledModels = originalDisabled }()
+	cfg.DisabledModels = []models.ModelType{models.Gemini}
+	
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	
+	if r.GetModelAvailability()[string(models.Gemini)] {
+		t.Error("Expected disabled model to report unavailable")
+	}
+	if r.GetAvailability().Gemini {
+		t.Error("Expected disabled model to report unavailable in the legacy status")
+	}
+	
+	for i := 0; i < 50; i++ {
+		requests := []models.QueryRequest{
+			{Query: "test", Model: models.Gemini},
+			{Query: "test", TaskType: models.SentimentAnalysis},
+			{Query: "test"},
+		}
+		for _, req := range requests {
+			model, _, err := r.RouteRequest(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if model == models.Gemini {
+				t.Fatalf("Disabled model selected for request %+v", req)
+			}
+		}
+		
+		model, err := r.FallbackOnError(context.Background(), models.OpenAI, models.QueryRequest{Query: "test"}, myerrors.NewUnavailableError("openai"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if model == models.Gemini {
+			t.Fatal("Disabled model selected as fallback")
+		}
+	}
+	
+	cfg.DisabledModels = nil
+	if !r.GetModelAvailability()[string(models.Gemini)] {
+		t.Error("Expected model to be available again once re-enabled")
+	}
+}
+
+func TestSetRandomSeed(t *testing.T) {
+	pick := func(seed int64) []models.ModelType {
+		r := NewRouter()
+		r.SetTestMode(true)
+		for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+			r.SetModelAvailability(model, true)
+		}
+		r.SetRandomSeed(seed)
+		
+		var picks []models.ModelType
+		for i := 0; i < 20; i++ {
+			model, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: "test"})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			picks = append(picks, model)
+		}
+		return picks
+	}
+	
+	first := pick(42)
+	second := pick(42)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected identical routing for the same seed, got %v and %v", first, second)
+		}
+	}
+}
+
+func TestNewRouterSeedFromEnv(t *testing.T) {
+	t.Setenv("ROUTER_SEED", "7")
+	
+	r1 := NewRouter()
+	r2 := NewRouter()
+	for _, r := range []*Router{r1, r2} {
+		r.SetTestMode(true)
+		for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+			r.SetModelAvailability(model, true)
+		}
+	}
+	
+	for i := 0; i < 20; i++ {
+		m1, _ := r1.getRandomAvailableModel()
+		m2, _ := r2.getRandomAvailableModel()
+		if m1 != m2 {
+			t.Fatalf("Expected routers with the same ROUTER_SEED to pick the same models, got %s and %s", m1, m2)
+		}
+	}
+}
+
+func TestTimeoutDowngrade(t *testing.T) {
+	cfg := config.GetConfig()
+	originalDowngrades := cfg.ModelDowngrades
+	defer func() { cfg.ModelDowngrades = originalDowngrades }()
+	cfg.ModelDowngrades = map[models.ModelType]config.DowngradePolicy{
+		models.OpenAI: {Target: models.Mistral, Timeouts: 2, WindowSeconds: 60, CooldownSeconds: 300},
+	}
+	
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	
+	route := func(req models.QueryRequest) models.ModelType {
+		t.Helper()
+		model, _, err := r.RouteRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return model
+	}
+	openAIRequest := models.QueryRequest{Query: "test", Model: models.OpenAI}
+	
+	r.RecordTimeout(models.OpenAI)
+	now = now.Add(61 * time.Second)
+	r.RecordTimeout(models.OpenAI)
+	if model := route(openAIRequest); model != models.OpenAI {
+		t.Fatalf("Expected timeouts outside the window not to downgrade, got %s", model)
+	}
+	
+	r.RecordTimeout(models.OpenAI)
+	if model := route(openAIRequest); model != models.Mistral {
+		t.Fatalf("Expected downgrade to mistral after repeated timeouts, got %s", model)
+	}
+	
+	if model := route(models.QueryRequest{Query: "test", Model: models.OpenAI, NoFallback: true}); model != models.OpenAI {
+		t.Errorf("Expected no_fallback to keep the requested model, got %s", model)
+	}
+	
+	r.SetModelAvailability(models.Mistral, false)
+	if model := route(openAIRequest); model != models.OpenAI {
+		t.Errorf("Expected an unavailable target to keep the model, got %s", model)
+	}
+	r.SetModelAvailability(models.Mistral, true)
+	
+	r.RecordTimeout(models.Claude)
+	r.RecordTimeout(models.Claude)
+	if model := route(models.QueryRequest{Query: "test", Model: models.Claude}); model != models.Claude {
+		t.Errorf("Expected models without a policy never to downgrade, got %s", model)
+	}
+	
+	now = now.Add(301 * time.Second)
+	if model := route(openAIRequest); model != models.OpenAI {
+		t.Errorf("Expected traffic back on openai after the cooldown, got %s", model)
+	}
+}
+
+func TestRouteByLanguage(t *testing.T) {
+	cfg := config.GetConfig()
+	originalEnabled, originalRouting, originalConfidence := cfg.RouteByLanguage, cfg.LanguageRouting, cfg.LanguageMinConfidence
+	defer func() {
+		cfg.RouteByLanguage, cfg.LanguageRouting, cfg.LanguageMinConfidence = originalEnabled, originalRouting, originalConfidence
+	}()
+	cfg.RouteByLanguage = true
+	cfg.LanguageRouting = map[string]models.ModelType{"es": models.Mistral, "de": models.Claude}
+	cfg.LanguageMinConfidence = 0.5
+	
+	r := NewRouter()
+	r.SetTestMode(true)
+	for _, model := range []models.ModelType{models.OpenAI, models.Gemini, models.Mistral, models.Claude} {
+		r.SetModelAvailability(model, true)
+	}
+	
+	spanish := "¿Puedes explicarme cómo funciona la fotosíntesis en las plantas y por qué es tan importante para la vida en la Tierra?"
+	if language := DetectLanguage(spanish); language != "es" {
+		t.Fatalf("Expected es, got %q", language)
+	}
+	
+	t.Run("Mapped language overrides task routing", func(t *testing.T) {
+		model, language, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: spanish, TaskType: models.TextGeneration})
+		if err != nil || model != models.Mistral {
+			t.Errorf("Expected mistral for a Spanish query, got %s, %v", model, err)
+		}
+		if language != "es" {
+			t.Errorf("Expected detected language es, got %q", language)
+		}
+	})
+	
+	t.Run("Unavailable preferred model falls back", func(t *testing.T) {
+		r.SetModelAvailability(models.Mistral, false)
+		defer r.SetModelAvailability(models.Mistral, true)
+		
+		model, _, err := r.RouteRequest(context.Background(), models.QueryRequest{Query: spanish, TaskType: models.TextGeneration})
+		if err != nil || model != models.OpenAI {
+			t.Errorf("Expected task routing to openai, got %s, %v", model, err)
+		}
+	})
+	
+	t.Run("Low confidence falls back", func(t *testing.T) {
+		cfg.LanguageMinConfidence = 1.01
+		defer func() { cfg.LanguageMinConfidence = 0.5 }()
+		
+		if language := DetectLanguage(spanish); language != "" {
+			t.Errorf("Expected no language below the confidence threshold, got %q", language)
+		}
+		model, _, _ := r.RouteRequest(context.Background(), models.QueryRequest{Query: spanish, TaskType: models.TextGeneration})
+		if model != models.OpenAI {
+			t.Errorf("Expected task routing to openai, got %s", model)
+		}
+	})
+	
+	t.Run("Disabled", func(t *testing.T) {
+		cfg.RouteByLanguage = false
+		defer func() { cfg.RouteByLanguage = true }()
+		
+		model, language, _ := r.RouteRequest(context.Background(), models.QueryRequest{Query: spanish, TaskType: models.TextGeneration})
+		if model != models.OpenAI {
+			t.Errorf("Expected task routing to openai, got %s", model)
+		}
+		if language != "" {
+			t.Errorf("Expected no detected language when disabled, got %q", language)
+		}
+	})
+}
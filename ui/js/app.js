@@ -228,7 +228,7 @@ document.addEventListener('DOMContentLoaded', function() {
                     return response.text().then(text => {
                         try {
                             const errorData = JSON.parse(text);
-                            throw new Error(errorData.error || `HTTP error! Status: ${response.status}`);
+                            throw new Error((errorData.error && errorData.error.message) || errorData.error || `HTTP error! Status: ${response.status}`);
                         } catch (e) {
                             throw new Error(text || `HTTP error! Status: ${response.status}`);
                         }